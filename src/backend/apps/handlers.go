@@ -1,115 +1,219 @@
 package apps
 
 import (
+	"errors"
 	"fmt"
 	"github.com/ocelot-cloud/shared/utils"
-	"github.com/ocelot-cloud/shared/validation"
 	"net/http"
 	"ocelot/store/tools"
 	"ocelot/store/users"
+	"ocelot/store/webhooks"
 	"strconv"
 )
 
-func AppCreationHandler(w http.ResponseWriter, r *http.Request) {
+// Handlers serve the app routes using the given repositories. Deleting an app is announced to the webhooks.
+type Handlers struct {
+	Apps     AppRepository
+	Users    users.UserRepository
+	Webhooks *webhooks.Dispatcher
+}
+
+// forRequest returns a copy of the handlers whose repositories log with the logger of the request, so that their lines
+// carry the request ID.
+func (h *Handlers) forRequest(r *http.Request) *Handlers {
+	logger := tools.GetLogger(r)
+	bound := *h
+	bound.Apps = h.Apps.WithLogger(logger)
+	bound.Users = h.Users.WithLogger(logger)
+	return &bound
+}
+
+func (h *Handlers) AppCreationHandler(w http.ResponseWriter, r *http.Request) {
+	h = h.forRequest(r)
 	user := tools.GetUserFromContext(r)
-	appString, err := validation.ReadBody[tools.AppNameString](w, r)
+	appString, err := tools.ReadBody[tools.AppNameString](w, r)
 	if err != nil {
 		return
 	}
 
-	if !users.UserRepo.DoesUserExist(user) {
-		tools.Logger.Info("user '%s' tried to create app '%s' but it does not exist", user, appString)
-		http.Error(w, "user does not exists", http.StatusNotFound)
+	if !h.Users.DoesUserExist(user) {
+		tools.GetLogger(r).Info("user '%s' tried to create app '%s' but it does not exist", user, appString)
+		tools.WriteError(w, r, http.StatusNotFound, tools.CodeUserNotFound, "user does not exist")
 		return
 	}
 
 	if appString.Value == "ocelotcloud" {
-		tools.Logger.Info("user '%s' tried to create app '%s' but it is reserved", user, appString)
-		http.Error(w, "app name is reserved", http.StatusBadRequest)
+		tools.GetLogger(r).Info("user '%s' tried to create app '%s' but it is reserved", user, appString)
+		tools.WriteError(w, r, http.StatusBadRequest, tools.CodeReservedName, "app name is reserved")
 		return
 	}
 
-	_, err = AppRepo.GetAppId(user, appString.Value)
+	_, err = h.Apps.GetAppId(user, appString.Value)
 	if err == nil {
-		tools.Logger.Info("user '%s' tried to create app '%s' but it already exists", user, appString)
-		http.Error(w, "app already exists", http.StatusConflict)
+		tools.GetLogger(r).Info("user '%s' tried to create app '%s' but it already exists", user, appString)
+		tools.WriteError(w, r, http.StatusConflict, tools.CodeAppAlreadyExists, "app already exists")
 		return
 	}
 
-	err = AppRepo.CreateApp(user, appString.Value)
+	err = h.Apps.CreateApp(user, appString.Value)
 	if err != nil {
-		tools.Logger.Error("user '%s' tried to create app '%s' but it failed: %v", user, appString, err)
-		http.Error(w, "app creation failed", http.StatusInternalServerError)
+		tools.GetLogger(r).Error("user '%s' tried to create app '%s' but it failed: %v", user, appString, err)
+		tools.WriteInternalError(w, r, "app creation failed")
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	tools.Logger.Info("user '%s' created app '%s'", user, appString)
+	tools.GetLogger(r).Info("user '%s' created app '%s'", user, appString)
 }
 
-func AppDeleteHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) AppDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	h = h.forRequest(r)
 	user := tools.GetUserFromContext(r)
 	appId, err := ReadBodyAsStringNumber(w, r)
 	if err != nil {
 		return
 	}
 
-	if !AppRepo.IsAppOwner(user, appId) {
-		tools.Logger.Warn("user '%s' tried to delete app with ID '%d' but does not own it", user, appId)
-		http.Error(w, "you do not own this app", http.StatusUnauthorized)
+	if !h.Apps.IsAppOwner(user, appId) {
+		tools.GetLogger(r).Warn("user '%s' tried to delete app with ID '%d' but does not own it", user, appId)
+		tools.WriteError(w, r, http.StatusUnauthorized, tools.CodeNotOwner, "you do not own this app")
+		return
+	}
+
+	appName, err := h.Apps.GetAppName(appId)
+	if err != nil {
+		tools.GetLogger(r).Error("getting app name failed: %v", err)
+		tools.WriteInternalError(w, r, "app deletion failed")
+		return
+	}
+
+	err = h.Apps.DeleteApp(appId)
+	if err != nil {
+		tools.GetLogger(r).Error("user '%s' tried to delete app with ID '%d' but it failed", user, appId)
+		tools.WriteInternalError(w, r, "app deletion failed")
 		return
 	}
 
-	err = AppRepo.DeleteApp(appId)
+	tools.GetLogger(r).Info("user '%s' deleted app with ID '%d'", user, appId)
+	h.Webhooks.Notify(tools.GetLogger(r), tools.WebhookEvent{
+		Event:      tools.WebhookEventAppDeleted,
+		Maintainer: user,
+		AppId:      strconv.Itoa(appId),
+		AppName:    appName,
+	})
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handlers) AppQuotaUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	h = h.forRequest(r)
+	admin := tools.GetUserFromContext(r)
+
+	update, err := tools.ReadBody[tools.AppQuotaUpdate](w, r)
 	if err != nil {
-		tools.Logger.Error("user '%s' tried to delete app with ID '%d' but it failed", user, appId)
-		http.Error(w, "app deletion failed", http.StatusInternalServerError)
 		return
 	}
 
-	tools.Logger.Info("user '%s' deleted app with ID '%d'", user, appId)
+	appId, err := strconv.Atoi(update.AppId)
+	if err != nil {
+		tools.WriteError(w, r, http.StatusBadRequest, tools.CodeInvalidInput, "could not convert to number")
+		return
+	}
+
+	if update.StorageLimitBytes < 0 || update.MaxVersions < 0 {
+		tools.HandleInvalidInput(w, r, errors.New("limits must not be negative"))
+		return
+	}
+
+	err = h.Apps.SetAppQuota(appId, tools.NilIfZero(update.StorageLimitBytes), tools.NilIfZero(update.MaxVersions))
+	if errors.Is(err, tools.ErrAppNotFound) {
+		tools.GetLogger(r).Info("admin '%s' tried to change the quota of app with ID '%d' but it does not exist", admin, appId)
+		tools.WriteError(w, r, http.StatusNotFound, tools.CodeAppNotFound, "app does not exist")
+		return
+	} else if err != nil {
+		tools.GetLogger(r).Error("admin '%s' failed to change the quota of app with ID '%d': %v", admin, appId, err)
+		tools.WriteInternalError(w, r, "changing app quota failed")
+		return
+	}
+
+	tools.GetLogger(r).Info("admin '%s' changed the quota of app with ID '%d'", admin, appId)
 	w.WriteHeader(http.StatusOK)
 }
 
 func ReadBodyAsStringNumber(w http.ResponseWriter, r *http.Request) (int, error) {
-	appIdString, err := validation.ReadBody[tools.NumberString](w, r)
+	appIdString, err := tools.ReadBody[tools.NumberString](w, r)
 	if err != nil {
 		return -1, fmt.Errorf("")
 	}
 	appId, err := strconv.Atoi(appIdString.Value)
 	if err != nil {
-		tools.Logger.Warn("request body string conversion error: %v", appIdString)
-		http.Error(w, "invalid input", http.StatusBadRequest)
+		tools.GetLogger(r).Warn("request body string conversion error: %v", appIdString)
+		tools.WriteError(w, r, http.StatusBadRequest, tools.CodeInvalidInput, "invalid input")
 		return -1, fmt.Errorf("")
 	}
 	return appId, nil
 }
 
-func AppGetListHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) AppGetListHandler(w http.ResponseWriter, r *http.Request) {
+	h = h.forRequest(r)
 	user := tools.GetUserFromContext(r)
 
-	list, err := AppRepo.GetAppList(user)
+	list, err := h.Apps.GetAppList(user)
 	if err != nil {
-		tools.Logger.Warn("error getting app list: %v", err)
-		http.Error(w, "error getting app list", http.StatusInternalServerError)
+		tools.GetLogger(r).Warn("error getting app list: %v", err)
+		tools.WriteInternalError(w, r, "error getting app list")
+		return
 	}
 
-	tools.Logger.Info("got apps of user '%s'", user)
+	tools.GetLogger(r).Info("got apps of user '%s'", user)
 	utils.SendJsonResponse(w, list)
 }
 
-func SearchForAppsHandler(w http.ResponseWriter, r *http.Request) {
-	appSearchRequest, err := validation.ReadBody[tools.AppSearchRequest](w, r)
+func (h *Handlers) SearchForAppsHandler(w http.ResponseWriter, r *http.Request) {
+	h = h.forRequest(r)
+	appSearchRequest, err := tools.ReadBody[tools.AppSearchRequest](w, r)
 	if err != nil {
 		return
 	}
 
-	apps, err := AppRepo.SearchForApps(*appSearchRequest)
+	apps, err := h.Apps.SearchForApps(*appSearchRequest)
 	if err != nil {
-		tools.Logger.Warn("error finding apps: %v", err)
-		http.Error(w, "error finding apps", http.StatusInternalServerError)
+		tools.GetLogger(r).Warn("error finding apps: %v", err)
+		tools.WriteInternalError(w, r, "error finding apps")
 		return
 	}
 
 	utils.SendJsonResponse(w, apps)
 }
+
+func (h *Handlers) AppLookupHandler(w http.ResponseWriter, r *http.Request) {
+	h = h.forRequest(r)
+	lookupRequest, err := tools.ReadBody[tools.AppLookupRequest](w, r)
+	if err != nil {
+		return
+	}
+
+	appId, err := h.Apps.GetAppId(lookupRequest.Maintainer, lookupRequest.AppName)
+	if IsNotFound(err) {
+		tools.GetLogger(r).Info("someone looked up app '%s/%s' but it does not exist", lookupRequest.Maintainer, lookupRequest.AppName)
+		tools.WriteError(w, r, http.StatusNotFound, tools.CodeAppNotFound, "app does not exist")
+		return
+	} else if err != nil {
+		tools.GetLogger(r).Error("looking up app '%s/%s' failed: %v", lookupRequest.Maintainer, lookupRequest.AppName, err)
+		tools.WriteInternalError(w, r, "error getting app")
+		return
+	}
+
+	app, err := h.Apps.GetAppWithLatestVersion(appId)
+	if err != nil {
+		tools.GetLogger(r).Error("getting app with ID '%d' failed: %v", appId, err)
+		tools.WriteInternalError(w, r, "error getting app")
+		return
+	}
+
+	utils.SendJsonResponse(w, app)
+}
+
+// IsNotFound reports whether the error of AppRepository.GetAppId means that the maintainer or the app does not exist.
+func IsNotFound(err error) bool {
+	return errors.Is(err, tools.ErrUserNotFound) || errors.Is(err, tools.ErrAppNotFound)
+}
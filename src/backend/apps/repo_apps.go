@@ -2,26 +2,24 @@ package apps
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/ocelot-cloud/shared/utils"
 	"ocelot/store/tools"
-	"ocelot/store/users"
 	"strconv"
 )
 
-var AppRepo AppRepository = &AppRepositoryImpl{}
-
 func (u *AppRepositoryImpl) IsAppOwner(user string, appId int) bool {
-	userId, err := tools.GetUserId(user)
+	userId, err := u.db.GetUserId(user)
 	if err != nil {
-		tools.Logger.Info("Failed to get user ID: %v", err)
+		u.logger.Info("Failed to get user ID: %v", err)
 		return false
 	}
 
 	var ownerId int
-	err = tools.Db.QueryRow("SELECT user_id FROM apps WHERE app_id = $1", appId).Scan(&ownerId)
+	err = u.db.QueryRow("SELECT user_id FROM apps WHERE app_id = $1", appId).Scan(&ownerId)
 	if err != nil {
-		tools.Logger.Error("Failed to get app owner ID: %v", err)
+		u.logger.Error("Failed to get app owner ID: %v", err)
 		return false
 	}
 
@@ -29,18 +27,16 @@ func (u *AppRepositoryImpl) IsAppOwner(user string, appId int) bool {
 }
 
 func (u *AppRepositoryImpl) CreateApp(user string, app string) error {
-	if !users.UserRepo.DoesUserExist(user) {
-		tools.Logger.Info("User '%s' does not exist", user)
+	userID, err := u.db.GetUserId(user)
+	if errors.Is(err, tools.ErrUserNotFound) {
+		u.logger.Info("User '%s' does not exist", user)
 		return fmt.Errorf("user does not exist")
-	}
-
-	userID, err := tools.GetUserId(user)
-	if err != nil {
+	} else if err != nil {
 		return err
 	}
-	_, err = tools.Db.Exec(`INSERT INTO apps (user_id, app_name) VALUES ($1, $2)`, userID, app)
+	_, err = u.db.Exec(`INSERT INTO apps (user_id, app_name) VALUES ($1, $2)`, userID, app)
 	if err != nil {
-		tools.Logger.Error("Failed to create app: %v", err)
+		u.logger.Error("Failed to create app: %v", err)
 		return fmt.Errorf("failed to create app")
 	}
 	return nil
@@ -48,52 +44,61 @@ func (u *AppRepositoryImpl) CreateApp(user string, app string) error {
 
 func (u *AppRepositoryImpl) DoesAppExist(appId int) bool {
 	var exists bool
-	err := tools.Db.QueryRow("SELECT EXISTS(SELECT 1 FROM apps WHERE app_id = $1)", appId).Scan(&exists)
+	err := u.db.QueryRow("SELECT EXISTS(SELECT 1 FROM apps WHERE app_id = $1)", appId).Scan(&exists)
 	if err != nil {
-		tools.Logger.Error("Failed to check app existence for app with ID: %d, error: %v", appId, err)
+		u.logger.Error("Failed to check app existence for app with ID: %d, error: %v", appId, err)
 		return false
 	}
 	return exists
 }
 
 func (u *AppRepositoryImpl) DeleteApp(appId int) error {
-	userId, err := GetUserIdOfApp(appId)
+	userId, err := u.db.GetUserIdOfApp(appId)
 	if err != nil {
+		u.logger.Error("Failed to delete app: %v", err)
 		return err
 	}
 
-	totalDataSize, err := u.sumBlobSizes(appId)
-	if err != nil {
-		return err
-	}
+	return u.db.RunInTransaction(func(tx *sql.Tx) error {
+		if _, err := u.db.LockUsedSpace(tx, userId); err != nil {
+			return err
+		}
 
-	_, err = tools.Db.Exec(`DELETE FROM apps WHERE app_id = $1`, appId)
-	if err != nil {
-		tools.Logger.Error("Failed to delete app: %v", err)
-		return fmt.Errorf("failed to delete app")
-	}
+		totalDataSize, err := sumBlobSizes(tx, appId)
+		if err != nil {
+			return err
+		}
 
-	_, err = tools.Db.Exec("UPDATE users SET used_space = used_space - $1 WHERE user_id = $2", totalDataSize, userId)
-	if err != nil {
-		return fmt.Errorf("failed to update user space: %w", err)
-	}
+		_, err = tx.Exec(`DELETE FROM apps WHERE app_id = $1`, appId)
+		if err != nil {
+			u.logger.Error("Failed to delete app: %v", err)
+			return fmt.Errorf("failed to delete app")
+		}
 
-	return nil
+		_, err = tx.Exec("UPDATE users SET used_space = used_space - $1 WHERE user_id = $2", totalDataSize, userId)
+		if err != nil {
+			return fmt.Errorf("failed to update user space: %w", err)
+		}
+		return nil
+	})
 }
 
-func GetUserIdOfApp(appId int) (int, error) {
-	var userId int
-	err := tools.Db.QueryRow(`SELECT user_id FROM apps WHERE app_id = $1`, appId).Scan(&userId)
+// SetAppQuota restricts the storage and the number of versions of an app, nil values remove the restriction.
+func (u *AppRepositoryImpl) SetAppQuota(appId int, storageLimit *int, maxVersions *int) error {
+	result, err := u.db.Exec("UPDATE apps SET storage_limit = $1, max_versions = $2 WHERE app_id = $3", storageLimit, maxVersions, appId)
 	if err != nil {
-		tools.Logger.Error("Failed to get user ID of app: %v", err)
-		return -1, fmt.Errorf("failed to get user ID of app")
+		u.logger.Error("Failed to set app quota: %v", err)
+		return fmt.Errorf("failed to set app quota")
+	}
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 {
+		return tools.ErrAppNotFound
 	}
-	return userId, nil
+	return nil
 }
 
-func (u *AppRepositoryImpl) sumBlobSizes(appID int) (int64, error) {
+func sumBlobSizes(tx *sql.Tx, appID int) (int64, error) {
 	var totalSize sql.NullInt64
-	err := tools.Db.QueryRow("SELECT SUM(LENGTH(data)) FROM versions WHERE app_id = $1", appID).Scan(&totalSize)
+	err := tx.QueryRow("SELECT SUM(LENGTH(data)) FROM versions WHERE app_id = $1", appID).Scan(&totalSize)
 	if err != nil {
 		return 0, fmt.Errorf("failed to calculate total BLOB size: %w", err)
 	}
@@ -111,13 +116,13 @@ func (u *AppRepositoryImpl) SearchForApps(request tools.AppSearchRequest) ([]too
 		SELECT u.user_name, a.app_id, a.app_name, v.version_id, v.version_name
 		FROM users u
 		JOIN apps a ON u.user_id = a.user_id
-		JOIN LATERAL (
-			SELECT version_id, version_name
+		JOIN versions v ON v.version_id = (
+			SELECT version_id
 			FROM versions
 			WHERE app_id = a.app_id
-			ORDER BY creation_timestamp DESC
+			ORDER BY creation_timestamp DESC, version_id DESC
 			LIMIT 1
-		) v ON true
+		)
 		WHERE (u.user_name LIKE $1 OR a.app_name LIKE $2)
 	`
 
@@ -126,9 +131,9 @@ func (u *AppRepositoryImpl) SearchForApps(request tools.AppSearchRequest) ([]too
 	}
 	query += " LIMIT 100"
 
-	rows, err := tools.Db.Query(query, "%"+request.SearchTerm+"%", "%"+request.SearchTerm+"%")
+	rows, err := u.db.Query(query, "%"+request.SearchTerm+"%", "%"+request.SearchTerm+"%")
 	if err != nil {
-		tools.Logger.Error("Failed to find apps: %v", err)
+		u.logger.Error("Failed to find apps: %v", err)
 		return nil, fmt.Errorf("failed to find apps")
 	}
 	defer utils.Close(rows)
@@ -138,7 +143,7 @@ func (u *AppRepositoryImpl) SearchForApps(request tools.AppSearchRequest) ([]too
 		var appId, versionId int
 		err := rows.Scan(&maintainer, &appId, &appName, &versionId, &versionName)
 		if err != nil {
-			tools.Logger.Error("Error scanning app row: %v", err)
+			u.logger.Error("Error scanning app row: %v", err)
 			continue
 		}
 		apps = append(apps, tools.AppWithLatestVersion{
@@ -151,19 +156,19 @@ func (u *AppRepositoryImpl) SearchForApps(request tools.AppSearchRequest) ([]too
 	}
 	err = rows.Err()
 	if err != nil {
-		tools.Logger.Error("Error iterating over rows: %v", err)
+		u.logger.Error("Error iterating over rows: %v", err)
 		return nil, fmt.Errorf("error iterating over rows")
 	}
 	return apps, nil
 }
 
 func (u *AppRepositoryImpl) GetAppId(user, app string) (int, error) {
-	userID, err := tools.GetUserId(user)
+	userID, err := u.db.GetUserId(user)
 	if err != nil {
 		return -1, err
 	}
 
-	appID, err := tools.GetAppId(userID, app)
+	appID, err := u.db.GetAppId(userID, app)
 	if err != nil {
 		return -1, err
 	}
@@ -171,12 +176,12 @@ func (u *AppRepositoryImpl) GetAppId(user, app string) (int, error) {
 }
 
 func (u *AppRepositoryImpl) GetAppList(user string) ([]tools.App, error) {
-	userID, err := tools.GetUserId(user)
+	userID, err := u.db.GetUserId(user)
 	if err != nil {
 		return nil, err
 	}
 
-	rows, err := tools.Db.Query("SELECT app_name, app_id FROM apps WHERE user_id = $1", userID)
+	rows, err := u.db.Query("SELECT app_name, app_id FROM apps WHERE user_id = $1", userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get apps: %w", err)
 	}
@@ -201,7 +206,7 @@ func (u *AppRepositoryImpl) GetAppList(user string) ([]tools.App, error) {
 
 func (u *AppRepositoryImpl) GetAppName(appId int) (string, error) {
 	var appName string
-	err := tools.Db.QueryRow("SELECT app_name FROM apps WHERE app_id = $1", appId).Scan(&appName)
+	err := u.db.QueryRow("SELECT app_name FROM apps WHERE app_id = $1", appId).Scan(&appName)
 	if err != nil {
 		return "", fmt.Errorf("failed to get app name: %w", err)
 	}
@@ -210,7 +215,7 @@ func (u *AppRepositoryImpl) GetAppName(appId int) (string, error) {
 
 func (u *AppRepositoryImpl) GetMaintainerName(appId int) (string, error) {
 	var maintainer string
-	err := tools.Db.QueryRow(`
+	err := u.db.QueryRow(`
 		SELECT u.user_name
 		FROM users u
 		JOIN apps a ON u.user_id = a.user_id
@@ -222,7 +227,59 @@ func (u *AppRepositoryImpl) GetMaintainerName(appId int) (string, error) {
 	return maintainer, nil
 }
 
-type AppRepositoryImpl struct{}
+func (u *AppRepositoryImpl) GetAppWithLatestVersion(appId int) (*tools.AppWithLatestVersion, error) {
+	var maintainer, appName string
+	var versionId sql.NullInt64
+	var versionName sql.NullString
+	err := u.db.QueryRow(`
+		SELECT u.user_name, a.app_name, v.version_id, v.version_name
+		FROM apps a
+		JOIN users u ON u.user_id = a.user_id
+		LEFT JOIN versions v ON v.version_id = (
+			SELECT version_id
+			FROM versions
+			WHERE app_id = a.app_id
+			ORDER BY creation_timestamp DESC, version_id DESC
+			LIMIT 1
+		)
+		WHERE a.app_id = $1
+	`, appId).Scan(&maintainer, &appName, &versionId, &versionName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get app: %w", err)
+	}
+
+	app := &tools.AppWithLatestVersion{
+		Maintainer: maintainer,
+		AppId:      strconv.Itoa(appId),
+		AppName:    appName,
+	}
+	if versionId.Valid {
+		app.LatestVersionId = strconv.FormatInt(versionId.Int64, 10)
+		app.LatestVersionName = versionName.String
+	}
+	return app, nil
+}
+
+type AppRepositoryImpl struct {
+	db     *tools.Database
+	logger utils.LoggerType
+}
+
+func NewAppRepository(db *tools.Database, logger utils.LoggerType) *AppRepositoryImpl {
+	return &AppRepositoryImpl{db: db, logger: logger}
+}
+
+func (u *AppRepositoryImpl) WithLogger(logger utils.LoggerType) AppRepository {
+	return &AppRepositoryImpl{db: u.db, logger: logger}
+}
+
+func (u *AppRepositoryImpl) CountApps() (int, error) {
+	var count int
+	if err := u.db.QueryRow("SELECT COUNT(*) FROM apps").Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count apps: %w", err)
+	}
+	return count, nil
+}
 
 type AppRepository interface {
 	IsAppOwner(user string, appId int) bool
@@ -234,4 +291,9 @@ type AppRepository interface {
 	GetAppName(appId int) (string, error)
 	GetAppList(user string) ([]tools.App, error)
 	GetMaintainerName(appId int) (string, error)
+	GetAppWithLatestVersion(appId int) (*tools.AppWithLatestVersion, error)
+	SetAppQuota(appId int, storageLimit *int, maxVersions *int) error
+	CountApps() (int, error)
+	// WithLogger returns a copy of the repository logging with the given logger, e.g. the one of the request being handled.
+	WithLogger(logger utils.LoggerType) AppRepository
 }
@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS storage_limit BIGINT;
+
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS storage_limit BIGINT;
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS max_versions INTEGER;
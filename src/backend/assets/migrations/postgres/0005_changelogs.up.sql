@@ -0,0 +1 @@
+ALTER TABLE versions ADD COLUMN changelog TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,14 @@
+-- Versions uploaded before version names were unique per app may share a name. The newest of them keeps the name, the
+-- older ones are renamed so that the index can be created.
+UPDATE versions
+SET version_name = version_name || '-duplicate-' || version_id
+WHERE EXISTS (
+    SELECT 1
+    FROM versions newer
+    WHERE newer.app_id = versions.app_id
+      AND newer.version_name = versions.version_name
+      AND (newer.creation_timestamp > versions.creation_timestamp
+        OR newer.creation_timestamp = versions.creation_timestamp AND newer.version_id > versions.version_id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS versions_app_id_version_name ON versions (app_id, version_name);
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS users (
+    user_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_name TEXT UNIQUE NOT NULL,
+    email TEXT UNIQUE NOT NULL,
+    hashed_password TEXT NOT NULL UNIQUE,
+    hashed_cookie_value TEXT UNIQUE,
+    expiration_date TEXT,
+    used_space INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS apps (
+    app_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER,
+    app_name TEXT,
+    UNIQUE(user_id, app_name),
+    FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS versions (
+    version_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    version_name TEXT NOT NULL,
+    app_id INTEGER NOT NULL,
+    creation_timestamp TIMESTAMP NOT NULL,
+    data BLOB NOT NULL,
+    UNIQUE(app_id, version_id),
+    FOREIGN KEY (app_id) REFERENCES apps(app_id) ON DELETE CASCADE
+);
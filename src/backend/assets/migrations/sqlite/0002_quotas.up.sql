@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN storage_limit INTEGER;
+
+ALTER TABLE apps ADD COLUMN storage_limit INTEGER;
+ALTER TABLE apps ADD COLUMN max_versions INTEGER;
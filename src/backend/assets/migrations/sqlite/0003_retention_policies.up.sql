@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS retention_policies (
+    app_id INTEGER PRIMARY KEY,
+    keep_last INTEGER,
+    keep_days INTEGER,
+    keep_latest_per_major BOOLEAN NOT NULL DEFAULT FALSE,
+    FOREIGN KEY (app_id) REFERENCES apps(app_id) ON DELETE CASCADE
+);
@@ -0,0 +1,42 @@
+package buildinfo
+
+import (
+	"runtime/debug"
+)
+
+// Version, Commit and Date describe the build of the binary. They are set at build time, e.g.
+// go build -ldflags "-X ocelot/store/buildinfo.Version=1.2.3". If not set, the commit and date are taken from the
+// version control information embedded by the Go toolchain.
+var (
+	Version = "dev"
+	Commit  = ""
+	Date    = ""
+)
+
+// Info describes the build of the running binary.
+type Info struct {
+	Version string
+	Commit  string
+	Date    string
+}
+
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, Date: Date}
+	buildInfo, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	for _, setting := range buildInfo.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if info.Commit == "" {
+				info.Commit = setting.Value
+			}
+		case "vcs.time":
+			if info.Date == "" {
+				info.Date = setting.Value
+			}
+		}
+	}
+	return info
+}
@@ -4,14 +4,14 @@ package check
 
 import (
 	"github.com/ocelot-cloud/shared/assert"
-	"github.com/ocelot-cloud/shared/utils"
+	"ocelot/store/tools"
 	"testing"
 )
 
 func TestCorsHeaderNotPresentInProd(t *testing.T) {
 	hub := getHub()
 	defer hub.wipeData()
-	response, err := hub.Parent.DoRequestWithFullResponse("/api/apps/list", nil, "")
+	response, err := hub.doRequestWithFullResponse("/api/apps/list", nil)
 	assert.Nil(t, err)
 
 	assert.Equal(t, "", response.Header.Get("Access-Control-Allow-Origin"))
@@ -23,7 +23,6 @@ func TestCorsHeaderNotPresentInProd(t *testing.T) {
 func TestDontAllowDifferentHostAndOriginHeader(t *testing.T) {
 	hub := getHub()
 	hub.Parent.Origin = "localhost2"
-	_, err := hub.Parent.DoRequestWithFullResponse("/api/apps/list", nil, "")
-	assert.NotNil(t, err)
-	assert.Equal(t, utils.GetErrMsg(400, "When 'Origin' header is set, it must match host header"), err.Error())
+	_, err := hub.doRequestWithFullResponse("/api/apps/list", nil)
+	assertApiError(t, err, 400, tools.CodeOriginMismatch)
 }
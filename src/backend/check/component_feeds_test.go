@@ -0,0 +1,122 @@
+//go:build component
+
+package check
+
+import (
+	"encoding/xml"
+	"github.com/ocelot-cloud/shared/assert"
+	"net/http"
+	"net/url"
+	"ocelot/store/tools"
+	"strings"
+	"testing"
+)
+
+type sampleFeed struct {
+	Title   string `xml:"title"`
+	Entries []struct {
+		Id      string `xml:"id"`
+		Title   string `xml:"title"`
+		Author  string `xml:"author>name"`
+		Summary string `xml:"summary"`
+	} `xml:"entry"`
+}
+
+func getFeed(t *testing.T, hub *HubClient, query string) *sampleFeed {
+	response, body, err := hub.getReleaseFeed(query, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "application/atom+xml; charset=utf-8", response.Header.Get("Content-Type"))
+	var feed sampleFeed
+	assert.Nil(t, xml.Unmarshal(body, &feed))
+	return &feed
+}
+
+func TestReleaseFeeds(t *testing.T) {
+	hub := getHubAndLogin(t)
+	defer hub.wipeData()
+	assert.Nil(t, hub.createApp())
+	hub.Changelog = "Fixes the login."
+	assert.Nil(t, hub.uploadVersion())
+	hub.Version = tools.SampleVersion + "2"
+	hub.Changelog = ""
+	assert.Nil(t, hub.uploadVersion())
+
+	feed := getFeed(t, hub, "")
+	assert.Equal(t, "New releases", feed.Title)
+	assert.Equal(t, 2, len(feed.Entries))
+	assert.Equal(t, tools.SampleUser+"/"+tools.SampleApp+" "+tools.SampleVersion+"2", feed.Entries[0].Title)
+	assert.Equal(t, "", feed.Entries[0].Summary)
+	assert.Equal(t, tools.SampleUser+"/"+tools.SampleApp+" "+tools.SampleVersion, feed.Entries[1].Title)
+	assert.Equal(t, "Fixes the login.", feed.Entries[1].Summary)
+	assert.Equal(t, tools.SampleUser, feed.Entries[1].Author)
+	assert.True(t, strings.HasPrefix(feed.Entries[1].Id, "tag:localhost,"))
+
+	feed = getFeed(t, hub, "?maintainer="+tools.SampleUser)
+	assert.Equal(t, "Releases of "+tools.SampleUser, feed.Title)
+	assert.Equal(t, 2, len(feed.Entries))
+
+	feed = getFeed(t, hub, "?maintainer="+tools.SampleUser+"&app="+tools.SampleApp)
+	assert.Equal(t, "Releases of "+tools.SampleUser+"/"+tools.SampleApp, feed.Title)
+	assert.Equal(t, 2, len(feed.Entries))
+
+	hub.App = tools.SampleApp + "2"
+	assert.Nil(t, hub.createApp())
+	feed = getFeed(t, hub, "?maintainer="+tools.SampleUser+"&app="+hub.App)
+	assert.Equal(t, 0, len(feed.Entries))
+}
+
+func TestReleaseFeedSupportsConditionalRequests(t *testing.T) {
+	hub := getHubAndLogin(t)
+	defer hub.wipeData()
+	assert.Nil(t, hub.createApp())
+	assert.Nil(t, hub.uploadVersion())
+
+	response, _, err := hub.getReleaseFeed("", nil)
+	assert.Nil(t, err)
+	eTag := response.Header.Get("ETag")
+	lastModified := response.Header.Get("Last-Modified")
+	assert.NotEqual(t, "", eTag)
+	assert.NotEqual(t, "", lastModified)
+
+	response, body, err := hub.getReleaseFeed("", http.Header{"If-None-Match": {eTag}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNotModified, response.StatusCode)
+	assert.Equal(t, 0, len(body))
+	response, _, err = hub.getReleaseFeed("", http.Header{"If-Modified-Since": {lastModified}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNotModified, response.StatusCode)
+
+	assert.Nil(t, hub.deleteVersion())
+	response, _, err = hub.getReleaseFeed("", http.Header{"If-None-Match": {eTag}})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.NotEqual(t, eTag, response.Header.Get("ETag"))
+}
+
+func TestReleaseFeedQueryValidation(t *testing.T) {
+	hub := getHubAndLogin(t)
+	defer hub.wipeData()
+	assert.Nil(t, hub.createApp())
+
+	for query, expectedStatus := range map[string]int{
+		"?maintainer=" + url.QueryEscape("<script>"):                  http.StatusBadRequest,
+		"?app=" + tools.SampleApp:                                     http.StatusBadRequest,
+		"?maintainer=unknownuser":                                     http.StatusNotFound,
+		"?maintainer=" + tools.SampleUser + "&app=unknownapp":         http.StatusNotFound,
+		"?maintainer=" + tools.SampleUser + "&app=" + tools.SampleApp: http.StatusOK,
+	} {
+		response, _, err := hub.getReleaseFeed(query, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, expectedStatus, response.StatusCode)
+	}
+}
+
+func TestVersionUploadRejectsTooLongChangelog(t *testing.T) {
+	hub := getHubAndLogin(t)
+	defer hub.wipeData()
+	assert.Nil(t, hub.createApp())
+	hub.Changelog = strings.Repeat("a", tools.MaxChangelogLength+1)
+	err := hub.uploadVersion()
+	assertApiError(t, err, http.StatusBadRequest, tools.CodeInvalidInput)
+}
@@ -3,9 +3,14 @@
 package check
 
 import (
+	"encoding/json"
 	"github.com/ocelot-cloud/shared/assert"
 	"github.com/ocelot-cloud/shared/utils"
+	"net/http"
+	"ocelot/store/config"
+	"ocelot/store/openapi"
 	"ocelot/store/tools"
+	"strings"
 	"testing"
 	"time"
 )
@@ -14,20 +19,17 @@ func TestVersionDownload(t *testing.T) {
 	hub := getHub()
 
 	_, err := hub.downloadVersion()
-	assert.NotNil(t, err)
-	assert.Equal(t, utils.GetErrMsg(404, "version does not exist"), err.Error())
+	assertApiError(t, err, 404, tools.CodeVersionNotFound)
 
 	assert.Nil(t, hub.registerAndValidateUser())
 	assert.Nil(t, hub.login())
 
 	_, err = hub.downloadVersion()
-	assert.NotNil(t, err)
-	assert.Equal(t, utils.GetErrMsg(404, "version does not exist"), err.Error())
+	assertApiError(t, err, 404, tools.CodeVersionNotFound)
 
 	assert.Nil(t, hub.createApp())
 	_, err = hub.downloadVersion()
-	assert.NotNil(t, err)
-	assert.Equal(t, utils.GetErrMsg(404, "version does not exist"), err.Error())
+	assertApiError(t, err, 404, tools.CodeVersionNotFound)
 
 	assert.Nil(t, hub.uploadVersion())
 	foundVersions, err := hub.getVersions()
@@ -66,8 +68,7 @@ func TestCreateApp(t *testing.T) {
 	assert.Equal(t, hub.App, foundApp.Name)
 
 	err = hub.createApp()
-	assert.NotNil(t, err)
-	assert.Equal(t, utils.GetErrMsg(409, "app already exists"), err.Error())
+	assertApiError(t, err, 409, tools.CodeAppAlreadyExists)
 
 	assert.Nil(t, hub.deleteApp())
 	foundApps, err = hub.ListOwnApps()
@@ -79,15 +80,13 @@ func TestUploadVersion(t *testing.T) {
 	hub := getHubAndLogin(t)
 
 	err := hub.uploadVersion()
-	assert.NotNil(t, err)
-	assert.Equal(t, utils.GetErrMsg(404, "app does not exist"), err.Error())
+	assertApiError(t, err, 404, tools.CodeAppNotFound)
 
 	assert.Nil(t, hub.createApp())
 	assert.Nil(t, hub.uploadVersion())
 
 	err = hub.uploadVersion()
-	assert.NotNil(t, err)
-	assert.Equal(t, utils.GetErrMsg(409, "version already exists"), err.Error())
+	assertApiError(t, err, 409, tools.CodeVersionAlreadyExists)
 
 	versions, err := hub.getVersions()
 	assert.Nil(t, err)
@@ -100,15 +99,13 @@ func TestUploadVersion(t *testing.T) {
 	assert.Equal(t, 0, len(versions))
 
 	err = hub.deleteVersion()
-	assert.NotNil(t, err)
-	assert.Equal(t, utils.GetErrMsg(404, "version does not exist"), err.Error())
+	assertApiError(t, err, 404, tools.CodeVersionNotFound)
 }
 
 func TestLogin(t *testing.T) {
 	hub := getHub()
 	err := hub.login()
-	assert.NotNil(t, err)
-	assert.Equal(t, utils.GetErrMsg(404, "user does not exist"), err.Error())
+	assertApiError(t, err, 404, tools.CodeUserNotFound)
 }
 
 func TestChangePassword(t *testing.T) {
@@ -118,8 +115,7 @@ func TestChangePassword(t *testing.T) {
 
 	assert.Nil(t, hub.changePassword())
 	err := hub.login()
-	assert.NotNil(t, err)
-	assert.Equal(t, utils.GetErrMsg(401, "incorrect username or password"), err.Error())
+	assertApiError(t, err, 401, tools.CodeInvalidCredentials)
 
 	hub.Parent.Password = hub.Parent.NewPassword
 	hub.Parent.Cookie = nil
@@ -132,8 +128,7 @@ func TestRegistration(t *testing.T) {
 	hub := getHub()
 	assert.Nil(t, hub.registerAndValidateUser())
 	err := hub.registerAndValidateUser()
-	assert.NotNil(t, err)
-	assert.Equal(t, utils.GetErrMsg(409, "user already exists"), err.Error())
+	assertApiError(t, err, 409, tools.CodeUserAlreadyExists)
 }
 
 func TestGetVersionsUnhappyPath(t *testing.T) {
@@ -142,8 +137,7 @@ func TestGetVersionsUnhappyPath(t *testing.T) {
 	assert.Nil(t, hub.registerAndValidateUser())
 	assert.Nil(t, hub.login())
 	_, err := hub.getVersions()
-	assert.NotNil(t, err)
-	assert.Equal(t, utils.GetErrMsg(404, "app does not exist"), err.Error())
+	assertApiError(t, err, 404, tools.CodeAppNotFound)
 
 	assert.Nil(t, hub.createApp())
 	versionList, err := hub.getVersions()
@@ -156,8 +150,7 @@ func TestLogout(t *testing.T) {
 	assert.Nil(t, hub.createApp())
 	assert.Nil(t, hub.logout())
 	err := hub.createApp()
-	assert.NotNil(t, err)
-	assert.Equal(t, utils.GetErrMsg(401, "cookie not found"), err.Error())
+	assertApiError(t, err, 401, tools.CodeCookieNotFound)
 }
 
 func TestGetAppList(t *testing.T) {
@@ -187,8 +180,7 @@ func TestEmailAlreadyExists(t *testing.T) {
 	assert.Nil(t, hub.registerAndValidateUser())
 	hub.Parent.User = tools.SampleUser + "2"
 	err := hub.registerUser()
-	assert.NotNil(t, err)
-	assert.Equal(t, utils.GetErrMsg(409, "email already exists"), err.Error())
+	assertApiError(t, err, 409, tools.CodeEmailAlreadyExists)
 }
 
 func TestDownloadDummyVersion(t *testing.T) {
@@ -217,8 +209,7 @@ func TestCreationOfOcelotCloudAppIsForbidden(t *testing.T) {
 	hub := getHubAndLogin(t)
 	hub.App = "ocelotcloud"
 	err := hub.createApp()
-	assert.NotNil(t, err)
-	assert.Equal(t, utils.GetErrMsg(400, "app name is reserved"), err.Error())
+	assertApiError(t, err, 400, tools.CodeReservedName)
 }
 
 func TestUnofficialAppFilteringWhenSearching(t *testing.T) {
@@ -254,3 +245,144 @@ func TestAllowEmptyStringAsSearchTerm(t *testing.T) {
 	assert.Equal(t, 1, len(apps))
 
 }
+
+func TestLookupAppAndVersionByName(t *testing.T) {
+	hub := getHubAndLogin(t)
+	defer hub.wipeData()
+
+	_, err := hub.lookupApp()
+	assertApiError(t, err, 404, tools.CodeAppNotFound)
+
+	assert.Nil(t, hub.createApp())
+	app, err := hub.lookupApp()
+	assert.Nil(t, err)
+	assert.Equal(t, hub.AppId, app.AppId)
+	assert.Equal(t, "", app.LatestVersionId)
+
+	_, err = hub.lookupVersion()
+	assertApiError(t, err, 404, tools.CodeVersionNotFound)
+
+	assert.Nil(t, hub.uploadVersion())
+	version, err := hub.lookupVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, hub.Parent.User, version.Maintainer)
+	assert.Equal(t, hub.AppId, version.AppId)
+	assert.Equal(t, hub.App, version.AppName)
+	assert.Equal(t, hub.VersionId, version.VersionId)
+	assert.Equal(t, hub.Version, version.VersionName)
+
+	hub.Version = tools.SampleVersion + "x"
+	assert.Nil(t, hub.uploadVersion())
+	hub.Version = tools.LatestVersionAlias
+	version, err = hub.lookupVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, hub.VersionId, version.VersionId)
+	assert.Equal(t, tools.SampleVersion+"x", version.VersionName)
+
+	app, err = hub.lookupApp()
+	assert.Nil(t, err)
+	assert.Equal(t, hub.VersionId, app.LatestVersionId)
+	assert.Equal(t, tools.SampleVersion+"x", app.LatestVersionName)
+}
+
+func TestLatestIsReservedVersionName(t *testing.T) {
+	hub := getHubAndLogin(t)
+	defer hub.wipeData()
+	assert.Nil(t, hub.createApp())
+	hub.Version = tools.LatestVersionAlias
+	err := hub.uploadVersion()
+	assertApiError(t, err, 400, tools.CodeReservedName)
+}
+
+func TestQuotaReportsUsageAndLimits(t *testing.T) {
+	hub := getHubAndLogin(t)
+	defer hub.wipeData()
+	assert.Nil(t, hub.createApp())
+	assert.Nil(t, hub.uploadVersion())
+
+	quota, err := hub.getQuota()
+	assert.Nil(t, err)
+	assert.Equal(t, len(hub.UploadContent), quota.UsedBytes)
+	assert.Equal(t, config.Default().Quota.DefaultStorageLimit, quota.StorageLimitBytes)
+	assert.Equal(t, config.Default().Quota.MaxPayloadSize, quota.MaxPayloadBytes)
+	assert.Equal(t, 1, len(quota.Apps))
+	assert.Equal(t, hub.AppId, quota.Apps[0].AppId)
+	assert.Equal(t, len(hub.UploadContent), quota.Apps[0].UsedBytes)
+	assert.Equal(t, 1, quota.Apps[0].VersionCount)
+	assert.Nil(t, quota.Apps[0].StorageLimitBytes)
+	assert.Nil(t, quota.Apps[0].MaxVersions)
+}
+
+func TestQuotaRoutesOfAdminsAreForbiddenForOtherUsers(t *testing.T) {
+	hub := getHubAndLogin(t)
+	defer hub.wipeData()
+	assert.Nil(t, hub.createApp())
+
+	_, err := hub.doRequest(tools.AdminUserQuotaPath, tools.UserQuotaUpdate{User: hub.Parent.User, StorageLimitBytes: 1})
+	assertApiError(t, err, http.StatusForbidden, tools.CodeNotAdmin)
+	_, err = hub.doRequest(tools.AdminAppQuotaPath, tools.AppQuotaUpdate{AppId: hub.AppId, MaxVersions: 1})
+	assertApiError(t, err, http.StatusForbidden, tools.CodeNotAdmin)
+}
+
+func TestRetentionPolicyPrunesOldVersionsOnUpload(t *testing.T) {
+	hub := getHubAndLogin(t)
+	defer hub.wipeData()
+	assert.Nil(t, hub.createApp())
+	assert.Nil(t, hub.uploadVersion())
+	hub.Version = "0.0.2"
+	assert.Nil(t, hub.uploadVersion())
+
+	assert.Nil(t, hub.setRetentionPolicy(tools.RetentionPolicy{KeepLast: 1}))
+	result, err := hub.dryRunRetentionPolicy()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(result.Versions))
+	assert.Equal(t, tools.SampleVersion, result.Versions[0].Name)
+	foundVersions, err := hub.getVersions()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(foundVersions))
+
+	hub.Version = "0.0.3"
+	assert.Nil(t, hub.uploadVersion())
+	foundVersions, err = hub.getVersions()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(foundVersions))
+	assert.Equal(t, "0.0.3", foundVersions[0].Name)
+}
+
+func TestRetentionPolicyValidation(t *testing.T) {
+	hub := getHubAndLogin(t)
+	defer hub.wipeData()
+	assert.Nil(t, hub.createApp())
+	err := hub.setRetentionPolicy(tools.RetentionPolicy{KeepLast: -1})
+	assertApiError(t, err, http.StatusBadRequest, tools.CodeInvalidInput)
+}
+
+func TestOpenApiDocumentIsServed(t *testing.T) {
+	hub := getHub()
+	result, err := hub.doRequest(tools.OpenApiPath, nil)
+	assert.Nil(t, err)
+	document, err := utils.UnpackResponse[openapi.Document](result)
+	assert.Nil(t, err)
+	assert.Equal(t, "3.1.0", document.OpenApi)
+	_, found := document.Paths[tools.VersionUploadPath]
+	assert.True(t, found)
+}
+
+func TestErrorResponsesAreStructured(t *testing.T) {
+	hub := getHub()
+	request, err := http.NewRequest(http.MethodPost, hub.Parent.RootUrl+tools.DownloadPath, strings.NewReader(`{"value":"1"}`))
+	assert.Nil(t, err)
+	request.Header.Set(tools.RequestIdHeader, "sample-request-id")
+	response, err := http.DefaultClient.Do(request)
+	assert.Nil(t, err)
+	defer utils.Close(response.Body)
+
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+	assert.Equal(t, "application/json", response.Header.Get("Content-Type"))
+	var errorResponse tools.ErrorResponse
+	assert.Nil(t, json.NewDecoder(response.Body).Decode(&errorResponse))
+	assert.Equal(t, tools.CodeVersionNotFound, errorResponse.Code)
+	assert.Equal(t, "version does not exist", errorResponse.Message)
+	assert.Equal(t, "sample-request-id", errorResponse.RequestId)
+	assert.Equal(t, "sample-request-id", response.Header.Get(tools.RequestIdHeader))
+}
@@ -0,0 +1,62 @@
+//go:build component
+
+package check
+
+import (
+	"context"
+	"github.com/ocelot-cloud/shared/utils"
+	"net"
+	"ocelot/store/config"
+	"ocelot/store/memory"
+	"ocelot/store/server"
+	"ocelot/store/tools"
+	"ocelot/store/users"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestMain runs the component tests against an in-process store using in-memory repositories. To test a running
+// store instead, e.g. one using PostgreSQL, set STORE_TEST_URL to its root URL. That store must allow requests from
+// frontendDevelopmentOrigin and deliver webhook events to private addresses with a short backoff, like the store
+// started by the CI runner.
+func TestMain(m *testing.M) {
+	if url := os.Getenv("STORE_TEST_URL"); url != "" {
+		tools.RootUrl = url
+		os.Exit(m.Run())
+	}
+
+	cfg := config.Default()
+	cfg.Server.Profile = config.ProfileTest
+	cfg.Cors.AllowedOrigins = []string{frontendDevelopmentOrigin}
+	cfg.Webhooks.AllowPrivateAddresses = true
+	cfg.Webhooks.InitialBackoff = 100 * time.Millisecond
+	cfg.Webhooks.PollInterval = 100 * time.Millisecond
+	logger := utils.ProvideLogger(cfg.Server.LogLevel)
+	db := memory.NewDatabase()
+	repos := server.Repositories{
+		Users:    memory.NewUserRepository(db, cfg, logger),
+		Apps:     memory.NewAppRepository(db, logger),
+		Versions: memory.NewVersionRepository(db, cfg, logger),
+		Webhooks: memory.NewWebhookRepository(db, logger),
+	}
+	store := server.New(cfg, nil, logger, users.NewMailer(cfg, logger), repos)
+
+	// The store is served including its background jobs, which deliver the webhook events.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		logger.Fatal("failed to listen: %v", err)
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- store.Serve(ctx, listener, nil)
+	}()
+	tools.RootUrl = "http://" + listener.Addr().String()
+	code := m.Run()
+	stop()
+	if err = <-stopped; err != nil {
+		logger.Error("store stopped: %v", err)
+	}
+	os.Exit(code)
+}
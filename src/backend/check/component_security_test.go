@@ -4,24 +4,44 @@ package check
 
 import (
 	"github.com/ocelot-cloud/shared/assert"
-	"github.com/ocelot-cloud/shared/utils"
 	"net/http"
 	"ocelot/store/tools"
 	"ocelot/store/users"
+	"strings"
 	"testing"
 	"time"
 )
 
-func TestCorsHeaderArePresentInTestProfile(t *testing.T) {
+func TestCorsHeadersArePresentForAllowedOrigins(t *testing.T) {
 	hub := getHubAndLogin(t)
-	defer hub.wipeData()
-	response, err := hub.Parent.DoRequestWithFullResponse(tools.AppGetListPath, nil, "")
+	hub.Parent.Origin = frontendDevelopmentOrigin
+	response, err := hub.doRequestWithFullResponse(tools.AppGetListPath, nil)
+	assert.Nil(t, err)
+
+	assert.Equal(t, frontendDevelopmentOrigin, response.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", response.Header.Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "X-Request-ID, Retry-After", response.Header.Get("Access-Control-Expose-Headers"))
+
+	hub.Parent.Origin = "http://evil.example.com"
+	_, err = hub.doRequestWithFullResponse(tools.AppGetListPath, nil)
+	assertApiError(t, err, 400, tools.CodeOriginMismatch)
+}
+
+func TestCorsPreflight(t *testing.T) {
+	request, err := http.NewRequest(http.MethodOptions, tools.RootUrl+tools.AppCreationPath, nil)
+	assert.Nil(t, err)
+	request.Header.Set("Origin", frontendDevelopmentOrigin)
+	request.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	request.Header.Set("Access-Control-Request-Headers", "content-type, x-csrf-token")
+	response, err := http.DefaultClient.Do(request)
 	assert.Nil(t, err)
+	assert.Nil(t, response.Body.Close())
 
-	assert.Equal(t, "", response.Header.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, http.StatusNoContent, response.StatusCode)
+	assert.Equal(t, frontendDevelopmentOrigin, response.Header.Get("Access-Control-Allow-Origin"))
 	assert.Equal(t, "true", response.Header.Get("Access-Control-Allow-Credentials"))
-	assert.Equal(t, "POST, GET, OPTIONS, PUT, DELETE", response.Header.Get("Access-Control-Allow-Methods"))
-	assert.Equal(t, "Accept, Content-Type, Content-Length, Authorization", response.Header.Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "GET, POST, OPTIONS", response.Header.Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Accept, Content-Type, Authorization, X-CSRF-Token, X-Request-ID", response.Header.Get("Access-Control-Allow-Headers"))
 }
 
 func TestFindAppsSecurity(t *testing.T) {
@@ -73,8 +93,7 @@ func TestChangePasswordSecurity(t *testing.T) {
 	correctlyFormattedButNotMatchingPassword := tools.SamplePassword + "xy"
 	hub.Parent.Password = correctlyFormattedButNotMatchingPassword
 	err := hub.changePassword()
-	assert.NotNil(t, err)
-	assert.Equal(t, utils.GetErrMsg(401, "incorrect username or password"), err.Error())
+	assertApiError(t, err, 401, tools.CodeInvalidCredentials)
 	hub.Parent.Password = tools.SamplePassword
 
 	testInputInvalidation(t, hub, "invalid-password-ä", PasswordField, ChangePassword)
@@ -102,8 +121,7 @@ func TestLoginSecurity(t *testing.T) {
 	correctlyFormattedButNotMatchingPassword := tools.SamplePassword + "x"
 	hub.Parent.Password = correctlyFormattedButNotMatchingPassword
 	err = hub.login()
-	assert.NotNil(t, err)
-	assert.Equal(t, utils.GetErrMsg(401, "incorrect username or password"), err.Error())
+	assertApiError(t, err, 401, tools.CodeInvalidCredentials)
 	hub.Parent.Password = tools.SamplePassword
 }
 
@@ -133,8 +151,7 @@ func TestCookieExpirationAndRenewal(t *testing.T) {
 	assert.Nil(t, hub.login())
 	assert.True(t, time.Now().UTC().After(hub.Parent.Cookie.Expires))
 	err := hub.createApp()
-	assert.NotNil(t, err)
-	assert.Equal(t, utils.GetErrMsg(400, "cookie expired"), err.Error())
+	assertApiError(t, err, 400, tools.CodeCookieExpired)
 	hub.Parent.User = tools.SampleUser
 
 	// There is some specific logic for this user in the production code when handling cookie.
@@ -155,6 +172,13 @@ func TestOwnership(t *testing.T) {
 	testVersionOwnership(t, hub, hub.deleteApp)
 	hub = getHub()
 	testVersionOwnership(t, hub, hub.uploadVersion)
+	hub = getHub()
+	testVersionOwnership(t, hub, func() error { return hub.setRetentionPolicy(tools.RetentionPolicy{KeepLatestPerMajor: true}) })
+	hub = getHub()
+	testVersionOwnership(t, hub, func() error {
+		_, err := hub.dryRunRetentionPolicy()
+		return err
+	})
 }
 
 func testVersionOwnership(t *testing.T, hub *HubClient, operation func() error) {
@@ -167,8 +191,7 @@ func testVersionOwnership(t *testing.T, hub *HubClient, operation func() error)
 	assert.Nil(t, hub.registerAndValidateUser())
 	assert.Nil(t, hub.login())
 	err := operation()
-	assert.NotNil(t, err)
-	assert.Equal(t, utils.GetErrMsg(401, "you do not own this app"), err.Error())
+	assertApiError(t, err, 401, tools.CodeNotOwner)
 }
 
 func TestOwnershipOfDeleteVersion(t *testing.T) {
@@ -183,8 +206,7 @@ func TestOwnershipOfDeleteVersion(t *testing.T) {
 	assert.Nil(t, hub.login())
 
 	err := hub.deleteVersion()
-	assert.NotNil(t, err)
-	assert.Equal(t, utils.GetErrMsg(401, "you do not own this version"), err.Error())
+	assertApiError(t, err, 401, tools.CodeNotOwner)
 }
 
 func TestValidationCodeInputValidation(t *testing.T) {
@@ -212,8 +234,7 @@ func TestUploadOfInvalidZipContent(t *testing.T) {
 	hub.UploadContent = []byte("not-bytes-of-valid-zip-file")
 	assert.Nil(t, hub.createApp())
 	err := hub.uploadVersion()
-	assert.NotNil(t, err)
-	assert.Equal(t, utils.GetErrMsg(400, "invalid version: failed to read zip file: zip: not a valid zip file"), err.Error())
+	assertApiError(t, err, 400, tools.CodeInvalidVersion)
 }
 
 func TestCookieAndHostProtection(t *testing.T) {
@@ -240,20 +261,17 @@ func doCookieAndHostPolicyChecks(t *testing.T, hub *HubClient, operation func()
 	hub.Parent.SetCookieHeader = false
 
 	err := operation()
-	assert.NotNil(t, err)
-	assert.Equal(t, utils.GetErrMsg(401, "cookie not set in request"), err.Error())
+	assertApiError(t, err, 401, tools.CodeCookieMissing)
 
 	hub.Parent.SetCookieHeader = true
 	hub.Parent.Cookie.Value = "some-invalid-cookie-value"
 	err = operation()
-	assert.NotNil(t, err)
-	assert.Equal(t, utils.GetErrMsg(400, "invalid cookie"), err.Error())
+	assertApiError(t, err, 400, tools.CodeCookieInvalid)
 
 	validButNonExistentCookie := "abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789"
 	hub.Parent.Cookie.Value = validButNonExistentCookie
 	err = operation()
-	assert.NotNil(t, err)
-	assert.Equal(t, utils.GetErrMsg(401, "cookie not found"), err.Error())
+	assertApiError(t, err, 401, tools.CodeCookieNotFound)
 
 	assert.Nil(t, hub.login())
 
@@ -262,8 +280,7 @@ func doCookieAndHostPolicyChecks(t *testing.T, hub *HubClient, operation func()
 	assert.Nil(t, hub.registerAndValidateUser())
 	assert.Nil(t, hub.login())
 	err = operation()
-	assert.NotNil(t, err)
-	assert.Equal(t, utils.GetErrMsg(400, "cookie expired"), err.Error())
+	assertApiError(t, err, 400, tools.CodeCookieExpired)
 	assert.True(t, time.Now().UTC().After(hub.Parent.Cookie.Expires))
 	hub.Parent.User = tools.SampleUser
 	hub.Email = tools.SampleEmail
@@ -323,8 +340,7 @@ func testInputInvalidation(t *testing.T, hub *HubClient, invalidValue string, fi
 }
 
 func assertInvalidInputError(t *testing.T, err error) {
-	assert.NotNil(t, err)
-	assert.Equal(t, utils.GetErrMsg(400, "invalid input"), err.Error())
+	assertApiError(t, err, 400, tools.CodeInvalidInput)
 }
 
 func returnCurrentValueAndSetField(hub *HubClient, fieldType FieldType, value string) string {
@@ -363,3 +379,56 @@ func returnCurrentValueAndSetField(hub *HubClient, fieldType FieldType, value st
 	}
 	return originalValue
 }
+
+func TestCsrfTokenIsRequiredForCookieSessions(t *testing.T) {
+	hub := getHubAndLogin(t)
+	assert.Equal(t, 64, len(hub.CsrfToken))
+	token := hub.CsrfToken
+
+	hub.CsrfToken = ""
+	assertApiError(t, hub.createApp(), 403, tools.CodeCsrfTokenInvalid)
+	hub.CsrfToken = strings.Repeat("0", 64)
+	assertApiError(t, hub.createApp(), 403, tools.CodeCsrfTokenInvalid)
+	hub.CsrfToken = token
+	assert.Nil(t, hub.createApp())
+
+	// the token belongs to the session, so it changes with every login
+	assert.Nil(t, hub.login())
+	assert.NotEqual(t, token, hub.CsrfToken)
+	newToken := hub.CsrfToken
+	hub.CsrfToken = token
+	assertApiError(t, hub.deleteApp(), 403, tools.CodeCsrfTokenInvalid)
+	hub.CsrfToken = newToken
+}
+
+func TestCsrfTokenIsRequiredForGetRequests(t *testing.T) {
+	hub := getHubAndLogin(t)
+
+	// the account deletion reads no body, so a GET request sent by a link or image tag would be enough to delete it
+	request, err := http.NewRequest(http.MethodGet, hub.Parent.RootUrl+tools.DeleteUserPath, nil)
+	assert.Nil(t, err)
+	request.AddCookie(hub.Parent.Cookie)
+	response, err := http.DefaultClient.Do(request)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusForbidden, response.StatusCode)
+	assert.Nil(t, response.Body.Close())
+
+	assert.Nil(t, hub.checkAuth())
+}
+
+func TestCsrfTokenIsNotRequiredForBearerTokens(t *testing.T) {
+	hub := getHubAndLogin(t)
+
+	request, err := http.NewRequest(http.MethodPost, hub.Parent.RootUrl+tools.AppCreationPath, strings.NewReader(`{"value":"`+hub.App+`"}`))
+	assert.Nil(t, err)
+	request.Header.Set("Authorization", "Bearer "+hub.Parent.Cookie.Value)
+	response, err := http.DefaultClient.Do(request)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, 0, len(response.Cookies()))
+	assert.Nil(t, response.Body.Close())
+
+	apps, err := hub.ListOwnApps()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(apps))
+}
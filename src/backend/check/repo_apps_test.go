@@ -4,122 +4,165 @@ package check
 
 import (
 	"github.com/ocelot-cloud/shared/assert"
+	"github.com/ocelot-cloud/shared/utils"
 	"ocelot/store/apps"
+	"ocelot/store/config"
+	"ocelot/store/metrics"
 	"ocelot/store/tools"
 	"ocelot/store/users"
 	"ocelot/store/versions"
+	"ocelot/store/webhooks"
 	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
 )
 
+var (
+	testConfig  = config.Default()
+	testLogger  = utils.ProvideLogger(testConfig.Server.LogLevel)
+	testDb      *tools.Database
+	userRepo    users.UserRepository
+	appRepo     apps.AppRepository
+	versionRepo versions.VersionRepository
+	webhookRepo webhooks.WebhookRepository
+	dispatcher  *webhooks.Dispatcher
+)
+
+// TestMain runs the repository tests against PostgreSQL, or against a temporary SQLite database if
+// STORE_DATABASE_DRIVER=sqlite is set.
 func TestMain(m *testing.M) {
-	tools.InitializeDatabase()
+	var sqliteDir string
+	if os.Getenv(config.EnvName("database.driver")) == config.DriverSqlite {
+		var err error
+		sqliteDir, err = os.MkdirTemp("", "store-repo-tests")
+		if err != nil {
+			testLogger.Fatal("failed to create directory for database: %v", err)
+		}
+		testConfig.Database.Driver = config.DriverSqlite
+		testConfig.Database.Path = filepath.Join(sqliteDir, "store.db")
+	}
+	var err error
+	testDb, err = tools.OpenDatabase(testConfig.Database, testLogger)
+	if err != nil {
+		testLogger.Fatal("%v", err)
+	}
+	userRepo = users.NewUserRepository(testDb, testConfig, testLogger)
+	appRepo = apps.NewAppRepository(testDb, testLogger)
+	versionRepo = versions.NewVersionRepository(testDb, testConfig, testLogger)
+	webhookRepo = webhooks.NewWebhookRepository(testDb, testLogger)
+	dispatcher = webhooks.NewDispatcher(webhookRepo, testConfig.Webhooks, metrics.New(), testLogger)
+
 	code := m.Run()
+	utils.Close(testDb)
+	if sqliteDir != "" {
+		_ = os.RemoveAll(sqliteDir)
+	}
 	os.Exit(code)
 }
 
 func TestCreateRepoApp(t *testing.T) {
-	defer users.UserRepo.WipeDatabase()
-	assert.Nil(t, users.CreateAndValidateUser(tools.SampleForm))
-	assert.Nil(t, apps.AppRepo.CreateApp(tools.SampleUser, tools.SampleApp))
-	appId, err := apps.AppRepo.GetAppId(tools.SampleUser, tools.SampleApp)
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+	appId, err := appRepo.GetAppId(tools.SampleUser, tools.SampleApp)
 	assert.Nil(t, err)
-	assert.True(t, apps.AppRepo.DoesAppExist(appId))
-	maintainer, err := apps.AppRepo.GetMaintainerName(appId)
+	assert.True(t, appRepo.DoesAppExist(appId))
+	maintainer, err := appRepo.GetMaintainerName(appId)
 	assert.Nil(t, err)
 	assert.Equal(t, tools.SampleUser, maintainer)
 }
 
 func TestDeleteAppCascadingThroughUser(t *testing.T) {
-	defer users.UserRepo.WipeDatabase()
-	assert.Nil(t, users.CreateAndValidateUser(tools.SampleForm))
-	assert.Nil(t, apps.AppRepo.CreateApp(tools.SampleUser, tools.SampleApp))
-	appId, err := apps.AppRepo.GetAppId(tools.SampleUser, tools.SampleApp)
-	assert.Nil(t, err)
-	assert.True(t, apps.AppRepo.DoesAppExist(appId))
-	assert.Nil(t, apps.AppRepo.DeleteApp(appId))
-	assert.False(t, apps.AppRepo.DoesAppExist(appId))
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+	appId, err := appRepo.GetAppId(tools.SampleUser, tools.SampleApp)
+	assert.Nil(t, err)
+	assert.True(t, appRepo.DoesAppExist(appId))
+	assert.Nil(t, appRepo.DeleteApp(appId))
+	assert.False(t, appRepo.DoesAppExist(appId))
 }
 
 func TestDeleteAppDirectly(t *testing.T) {
-	defer users.UserRepo.WipeDatabase()
-	assert.Nil(t, users.CreateAndValidateUser(tools.SampleForm))
-	assert.Nil(t, apps.AppRepo.CreateApp(tools.SampleUser, tools.SampleApp))
-	appId, err := apps.AppRepo.GetAppId(tools.SampleUser, tools.SampleApp)
-	assert.Nil(t, err)
-	assert.True(t, apps.AppRepo.DoesAppExist(appId))
-	assert.Nil(t, users.UserRepo.DeleteUser(tools.SampleUser))
-	assert.False(t, apps.AppRepo.DoesAppExist(appId))
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+	appId, err := appRepo.GetAppId(tools.SampleUser, tools.SampleApp)
+	assert.Nil(t, err)
+	assert.True(t, appRepo.DoesAppExist(appId))
+	assert.Nil(t, userRepo.DeleteUser(tools.SampleUser))
+	assert.False(t, appRepo.DoesAppExist(appId))
 }
 
 func TestTolerateSameAppsForTwoUsers(t *testing.T) {
-	defer users.UserRepo.WipeDatabase()
+	defer userRepo.WipeDatabase()
 	user2 := tools.SampleUser + "2"
-	assert.Nil(t, users.CreateAndValidateUser(tools.SampleForm))
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
 	newForm := *tools.SampleForm
 	newForm.User = user2
 	newForm.Email = tools.SampleEmail + "x"
-	assert.Nil(t, users.CreateAndValidateUser(&newForm))
-	assert.Nil(t, apps.AppRepo.CreateApp(tools.SampleUser, tools.SampleApp))
-	assert.Nil(t, apps.AppRepo.CreateApp(user2, tools.SampleApp))
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, &newForm))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+	assert.Nil(t, appRepo.CreateApp(user2, tools.SampleApp))
 
-	appId1, err := apps.AppRepo.GetAppId(tools.SampleUser, tools.SampleApp)
+	appId1, err := appRepo.GetAppId(tools.SampleUser, tools.SampleApp)
 	assert.Nil(t, err)
-	assert.True(t, apps.AppRepo.DoesAppExist(appId1))
-	appId2, err := apps.AppRepo.GetAppId(user2, tools.SampleApp)
+	assert.True(t, appRepo.DoesAppExist(appId1))
+	appId2, err := appRepo.GetAppId(user2, tools.SampleApp)
 	assert.Nil(t, err)
-	assert.True(t, apps.AppRepo.DoesAppExist(appId2))
+	assert.True(t, appRepo.DoesAppExist(appId2))
 
-	assert.Nil(t, apps.AppRepo.DeleteApp(appId1))
-	assert.False(t, apps.AppRepo.DoesAppExist(appId1))
-	assert.True(t, apps.AppRepo.DoesAppExist(appId2))
+	assert.Nil(t, appRepo.DeleteApp(appId1))
+	assert.False(t, appRepo.DoesAppExist(appId1))
+	assert.True(t, appRepo.DoesAppExist(appId2))
 }
 
 func TestSearchNegative(t *testing.T) {
-	defer users.UserRepo.WipeDatabase()
-	assert.Nil(t, users.CreateAndValidateUser(tools.SampleForm))
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
 	app := "prefix_myapp_suffix"
-	assert.Nil(t, apps.AppRepo.CreateApp(tools.SampleUser, app))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, app))
 
 	appSearchRequest := tools.AppSearchRequest{
 		SearchTerm:         "some",
 		ShowUnofficialApps: true,
 	}
-	a, err := apps.AppRepo.SearchForApps(appSearchRequest)
+	a, err := appRepo.SearchForApps(appSearchRequest)
 	assert.Nil(t, err)
 	assert.Equal(t, 0, len(a))
 }
 
 func TestSearchingWithEmptySearchTerm(t *testing.T) {
-	defer users.UserRepo.WipeDatabase()
+	defer userRepo.WipeDatabase()
 	emptySearchRequest := tools.AppSearchRequest{
 		SearchTerm:         "",
 		ShowUnofficialApps: true,
 	}
-	searchedApps, err := apps.AppRepo.SearchForApps(emptySearchRequest)
+	searchedApps, err := appRepo.SearchForApps(emptySearchRequest)
 	assert.Nil(t, err)
 	assert.Equal(t, 0, len(searchedApps))
 
-	assert.Nil(t, users.CreateAndValidateUser(tools.SampleForm))
-	assert.Nil(t, apps.AppRepo.CreateApp(tools.SampleUser, tools.SampleApp))
-	appId, err := apps.AppRepo.GetAppId(tools.SampleUser, tools.SampleApp)
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+	appId, err := appRepo.GetAppId(tools.SampleUser, tools.SampleApp)
 	assert.Nil(t, err)
-	assert.Nil(t, versions.VersionRepo.CreateVersion(appId, tools.SampleVersion, nil))
+	assert.Nil(t, versionRepo.CreateVersion(appId, tools.SampleVersion, nil, ""))
 
-	searchedApps, err = apps.AppRepo.SearchForApps(emptySearchRequest)
+	searchedApps, err = appRepo.SearchForApps(emptySearchRequest)
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(searchedApps))
 }
 
 func TestGetAppListRepo(t *testing.T) {
-	defer users.UserRepo.WipeDatabase()
-	assert.Nil(t, users.CreateAndValidateUser(tools.SampleForm))
-	list, err := apps.AppRepo.GetAppList(tools.SampleUser)
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	list, err := appRepo.GetAppList(tools.SampleUser)
 	assert.Nil(t, err)
 	assert.Equal(t, 0, len(list))
-	assert.Nil(t, apps.AppRepo.CreateApp(tools.SampleUser, tools.SampleApp))
-	assert.Nil(t, apps.AppRepo.CreateApp(tools.SampleUser, tools.SampleApp+"x"))
-	list, err = apps.AppRepo.GetAppList(tools.SampleUser)
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp+"x"))
+	list, err = appRepo.GetAppList(tools.SampleUser)
 	assert.Nil(t, err)
 	assert.Equal(t, 2, len(list))
 	assert.Equal(t, tools.SampleApp, list[0].Name)
@@ -127,43 +170,88 @@ func TestGetAppListRepo(t *testing.T) {
 }
 
 func TestIsAppOwner(t *testing.T) {
-	defer users.UserRepo.WipeDatabase()
-	assert.Nil(t, users.CreateAndValidateUser(tools.SampleForm))
-	assert.False(t, apps.AppRepo.IsAppOwner(tools.SampleUser, 1))
-	assert.Nil(t, apps.AppRepo.CreateApp(tools.SampleUser, tools.SampleApp))
-	appId, err := apps.AppRepo.GetAppId(tools.SampleUser, tools.SampleApp)
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	assert.False(t, appRepo.IsAppOwner(tools.SampleUser, 1))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+	appId, err := appRepo.GetAppId(tools.SampleUser, tools.SampleApp)
 	assert.Nil(t, err)
-	assert.True(t, apps.AppRepo.IsAppOwner(tools.SampleUser, appId))
+	assert.True(t, appRepo.IsAppOwner(tools.SampleUser, appId))
 
 	sampleForm2 := *tools.SampleForm
 	sampleForm2.User = tools.SampleUser + "2"
 	sampleForm2.Email = tools.SampleEmail + "x"
-	assert.Nil(t, users.CreateAndValidateUser(&sampleForm2))
-	assert.Nil(t, apps.AppRepo.CreateApp(tools.SampleUser+"2", tools.SampleApp))
-	assert.False(t, apps.AppRepo.IsAppOwner(tools.SampleUser+"2", appId))
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, &sampleForm2))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser+"2", tools.SampleApp))
+	assert.False(t, appRepo.IsAppOwner(tools.SampleUser+"2", appId))
 
-	assert.False(t, apps.AppRepo.IsAppOwner("notExistingUser", appId))
+	assert.False(t, appRepo.IsAppOwner("notExistingUser", appId))
 }
 
 func TestGetAppName(t *testing.T) {
-	defer users.UserRepo.WipeDatabase()
-	assert.Nil(t, users.CreateAndValidateUser(tools.SampleForm))
-	assert.Nil(t, apps.AppRepo.CreateApp(tools.SampleUser, tools.SampleApp))
-	appId, err := apps.AppRepo.GetAppId(tools.SampleUser, tools.SampleApp)
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+	appId, err := appRepo.GetAppId(tools.SampleUser, tools.SampleApp)
 	assert.Nil(t, err)
-	name, err := apps.AppRepo.GetAppName(appId)
+	name, err := appRepo.GetAppName(appId)
 	assert.Nil(t, err)
 	assert.Equal(t, tools.SampleApp, name)
 }
 
 func TestCantCreateAppTwiceForSameUser(t *testing.T) {
-	defer users.UserRepo.WipeDatabase()
-	assert.Nil(t, users.CreateAndValidateUser(tools.SampleForm))
-	assert.Nil(t, apps.AppRepo.CreateApp(tools.SampleUser, tools.SampleApp))
-	assert.NotNil(t, apps.AppRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+	assert.NotNil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp))
 }
 
 func TestCantCreateAppWithoutUser(t *testing.T) {
-	defer users.UserRepo.WipeDatabase()
-	assert.NotNil(t, apps.AppRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+	defer userRepo.WipeDatabase()
+	assert.NotNil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+}
+
+func TestGetAppWithLatestVersion(t *testing.T) {
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+	appId, err := appRepo.GetAppId(tools.SampleUser, tools.SampleApp)
+	assert.Nil(t, err)
+
+	app, err := appRepo.GetAppWithLatestVersion(appId)
+	assert.Nil(t, err)
+	assert.Equal(t, tools.SampleUser, app.Maintainer)
+	assert.Equal(t, tools.SampleApp, app.AppName)
+	assert.Equal(t, "", app.LatestVersionId)
+	assert.Equal(t, "", app.LatestVersionName)
+
+	assert.Nil(t, versionRepo.CreateVersion(appId, tools.SampleVersion, []byte("asdf"), ""))
+	versionId, err := versionRepo.GetVersionId(appId, tools.SampleVersion)
+	assert.Nil(t, err)
+	app, err = appRepo.GetAppWithLatestVersion(appId)
+	assert.Nil(t, err)
+	assert.Equal(t, strconv.Itoa(versionId), app.LatestVersionId)
+	assert.Equal(t, tools.SampleVersion, app.LatestVersionName)
+
+	_, err = appRepo.GetAppWithLatestVersion(-1)
+	assert.NotNil(t, err)
+}
+
+func TestCountUsersAppsAndVersions(t *testing.T) {
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+	appId, err := appRepo.GetAppId(tools.SampleUser, tools.SampleApp)
+	assert.Nil(t, err)
+	assert.Nil(t, versionRepo.CreateVersion(appId, tools.SampleVersion, []byte("hello"), ""))
+
+	userCount, err := userRepo.CountUsers()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, userCount)
+	appCount, err := appRepo.CountApps()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, appCount)
+	versionCount, err := versionRepo.CountVersions()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, versionCount)
 }
@@ -3,128 +3,131 @@
 package check
 
 import (
+	"errors"
 	"github.com/ocelot-cloud/shared/assert"
 	"github.com/ocelot-cloud/shared/utils"
-	"ocelot/store/apps"
 	"ocelot/store/tools"
 	"ocelot/store/users"
 	"ocelot/store/versions"
 	"regexp"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
 func TestCreateRepoUser(t *testing.T) {
-	defer users.UserRepo.WipeDatabase()
-	assert.False(t, users.UserRepo.DoesUserExist(tools.SampleUser))
-	assert.Nil(t, users.CreateAndValidateUser(tools.SampleForm))
-	assert.True(t, users.UserRepo.DoesUserExist(tools.SampleUser))
+	defer userRepo.WipeDatabase()
+	assert.False(t, userRepo.DoesUserExist(tools.SampleUser))
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	assert.True(t, userRepo.DoesUserExist(tools.SampleUser))
 
-	assert.Nil(t, users.UserRepo.DeleteUser(tools.SampleUser))
-	assert.False(t, users.UserRepo.DoesUserExist(tools.SampleUser))
+	assert.Nil(t, userRepo.DeleteUser(tools.SampleUser))
+	assert.False(t, userRepo.DoesUserExist(tools.SampleUser))
 }
 
 func TestCantCreateUserTwice(t *testing.T) {
-	defer users.UserRepo.WipeDatabase()
-	assert.Nil(t, users.CreateAndValidateUser(tools.SampleForm))
-	assert.NotNil(t, users.CreateAndValidateUser(tools.SampleForm))
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	assert.NotNil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
 }
 
 func TestTolerateSamePasswordForTwoUsers(t *testing.T) {
-	defer users.UserRepo.WipeDatabase()
+	defer userRepo.WipeDatabase()
 	user2 := tools.SampleUser + "2"
-	assert.Nil(t, users.CreateAndValidateUser(tools.SampleForm))
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
 	newForm := *tools.SampleForm
 	newForm.User = user2
 	newForm.Email = tools.SampleEmail + "x"
-	assert.Nil(t, users.CreateAndValidateUser(&newForm))
-	assert.True(t, users.UserRepo.IsPasswordCorrect(tools.SampleUser, tools.SamplePassword))
-	assert.True(t, users.UserRepo.IsPasswordCorrect(user2, tools.SamplePassword))
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, &newForm))
+	assert.True(t, userRepo.IsPasswordCorrect(tools.SampleUser, tools.SamplePassword))
+	assert.True(t, userRepo.IsPasswordCorrect(user2, tools.SamplePassword))
 }
 
 func TestPasswordVerification(t *testing.T) {
-	defer users.UserRepo.WipeDatabase()
-	assert.Nil(t, users.CreateAndValidateUser(tools.SampleForm))
-	assert.True(t, users.UserRepo.IsPasswordCorrect(tools.SampleUser, tools.SamplePassword))
-	assert.False(t, users.UserRepo.IsPasswordCorrect(tools.SampleUser, tools.SamplePassword+"x"))
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	assert.True(t, userRepo.IsPasswordCorrect(tools.SampleUser, tools.SamplePassword))
+	assert.False(t, userRepo.IsPasswordCorrect(tools.SampleUser, tools.SamplePassword+"x"))
 }
 
 func TestCookieExpiration(t *testing.T) {
-	defer users.UserRepo.WipeDatabase()
-	assert.Nil(t, users.CreateAndValidateUser(tools.SampleForm))
-	_, err := users.UserRepo.GetUserViaCookie("")
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	_, err := userRepo.GetUserViaCookie("")
 	assert.NotNil(t, err)
 
-	assert.True(t, users.UserRepo.IsCookieExpired("non-existing-cookie"))
+	assert.True(t, userRepo.IsCookieExpired("non-existing-cookie"))
 
 	timeIn30Days := utils.GetTimeIn30Days()
 	cookie, _ := utils.GenerateCookie()
-	assert.Nil(t, users.UserRepo.HashAndSaveCookie(tools.SampleUser, cookie.Value, timeIn30Days))
-	assert.False(t, users.UserRepo.IsCookieExpired(cookie.Value))
+	assert.Nil(t, userRepo.HashAndSaveCookie(tools.SampleUser, cookie.Value, timeIn30Days))
+	assert.False(t, userRepo.IsCookieExpired(cookie.Value))
 
 	past := time.Now().Add(-1 * time.Second)
-	assert.Nil(t, users.UserRepo.HashAndSaveCookie(tools.SampleUser, cookie.Value, past))
-	assert.True(t, users.UserRepo.IsCookieExpired(cookie.Value))
+	assert.Nil(t, userRepo.HashAndSaveCookie(tools.SampleUser, cookie.Value, past))
+	assert.True(t, userRepo.IsCookieExpired(cookie.Value))
 
-	user, err := users.UserRepo.GetUserViaCookie(cookie.Value)
+	user, err := userRepo.GetUserViaCookie(cookie.Value)
 	assert.Nil(t, err)
 	assert.Equal(t, tools.SampleUser, user)
 }
 
 func TestChangeRepoPassword(t *testing.T) {
-	defer users.UserRepo.WipeDatabase()
-	assert.Nil(t, users.CreateAndValidateUser(tools.SampleForm))
-	assert.True(t, users.UserRepo.IsPasswordCorrect(tools.SampleUser, tools.SamplePassword))
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	assert.True(t, userRepo.IsPasswordCorrect(tools.SampleUser, tools.SamplePassword))
 	newPassword := tools.SamplePassword + "x"
-	assert.Nil(t, users.UserRepo.ChangePassword(tools.SampleUser, newPassword))
-	assert.False(t, users.UserRepo.IsPasswordCorrect(tools.SampleUser, tools.SampleForm.Password))
-	assert.True(t, users.UserRepo.IsPasswordCorrect(tools.SampleUser, newPassword))
+	assert.Nil(t, userRepo.ChangePassword(tools.SampleUser, newPassword))
+	assert.False(t, userRepo.IsPasswordCorrect(tools.SampleUser, tools.SampleForm.Password))
+	assert.True(t, userRepo.IsPasswordCorrect(tools.SampleUser, newPassword))
 }
 
 func TestRepoLogout(t *testing.T) {
-	defer users.UserRepo.WipeDatabase()
-	assert.Nil(t, users.CreateAndValidateUser(tools.SampleForm))
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
 	sampleCookie := "asdasdasd"
-	err := users.UserRepo.HashAndSaveCookie(tools.SampleUser, sampleCookie, time.Now().Add(1*time.Hour))
+	err := userRepo.HashAndSaveCookie(tools.SampleUser, sampleCookie, time.Now().Add(1*time.Hour))
 	assert.Nil(t, err)
-	assert.False(t, users.UserRepo.IsCookieExpired(sampleCookie))
-	assert.Nil(t, users.UserRepo.Logout(tools.SampleUser))
-	assert.True(t, users.UserRepo.IsCookieExpired(sampleCookie))
+	assert.False(t, userRepo.IsCookieExpired(sampleCookie))
+	assert.Nil(t, userRepo.Logout(tools.SampleUser))
+	assert.True(t, userRepo.IsCookieExpired(sampleCookie))
 }
 
 func TestEmailDuringUserCreation(t *testing.T) {
-	defer users.UserRepo.WipeDatabase()
-	assert.False(t, users.UserRepo.DoesEmailExist(tools.SampleEmail))
-	assert.Nil(t, users.CreateAndValidateUser(tools.SampleForm))
-	assert.True(t, users.UserRepo.DoesEmailExist(tools.SampleEmail))
+	defer userRepo.WipeDatabase()
+	assert.False(t, userRepo.DoesEmailExist(tools.SampleEmail))
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	assert.True(t, userRepo.DoesEmailExist(tools.SampleEmail))
 
 	newForm := *tools.SampleForm
 	newForm.User = tools.SampleUser + "x"
-	code, err := users.UserRepo.CreateUser(&newForm)
+	code, err := userRepo.CreateUser(&newForm)
 	assert.Nil(t, err)
-	assert.NotNil(t, users.UserRepo.ValidateUser(code))
-	assert.False(t, users.UserRepo.DoesUserExist(tools.SampleUser+"x"))
+	assert.NotNil(t, userRepo.ValidateUser(code))
+	assert.False(t, userRepo.DoesUserExist(tools.SampleUser+"x"))
 
 	newForm.Email = tools.SampleEmail + "x"
-	code, err = users.UserRepo.CreateUser(&newForm)
+	code, err = userRepo.CreateUser(&newForm)
 	assert.Nil(t, err)
-	assert.Nil(t, users.UserRepo.ValidateUser(code))
-	assert.True(t, users.UserRepo.DoesUserExist(tools.SampleUser+"x"))
+	assert.Nil(t, userRepo.ValidateUser(code))
+	assert.True(t, userRepo.DoesUserExist(tools.SampleUser+"x"))
 }
 
 func TestValidationCode(t *testing.T) {
-	defer users.UserRepo.WipeDatabase()
-	code, err := users.UserRepo.CreateUser(tools.SampleForm)
+	defer userRepo.WipeDatabase()
+	code, err := userRepo.CreateUser(tools.SampleForm)
 	assert.Nil(t, err)
 	assert.Equal(t, 64, len(code))
 	assert.True(t, consistOfHexadecimalCharactersOnly(code))
 
-	assert.False(t, users.UserRepo.DoesUserExist(tools.SampleUser))
-	err = users.UserRepo.ValidateUser(code)
+	assert.False(t, userRepo.DoesUserExist(tools.SampleUser))
+	err = userRepo.ValidateUser(code)
 	assert.Nil(t, err)
-	assert.True(t, users.UserRepo.DoesUserExist(tools.SampleUser))
+	assert.True(t, userRepo.DoesUserExist(tools.SampleUser))
 
-	err = users.UserRepo.ValidateUser(code)
+	err = userRepo.ValidateUser(code)
 	assert.NotNil(t, err)
 	assert.Equal(t, "code not found", err.Error())
 }
@@ -134,62 +137,195 @@ func consistOfHexadecimalCharactersOnly(code string) bool {
 }
 
 func TestSpace(t *testing.T) {
-	defer users.UserRepo.WipeDatabase()
-	assert.Nil(t, users.CreateAndValidateUser(tools.SampleForm))
-	assert.Nil(t, apps.AppRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp))
 
 	tenMegaBytes := 10 * 1024 * 1024
-	assert.Nil(t, users.UserRepo.IsThereEnoughSpaceToAddVersion(tools.SampleUser, tenMegaBytes))
-	assert.NotNil(t, users.UserRepo.IsThereEnoughSpaceToAddVersion(tools.SampleUser, tenMegaBytes+1))
+	assert.Nil(t, userRepo.IsThereEnoughSpaceToAddVersion(tools.SampleUser, tenMegaBytes))
+	assert.NotNil(t, userRepo.IsThereEnoughSpaceToAddVersion(tools.SampleUser, tenMegaBytes+1))
 
-	appId, err := apps.AppRepo.GetAppId(tools.SampleUser, tools.SampleApp)
+	appId, err := appRepo.GetAppId(tools.SampleUser, tools.SampleApp)
 	assert.Nil(t, err)
 	oneKiloByte := 1024
 	randomBytes := make([]byte, oneKiloByte)
 	assert.Nil(t, err)
-	assert.Nil(t, versions.VersionRepo.CreateVersion(appId, "version", randomBytes))
+	assert.Nil(t, versionRepo.CreateVersion(appId, "version", randomBytes, ""))
 
-	assert.Nil(t, users.UserRepo.IsThereEnoughSpaceToAddVersion(tools.SampleUser, tenMegaBytes-oneKiloByte))
-	assert.NotNil(t, users.UserRepo.IsThereEnoughSpaceToAddVersion(tools.SampleUser, tenMegaBytes-oneKiloByte+1))
+	assert.Nil(t, userRepo.IsThereEnoughSpaceToAddVersion(tools.SampleUser, tenMegaBytes-oneKiloByte))
+	assert.NotNil(t, userRepo.IsThereEnoughSpaceToAddVersion(tools.SampleUser, tenMegaBytes-oneKiloByte+1))
 }
 
 func TestUsedSpace(t *testing.T) {
-	defer users.UserRepo.WipeDatabase()
-	assert.Nil(t, users.CreateAndValidateUser(tools.SampleForm))
-	space, err := users.UserRepo.GetUsedSpaceInBytes(tools.SampleUser)
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	space, err := userRepo.GetUsedSpaceInBytes(tools.SampleUser)
 	assert.Nil(t, err)
 	assert.Equal(t, 0, space)
 
-	assert.Nil(t, apps.AppRepo.CreateApp(tools.SampleUser, tools.SampleApp))
-	appId, err := apps.AppRepo.GetAppId(tools.SampleUser, tools.SampleApp)
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+	appId, err := appRepo.GetAppId(tools.SampleUser, tools.SampleApp)
 	assert.Nil(t, err)
 
 	bytes := []byte("hello")
 	bytes2 := []byte(" world")
-	assert.Nil(t, versions.VersionRepo.CreateVersion(appId, tools.SampleVersion, bytes))
-	space, err = users.UserRepo.GetUsedSpaceInBytes(tools.SampleUser)
+	assert.Nil(t, versionRepo.CreateVersion(appId, tools.SampleVersion, bytes, ""))
+	space, err = userRepo.GetUsedSpaceInBytes(tools.SampleUser)
 	assert.Nil(t, err)
 	assert.Equal(t, 5, space)
 
-	assert.Nil(t, versions.VersionRepo.CreateVersion(appId, tools.SampleVersion+"x", bytes2))
-	space, err = users.UserRepo.GetUsedSpaceInBytes(tools.SampleUser)
+	assert.Nil(t, versionRepo.CreateVersion(appId, tools.SampleVersion+"x", bytes2, ""))
+	space, err = userRepo.GetUsedSpaceInBytes(tools.SampleUser)
 	assert.Nil(t, err)
 	assert.Equal(t, 11, space)
 
-	versionId, err := versions.VersionRepo.GetVersionId(appId, tools.SampleVersion)
+	versionId, err := versionRepo.GetVersionId(appId, tools.SampleVersion)
 	assert.Nil(t, err)
-	assert.Nil(t, versions.VersionRepo.DeleteVersion(versionId))
-	space, err = users.UserRepo.GetUsedSpaceInBytes(tools.SampleUser)
+	assert.Nil(t, versionRepo.DeleteVersion(versionId))
+	space, err = userRepo.GetUsedSpaceInBytes(tools.SampleUser)
 	assert.Nil(t, err)
 	assert.Equal(t, 6, space)
 
-	assert.Nil(t, versions.VersionRepo.CreateVersion(appId, tools.SampleVersion, bytes2))
-	space, err = users.UserRepo.GetUsedSpaceInBytes(tools.SampleUser)
+	assert.Nil(t, versionRepo.CreateVersion(appId, tools.SampleVersion, bytes2, ""))
+	space, err = userRepo.GetUsedSpaceInBytes(tools.SampleUser)
 	assert.Nil(t, err)
 	assert.Equal(t, 12, space)
 
-	assert.Nil(t, apps.AppRepo.DeleteApp(appId))
-	space, err = users.UserRepo.GetUsedSpaceInBytes(tools.SampleUser)
+	assert.Nil(t, appRepo.DeleteApp(appId))
+	space, err = userRepo.GetUsedSpaceInBytes(tools.SampleUser)
 	assert.Nil(t, err)
 	assert.Equal(t, 0, space)
 }
+
+func TestCreateVersionRejectsContentExceedingQuota(t *testing.T) {
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+	appId, err := appRepo.GetAppId(tools.SampleUser, tools.SampleApp)
+	assert.Nil(t, err)
+
+	assert.Nil(t, versionRepo.CreateVersion(appId, tools.SampleVersion, make([]byte, testConfig.Quota.DefaultStorageLimit), ""))
+	err = versionRepo.CreateVersion(appId, tools.SampleVersion+"x", []byte("a"), "")
+	var quotaErr *users.QuotaExceededError
+	assert.True(t, errors.As(err, &quotaErr))
+	assert.Equal(t, testConfig.Quota.DefaultStorageLimit, quotaErr.UsedBytes)
+	assert.Equal(t, 1, quotaErr.RequestedBytes)
+
+	foundVersions, err := versionRepo.GetVersionList(appId)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(foundVersions))
+	space, err := userRepo.GetUsedSpaceInBytes(tools.SampleUser)
+	assert.Nil(t, err)
+	assert.Equal(t, testConfig.Quota.DefaultStorageLimit, space)
+}
+
+func TestConcurrentUploadsRespectQuota(t *testing.T) {
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+	appId, err := appRepo.GetAppId(tools.SampleUser, tools.SampleApp)
+	assert.Nil(t, err)
+
+	versionSize := 2 * testConfig.Quota.MaxPayloadSize
+	uploads := 10
+	var successes atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < uploads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if versionRepo.CreateVersion(appId, "v"+strconv.Itoa(i), make([]byte, versionSize), "") == nil {
+				successes.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	expectedSuccesses := testConfig.Quota.DefaultStorageLimit / versionSize
+	assert.Equal(t, expectedSuccesses, int(successes.Load()))
+	space, err := userRepo.GetUsedSpaceInBytes(tools.SampleUser)
+	assert.Nil(t, err)
+	assert.Equal(t, expectedSuccesses*versionSize, space)
+}
+
+func TestReconcileUsedSpace(t *testing.T) {
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+	appId, err := appRepo.GetAppId(tools.SampleUser, tools.SampleApp)
+	assert.Nil(t, err)
+	assert.Nil(t, versionRepo.CreateVersion(appId, tools.SampleVersion, []byte("hello"), ""))
+
+	corrected, err := userRepo.ReconcileUsedSpace()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, corrected)
+
+	_, err = testDb.Exec("UPDATE users SET used_space = 12345 WHERE user_name = $1", tools.SampleUser)
+	assert.Nil(t, err)
+	corrected, err = userRepo.ReconcileUsedSpace()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, corrected)
+	space, err := userRepo.GetUsedSpaceInBytes(tools.SampleUser)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, space)
+}
+
+func TestStorageLimitOfUser(t *testing.T) {
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	storageLimit, err := userRepo.GetStorageLimitInBytes(tools.SampleUser)
+	assert.Nil(t, err)
+	assert.Equal(t, testConfig.Quota.DefaultStorageLimit, storageLimit)
+
+	raisedLimit := 2 * testConfig.Quota.DefaultStorageLimit
+	assert.Nil(t, userRepo.SetStorageLimit(tools.SampleUser, &raisedLimit))
+	storageLimit, err = userRepo.GetStorageLimitInBytes(tools.SampleUser)
+	assert.Nil(t, err)
+	assert.Equal(t, raisedLimit, storageLimit)
+	assert.Nil(t, userRepo.IsThereEnoughSpaceToAddVersion(tools.SampleUser, raisedLimit))
+	assert.NotNil(t, userRepo.IsThereEnoughSpaceToAddVersion(tools.SampleUser, raisedLimit+1))
+
+	assert.Nil(t, userRepo.SetStorageLimit(tools.SampleUser, nil))
+	storageLimit, err = userRepo.GetStorageLimitInBytes(tools.SampleUser)
+	assert.Nil(t, err)
+	assert.Equal(t, testConfig.Quota.DefaultStorageLimit, storageLimit)
+
+	assert.Equal(t, tools.ErrUserNotFound, userRepo.SetStorageLimit("notexisting", &raisedLimit))
+}
+
+func TestAppQuotas(t *testing.T) {
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+	appId, err := appRepo.GetAppId(tools.SampleUser, tools.SampleApp)
+	assert.Nil(t, err)
+
+	storageLimit := 10
+	assert.Nil(t, appRepo.SetAppQuota(appId, &storageLimit, nil))
+	assert.Nil(t, versionRepo.CreateVersion(appId, "v1", []byte("hello"), ""))
+	err = versionRepo.CreateVersion(appId, "v2", []byte("world!"), "")
+	var quotaErr *users.QuotaExceededError
+	assert.True(t, errors.As(err, &quotaErr))
+	assert.Equal(t, users.QuotaScopeApp, quotaErr.Scope)
+	assert.Equal(t, 5, quotaErr.UsedBytes)
+	assert.Equal(t, storageLimit, quotaErr.LimitBytes)
+
+	maxVersions := 2
+	assert.Nil(t, appRepo.SetAppQuota(appId, nil, &maxVersions))
+	assert.Nil(t, versionRepo.CreateVersion(appId, "v2", []byte("world!"), ""))
+	err = versionRepo.CreateVersion(appId, "v3", []byte("a"), "")
+	var versionLimitErr *versions.VersionLimitExceededError
+	assert.True(t, errors.As(err, &versionLimitErr))
+	assert.Equal(t, 2, versionLimitErr.VersionCount)
+
+	quota, err := userRepo.GetQuota(tools.SampleUser)
+	assert.Nil(t, err)
+	assert.Equal(t, 11, quota.UsedBytes)
+	assert.Equal(t, 1, len(quota.Apps))
+	assert.Equal(t, 11, quota.Apps[0].UsedBytes)
+	assert.Equal(t, 2, quota.Apps[0].VersionCount)
+	assert.Nil(t, quota.Apps[0].StorageLimitBytes)
+	assert.Equal(t, maxVersions, *quota.Apps[0].MaxVersions)
+
+	assert.Equal(t, tools.ErrAppNotFound, appRepo.SetAppQuota(appId+1000, nil, nil))
+}
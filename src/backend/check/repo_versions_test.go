@@ -3,8 +3,10 @@
 package check
 
 import (
+	"errors"
 	"github.com/ocelot-cloud/shared/assert"
 	"ocelot/store/apps"
+	"ocelot/store/memory"
 	"ocelot/store/tools"
 	"ocelot/store/users"
 	"ocelot/store/versions"
@@ -15,16 +17,16 @@ import (
 )
 
 func TestCreateRepoVersion(t *testing.T) {
-	defer users.UserRepo.WipeDatabase()
-	assert.Nil(t, users.CreateAndValidateUser(tools.SampleForm))
-	assert.Nil(t, apps.AppRepo.CreateApp(tools.SampleUser, tools.SampleApp))
-	appId, err := apps.AppRepo.GetAppId(tools.SampleUser, tools.SampleApp)
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+	appId, err := appRepo.GetAppId(tools.SampleUser, tools.SampleApp)
 	assert.Nil(t, err)
-	assert.Nil(t, versions.VersionRepo.CreateVersion(appId, tools.SampleVersion, []byte("asdf")))
-	versionId, err := versions.VersionRepo.GetVersionId(appId, tools.SampleVersion)
+	assert.Nil(t, versionRepo.CreateVersion(appId, tools.SampleVersion, []byte("asdf"), ""))
+	versionId, err := versionRepo.GetVersionId(appId, tools.SampleVersion)
 	assert.Nil(t, err)
-	assert.True(t, versions.VersionRepo.DoesVersionExist(versionId))
-	versions, err := versions.VersionRepo.GetVersionList(appId)
+	assert.True(t, versionRepo.DoesVersionExist(versionId))
+	versions, err := versionRepo.GetVersionList(appId)
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(versions))
 	version := versions[0]
@@ -35,125 +37,127 @@ func TestCreateRepoVersion(t *testing.T) {
 }
 
 func TestGetVersionList(t *testing.T) {
-	defer users.UserRepo.WipeDatabase()
-	assert.Nil(t, users.CreateAndValidateUser(tools.SampleForm))
-	assert.Nil(t, apps.AppRepo.CreateApp(tools.SampleUser, tools.SampleApp))
-	appId, err := apps.AppRepo.GetAppId(tools.SampleUser, tools.SampleApp)
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+	appId, err := appRepo.GetAppId(tools.SampleUser, tools.SampleApp)
 	assert.Nil(t, err)
-	foundVersions, err := versions.VersionRepo.GetVersionList(appId)
+	foundVersions, err := versionRepo.GetVersionList(appId)
 	assert.Nil(t, err)
 	assert.Equal(t, 0, len(foundVersions))
-	versionId, err := versions.VersionRepo.GetVersionId(appId, tools.SampleVersion)
+	versionId, err := versionRepo.GetVersionId(appId, tools.SampleVersion)
 	assert.NotNil(t, err)
-	assert.False(t, versions.VersionRepo.DoesVersionExist(versionId))
+	assert.False(t, versionRepo.DoesVersionExist(versionId))
 
-	assert.Nil(t, versions.VersionRepo.CreateVersion(appId, tools.SampleVersion, []byte("asdf")))
-	foundVersions, err = versions.VersionRepo.GetVersionList(appId)
+	assert.Nil(t, versionRepo.CreateVersion(appId, tools.SampleVersion, []byte("asdf"), ""))
+	foundVersions, err = versionRepo.GetVersionList(appId)
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(foundVersions))
 	assert.Equal(t, tools.SampleVersion, foundVersions[0].Name)
-	versionId, err = versions.VersionRepo.GetVersionId(appId, tools.SampleVersion)
+	versionId, err = versionRepo.GetVersionId(appId, tools.SampleVersion)
 	assert.Nil(t, err)
-	assert.True(t, versions.VersionRepo.DoesVersionExist(versionId))
-	data, err := versions.VersionRepo.GetVersionContent(versionId)
+	assert.True(t, versionRepo.DoesVersionExist(versionId))
+	data, err := versionRepo.GetVersionContent(versionId)
 	assert.Nil(t, err)
 	assert.Equal(t, []byte("asdf"), data)
 	assert.True(t, foundVersions[0].CreationTimestamp.Before(time.Now().UTC()))
 	assert.True(t, foundVersions[0].CreationTimestamp.After(time.Now().UTC().Add(-1*time.Second)))
 
-	assert.Nil(t, versions.VersionRepo.DeleteVersion(versionId))
-	foundVersions, err = versions.VersionRepo.GetVersionList(appId)
+	assert.Nil(t, versionRepo.DeleteVersion(versionId))
+	foundVersions, err = versionRepo.GetVersionList(appId)
 	assert.Nil(t, err)
 	assert.Equal(t, 0, len(foundVersions))
-	assert.False(t, versions.VersionRepo.DoesVersionExist(versionId))
+	assert.False(t, versionRepo.DoesVersionExist(versionId))
 
-	assert.Nil(t, versions.VersionRepo.CreateVersion(appId, tools.SampleVersion, []byte("asdf")))
-	foundVersions, err = versions.VersionRepo.GetVersionList(appId)
+	assert.Nil(t, versionRepo.CreateVersion(appId, tools.SampleVersion, []byte("asdf"), ""))
+	foundVersions, err = versionRepo.GetVersionList(appId)
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(foundVersions))
 	assert.Equal(t, tools.SampleVersion, foundVersions[0].Name)
-	versionId, err = versions.VersionRepo.GetVersionId(appId, tools.SampleVersion)
+	versionId, err = versionRepo.GetVersionId(appId, tools.SampleVersion)
 	assert.Nil(t, err)
-	assert.True(t, versions.VersionRepo.DoesVersionExist(versionId))
+	assert.True(t, versionRepo.DoesVersionExist(versionId))
 }
 
 func TestGetVersionListForNonExistingVersions(t *testing.T) {
-	list, err := versions.VersionRepo.GetVersionList(-1)
+	list, err := versionRepo.GetVersionList(-1)
 	assert.NotNil(t, err)
 	assert.Nil(t, list)
 }
 
 func TestAppIdConsistency(t *testing.T) {
-	defer users.UserRepo.WipeDatabase()
-	assert.Nil(t, users.CreateAndValidateUser(tools.SampleForm))
-	assert.Nil(t, apps.AppRepo.CreateApp(tools.SampleUser, tools.SampleApp))
-	appId, err := apps.AppRepo.GetAppId(tools.SampleUser, tools.SampleApp)
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+	appId, err := appRepo.GetAppId(tools.SampleUser, tools.SampleApp)
 	assert.Nil(t, err)
-	assert.Nil(t, versions.VersionRepo.CreateVersion(appId, tools.SampleVersion, []byte("asdf")))
-	versionId, err := versions.VersionRepo.GetVersionId(appId, tools.SampleVersion)
+	assert.Nil(t, versionRepo.CreateVersion(appId, tools.SampleVersion, []byte("asdf"), ""))
+	versionId, err := versionRepo.GetVersionId(appId, tools.SampleVersion)
 	assert.Nil(t, err)
 
-	appList, err := apps.AppRepo.GetAppList(tools.SampleUser)
+	appList, err := appRepo.GetAppList(tools.SampleUser)
 	assert.Nil(t, err)
 	assert.Equal(t, strconv.Itoa(appId), appList[0].Id)
 
-	versionList, err := versions.VersionRepo.GetVersionList(appId)
+	versionList, err := versionRepo.GetVersionList(appId)
 	assert.Nil(t, err)
 	assert.Equal(t, strconv.Itoa(versionId), versionList[0].Id)
 }
 
 func TestIsVersionOwner(t *testing.T) {
-	defer users.UserRepo.WipeDatabase()
-	assert.Nil(t, users.CreateAndValidateUser(tools.SampleForm))
-	assert.False(t, versions.VersionRepo.IsVersionOwner(tools.SampleUser, 1))
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	assert.False(t, versionRepo.IsVersionOwner(tools.SampleUser, 1))
 
-	assert.Nil(t, apps.AppRepo.CreateApp(tools.SampleUser, tools.SampleApp))
-	appId, err := apps.AppRepo.GetAppId(tools.SampleUser, tools.SampleApp)
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+	appId, err := appRepo.GetAppId(tools.SampleUser, tools.SampleApp)
 	assert.Nil(t, err)
-	assert.False(t, versions.VersionRepo.IsVersionOwner(tools.SampleUser, 1))
+	assert.False(t, versionRepo.IsVersionOwner(tools.SampleUser, 1))
 
-	assert.Nil(t, versions.VersionRepo.CreateVersion(appId, tools.SampleVersion, []byte("asdf")))
-	versionId, err := versions.VersionRepo.GetVersionId(appId, tools.SampleVersion)
+	assert.Nil(t, versionRepo.CreateVersion(appId, tools.SampleVersion, []byte("asdf"), ""))
+	versionId, err := versionRepo.GetVersionId(appId, tools.SampleVersion)
 	assert.Nil(t, err)
-	assert.True(t, versions.VersionRepo.IsVersionOwner(tools.SampleUser, versionId))
+	assert.True(t, versionRepo.IsVersionOwner(tools.SampleUser, versionId))
 
 	sampleForm2 := *tools.SampleForm
 	sampleForm2.User = tools.SampleUser + "2"
 	sampleForm2.Email = tools.SampleEmail + "2"
-	assert.Nil(t, users.CreateAndValidateUser(&sampleForm2))
-	assert.Nil(t, apps.AppRepo.CreateApp(tools.SampleUser+"2", tools.SampleApp))
-	assert.Nil(t, versions.VersionRepo.CreateVersion(appId, tools.SampleVersion, []byte("asdf")))
-	assert.False(t, versions.VersionRepo.IsVersionOwner(tools.SampleUser+"2", appId))
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, &sampleForm2))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser+"2", tools.SampleApp))
+	appId2, err := appRepo.GetAppId(tools.SampleUser+"2", tools.SampleApp)
+	assert.Nil(t, err)
+	assert.Nil(t, versionRepo.CreateVersion(appId2, tools.SampleVersion, []byte("asdf"), ""))
+	assert.False(t, versionRepo.IsVersionOwner(tools.SampleUser+"2", versionId))
 
-	assert.False(t, versions.VersionRepo.IsVersionOwner("notExistingUser", versionId))
+	assert.False(t, versionRepo.IsVersionOwner("notExistingUser", versionId))
 }
 
 func TestGetAppIdByVersionId(t *testing.T) {
-	defer users.UserRepo.WipeDatabase()
-	assert.Nil(t, users.CreateAndValidateUser(tools.SampleForm))
-	assert.Nil(t, apps.AppRepo.CreateApp(tools.SampleUser, tools.SampleApp))
-	expectedAppId, err := apps.AppRepo.GetAppId(tools.SampleUser, tools.SampleApp)
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+	expectedAppId, err := appRepo.GetAppId(tools.SampleUser, tools.SampleApp)
 	assert.Nil(t, err)
-	assert.Nil(t, versions.VersionRepo.CreateVersion(expectedAppId, tools.SampleVersion, []byte("asdf")))
-	versionId, err := versions.VersionRepo.GetVersionId(expectedAppId, tools.SampleVersion)
+	assert.Nil(t, versionRepo.CreateVersion(expectedAppId, tools.SampleVersion, []byte("asdf"), ""))
+	versionId, err := versionRepo.GetVersionId(expectedAppId, tools.SampleVersion)
 	assert.Nil(t, err)
 
-	actualAppId, err := versions.VersionRepo.GetAppIdByVersionId(versionId)
+	actualAppId, err := versionRepo.GetAppIdByVersionId(versionId)
 	assert.Nil(t, err)
 	assert.Equal(t, expectedAppId, actualAppId)
 }
 
 func TestGetFullVersionInfo(t *testing.T) {
-	defer users.UserRepo.WipeDatabase()
-	assert.Nil(t, users.CreateAndValidateUser(tools.SampleForm))
-	assert.Nil(t, apps.AppRepo.CreateApp(tools.SampleUser, tools.SampleApp))
-	appId, err := apps.AppRepo.GetAppId(tools.SampleUser, tools.SampleApp)
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+	appId, err := appRepo.GetAppId(tools.SampleUser, tools.SampleApp)
 	assert.Nil(t, err)
-	assert.Nil(t, versions.VersionRepo.CreateVersion(appId, tools.SampleVersion, SampleVersionFileContent))
-	versionId, err := versions.VersionRepo.GetVersionId(appId, tools.SampleVersion)
+	assert.Nil(t, versionRepo.CreateVersion(appId, tools.SampleVersion, SampleVersionFileContent, ""))
+	versionId, err := versionRepo.GetVersionId(appId, tools.SampleVersion)
 	assert.Nil(t, err)
 
-	fullVersionInfo, err := versions.VersionRepo.GetFullVersionInfo(versionId)
+	fullVersionInfo, err := versionRepo.GetFullVersionInfo(versionId)
 	assert.Nil(t, err)
 	assert.Equal(t, tools.SampleUser, fullVersionInfo.Maintainer)
 	assert.Equal(t, tools.SampleApp, fullVersionInfo.AppName)
@@ -165,28 +169,28 @@ func TestGetFullVersionInfo(t *testing.T) {
 }
 
 func TestSearchForApps(t *testing.T) {
-	defer users.UserRepo.WipeDatabase()
-	assert.Nil(t, users.CreateAndValidateUser(tools.SampleForm))
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
 	app1 := "prefix_myapp_suffix"
 	app2 := "prefix_another-app_suffix"
-	assert.Nil(t, apps.AppRepo.CreateApp(tools.SampleUser, app1))
-	assert.Nil(t, apps.AppRepo.CreateApp(tools.SampleUser, app2))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, app1))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, app2))
 
-	app1Id, err := apps.AppRepo.GetAppId(tools.SampleUser, app1)
+	app1Id, err := appRepo.GetAppId(tools.SampleUser, app1)
 	assert.Nil(t, err)
-	err = versions.VersionRepo.CreateVersion(app1Id, tools.SampleVersion, []byte("asdf"))
+	err = versionRepo.CreateVersion(app1Id, tools.SampleVersion, []byte("asdf"), "")
 	assert.Nil(t, err)
-	app2Id, err := apps.AppRepo.GetAppId(tools.SampleUser, app2)
+	app2Id, err := appRepo.GetAppId(tools.SampleUser, app2)
 	assert.Nil(t, err)
 	sampleVersion2 := tools.SampleVersion + "x"
-	err = versions.VersionRepo.CreateVersion(app2Id, sampleVersion2, []byte("asdf"))
+	err = versionRepo.CreateVersion(app2Id, sampleVersion2, []byte("asdf"), "")
 	assert.Nil(t, err)
 
 	appSearchRequest := tools.AppSearchRequest{
 		SearchTerm:         "app",
 		ShowUnofficialApps: true,
 	}
-	foundApps, err := apps.AppRepo.SearchForApps(appSearchRequest)
+	foundApps, err := appRepo.SearchForApps(appSearchRequest)
 	assert.Nil(t, err)
 	sort.Slice(foundApps, func(i, j int) bool {
 		return foundApps[i].AppName < foundApps[j].AppName
@@ -200,23 +204,23 @@ func TestSearchForApps(t *testing.T) {
 }
 
 func TestSearchForApps_LatestVersions(t *testing.T) {
-	defer users.UserRepo.WipeDatabase()
-	assert.Nil(t, users.CreateAndValidateUser(tools.SampleForm))
-	assert.Nil(t, apps.AppRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp))
 	appSearchRequest := tools.AppSearchRequest{
 		SearchTerm:         tools.SampleApp,
 		ShowUnofficialApps: true,
 	}
-	searchedApps, err := apps.AppRepo.SearchForApps(appSearchRequest)
+	searchedApps, err := appRepo.SearchForApps(appSearchRequest)
 	assert.Nil(t, err)
 	assert.Equal(t, 0, len(searchedApps))
 
-	appId, err := apps.AppRepo.GetAppId(tools.SampleUser, tools.SampleApp)
+	appId, err := appRepo.GetAppId(tools.SampleUser, tools.SampleApp)
 	assert.Nil(t, err)
-	assert.Nil(t, versions.VersionRepo.CreateVersion(appId, tools.SampleVersion, []byte("asdf")))
-	versionId, err := versions.VersionRepo.GetVersionId(appId, tools.SampleVersion)
+	assert.Nil(t, versionRepo.CreateVersion(appId, tools.SampleVersion, []byte("asdf"), ""))
+	versionId, err := versionRepo.GetVersionId(appId, tools.SampleVersion)
 	assert.Nil(t, err)
-	searchedApps, err = apps.AppRepo.SearchForApps(appSearchRequest)
+	searchedApps, err = appRepo.SearchForApps(appSearchRequest)
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(searchedApps))
 	assert.Equal(t, strconv.Itoa(appId), searchedApps[0].AppId)
@@ -224,10 +228,10 @@ func TestSearchForApps_LatestVersions(t *testing.T) {
 	assert.Equal(t, tools.SampleVersion, searchedApps[0].LatestVersionName)
 
 	sampleVersion2 := tools.SampleVersion + "x"
-	assert.Nil(t, versions.VersionRepo.CreateVersion(appId, sampleVersion2, []byte("asdf")))
-	version2Id, err := versions.VersionRepo.GetVersionId(appId, sampleVersion2)
+	assert.Nil(t, versionRepo.CreateVersion(appId, sampleVersion2, []byte("asdf"), ""))
+	version2Id, err := versionRepo.GetVersionId(appId, sampleVersion2)
 	assert.Nil(t, err)
-	searchedApps, err = apps.AppRepo.SearchForApps(appSearchRequest)
+	searchedApps, err = appRepo.SearchForApps(appSearchRequest)
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(searchedApps))
 	assert.Equal(t, strconv.Itoa(appId), searchedApps[0].AppId)
@@ -236,41 +240,41 @@ func TestSearchForApps_LatestVersions(t *testing.T) {
 }
 
 func TestUnofficialAppFiltering(t *testing.T) {
-	defer users.UserRepo.WipeDatabase()
+	defer userRepo.WipeDatabase()
 	officialUser := "ocelotcloud"
-	assert.Nil(t, users.CreateAndValidateUser(tools.SampleForm))
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
 	officialUserRegistrationForm := &tools.RegistrationForm{
 		User:     officialUser,
 		Password: "password",
 		Email:    officialUser + "@ocelot-cloud.org",
 	}
-	assert.Nil(t, users.CreateAndValidateUser(officialUserRegistrationForm))
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, officialUserRegistrationForm))
 
 	appSearchRequest := tools.AppSearchRequest{
 		SearchTerm:         "app",
 		ShowUnofficialApps: true,
 	}
-	foundApps, err := apps.AppRepo.SearchForApps(appSearchRequest)
+	foundApps, err := appRepo.SearchForApps(appSearchRequest)
 	assert.Nil(t, err)
 	assert.Equal(t, 0, len(foundApps))
 
 	app1 := "official_app"
-	assert.Nil(t, apps.AppRepo.CreateApp(tools.SampleUser, app1))
-	app1Id, err := apps.AppRepo.GetAppId(tools.SampleUser, app1)
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, app1))
+	app1Id, err := appRepo.GetAppId(tools.SampleUser, app1)
 	assert.Nil(t, err)
-	assert.Nil(t, versions.VersionRepo.CreateVersion(app1Id, tools.SampleVersion, []byte("sample-bytes")))
+	assert.Nil(t, versionRepo.CreateVersion(app1Id, tools.SampleVersion, []byte("sample-bytes"), ""))
 
 	app2 := "unofficial_app"
-	assert.Nil(t, apps.AppRepo.CreateApp(officialUser, app2))
-	app2Id, err := apps.AppRepo.GetAppId(officialUser, app2)
+	assert.Nil(t, appRepo.CreateApp(officialUser, app2))
+	app2Id, err := appRepo.GetAppId(officialUser, app2)
 	assert.Nil(t, err)
-	assert.Nil(t, versions.VersionRepo.CreateVersion(app2Id, tools.SampleVersion, []byte("sample-bytes")))
+	assert.Nil(t, versionRepo.CreateVersion(app2Id, tools.SampleVersion, []byte("sample-bytes"), ""))
 
 	appSearchRequest = tools.AppSearchRequest{
 		SearchTerm:         "app",
 		ShowUnofficialApps: true,
 	}
-	foundApps, err = apps.AppRepo.SearchForApps(appSearchRequest)
+	foundApps, err = appRepo.SearchForApps(appSearchRequest)
 	assert.Nil(t, err)
 	assert.Equal(t, 2, len(foundApps))
 
@@ -278,8 +282,218 @@ func TestUnofficialAppFiltering(t *testing.T) {
 		SearchTerm:         "app",
 		ShowUnofficialApps: false,
 	}
-	foundApps, err = apps.AppRepo.SearchForApps(appSearchRequest)
+	foundApps, err = appRepo.SearchForApps(appSearchRequest)
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(foundApps))
 	assert.Equal(t, officialUser, foundApps[0].Maintainer)
 }
+
+func TestGetLatestVersionAndVersion(t *testing.T) {
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+	appId, err := appRepo.GetAppId(tools.SampleUser, tools.SampleApp)
+	assert.Nil(t, err)
+	_, err = versionRepo.GetLatestVersionId(appId)
+	assert.NotNil(t, err)
+
+	assert.Nil(t, versionRepo.CreateVersion(appId, tools.SampleVersion, []byte("asdf"), ""))
+	sampleVersion2 := tools.SampleVersion + "x"
+	assert.Nil(t, versionRepo.CreateVersion(appId, sampleVersion2, []byte("asdf"), ""))
+	version2Id, err := versionRepo.GetVersionId(appId, sampleVersion2)
+	assert.Nil(t, err)
+
+	latestVersionId, err := versionRepo.GetLatestVersionId(appId)
+	assert.Nil(t, err)
+	assert.Equal(t, version2Id, latestVersionId)
+
+	version, err := versionRepo.GetVersion(latestVersionId)
+	assert.Nil(t, err)
+	assert.Equal(t, strconv.Itoa(version2Id), version.Id)
+	assert.Equal(t, sampleVersion2, version.Name)
+	assert.True(t, version.CreationTimestamp.After(time.Now().UTC().Add(-1*time.Minute)))
+
+	_, err = versionRepo.GetVersion(-1)
+	assert.NotNil(t, err)
+}
+
+func TestLatestVersionOfEqualTimestampsIsTheLastCreated(t *testing.T) {
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+	appId, err := appRepo.GetAppId(tools.SampleUser, tools.SampleApp)
+	assert.Nil(t, err)
+	assert.Nil(t, versionRepo.CreateVersion(appId, "0.0.1", []byte("asdf"), ""))
+	assert.Nil(t, versionRepo.CreateVersion(appId, "0.0.2", []byte("asdf"), ""))
+	_, err = testDb.Exec("UPDATE versions SET creation_timestamp = $1 WHERE app_id = $2", time.Now().UTC().Truncate(time.Second), appId)
+	assert.Nil(t, err)
+	version2Id, err := versionRepo.GetVersionId(appId, "0.0.2")
+	assert.Nil(t, err)
+
+	latestVersionId, err := versionRepo.GetLatestVersionId(appId)
+	assert.Nil(t, err)
+	assert.Equal(t, version2Id, latestVersionId)
+
+	app, err := appRepo.GetAppWithLatestVersion(appId)
+	assert.Nil(t, err)
+	assert.Equal(t, "0.0.2", app.LatestVersionName)
+
+	foundApps, err := appRepo.SearchForApps(tools.AppSearchRequest{SearchTerm: tools.SampleApp, ShowUnofficialApps: true})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(foundApps))
+	assert.Equal(t, "0.0.2", foundApps[0].LatestVersionName)
+
+	versionList, err := versionRepo.GetVersionList(appId)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(versionList))
+	assert.Equal(t, "0.0.2", versionList[0].Name)
+}
+
+func TestDuplicateVersionNamesAreRejected(t *testing.T) {
+	defer userRepo.WipeDatabase()
+	assertDuplicateVersionNamesAreRejected(t, userRepo, appRepo, versionRepo)
+
+	db := memory.NewDatabase()
+	assertDuplicateVersionNamesAreRejected(t, memory.NewUserRepository(db, testConfig, testLogger),
+		memory.NewAppRepository(db, testLogger), memory.NewVersionRepository(db, testConfig, testLogger))
+}
+
+// assertDuplicateVersionNamesAreRejected is run against the SQL and the in-memory repositories, so that the component
+// tests using the latter catch regressions in the handling of duplicates as well.
+func assertDuplicateVersionNamesAreRejected(t *testing.T, userRepo users.UserRepository, appRepo apps.AppRepository, versionRepo versions.VersionRepository) {
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp+"x"))
+	appId, err := appRepo.GetAppId(tools.SampleUser, tools.SampleApp)
+	assert.Nil(t, err)
+	otherAppId, err := appRepo.GetAppId(tools.SampleUser, tools.SampleApp+"x")
+	assert.Nil(t, err)
+
+	assert.Nil(t, versionRepo.CreateVersion(appId, tools.SampleVersion, []byte("asdf"), ""))
+	err = versionRepo.CreateVersion(appId, tools.SampleVersion, []byte("qwertz"), "")
+	assert.True(t, errors.Is(err, tools.ErrVersionAlreadyExists))
+	assert.Nil(t, versionRepo.CreateVersion(otherAppId, tools.SampleVersion, []byte("asdf"), ""))
+
+	versionList, err := versionRepo.GetVersionList(appId)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(versionList))
+	usedSpace, err := userRepo.GetUsedSpaceInBytes(tools.SampleUser)
+	assert.Nil(t, err)
+	assert.Equal(t, 8, usedSpace)
+}
+
+func TestRetentionPolicy(t *testing.T) {
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+	appId, err := appRepo.GetAppId(tools.SampleUser, tools.SampleApp)
+	assert.Nil(t, err)
+
+	policy, err := versionRepo.GetRetentionPolicy(appId)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, policy.KeepLast)
+	assert.Equal(t, 0, policy.KeepDays)
+	assert.False(t, policy.KeepLatestPerMajor)
+	appIds, err := versionRepo.GetAppIdsWithRetentionPolicy()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(appIds))
+
+	assert.Nil(t, versionRepo.SetRetentionPolicy(appId, tools.RetentionPolicy{KeepLast: 2}))
+	assert.Nil(t, versionRepo.SetRetentionPolicy(appId, tools.RetentionPolicy{KeepDays: 30, KeepLatestPerMajor: true}))
+	policy, err = versionRepo.GetRetentionPolicy(appId)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, policy.KeepLast)
+	assert.Equal(t, 30, policy.KeepDays)
+	assert.True(t, policy.KeepLatestPerMajor)
+	appIds, err = versionRepo.GetAppIdsWithRetentionPolicy()
+	assert.Nil(t, err)
+	assert.Equal(t, []int{appId}, appIds)
+}
+
+func TestPruneVersions(t *testing.T) {
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+	appId, err := appRepo.GetAppId(tools.SampleUser, tools.SampleApp)
+	assert.Nil(t, err)
+	for _, versionName := range []string{"1.0.0", "1.1.0", "2.0.0"} {
+		assert.Nil(t, versionRepo.CreateVersion(appId, versionName, []byte("hello"), ""))
+		time.Sleep(10 * time.Millisecond)
+	}
+	webhookId := createSampleWebhook(t, tools.SampleUser, false)
+
+	assert.Nil(t, versionRepo.SetRetentionPolicy(appId, tools.RetentionPolicy{KeepLast: 1}))
+	result, err := versions.PruneVersions(versionRepo, dispatcher, appId, true, testLogger)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(result.Versions))
+	assert.Equal(t, 10, result.FreedBytes)
+	foundVersions, err := versionRepo.GetVersionList(appId)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(foundVersions))
+	deliveries, err := webhookRepo.GetDeliveries(webhookId, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(deliveries))
+
+	_, err = versions.PruneVersions(versionRepo, dispatcher, appId, false, testLogger)
+	assert.Nil(t, err)
+	foundVersions, err = versionRepo.GetVersionList(appId)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(foundVersions))
+	assert.Equal(t, "2.0.0", foundVersions[0].Name)
+	space, err := userRepo.GetUsedSpaceInBytes(tools.SampleUser)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, space)
+
+	deliveries, err = webhookRepo.GetDeliveries(webhookId, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(deliveries))
+	for _, delivery := range deliveries {
+		assert.Equal(t, tools.WebhookEventVersionDeleted, delivery.Event)
+	}
+}
+
+func TestGetReleases(t *testing.T) {
+	defer userRepo.WipeDatabase()
+	otherForm := &tools.RegistrationForm{User: "otheruser", Password: tools.SamplePassword, Email: "other@example.com"}
+	for _, form := range []*tools.RegistrationForm{tools.SampleForm, otherForm} {
+		assert.Nil(t, users.CreateAndValidateUser(userRepo, form))
+	}
+	assert.Nil(t, appRepo.CreateApp(tools.SampleUser, tools.SampleApp))
+	assert.Nil(t, appRepo.CreateApp(otherForm.User, tools.SampleApp))
+	sampleAppId, err := appRepo.GetAppId(tools.SampleUser, tools.SampleApp)
+	assert.Nil(t, err)
+	otherAppId, err := appRepo.GetAppId(otherForm.User, tools.SampleApp)
+	assert.Nil(t, err)
+	assert.Nil(t, versionRepo.CreateVersion(sampleAppId, "0.0.1", []byte("asdf"), "first release"))
+	assert.Nil(t, versionRepo.CreateVersion(otherAppId, "0.0.1", []byte("asdf"), ""))
+	assert.Nil(t, versionRepo.CreateVersion(sampleAppId, "0.0.2", []byte("asdf"), "second release"))
+
+	releases, err := versionRepo.GetReleases("", "", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(releases))
+	assert.Equal(t, "0.0.2", releases[0].VersionName)
+	assert.Equal(t, "second release", releases[0].Changelog)
+	assert.Equal(t, tools.SampleUser, releases[0].Maintainer)
+	assert.Equal(t, sampleAppId, releases[0].AppId)
+	assert.Equal(t, tools.SampleApp, releases[0].AppName)
+	assert.Equal(t, otherForm.User, releases[1].Maintainer)
+	assert.Equal(t, "", releases[1].Changelog)
+	assert.Equal(t, "first release", releases[2].Changelog)
+
+	releases, err = versionRepo.GetReleases("", "", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(releases))
+
+	releases, err = versionRepo.GetReleases(tools.SampleUser, tools.SampleApp, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(releases))
+	assert.Equal(t, "0.0.2", releases[0].VersionName)
+	assert.Equal(t, "0.0.1", releases[1].VersionName)
+
+	releases, err = versionRepo.GetReleases(otherForm.User, "", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(releases))
+	releases, err = versionRepo.GetReleases(tools.SampleUser, "unknownapp", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(releases))
+}
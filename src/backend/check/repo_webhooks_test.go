@@ -0,0 +1,130 @@
+//go:build unit
+
+package check
+
+import (
+	"github.com/ocelot-cloud/shared/assert"
+	"ocelot/store/tools"
+	"ocelot/store/users"
+	"ocelot/store/webhooks"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const sampleWebhookSecret = "0123456789abcdef"
+
+func createSampleWebhook(t *testing.T, user string, allApps bool) int {
+	webhook, err := webhookRepo.CreateWebhook(user, tools.WebhookCreation{Url: "https://example.com/" + user, Secret: sampleWebhookSecret, AllApps: allApps})
+	assert.Nil(t, err)
+	webhookId, err := strconv.Atoi(webhook.Id)
+	assert.Nil(t, err)
+	return webhookId
+}
+
+func TestCreateAndDeleteWebhook(t *testing.T) {
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	webhookId := createSampleWebhook(t, tools.SampleUser, false)
+	assert.True(t, webhookRepo.DoesWebhookExist(webhookId))
+	assert.True(t, webhookRepo.IsWebhookOwner(tools.SampleUser, webhookId))
+	assert.False(t, webhookRepo.IsWebhookOwner("otheruser", webhookId))
+
+	list, err := webhookRepo.GetWebhooks(tools.SampleUser)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(list))
+	assert.Equal(t, strconv.Itoa(webhookId), list[0].Id)
+	assert.Equal(t, "https://example.com/"+tools.SampleUser, list[0].Url)
+	count, err := webhookRepo.CountWebhooks(tools.SampleUser)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	assert.Nil(t, webhookRepo.DeleteWebhook(webhookId))
+	assert.False(t, webhookRepo.DoesWebhookExist(webhookId))
+}
+
+func TestDeliveriesAreQueuedForMaintainerAndAllAppsWebhooks(t *testing.T) {
+	defer userRepo.WipeDatabase()
+	otherForm := &tools.RegistrationForm{User: "otheruser", Password: tools.SamplePassword, Email: "other@example.com"}
+	adminForm := &tools.RegistrationForm{User: "adminuser", Password: tools.SamplePassword, Email: "admin@example.com"}
+	for _, form := range []*tools.RegistrationForm{tools.SampleForm, otherForm, adminForm} {
+		assert.Nil(t, users.CreateAndValidateUser(userRepo, form))
+	}
+	maintainerWebhookId := createSampleWebhook(t, tools.SampleUser, false)
+	otherWebhookId := createSampleWebhook(t, otherForm.User, false)
+	adminWebhookId := createSampleWebhook(t, adminForm.User, true)
+
+	now := time.Now().UTC()
+	count, err := webhookRepo.EnqueueDeliveries(tools.SampleUser, tools.WebhookEventAppDeleted, []byte(`{"event":"app.deleted"}`), now)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+
+	due, err := webhookRepo.GetDueDeliveries(now, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(due))
+	webhookIds := []int{due[0].WebhookId, due[1].WebhookId}
+	assert.True(t, webhookIds[0] == maintainerWebhookId && webhookIds[1] == adminWebhookId || webhookIds[0] == adminWebhookId && webhookIds[1] == maintainerWebhookId)
+	assert.Equal(t, `{"event":"app.deleted"}`, string(due[0].Payload))
+	assert.Equal(t, sampleWebhookSecret, due[0].Secret)
+
+	deliveries, err := webhookRepo.GetDeliveries(otherWebhookId, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(deliveries))
+}
+
+func TestDeliveryAttemptsAreRecorded(t *testing.T) {
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	webhookId := createSampleWebhook(t, tools.SampleUser, false)
+	now := time.Now().UTC()
+	_, err := webhookRepo.EnqueueDeliveries(tools.SampleUser, tools.WebhookEventVersionPublished, []byte("{}"), now)
+	assert.Nil(t, err)
+	due, err := webhookRepo.GetDueDeliveries(now, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(due))
+
+	nextAttempt := now.Add(time.Minute)
+	assert.Nil(t, webhookRepo.RecordAttempt(due[0].Id, webhooks.Attempt{Status: tools.WebhookStatusPending, StatusCode: 500, Error: "receiver responded with status code 500", Time: now, NextAttempt: nextAttempt}))
+	due, err = webhookRepo.GetDueDeliveries(now.Add(time.Second), 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(due))
+
+	deliveries, err := webhookRepo.GetDeliveries(webhookId, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(deliveries))
+	assert.Equal(t, tools.WebhookStatusPending, deliveries[0].Status)
+	assert.Equal(t, 1, deliveries[0].Attempts)
+	assert.Equal(t, 500, deliveries[0].LastStatusCode)
+	assert.True(t, deliveries[0].NextAttempt != nil && deliveries[0].NextAttempt.Equal(nextAttempt))
+	assert.NotNil(t, deliveries[0].LastAttempt)
+
+	due, err = webhookRepo.GetDueDeliveries(nextAttempt, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(due))
+	assert.Equal(t, 1, due[0].Attempts)
+	assert.Nil(t, webhookRepo.RecordAttempt(due[0].Id, webhooks.Attempt{Status: tools.WebhookStatusDelivered, StatusCode: 200, Time: nextAttempt}))
+
+	deliveries, err = webhookRepo.GetDeliveries(webhookId, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, tools.WebhookStatusDelivered, deliveries[0].Status)
+	assert.Equal(t, 2, deliveries[0].Attempts)
+	assert.True(t, deliveries[0].NextAttempt == nil)
+
+	deleted, err := webhookRepo.DeleteFinishedDeliveriesBefore(now.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, deleted)
+}
+
+func TestWebhooksAreDeletedWithUser(t *testing.T) {
+	defer userRepo.WipeDatabase()
+	assert.Nil(t, users.CreateAndValidateUser(userRepo, tools.SampleForm))
+	webhookId := createSampleWebhook(t, tools.SampleUser, false)
+	_, err := webhookRepo.EnqueueDeliveries(tools.SampleUser, tools.WebhookEventVersionPublished, []byte("{}"), time.Now().UTC())
+	assert.Nil(t, err)
+
+	userRepo.WipeDatabase()
+	assert.False(t, webhookRepo.DoesWebhookExist(webhookId))
+	due, err := webhookRepo.GetDueDeliveries(time.Now().UTC(), 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(due))
+}
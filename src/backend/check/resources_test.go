@@ -1,23 +1,36 @@
 package check
 
 import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/ocelot-cloud/shared/assert"
 	"github.com/ocelot-cloud/shared/utils"
+	"io"
+	"net/http"
 	"ocelot/store/tools"
+	"strings"
 	"testing"
 )
 
+// frontendDevelopmentOrigin is the origin of the frontend development server, which is allowed to send requests to
+// the store under test.
+const frontendDevelopmentOrigin = "http://localhost:8081"
+
 type HubClient struct {
 	Parent             utils.ComponentClient
 	Email              string
 	App                string
 	Version            string
 	UploadContent      []byte
+	Changelog          string
 	AppId              string
 	VersionId          string
 	ValidationCode     string
 	ShowUnofficialApps bool
+	CsrfToken          string
 }
 
 type Operation int
@@ -45,6 +58,65 @@ func getRegistrationForm(hub *HubClient) *tools.RegistrationForm {
 	}
 }
 
+// doRequest sends a request the way the frontend does. Besides the session cookie, the CSRF token is sent, which is
+// required by protected routes. Both are updated whenever the store sets new cookies.
+func (h *HubClient) doRequest(path string, payload any) ([]byte, error) {
+	resp, err := h.doRequestWithFullResponse(path, payload)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (h *HubClient) doRequestWithFullResponse(path string, payload any) (*http.Response, error) {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, h.Parent.RootUrl+path, bytes.NewReader(payloadBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	utils.SetCookieHeaders(req, &h.Parent)
+	if h.Parent.SetCookieHeader && h.CsrfToken != "" {
+		req.Header.Set(tools.CsrfHeader, h.CsrfToken)
+	}
+	if h.Parent.Origin != "" {
+		req.Header.Set("Origin", h.Parent.Origin)
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: !h.Parent.VerifyCertificate}, // #nosec G402 (CWE-295): only used in tests
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %v", err)
+	}
+	defer utils.Close(resp.Body)
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusFound {
+		return nil, errors.New(strings.TrimSuffix(utils.GetErrMsg(resp.StatusCode, string(body)), "\n"))
+	}
+
+	for _, cookie := range resp.Cookies() {
+		switch cookie.Name {
+		case tools.CookieName:
+			h.Parent.Cookie = cookie
+		case tools.CsrfCookieName:
+			h.CsrfToken = cookie.Value
+		}
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
 func getHub() *HubClient {
 	hub := getHubWithoutWipe()
 	hub.wipeData()
@@ -83,12 +155,12 @@ func (h *HubClient) registerAndValidateUser() error {
 
 func (h *HubClient) registerUser() error {
 	form := getRegistrationForm(h)
-	_, err := h.Parent.DoRequest(tools.RegistrationPath, form, "")
+	_, err := h.doRequest(tools.RegistrationPath, form)
 	return err
 }
 
 func (h *HubClient) validateCode() error {
-	_, err := h.Parent.DoRequest(tools.EmailValidationPath+"?code="+h.ValidationCode, nil, "")
+	_, err := h.doRequest(tools.EmailValidationPath+"?code="+h.ValidationCode, nil)
 	return err
 }
 
@@ -98,26 +170,26 @@ func (h *HubClient) login() error {
 		Password: h.Parent.Password,
 	}
 
-	resp, err := h.Parent.DoRequestWithFullResponse(tools.LoginPath, creds, "")
+	resp, err := h.doRequestWithFullResponse(tools.LoginPath, creds)
 	if err != nil {
 		return err
 	}
 
+	// The session and CSRF cookies are taken over by doRequestWithFullResponse.
 	cookies := resp.Cookies()
-	if len(cookies) != 1 {
-		return fmt.Errorf("Expected 1 cookie, got %d", len(cookies))
+	if len(cookies) != 2 {
+		return fmt.Errorf("Expected 2 cookies, got %d", len(cookies))
 	}
-	h.Parent.Cookie = cookies[0]
 	return nil
 }
 
 func (h *HubClient) deleteUser() error {
-	_, err := h.Parent.DoRequest(tools.DeleteUserPath, nil, "")
+	_, err := h.doRequest(tools.DeleteUserPath, nil)
 	return err
 }
 
 func (h *HubClient) createApp() error {
-	_, err := h.Parent.DoRequest(tools.AppCreationPath, tools.AppNameString{Value: h.App}, "")
+	_, err := h.doRequest(tools.AppCreationPath, tools.AppNameString{Value: h.App})
 	if err != nil {
 		return err
 	}
@@ -139,7 +211,7 @@ func (h *HubClient) SearchForApps(searchTerm string) ([]tools.AppWithLatestVersi
 		SearchTerm:         searchTerm,
 		ShowUnofficialApps: h.ShowUnofficialApps,
 	}
-	result, err := h.Parent.DoRequest(tools.SearchAppsPath, appSearchRequest, "")
+	result, err := h.doRequest(tools.SearchAppsPath, appSearchRequest)
 	if err != nil {
 		return nil, err
 	}
@@ -153,7 +225,7 @@ func (h *HubClient) SearchForApps(searchTerm string) ([]tools.AppWithLatestVersi
 }
 
 func (h *HubClient) ListOwnApps() ([]tools.App, error) {
-	result, err := h.Parent.DoRequest(tools.AppGetListPath, nil, "")
+	result, err := h.doRequest(tools.AppGetListPath, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -168,11 +240,12 @@ func (h *HubClient) ListOwnApps() ([]tools.App, error) {
 
 func (h *HubClient) uploadVersion() error {
 	tapUpload := &tools.VersionUpload{
-		AppId:   h.AppId,
-		Version: h.Version,
-		Content: h.UploadContent,
+		AppId:     h.AppId,
+		Version:   h.Version,
+		Content:   h.UploadContent,
+		Changelog: h.Changelog,
 	}
-	_, err := h.Parent.DoRequest(tools.VersionUploadPath, tapUpload, "")
+	_, err := h.doRequest(tools.VersionUploadPath, tapUpload)
 	if err != nil {
 		return err
 	}
@@ -190,8 +263,30 @@ func (h *HubClient) uploadVersion() error {
 	return fmt.Errorf("version not found on server")
 }
 
+// getReleaseFeed requests the release feed with the given query and conditional request headers. Unlike doRequest, it
+// returns responses with any status code, as 304 is expected.
+func (h *HubClient) getReleaseFeed(query string, header http.Header) (*http.Response, []byte, error) {
+	req, err := http.NewRequest(http.MethodGet, h.Parent.RootUrl+tools.ReleaseFeedPath+query, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to send request: %v", err)
+	}
+	defer utils.Close(resp.Body)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read response body: %v", err)
+	}
+	return resp, body, nil
+}
+
 func (h *HubClient) downloadVersion() (*tools.FullVersionInfo, error) {
-	result, err := h.Parent.DoRequest(tools.DownloadPath, tools.NumberString{Value: h.VersionId}, "")
+	result, err := h.doRequest(tools.DownloadPath, tools.NumberString{Value: h.VersionId})
 	if err != nil {
 		return nil, err
 	}
@@ -205,7 +300,7 @@ func (h *HubClient) downloadVersion() (*tools.FullVersionInfo, error) {
 }
 
 func (h *HubClient) getVersions() ([]tools.Version, error) {
-	result, err := h.Parent.DoRequest(tools.GetVersionsPath, tools.NumberString{Value: h.AppId}, "")
+	result, err := h.doRequest(tools.GetVersionsPath, tools.NumberString{Value: h.AppId})
 	if err != nil {
 		return nil, err
 	}
@@ -219,12 +314,12 @@ func (h *HubClient) getVersions() ([]tools.Version, error) {
 }
 
 func (h *HubClient) deleteVersion() error {
-	_, err := h.Parent.DoRequest(tools.VersionDeletePath, tools.NumberString{Value: h.VersionId}, "")
+	_, err := h.doRequest(tools.VersionDeletePath, tools.NumberString{Value: h.VersionId})
 	return err
 }
 
 func (h *HubClient) deleteApp() error {
-	_, err := h.Parent.DoRequest(tools.AppDeletePath, tools.NumberString{Value: h.AppId}, "")
+	_, err := h.doRequest(tools.AppDeletePath, tools.NumberString{Value: h.AppId})
 	return err
 }
 
@@ -234,7 +329,7 @@ func (h *HubClient) changePassword() error {
 		NewPassword: h.Parent.NewPassword,
 	}
 
-	_, err := h.Parent.DoRequest(tools.ChangePasswordPath, form, "")
+	_, err := h.doRequest(tools.ChangePasswordPath, form)
 	return err
 }
 
@@ -248,18 +343,117 @@ func getHubAndLogin(t *testing.T) *HubClient {
 }
 
 func (h *HubClient) wipeData() {
-	_, err := h.Parent.DoRequest(tools.WipeDataPath, nil, "")
+	_, err := h.doRequest(tools.WipeDataPath, nil)
 	if err != nil {
 		panic("failed to wipe data: " + err.Error())
 	}
 }
 
 func (h *HubClient) logout() error {
-	_, err := h.Parent.DoRequest(tools.LogoutPath, nil, "")
+	_, err := h.doRequest(tools.LogoutPath, nil)
 	return err
 }
 
 func (h *HubClient) checkAuth() error {
-	_, err := h.Parent.DoRequest(tools.AuthCheckPath, nil, "")
+	_, err := h.doRequest(tools.AuthCheckPath, nil)
+	return err
+}
+
+func (h *HubClient) lookupApp() (*tools.AppWithLatestVersion, error) {
+	lookupRequest := tools.AppLookupRequest{
+		Maintainer: h.Parent.User,
+		AppName:    h.App,
+	}
+	result, err := h.doRequest(tools.AppLookupPath, lookupRequest)
+	if err != nil {
+		return nil, err
+	}
+	return utils.UnpackResponse[tools.AppWithLatestVersion](result)
+}
+
+func (h *HubClient) lookupVersion() (*tools.VersionLookupResult, error) {
+	lookupRequest := tools.VersionLookupRequest{
+		Maintainer:  h.Parent.User,
+		AppName:     h.App,
+		VersionName: h.Version,
+	}
+	result, err := h.doRequest(tools.VersionLookupPath, lookupRequest)
+	if err != nil {
+		return nil, err
+	}
+	return utils.UnpackResponse[tools.VersionLookupResult](result)
+}
+
+func (h *HubClient) getQuota() (*tools.QuotaInfo, error) {
+	result, err := h.doRequest(tools.QuotaPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	return utils.UnpackResponse[tools.QuotaInfo](result)
+}
+
+func (h *HubClient) setRetentionPolicy(policy tools.RetentionPolicy) error {
+	policy.AppId = h.AppId
+	_, err := h.doRequest(tools.RetentionPolicySetPath, policy)
+	return err
+}
+
+func (h *HubClient) dryRunRetentionPolicy() (*tools.PruneResult, error) {
+	result, err := h.doRequest(tools.RetentionDryRunPath, tools.NumberString{Value: h.AppId})
+	if err != nil {
+		return nil, err
+	}
+	return utils.UnpackResponse[tools.PruneResult](result)
+}
+
+func (h *HubClient) createWebhook(creation tools.WebhookCreation) (*tools.Webhook, error) {
+	result, err := h.doRequest(tools.WebhookCreationPath, creation)
+	if err != nil {
+		return nil, err
+	}
+	return utils.UnpackResponse[tools.Webhook](result)
+}
+
+func (h *HubClient) listWebhooks() ([]tools.Webhook, error) {
+	result, err := h.doRequest(tools.WebhookListPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	list, err := utils.UnpackResponse[[]tools.Webhook](result)
+	if err != nil {
+		return nil, err
+	}
+	return *list, nil
+}
+
+func (h *HubClient) deleteWebhook(webhookId string) error {
+	_, err := h.doRequest(tools.WebhookDeletePath, tools.NumberString{Value: webhookId})
 	return err
 }
+
+func (h *HubClient) getWebhookDeliveries(webhookId string) ([]tools.WebhookDelivery, error) {
+	result, err := h.doRequest(tools.WebhookDeliveriesPath, tools.NumberString{Value: webhookId})
+	if err != nil {
+		return nil, err
+	}
+	deliveries, err := utils.UnpackResponse[[]tools.WebhookDelivery](result)
+	if err != nil {
+		return nil, err
+	}
+	return *deliveries, nil
+}
+
+// assertApiError checks that a request failed with the given status code and structured error code.
+func assertApiError(t *testing.T, err error, statusCode int, code tools.ErrorCode) {
+	assert.NotNil(t, err)
+	if err == nil {
+		return
+	}
+	body, found := strings.CutPrefix(err.Error(), utils.GetErrMsg(statusCode, "")+" Response body: ")
+	assert.True(t, found, "unexpected error: "+err.Error())
+
+	var errorResponse tools.ErrorResponse
+	assert.Nil(t, json.Unmarshal([]byte(body), &errorResponse))
+	assert.Equal(t, code, errorResponse.Code)
+	assert.NotEqual(t, "", errorResponse.Message)
+}
@@ -0,0 +1,354 @@
+// Package client is a Go client for the HTTP API of the Ocelot App Store. It has a method for every API route,
+// including the release feed, but not for the routes meant for operations, like the health and readiness checks, the
+// metrics, the build info, the CSP reports and the OpenAPI document.
+//
+// Requests that only read data are retried with exponential backoff when the connection fails or the
+// store is temporarily unavailable. If the store asks to wait longer via the Retry-After header, e.g. when the rate
+// limit is exceeded, the retry waits that long, but at most 5 seconds. Requests changing data are sent exactly once.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ocelot-cloud/shared/utils"
+	"io"
+	"net/http"
+	"net/url"
+	"ocelot/store/tools"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMaxRetries     = 3
+	defaultInitialBackoff = 200 * time.Millisecond
+	maxBackoff            = 5 * time.Second
+)
+
+type Client struct {
+	baseUrl        string
+	httpClient     *http.Client
+	token          string
+	maxRetries     int
+	initialBackoff time.Duration
+}
+
+type Option func(*Client)
+
+// WithHTTPClient replaces the default HTTP client, e.g. to configure timeouts or TLS settings.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithToken authenticates the client with a session token obtained from a previous login.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithRetries configures how often idempotent requests are retried and the backoff before the first retry.
+// The backoff doubles with each further attempt.
+func WithRetries(maxRetries int, initialBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.initialBackoff = initialBackoff
+	}
+}
+
+// New creates a client for the store reachable at baseUrl, e.g. "https://store.ocelot-cloud.org".
+func New(baseUrl string, options ...Option) *Client {
+	c := &Client{
+		baseUrl:        strings.TrimSuffix(baseUrl, "/"),
+		httpClient:     &http.Client{Timeout: 30 * time.Second},
+		maxRetries:     defaultMaxRetries,
+		initialBackoff: defaultInitialBackoff,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// Token returns the session token of the client, which is empty before a successful login.
+func (c *Client) Token() string {
+	return c.token
+}
+
+func (c *Client) Register(ctx context.Context, form tools.RegistrationForm) error {
+	return c.do(ctx, tools.RegistrationPath, form, nil, false)
+}
+
+func (c *Client) ValidateEmail(ctx context.Context, code string) error {
+	return c.do(ctx, tools.EmailValidationPath+"?"+url.Values{"code": {code}}.Encode(), nil, nil, false)
+}
+
+// Login authenticates the user and stores the received session token for subsequent requests.
+func (c *Client) Login(ctx context.Context, user, password string) error {
+	creds := tools.LoginCredentials{User: user, Password: password}
+	resp, err := c.send(ctx, tools.LoginPath, creds, false)
+	if err != nil {
+		return err
+	}
+	defer utils.Close(resp.Body)
+
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == tools.CookieName {
+			c.token = cookie.Value
+			return nil
+		}
+	}
+	return errors.New("login response did not contain a session token")
+}
+
+func (c *Client) Logout(ctx context.Context) error {
+	err := c.do(ctx, tools.LogoutPath, nil, nil, false)
+	if err == nil {
+		c.token = ""
+	}
+	return err
+}
+
+// CheckAuth verifies the session token and returns the name of the authenticated user.
+func (c *Client) CheckAuth(ctx context.Context) (string, error) {
+	var user tools.UserNameString
+	err := c.do(ctx, tools.AuthCheckPath, nil, &user, true)
+	return user.Value, err
+}
+
+func (c *Client) ChangePassword(ctx context.Context, oldPassword, newPassword string) error {
+	form := tools.ChangePasswordForm{OldPassword: oldPassword, NewPassword: newPassword}
+	return c.do(ctx, tools.ChangePasswordPath, form, nil, false)
+}
+
+func (c *Client) GetQuota(ctx context.Context) (*tools.QuotaInfo, error) {
+	var quota tools.QuotaInfo
+	if err := c.do(ctx, tools.QuotaPath, nil, &quota, true); err != nil {
+		return nil, err
+	}
+	return &quota, nil
+}
+
+func (c *Client) DeleteAccount(ctx context.Context) error {
+	return c.do(ctx, tools.DeleteUserPath, nil, nil, false)
+}
+
+func (c *Client) CreateApp(ctx context.Context, app string) error {
+	return c.do(ctx, tools.AppCreationPath, tools.AppNameString{Value: app}, nil, false)
+}
+
+// ListApps returns the apps of the authenticated user.
+func (c *Client) ListApps(ctx context.Context) ([]tools.App, error) {
+	var apps []tools.App
+	err := c.do(ctx, tools.AppGetListPath, nil, &apps, true)
+	return apps, err
+}
+
+func (c *Client) DeleteApp(ctx context.Context, appId string) error {
+	return c.do(ctx, tools.AppDeletePath, tools.NumberString{Value: appId}, nil, false)
+}
+
+func (c *Client) SearchApps(ctx context.Context, request tools.AppSearchRequest) ([]tools.AppWithLatestVersion, error) {
+	var apps []tools.AppWithLatestVersion
+	err := c.do(ctx, tools.SearchAppsPath, request, &apps, true)
+	return apps, err
+}
+
+func (c *Client) LookupApp(ctx context.Context, maintainer, app string) (*tools.AppWithLatestVersion, error) {
+	var result tools.AppWithLatestVersion
+	request := tools.AppLookupRequest{Maintainer: maintainer, AppName: app}
+	if err := c.do(ctx, tools.AppLookupPath, request, &result, true); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// UploadVersion uploads the zipped content of a version to the app with the given ID, the changelog may be empty.
+func (c *Client) UploadVersion(ctx context.Context, appId, version string, content []byte, changelog string) error {
+	upload := tools.VersionUpload{AppId: appId, Version: version, Content: content, Changelog: changelog}
+	return c.do(ctx, tools.VersionUploadPath, upload, nil, false)
+}
+
+func (c *Client) DeleteVersion(ctx context.Context, versionId string) error {
+	return c.do(ctx, tools.VersionDeletePath, tools.NumberString{Value: versionId}, nil, false)
+}
+
+// ListVersions returns the versions of an app, newest first.
+func (c *Client) ListVersions(ctx context.Context, appId string) ([]tools.Version, error) {
+	var versions []tools.Version
+	err := c.do(ctx, tools.GetVersionsPath, tools.NumberString{Value: appId}, &versions, true)
+	return versions, err
+}
+
+func (c *Client) DownloadVersion(ctx context.Context, versionId string) (*tools.FullVersionInfo, error) {
+	var info tools.FullVersionInfo
+	if err := c.do(ctx, tools.DownloadPath, tools.NumberString{Value: versionId}, &info, true); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// LookupVersion resolves a version by name. Passing tools.LatestVersionAlias as version returns the newest one.
+func (c *Client) LookupVersion(ctx context.Context, maintainer, app, version string) (*tools.VersionLookupResult, error) {
+	var result tools.VersionLookupResult
+	request := tools.VersionLookupRequest{Maintainer: maintainer, AppName: app, VersionName: version}
+	if err := c.do(ctx, tools.VersionLookupPath, request, &result, true); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) CreateWebhook(ctx context.Context, creation tools.WebhookCreation) (*tools.Webhook, error) {
+	var webhook tools.Webhook
+	if err := c.do(ctx, tools.WebhookCreationPath, creation, &webhook, false); err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// ListWebhooks returns the webhooks of the authenticated user.
+func (c *Client) ListWebhooks(ctx context.Context) ([]tools.Webhook, error) {
+	var webhooks []tools.Webhook
+	err := c.do(ctx, tools.WebhookListPath, nil, &webhooks, true)
+	return webhooks, err
+}
+
+func (c *Client) DeleteWebhook(ctx context.Context, webhookId string) error {
+	return c.do(ctx, tools.WebhookDeletePath, tools.NumberString{Value: webhookId}, nil, false)
+}
+
+// ListWebhookDeliveries returns the latest deliveries of the webhook, newest first.
+func (c *Client) ListWebhookDeliveries(ctx context.Context, webhookId string) ([]tools.WebhookDelivery, error) {
+	var deliveries []tools.WebhookDelivery
+	err := c.do(ctx, tools.WebhookDeliveriesPath, tools.NumberString{Value: webhookId}, &deliveries, true)
+	return deliveries, err
+}
+
+func (c *Client) SetRetentionPolicy(ctx context.Context, policy tools.RetentionPolicy) error {
+	return c.do(ctx, tools.RetentionPolicySetPath, policy, nil, false)
+}
+
+func (c *Client) GetRetentionPolicy(ctx context.Context, appId string) (*tools.RetentionPolicy, error) {
+	var policy tools.RetentionPolicy
+	if err := c.do(ctx, tools.RetentionPolicyGetPath, tools.NumberString{Value: appId}, &policy, true); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// DryRunRetention returns the versions of the app which the retention policy would prune now, without pruning them.
+func (c *Client) DryRunRetention(ctx context.Context, appId string) (*tools.PruneResult, error) {
+	var result tools.PruneResult
+	if err := c.do(ctx, tools.RetentionDryRunPath, tools.NumberString{Value: appId}, &result, true); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SetUserQuota changes the storage limit of a user, which only admins may do.
+func (c *Client) SetUserQuota(ctx context.Context, update tools.UserQuotaUpdate) error {
+	return c.do(ctx, tools.AdminUserQuotaPath, update, nil, false)
+}
+
+// SetAppQuota changes the limits of an app, which only admins may do.
+func (c *Client) SetAppQuota(ctx context.Context, update tools.AppQuotaUpdate) error {
+	return c.do(ctx, tools.AdminAppQuotaPath, update, nil, false)
+}
+
+// do sends the payload and decodes the JSON response into result unless result is nil.
+func (c *Client) do(ctx context.Context, path string, payload, result any, idempotent bool) error {
+	resp, err := c.send(ctx, path, payload, idempotent)
+	if err != nil {
+		return err
+	}
+	defer utils.Close(resp.Body)
+
+	if result == nil {
+		return nil
+	}
+	if err = json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode response of %s: %w", path, err)
+	}
+	return nil
+}
+
+// send posts the payload as JSON and returns the response of a successful request. The caller must close its body.
+func (c *Client) send(ctx context.Context, path string, payload any, idempotent bool) (*http.Response, error) {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	return c.sendWithRetries(ctx, http.MethodPost, path, payloadBytes, idempotent)
+}
+
+// sendWithRetries sends the request, which has no body if payloadBytes is nil, and retries it if idempotent.
+func (c *Client) sendWithRetries(ctx context.Context, method, path string, payloadBytes []byte, idempotent bool) (*http.Response, error) {
+	attempts := 1
+	if idempotent {
+		attempts += c.maxRetries
+	}
+	backoff := c.initialBackoff
+
+	for attempt := 1; ; attempt++ {
+		resp, err := c.sendOnce(ctx, method, path, payloadBytes)
+		if err == nil {
+			return resp, nil
+		}
+
+		var apiErr *APIError
+		retryable := !errors.As(err, &apiErr) || isRetryable(apiErr.StatusCode)
+		if !retryable || attempt >= attempts || ctx.Err() != nil {
+			return nil, err
+		}
+
+		// the store knows when it accepts requests again, retrying earlier would only use up the attempts
+		wait := backoff
+		if apiErr != nil && apiErr.RetryAfter > wait {
+			wait = max(min(apiErr.RetryAfter, maxBackoff), backoff)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		backoff = min(2*backoff, maxBackoff)
+	}
+}
+
+func (c *Client) sendOnce(ctx context.Context, method, path string, payloadBytes []byte) (*http.Response, error) {
+	var body io.Reader
+	if payloadBytes != nil {
+		body = bytes.NewReader(payloadBytes)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseUrl+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if payloadBytes != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request to %s: %w", path, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer utils.Close(resp.Body)
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		apiErr := newAPIError(resp.StatusCode, body)
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			apiErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
@@ -0,0 +1,277 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/ocelot-cloud/shared/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"ocelot/store/tools"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoginStoresTokenAndSendsItAsBearerToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case tools.LoginPath:
+			http.SetCookie(w, &http.Cookie{Name: tools.CookieName, Value: "sometoken"})
+		case tools.AuthCheckPath:
+			if r.Header.Get("Authorization") != "Bearer sometoken" {
+				http.Error(w, "token not found", http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(`{"value":"sampleuser"}`))
+		}
+	}))
+	defer server.Close()
+
+	c := New(server.URL)
+	_, err := c.CheckAuth(context.Background())
+	assert.True(t, errors.Is(err, ErrUnauthorized))
+
+	assert.Nil(t, c.Login(context.Background(), "sampleuser", "password"))
+	assert.Equal(t, "sometoken", c.Token())
+	user, err := c.CheckAuth(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "sampleuser", user)
+
+	user, err = New(server.URL, WithToken("sometoken")).CheckAuth(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, "sampleuser", user)
+}
+
+func TestStatusCodesAreMappedToTypedErrors(t *testing.T) {
+	statusCode := http.StatusNotFound
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "app does not exist", statusCode)
+	}))
+	defer server.Close()
+	c := New(server.URL, WithRetries(0, 0))
+
+	expectations := map[int]error{
+		http.StatusBadRequest:            ErrInvalidInput,
+		http.StatusUnauthorized:          ErrUnauthorized,
+		http.StatusNotFound:              ErrNotFound,
+		http.StatusConflict:              ErrConflict,
+		http.StatusRequestEntityTooLarge: ErrPayloadTooLarge,
+		http.StatusInsufficientStorage:   ErrInsufficientStorage,
+		http.StatusTooManyRequests:       ErrRateLimited,
+		http.StatusInternalServerError:   ErrServer,
+	}
+	for code, expectedErr := range expectations {
+		statusCode = code
+		_, err := c.ListVersions(context.Background(), "1")
+		assert.True(t, errors.Is(err, expectedErr))
+		var apiErr *APIError
+		assert.True(t, errors.As(err, &apiErr))
+		assert.Equal(t, code, apiErr.StatusCode)
+		assert.Equal(t, "app does not exist", apiErr.Message)
+	}
+}
+
+func TestStructuredErrorResponsesAreParsed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tools.WriteErrorWithDetails(w, r, http.StatusInsufficientStorage, tools.CodeQuotaExceeded, "not enough space", map[string]any{"limit_bytes": 10})
+	}))
+	defer server.Close()
+
+	err := New(server.URL).UploadVersion(context.Background(), "1", "0.0.1", []byte("content"), "")
+	assert.True(t, errors.Is(err, ErrInsufficientStorage))
+	var apiErr *APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, tools.CodeQuotaExceeded, apiErr.Code)
+	assert.Equal(t, "not enough space", apiErr.Message)
+	assert.Equal(t, float64(10), apiErr.Details["limit_bytes"])
+}
+
+func TestOnlyIdempotentRequestsAreRetried(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) < 3 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`[{"name":"0.0.1","id":"1"}]`))
+	}))
+	defer server.Close()
+	c := New(server.URL, WithRetries(3, time.Millisecond))
+
+	versions, err := c.ListVersions(context.Background(), "1")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(versions))
+	assert.Equal(t, "0.0.1", versions[0].Name)
+	assert.Equal(t, int32(3), requests.Load())
+
+	requests.Store(0)
+	err = c.DeleteVersion(context.Background(), "1")
+	assert.True(t, errors.Is(err, ErrServer))
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestRetriesStopWhenContextIsCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	c := New(server.URL, WithRetries(10, time.Hour))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := c.SearchApps(ctx, tools.AppSearchRequest{SearchTerm: "nginx"})
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestRetryWaitsForRetryAfter(t *testing.T) {
+	var requests atomic.Int32
+	var firstRequest time.Time
+	var waited time.Duration
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			firstRequest = time.Now()
+			w.Header().Set("Retry-After", "1")
+			tools.WriteError(w, r, http.StatusTooManyRequests, tools.CodeRateLimited, "too many requests")
+			return
+		}
+		waited = time.Since(firstRequest)
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+	c := New(server.URL, WithRetries(3, time.Millisecond))
+
+	_, err := c.ListVersions(context.Background(), "1")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), requests.Load())
+	assert.True(t, waited >= time.Second)
+}
+
+func TestRateLimitedErrorCarriesRetryAfter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "42")
+		tools.WriteError(w, r, http.StatusTooManyRequests, tools.CodeRateLimited, "too many requests")
+	}))
+	defer server.Close()
+
+	err := New(server.URL).CreateApp(context.Background(), "sampleapp")
+	assert.True(t, errors.Is(err, ErrRateLimited))
+	assert.False(t, errors.Is(err, ErrServer))
+	var apiErr *APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, tools.CodeRateLimited, apiErr.Code)
+	assert.Equal(t, 42*time.Second, apiErr.RetryAfter)
+}
+
+func TestValidationCodeIsEscaped(t *testing.T) {
+	var receivedCode string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedCode = r.URL.Query().Get("code")
+	}))
+	defer server.Close()
+
+	assert.Nil(t, New(server.URL).ValidateEmail(context.Background(), "a&b=c d"))
+	assert.Equal(t, "a&b=c d", receivedCode)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.Equal(t, 3*time.Second, parseRetryAfter("3", now))
+	assert.Equal(t, 10*time.Second, parseRetryAfter(now.Add(10*time.Second).Format(http.TimeFormat), now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(now.Add(-time.Minute).Format(http.TimeFormat), now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("-1", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+}
+
+func TestWebhookAndRetentionMethodsSendTheirPayloadToTheirPath(t *testing.T) {
+	requests := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests[r.URL.Path] = string(body)
+		switch r.URL.Path {
+		case tools.WebhookCreationPath:
+			_, _ = w.Write([]byte(`{"id":"7","url":"https://example.com/hook"}`))
+		case tools.WebhookListPath:
+			_, _ = w.Write([]byte(`[{"id":"7","url":"https://example.com/hook"}]`))
+		case tools.WebhookDeliveriesPath:
+			_, _ = w.Write([]byte(`[{"id":"1","event":"version.published","status":"delivered","attempts":1}]`))
+		case tools.RetentionPolicyGetPath:
+			_, _ = w.Write([]byte(`{"app_id":"3","keep_last":2}`))
+		case tools.RetentionDryRunPath:
+			_, _ = w.Write([]byte(`{"app_id":"3","versions":[{"name":"0.0.1","id":"5"}],"freed_bytes":10}`))
+		}
+	}))
+	defer server.Close()
+	c := New(server.URL)
+	ctx := context.Background()
+
+	webhook, err := c.CreateWebhook(ctx, tools.WebhookCreation{Url: "https://example.com/hook", Secret: "somesecret"})
+	assert.Nil(t, err)
+	assert.Equal(t, "7", webhook.Id)
+	webhooks, err := c.ListWebhooks(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(webhooks))
+	deliveries, err := c.ListWebhookDeliveries(ctx, "7")
+	assert.Nil(t, err)
+	assert.Equal(t, "delivered", deliveries[0].Status)
+	assert.Nil(t, c.DeleteWebhook(ctx, "7"))
+
+	assert.Nil(t, c.SetRetentionPolicy(ctx, tools.RetentionPolicy{AppId: "3", KeepLast: 2}))
+	policy, err := c.GetRetentionPolicy(ctx, "3")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, policy.KeepLast)
+	result, err := c.DryRunRetention(ctx, "3")
+	assert.Nil(t, err)
+	assert.Equal(t, 10, result.FreedBytes)
+	assert.Equal(t, "5", result.Versions[0].Id)
+
+	assert.Nil(t, c.SetUserQuota(ctx, tools.UserQuotaUpdate{User: "sampleuser"}))
+	assert.Nil(t, c.SetAppQuota(ctx, tools.AppQuotaUpdate{AppId: "3"}))
+
+	assert.Equal(t, `{"url":"https://example.com/hook","secret":"somesecret","all_apps":false}`, requests[tools.WebhookCreationPath])
+	assert.Equal(t, `{"value":"7"}`, requests[tools.WebhookDeletePath])
+	assert.Equal(t, `{"value":"7"}`, requests[tools.WebhookDeliveriesPath])
+	assert.Equal(t, `{"app_id":"3","keep_last":2,"keep_latest_per_major":false}`, requests[tools.RetentionPolicySetPath])
+	assert.Equal(t, `{"value":"3"}`, requests[tools.RetentionDryRunPath])
+	_, found := requests[tools.AdminUserQuotaPath]
+	assert.True(t, found)
+	_, found = requests[tools.AdminAppQuotaPath]
+	assert.True(t, found)
+}
+
+func TestReleaseFeedIsRequestedWithGetAndParsed(t *testing.T) {
+	var method, maintainer, app string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		maintainer = r.URL.Query().Get("maintainer")
+		app = r.URL.Query().Get("app")
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <id>http://localhost/api/feeds/releases</id>
+  <title>Releases of sampleuser/sampleapp</title>
+  <updated>2026-02-01T00:00:00Z</updated>
+  <entry>
+    <id>tag:localhost,2026-02-01:version/3</id>
+    <title>sampleuser/sampleapp 0.0.2</title>
+    <updated>2026-02-01T00:00:00Z</updated>
+    <author><name>sampleuser</name></author>
+    <summary type="text">Fixed a bug.</summary>
+  </entry>
+</feed>`))
+	}))
+	defer server.Close()
+
+	feed, err := New(server.URL).GetReleaseFeed(context.Background(), "sampleuser", "sampleapp")
+	assert.Nil(t, err)
+	assert.Equal(t, http.MethodGet, method)
+	assert.Equal(t, "sampleuser", maintainer)
+	assert.Equal(t, "sampleapp", app)
+	assert.Equal(t, "Releases of sampleuser/sampleapp", feed.Title)
+	assert.Equal(t, time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), feed.Updated)
+	assert.Equal(t, 1, len(feed.Entries))
+	entry := feed.Entries[0]
+	assert.Equal(t, "sampleuser/sampleapp 0.0.2", entry.Title)
+	assert.Equal(t, "sampleuser", entry.Author)
+	assert.Equal(t, "Fixed a bug.", entry.Summary)
+}
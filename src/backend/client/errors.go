@@ -0,0 +1,107 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"ocelot/store/tools"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidInput        = errors.New("invalid input")
+	ErrUnauthorized        = errors.New("unauthorized")
+	ErrNotFound            = errors.New("not found")
+	ErrConflict            = errors.New("conflict")
+	ErrPayloadTooLarge     = errors.New("payload too large")
+	ErrInsufficientStorage = errors.New("insufficient storage")
+	ErrRateLimited         = errors.New("rate limited")
+	ErrServer              = errors.New("server error")
+)
+
+// APIError is returned for every response with a non-2xx status code. It wraps one of the sentinel
+// errors above, so callers can use errors.Is(err, client.ErrNotFound) instead of comparing status codes.
+type APIError struct {
+	StatusCode int
+	Code       tools.ErrorCode
+	Message    string
+	Details    map[string]any
+	RequestId  string
+	// RetryAfter is the delay the store asked for in the Retry-After header of a 429 or 503 response, zero if none.
+	// Errors of 429 responses wrap ErrRateLimited.
+	RetryAfter time.Duration
+	kind       error
+}
+
+func (e *APIError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("store responded with status %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("store responded with status %d (%s): %s", e.StatusCode, e.Code, e.Message)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.kind
+}
+
+// newAPIError parses the structured error response of the store. Bodies that are not structured, e.g. sent by a
+// reverse proxy, are used as message.
+func newAPIError(statusCode int, body []byte) *APIError {
+	apiErr := &APIError{StatusCode: statusCode, kind: errorKindOf(statusCode)}
+	var errorResponse tools.ErrorResponse
+	if err := json.Unmarshal(body, &errorResponse); err == nil && errorResponse.Code != "" {
+		apiErr.Code = errorResponse.Code
+		apiErr.Message = errorResponse.Message
+		apiErr.Details = errorResponse.Details
+		apiErr.RequestId = errorResponse.RequestId
+	} else {
+		apiErr.Message = strings.TrimSpace(string(body))
+	}
+	return apiErr
+}
+
+func errorKindOf(statusCode int) error {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return ErrInvalidInput
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrUnauthorized
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusConflict:
+		return ErrConflict
+	case http.StatusRequestEntityTooLarge:
+		return ErrPayloadTooLarge
+	case http.StatusInsufficientStorage:
+		return ErrInsufficientStorage
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	default:
+		return ErrServer
+	}
+}
+
+// parseRetryAfter returns the delay given in a Retry-After header, which is either a number of seconds or an HTTP
+// date. Invalid values and dates in the past result in zero.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if seconds, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0)
+	}
+	return 0
+}
+
+// isRetryable reports whether a failed request may succeed when sent again unchanged.
+func isRetryable(statusCode int) bool {
+	switch statusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout, http.StatusTooManyRequests:
+		return true
+	default:
+		return false
+	}
+}
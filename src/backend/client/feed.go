@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"github.com/ocelot-cloud/shared/utils"
+	"net/http"
+	"net/url"
+	"ocelot/store/tools"
+	"time"
+)
+
+// Feed is the Atom feed of the newest releases, see GetReleaseFeed.
+type Feed struct {
+	Title   string      `xml:"title"`
+	Updated time.Time   `xml:"updated"`
+	Entries []FeedEntry `xml:"entry"`
+}
+
+// FeedEntry is a single release of a Feed. The summary is an excerpt of the changelog and empty if there is none.
+type FeedEntry struct {
+	Id      string    `xml:"id"`
+	Title   string    `xml:"title"`
+	Updated time.Time `xml:"updated"`
+	Author  string    `xml:"author>name"`
+	Summary string    `xml:"summary"`
+}
+
+// GetReleaseFeed returns the newest releases of all apps, of the apps of the maintainer or, if the app name is given
+// as well, of that app. Empty arguments are ignored.
+func (c *Client) GetReleaseFeed(ctx context.Context, maintainer, app string) (*Feed, error) {
+	query := url.Values{}
+	if maintainer != "" {
+		query.Set("maintainer", maintainer)
+	}
+	if app != "" {
+		query.Set("app", app)
+	}
+	path := tools.ReleaseFeedPath
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	resp, err := c.sendWithRetries(ctx, http.MethodGet, path, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	defer utils.Close(resp.Body)
+
+	var feed Feed
+	if err = xml.NewDecoder(resp.Body).Decode(&feed); err != nil {
+		return nil, fmt.Errorf("failed to decode release feed: %w", err)
+	}
+	return &feed, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"text/tabwriter"
+)
+
+var appCmd = &cobra.Command{
+	Use:   "app",
+	Short: "Manage your apps",
+}
+
+var appCreateCmd = &cobra.Command{
+	Use:   "create <app>",
+	Short: "Create a new app",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		storeClient, config, err := getAuthenticatedClient()
+		if err != nil {
+			return err
+		}
+		if err = storeClient.CreateApp(cmd.Context(), args[0]); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "created app '%s/%s'\n", config.User, args[0])
+		return nil
+	},
+}
+
+var appListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List your apps",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		storeClient, _, err := getAuthenticatedClient()
+		if err != nil {
+			return err
+		}
+		apps, err := storeClient.ListApps(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		writer := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "ID\tMAINTAINER\tAPP")
+		for _, app := range apps {
+			fmt.Fprintf(writer, "%s\t%s\t%s\n", app.Id, app.Maintainer, app.Name)
+		}
+		return writer.Flush()
+	},
+}
+
+func init() {
+	appCmd.AddCommand(appCreateCmd, appListCmd)
+}
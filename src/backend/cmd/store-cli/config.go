@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const defaultStoreUrl = "https://store.ocelot-cloud.org"
+
+// Config is persisted between invocations so that maintainers only need to log in once.
+type Config struct {
+	Url   string `json:"url"`
+	User  string `json:"user"`
+	Token string `json:"token"`
+}
+
+func defaultConfigPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ".store-cli.json"
+	}
+	return filepath.Join(configDir, "ocelot", "store-cli.json")
+}
+
+func loadConfig(path string) (*Config, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Config{Url: defaultStoreUrl}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var config Config
+	if err = json.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file '%s': %w", path, err)
+	}
+	if config.Url == "" {
+		config.Url = defaultStoreUrl
+	}
+	return &config, nil
+}
+
+// saveConfig writes the config readable only by the current user since it contains the session token.
+func saveConfig(path string, config *Config) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	content, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(path, content, 0600); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
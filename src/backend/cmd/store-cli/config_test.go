@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/ocelot-cloud/shared/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "store-cli.json")
+
+	config, err := loadConfig(path)
+	assert.Nil(t, err)
+	assert.Equal(t, defaultStoreUrl, config.Url)
+	assert.Equal(t, "", config.Token)
+
+	config.User = "samplemaintainer"
+	config.Token = "sometoken"
+	assert.Nil(t, saveConfig(path, config))
+
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	loaded, err := loadConfig(path)
+	assert.Nil(t, err)
+	assert.Equal(t, *config, *loaded)
+}
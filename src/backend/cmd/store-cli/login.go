@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"ocelot/store/client"
+	"os"
+	"strings"
+)
+
+var (
+	loginUrl      string
+	loginUser     string
+	loginPassword string
+)
+
+var loginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Log in and store the session token in the config file",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := loadConfig(configPath)
+		if err != nil {
+			return err
+		}
+		if loginUrl != "" {
+			config.Url = loginUrl
+		}
+		if loginUser == "" {
+			return fmt.Errorf("the --user flag is required")
+		}
+
+		password := loginPassword
+		if password == "" {
+			password = os.Getenv("STORE_PASSWORD")
+		}
+		if password == "" {
+			if password, err = promptPassword(); err != nil {
+				return err
+			}
+		}
+
+		storeClient := client.New(config.Url)
+		if err = storeClient.Login(cmd.Context(), loginUser, password); err != nil {
+			return err
+		}
+
+		config.User = loginUser
+		config.Token = storeClient.Token()
+		if err = saveConfig(configPath, config); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "logged in as '%s' at %s\n", config.User, config.Url)
+		return nil
+	},
+}
+
+var logoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Invalidate the session token and remove it from the config file",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		storeClient, config, err := getAuthenticatedClient()
+		if err != nil {
+			return err
+		}
+		if err = storeClient.Logout(cmd.Context()); err != nil {
+			return err
+		}
+		config.Token = ""
+		return saveConfig(configPath, config)
+	},
+}
+
+func init() {
+	loginCmd.Flags().StringVar(&loginUrl, "url", "", "base URL of the store, defaults to the last used one or "+defaultStoreUrl)
+	loginCmd.Flags().StringVar(&loginUser, "user", "", "name of the maintainer account")
+	loginCmd.Flags().StringVar(&loginPassword, "password", "", "password, can also be set via the STORE_PASSWORD env or is prompted for")
+}
+
+func promptPassword() (string, error) {
+	fmt.Print("Password: ")
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		password, err := term.ReadPassword(fd)
+		fmt.Println()
+		if err != nil {
+			return "", fmt.Errorf("failed to read password: %w", err)
+		}
+		return string(password), nil
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	return strings.TrimSpace(line), nil
+}
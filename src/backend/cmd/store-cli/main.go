@@ -0,0 +1,59 @@
+// store-cli is a command line tool for maintainers to publish apps in the Ocelot App Store.
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/spf13/cobra"
+	"ocelot/store/client"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+var configPath string
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := newRootCmd().ExecuteContext(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, "error: "+err.Error())
+		os.Exit(1)
+	}
+}
+
+func newRootCmd() *cobra.Command {
+	rootCmd := &cobra.Command{
+		Use:           "store-cli",
+		Short:         "store-cli publishes and manages apps in the Ocelot App Store",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", defaultConfigPath(), "path of the config file storing the credentials")
+	rootCmd.AddCommand(loginCmd, logoutCmd, appCmd, versionCmd)
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+	return rootCmd
+}
+
+// getClient returns a client using the credentials of the last login, if any, so it is only suited for public
+// endpoints.
+func getClient() (*client.Client, *Config, error) {
+	config, err := loadConfig(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client.New(config.Url, client.WithToken(config.Token)), config, nil
+}
+
+// getAuthenticatedClient returns a client using the credentials of the last login.
+func getAuthenticatedClient() (*client.Client, *Config, error) {
+	storeClient, config, err := getClient()
+	if err != nil {
+		return nil, nil, err
+	}
+	if config.Token == "" {
+		return nil, nil, fmt.Errorf("not logged in, please run 'store-cli login' first")
+	}
+	return storeClient, config, nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"github.com/ocelot-cloud/shared/validation"
+	"github.com/spf13/cobra"
+	"io"
+	"ocelot/store/tools"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+var (
+	versionApp        string
+	versionMaintainer string
+	versionChangelog  string
+)
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Manage the versions of your apps",
+}
+
+var versionPublishCmd = &cobra.Command{
+	Use:   "publish <dir> <version>",
+	Short: "Zip the app directory, validate it locally and upload it as a new version",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, version := args[0], args[1]
+		storeClient, config, err := getAuthenticatedClient()
+		if err != nil {
+			return err
+		}
+
+		changelog, err := readChangelog(versionChangelog)
+		if err != nil {
+			return err
+		}
+		content, err := validation.ZipDirectory(dir)
+		if err != nil {
+			return fmt.Errorf("failed to zip directory '%s': %w", dir, err)
+		}
+		if err = validation.ValidateVersion(content, config.User, versionApp); err != nil {
+			return fmt.Errorf("version is invalid: %w", err)
+		}
+
+		app, err := storeClient.LookupApp(cmd.Context(), config.User, versionApp)
+		if err != nil {
+			return err
+		}
+		if err = storeClient.UploadVersion(cmd.Context(), app.AppId, version, content, changelog); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "published version '%s' of app '%s/%s'\n", version, config.User, versionApp)
+		return nil
+	},
+}
+
+// readChangelog reads the changelog from the given file, or from stdin if the path is '-'.
+func readChangelog(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	var changelog []byte
+	var err error
+	if path == "-" {
+		changelog, err = io.ReadAll(os.Stdin)
+	} else {
+		changelog, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read changelog: %w", err)
+	}
+	if len(changelog) > tools.MaxChangelogLength {
+		return "", fmt.Errorf("changelog must not be longer than %d bytes", tools.MaxChangelogLength)
+	}
+	return string(changelog), nil
+}
+
+var versionListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the versions of an app, newest first",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// listing versions is public, so no login is required
+		storeClient, config, err := getClient()
+		if err != nil {
+			return err
+		}
+		maintainer := versionMaintainer
+		if maintainer == "" {
+			maintainer = config.User
+		}
+		if maintainer == "" {
+			return fmt.Errorf("the --maintainer flag is required when not logged in")
+		}
+
+		app, err := storeClient.LookupApp(cmd.Context(), maintainer, versionApp)
+		if err != nil {
+			return err
+		}
+		versions, err := storeClient.ListVersions(cmd.Context(), app.AppId)
+		if err != nil {
+			return err
+		}
+
+		writer := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "ID\tVERSION\tCREATED")
+		for _, version := range versions {
+			fmt.Fprintf(writer, "%s\t%s\t%s\n", version.Id, version.Name, version.CreationTimestamp.Format(time.RFC3339))
+		}
+		return writer.Flush()
+	},
+}
+
+// The store has no soft deletion, so yanking a version removes it just like deleting it.
+var versionDeleteCmd = &cobra.Command{
+	Use:     "delete <version>",
+	Aliases: []string{"yank"},
+	Short:   "Delete a version so that it can no longer be downloaded",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		storeClient, config, err := getAuthenticatedClient()
+		if err != nil {
+			return err
+		}
+		version, err := storeClient.LookupVersion(cmd.Context(), config.User, versionApp, args[0])
+		if err != nil {
+			return err
+		}
+		if err = storeClient.DeleteVersion(cmd.Context(), version.VersionId); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "deleted version '%s' of app '%s/%s'\n", version.VersionName, config.User, versionApp)
+		return nil
+	},
+}
+
+func init() {
+	versionCmd.PersistentFlags().StringVar(&versionApp, "app", "", "name of the app")
+	_ = versionCmd.MarkPersistentFlagRequired("app")
+	versionPublishCmd.Flags().StringVar(&versionChangelog, "changelog", "", "file containing the changelog of the version, '-' reads it from stdin")
+	versionListCmd.Flags().StringVar(&versionMaintainer, "maintainer", "", "maintainer of the app, defaults to the logged in user")
+	versionCmd.AddCommand(versionPublishCmd, versionListCmd, versionDeleteCmd)
+}
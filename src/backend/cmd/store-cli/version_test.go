@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/ocelot-cloud/shared/assert"
+	"github.com/ocelot-cloud/shared/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"net/http"
+	"net/http/httptest"
+	"ocelot/store/tools"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sampleToken = "sometoken"
+
+// fakeStore serves the routes used by the version commands for the app of tools.SampleUser and records the changes.
+type fakeStore struct {
+	uploads            []tools.VersionUpload
+	deletedVersionIds  []string
+	listedWithoutToken bool
+}
+
+func newFakeStore(t *testing.T) (*fakeStore, string) {
+	store := &fakeStore{}
+	server := httptest.NewServer(http.HandlerFunc(store.handle))
+	t.Cleanup(server.Close)
+	return store, server.URL
+}
+
+func (s *fakeStore) handle(w http.ResponseWriter, r *http.Request) {
+	authenticated := r.Header.Get("Authorization") == "Bearer "+sampleToken
+	switch r.URL.Path {
+	case tools.AppLookupPath:
+		var request tools.AppLookupRequest
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		if request.Maintainer != tools.SampleUser || request.AppName != tools.SampleApp {
+			tools.WriteError(w, r, http.StatusNotFound, tools.CodeAppNotFound, "app not found")
+			return
+		}
+		utils.SendJsonResponse(w, tools.AppWithLatestVersion{Maintainer: tools.SampleUser, AppId: "1", AppName: tools.SampleApp})
+	case tools.GetVersionsPath:
+		s.listedWithoutToken = !authenticated
+		utils.SendJsonResponse(w, []tools.Version{
+			{Id: "3", Name: "0.0.2", CreationTimestamp: time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)},
+			{Id: "2", Name: "0.0.1", CreationTimestamp: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		})
+	case tools.VersionLookupPath:
+		var request tools.VersionLookupRequest
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		if request.VersionName != "0.0.1" {
+			tools.WriteError(w, r, http.StatusNotFound, tools.CodeVersionNotFound, "version not found")
+			return
+		}
+		utils.SendJsonResponse(w, tools.VersionLookupResult{Maintainer: tools.SampleUser, AppId: "1", AppName: tools.SampleApp, VersionId: "2", VersionName: "0.0.1"})
+	case tools.VersionUploadPath, tools.VersionDeletePath:
+		if !authenticated {
+			tools.WriteError(w, r, http.StatusUnauthorized, tools.CodeCookieNotFound, "cookie not found")
+			return
+		}
+		if r.URL.Path == tools.VersionUploadPath {
+			var upload tools.VersionUpload
+			_ = json.NewDecoder(r.Body).Decode(&upload)
+			s.uploads = append(s.uploads, upload)
+		} else {
+			var versionId tools.NumberString
+			_ = json.NewDecoder(r.Body).Decode(&versionId)
+			s.deletedVersionIds = append(s.deletedVersionIds, versionId.Value)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// useConfig writes a config with the given credentials and returns its path.
+func useConfig(t *testing.T, config *Config) string {
+	path := filepath.Join(t.TempDir(), "store-cli.json")
+	assert.Nil(t, saveConfig(path, config))
+	return path
+}
+
+// runCli runs the command line tool with the given arguments and returns what it printed.
+func runCli(t *testing.T, args ...string) (string, error) {
+	rootCmd := newRootCmd()
+	var output bytes.Buffer
+	rootCmd.SetOut(&output)
+	rootCmd.SetArgs(args)
+	err := rootCmd.ExecuteContext(context.Background())
+	// the flags are bound to package variables, so they would keep their values for the next run
+	resetFlags(rootCmd)
+	return output.String(), err
+}
+
+func resetFlags(cmd *cobra.Command) {
+	reset := func(flag *pflag.Flag) {
+		_ = flag.Value.Set(flag.DefValue)
+		flag.Changed = false
+	}
+	cmd.Flags().VisitAll(reset)
+	cmd.PersistentFlags().VisitAll(reset)
+	for _, child := range cmd.Commands() {
+		resetFlags(child)
+	}
+}
+
+// stubDocker puts a docker executable accepting every compose file on the PATH, since the local validation checks the
+// syntax with 'docker compose config'.
+func stubDocker(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "docker"), []byte("#!/bin/sh\nexit 0\n"), 0700))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestVersionPublishUploadsTheZippedDirectory(t *testing.T) {
+	stubDocker(t)
+	store, url := newFakeStore(t)
+	configFile := useConfig(t, &Config{Url: url, User: tools.SampleUser, Token: sampleToken})
+	changelogFile := filepath.Join(t.TempDir(), "CHANGELOG.md")
+	assert.Nil(t, os.WriteFile(changelogFile, []byte("Initial release."), 0600))
+
+	output, err := runCli(t, "--config", configFile, "version", "publish", utils.FindDir("assets")+"/samplemaintainer-app", "0.0.3",
+		"--app", tools.SampleApp, "--changelog", changelogFile)
+	assert.Nil(t, err)
+	assert.Equal(t, "published version '0.0.3' of app 'samplemaintainer/gitea'\n", output)
+	assert.Equal(t, 1, len(store.uploads))
+	upload := store.uploads[0]
+	assert.Equal(t, "1", upload.AppId)
+	assert.Equal(t, "0.0.3", upload.Version)
+	assert.Equal(t, "Initial release.", upload.Changelog)
+	assert.Equal(t, tools.GetValidVersionBytesOfSampleMaintainerApp(), upload.Content)
+}
+
+func TestVersionPublishRejectsInvalidVersionsLocally(t *testing.T) {
+	store, url := newFakeStore(t)
+	configFile := useConfig(t, &Config{Url: url, User: tools.SampleUser, Token: sampleToken})
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not an app"), 0600))
+
+	_, err := runCli(t, "--config", configFile, "version", "publish", dir, "0.0.3", "--app", tools.SampleApp)
+	assert.NotNil(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "version is invalid"))
+	assert.Equal(t, 0, len(store.uploads))
+}
+
+func TestVersionPublishRequiresLogin(t *testing.T) {
+	store, url := newFakeStore(t)
+	configFile := useConfig(t, &Config{Url: url})
+
+	_, err := runCli(t, "--config", configFile, "version", "publish", t.TempDir(), "0.0.3", "--app", tools.SampleApp)
+	assert.NotNil(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "not logged in"))
+	assert.Equal(t, 0, len(store.uploads))
+}
+
+func TestVersionListWorksWithoutLogin(t *testing.T) {
+	store, url := newFakeStore(t)
+	configFile := useConfig(t, &Config{Url: url})
+
+	output, err := runCli(t, "--config", configFile, "version", "list", "--app", tools.SampleApp, "--maintainer", tools.SampleUser)
+	assert.Nil(t, err)
+	assert.True(t, store.listedWithoutToken)
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	assert.Equal(t, 3, len(lines))
+	assert.Equal(t, []string{"ID", "VERSION", "CREATED"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"3", "0.0.2", "2026-02-01T00:00:00Z"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"2", "0.0.1", "2026-01-01T00:00:00Z"}, strings.Fields(lines[2]))
+
+	_, err = runCli(t, "--config", configFile, "version", "list", "--app", tools.SampleApp)
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "--maintainer"))
+}
+
+func TestVersionListDefaultsToTheLoggedInMaintainer(t *testing.T) {
+	_, url := newFakeStore(t)
+	configFile := useConfig(t, &Config{Url: url, User: tools.SampleUser, Token: sampleToken})
+
+	output, err := runCli(t, "--config", configFile, "version", "list", "--app", tools.SampleApp)
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(output, "0.0.2"))
+
+	_, err = runCli(t, "--config", configFile, "version", "list", "--app", "unknownapp")
+	assert.NotNil(t, err)
+}
+
+func TestVersionDeleteAndYankDeleteTheVersion(t *testing.T) {
+	for _, command := range []string{"delete", "yank"} {
+		store, url := newFakeStore(t)
+		configFile := useConfig(t, &Config{Url: url, User: tools.SampleUser, Token: sampleToken})
+
+		output, err := runCli(t, "--config", configFile, "version", command, "0.0.1", "--app", tools.SampleApp)
+		assert.Nil(t, err)
+		assert.Equal(t, "deleted version '0.0.1' of app 'samplemaintainer/gitea'\n", output)
+		assert.Equal(t, []string{"2"}, store.deletedVersionIds)
+
+		_, err = runCli(t, "--config", configFile, "version", command, "9.9.9", "--app", tools.SampleApp)
+		assert.NotNil(t, err)
+		assert.Equal(t, 1, len(store.deletedVersionIds))
+	}
+}
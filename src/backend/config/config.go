@@ -0,0 +1,622 @@
+package config
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/ocelot-cloud/shared/utils"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net/netip"
+	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPath = "data/config.yml"
+	// legacyEnvFilePath is the file used for configuration before the config file was introduced. It is still read
+	// if present so that existing deployments keep working, but the config file takes precedence.
+	legacyEnvFilePath = "data/.env"
+	envPrefix         = "STORE_"
+
+	ProfileProd = "PROD"
+	ProfileTest = "TEST"
+
+	DriverPostgres = "postgres"
+	// DriverSqlite stores all data in a single embedded database file, which is handy for small setups and tests.
+	DriverSqlite = "sqlite"
+)
+
+var (
+	logLevels = []string{"TRACE", "DEBUG", "INFO", "WARN", "ERROR"}
+	sslModes  = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+)
+
+// Config contains all settings of the store. Values are taken from the defaults, the legacy data/.env file, the
+// config file, environment variables and command line flags, where later sources override earlier ones.
+type Config struct {
+	Server    ServerConfig    `yaml:"server"`
+	Tls       TlsConfig       `yaml:"tls"`
+	Database  DatabaseConfig  `yaml:"database"`
+	Email     EmailConfig     `yaml:"email"`
+	Quota     QuotaConfig     `yaml:"quota"`
+	Jobs      JobsConfig      `yaml:"jobs"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	Cors      CorsConfig      `yaml:"cors"`
+	Webhooks  WebhooksConfig  `yaml:"webhooks"`
+}
+
+type ServerConfig struct {
+	// PublicUrl is the URL under which users reach the store, it is used for links in emails and release feeds.
+	PublicUrl    string        `yaml:"public_url"`
+	Port         int           `yaml:"port"`
+	Profile      string        `yaml:"profile"`
+	LogLevel     string        `yaml:"log_level"`
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+	// ShutdownTimeout is how long running requests may take to finish when the store is stopped.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// CspReportOnly makes browsers only report violations of the Content Security Policy instead of blocking them,
+	// which helps to check a changed frontend before enforcing the policy.
+	CspReportOnly bool `yaml:"csp_report_only"`
+	// FrontendDir is a directory containing a frontend build which is served instead of the one embedded into the
+	// binary, e.g. to test frontend changes without rebuilding the store.
+	FrontendDir string `yaml:"frontend_dir"`
+	// MetricsToken protects the metrics, which are then only served to requests with the header
+	// "Authorization: Bearer <token>". They are public if empty.
+	MetricsToken string `yaml:"metrics_token"`
+}
+
+// TlsConfig enables serving HTTPS on the server port instead of HTTP if a certificate is configured.
+type TlsConfig struct {
+	// CertFile and KeyFile are PEM files containing the certificate chain and its private key. They are reloaded when
+	// they change, e.g. after a renewal by certbot.
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ReloadCheckInterval is how often the files are checked for changes.
+	ReloadCheckInterval time.Duration `yaml:"reload_check_interval"`
+	// RedirectPort is the port of a plain HTTP listener redirecting all requests to HTTPS, 0 disables it.
+	RedirectPort int `yaml:"redirect_port"`
+	// HstsMaxAge is how long browsers should only use HTTPS for the store, 0 disables the Strict-Transport-Security header.
+	HstsMaxAge time.Duration `yaml:"hsts_max_age"`
+}
+
+func (c TlsConfig) IsEnabled() bool {
+	return c.CertFile != ""
+}
+
+type DatabaseConfig struct {
+	Driver string `yaml:"driver"`
+	// Path is the database file used by the sqlite driver. All other settings except the pool sizes, the connect
+	// timeout and RunMigrations only apply to the postgres driver.
+	Path string `yaml:"path"`
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+	Name string `yaml:"name"`
+	User string `yaml:"user"`
+	// PasswordFile is the path of a file containing the password of the database user. The password itself is not
+	// part of the config so that it can be provided as a secret. No password is used if empty.
+	PasswordFile          string        `yaml:"password_file"`
+	SslMode               string        `yaml:"sslmode"`
+	MaxOpenConnections    int           `yaml:"max_open_connections"`
+	MaxIdleConnections    int           `yaml:"max_idle_connections"`
+	ConnectionMaxLifetime time.Duration `yaml:"connection_max_lifetime"`
+	// ConnectTimeout is how long to wait for the database to become reachable on startup.
+	ConnectTimeout time.Duration `yaml:"connect_timeout"`
+	// RunMigrations can be disabled if migrations are applied separately, the schema version is checked anyway.
+	RunMigrations bool `yaml:"run_migrations"`
+}
+
+// ReadPassword returns the content of the password file without trailing line breaks.
+func (c DatabaseConfig) ReadPassword() (string, error) {
+	if c.PasswordFile == "" {
+		return "", nil
+	}
+	content, err := os.ReadFile(c.PasswordFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read database password file: %w", err)
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+type EmailConfig struct {
+	SmtpHost string `yaml:"smtp_host"`
+	SmtpPort int    `yaml:"smtp_port"`
+	// From is the sender address of emails.
+	From     string `yaml:"from"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	// UseMockClient disables sending emails, should only be used for testing.
+	UseMockClient bool `yaml:"use_mock_client"`
+	// ReadinessCheck makes the store only report readiness if it can log in to the SMTP server.
+	ReadinessCheck bool `yaml:"readiness_check"`
+}
+
+type QuotaConfig struct {
+	MaxPayloadSize      int      `yaml:"max_payload_size"`
+	DefaultStorageLimit int      `yaml:"default_storage_limit"`
+	AdminUsers          []string `yaml:"admin_users"`
+}
+
+// IsAdmin reports whether the user may change the storage quotas of users and apps.
+func (c QuotaConfig) IsAdmin(user string) bool {
+	return slices.Contains(c.AdminUsers, user)
+}
+
+type JobsConfig struct {
+	UsedSpaceReconciliationInterval time.Duration `yaml:"used_space_reconciliation_interval"`
+	VersionPruningInterval          time.Duration `yaml:"version_pruning_interval"`
+	// MetricsRefreshInterval is how often the numbers of users, apps and versions exposed as metrics are counted.
+	MetricsRefreshInterval time.Duration `yaml:"metrics_refresh_interval"`
+}
+
+// RateLimitConfig limits the requests of a single client per class of routes. Clients are identified by their user
+// name on protected routes and by their IP address otherwise. Each client may send up to the burst size of requests
+// at once, which are refilled with the given rate per minute.
+type RateLimitConfig struct {
+	// Enabled has no effect in the TEST profile, where rate limiting is always disabled.
+	Enabled bool `yaml:"enabled"`
+	// TrustedProxies are the IP addresses or CIDR ranges of reverse proxies. For requests coming from them, the client
+	// IP address is taken from the X-Forwarded-For header.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// Account covers registration, email validation, login and password changes.
+	AccountPerMinute int `yaml:"account_per_minute"`
+	AccountBurst     int `yaml:"account_burst"`
+	// Search covers searching apps, looking up apps and versions and the other reading routes, e.g. the metrics.
+	SearchPerMinute   int `yaml:"search_per_minute"`
+	SearchBurst       int `yaml:"search_burst"`
+	DownloadPerMinute int `yaml:"download_per_minute"`
+	DownloadBurst     int `yaml:"download_burst"`
+	// Write covers the creation and deletion of apps, versions and webhooks and changes of retention policies.
+	WritePerMinute int `yaml:"write_per_minute"`
+	WriteBurst     int `yaml:"write_burst"`
+}
+
+// ParseTrustedProxies returns the trusted proxies as prefixes, single addresses are converted to prefixes matching
+// only the address.
+func (c RateLimitConfig) ParseTrustedProxies() ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, proxy := range c.TrustedProxies {
+		if address, err := netip.ParseAddr(proxy); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(address, address.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is neither an IP address nor a CIDR range", proxy)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// CorsConfig allows browsers to call the API from origins other than the store itself, e.g. a frontend hosted on
+// another domain. Requests from the host of the store are always allowed, requests from other origins are rejected
+// unless they are listed.
+type CorsConfig struct {
+	// AllowedOrigins are origins like "https://dashboard.example.com". "*" allows all origins, but only without
+	// credentials.
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	AllowedMethods []string `yaml:"allowed_methods"`
+	AllowedHeaders []string `yaml:"allowed_headers"`
+	// AllowCredentials lets browsers send the session cookie along with requests from the allowed origins.
+	AllowCredentials bool `yaml:"allow_credentials"`
+	// MaxAge is how long browsers may cache the result of a preflight request.
+	MaxAge time.Duration `yaml:"max_age"`
+}
+
+// IsOriginAllowed reports whether the origin is listed in AllowedOrigins, either explicitly or by a wildcard.
+func (c CorsConfig) IsOriginAllowed(origin string) bool {
+	return slices.Contains(c.AllowedOrigins, "*") || slices.Contains(c.AllowedOrigins, origin)
+}
+
+// WebhooksConfig controls the delivery of events to the webhooks registered by maintainers. Deliveries are queued in
+// the database and retried with exponential backoff until they succeed or MaxAttempts is reached.
+type WebhooksConfig struct {
+	MaxPerUser int `yaml:"max_per_user"`
+	// Timeout is how long a receiver may take to answer a delivery.
+	Timeout     time.Duration `yaml:"timeout"`
+	MaxAttempts int           `yaml:"max_attempts"`
+	// InitialBackoff is the delay before the first retry, it doubles with every further attempt up to MaxBackoff.
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+	// PollInterval is how often the queue is checked for deliveries which are due for a retry.
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// HistoryRetention is how long finished deliveries are kept in the delivery history.
+	HistoryRetention time.Duration `yaml:"history_retention"`
+	// AllowPrivateAddresses permits deliveries to loopback and private network addresses. It is disabled by default so
+	// that maintainers cannot use webhooks to reach services in the network of the store.
+	AllowPrivateAddresses bool `yaml:"allow_private_addresses"`
+}
+
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			PublicUrl:       "http://localhost:8082",
+			Port:            8082,
+			Profile:         ProfileProd,
+			LogLevel:        "INFO",
+			ReadTimeout:     10 * time.Second,
+			WriteTimeout:    10 * time.Second,
+			IdleTimeout:     120 * time.Second,
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Database: DatabaseConfig{
+			Driver:                DriverPostgres,
+			Path:                  "data/store.db",
+			Host:                  "localhost",
+			Port:                  5433,
+			Name:                  "postgres",
+			User:                  "postgres",
+			SslMode:               "disable",
+			MaxOpenConnections:    20,
+			MaxIdleConnections:    5,
+			ConnectionMaxLifetime: 30 * time.Minute,
+			ConnectTimeout:        30 * time.Second,
+			RunMigrations:         true,
+		},
+		Tls: TlsConfig{
+			ReloadCheckInterval: time.Minute,
+			HstsMaxAge:          365 * 24 * time.Hour,
+		},
+		Email: EmailConfig{
+			SmtpPort: 465,
+		},
+		Quota: QuotaConfig{
+			MaxPayloadSize:      1024 * 1024, // = 1 MiB
+			DefaultStorageLimit: 10 * 1024 * 1024,
+		},
+		Jobs: JobsConfig{
+			UsedSpaceReconciliationInterval: time.Hour,
+			VersionPruningInterval:          time.Hour,
+			MetricsRefreshInterval:          time.Minute,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:           true,
+			AccountPerMinute:  20,
+			AccountBurst:      20,
+			SearchPerMinute:   120,
+			SearchBurst:       60,
+			DownloadPerMinute: 60,
+			DownloadBurst:     30,
+			WritePerMinute:    60,
+			WriteBurst:        30,
+		},
+		Cors: CorsConfig{
+			AllowedMethods:   []string{"GET", "POST", "OPTIONS"},
+			AllowedHeaders:   []string{"Accept", "Content-Type", "Authorization", "X-CSRF-Token", "X-Request-ID"},
+			AllowCredentials: true,
+			MaxAge:           10 * time.Minute,
+		},
+		Webhooks: WebhooksConfig{
+			MaxPerUser:       10,
+			Timeout:          10 * time.Second,
+			MaxAttempts:      8,
+			InitialBackoff:   time.Minute,
+			MaxBackoff:       6 * time.Hour,
+			PollInterval:     10 * time.Second,
+			HistoryRetention: 30 * 24 * time.Hour,
+		},
+	}
+}
+
+func (c *Config) IsTestProfile() bool {
+	return c.Server.Profile == ProfileTest
+}
+
+// UsesRateLimits reports whether requests are rate limited, which is never the case in the TEST profile.
+func (c *Config) UsesRateLimits() bool {
+	return c.RateLimit.Enabled && !c.IsTestProfile()
+}
+
+// UsesMockEmailClient reports whether sending emails is disabled, which is always the case in the TEST profile.
+func (c *Config) UsesMockEmailClient() bool {
+	return c.Email.UseMockClient || c.IsTestProfile()
+}
+
+// Load builds the config from all sources and validates it. args are the command line arguments without the program name.
+func Load(args []string) (*Config, error) {
+	flags := flag.NewFlagSet("store", flag.ContinueOnError)
+	configPath := flags.String("config", DefaultPath, "path of the YAML config file")
+	port := flags.Int("port", 0, "port the server listens on")
+	profile := flags.String("profile", "", "profile, either PROD or TEST")
+	logLevel := flags.String("log-level", "", "log level, one of "+strings.Join(logLevels, ", "))
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	isConfigPathSet := false
+	flags.Visit(func(f *flag.Flag) {
+		isConfigPathSet = isConfigPathSet || f.Name == "config"
+	})
+
+	config := Default()
+	problems, err := config.loadLegacyEnvFile(legacyEnvFilePath)
+	if err != nil {
+		return nil, err
+	}
+	if err = config.loadFile(*configPath, isConfigPathSet); err != nil {
+		return nil, err
+	}
+	problems = append(problems, config.loadEnvOverrides(os.LookupEnv)...)
+
+	if *port != 0 {
+		config.Server.Port = *port
+	}
+	if *profile != "" {
+		config.Server.Profile = *profile
+	}
+	if *logLevel != "" {
+		config.Server.LogLevel = *logLevel
+	}
+	config.Server.Profile = strings.ToUpper(config.Server.Profile)
+	config.Server.LogLevel = strings.ToUpper(config.Server.LogLevel)
+	config.Database.Driver = strings.ToLower(config.Database.Driver)
+
+	problems = append(problems, config.validate()...)
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	return config, nil
+}
+
+// loadFile reads the YAML config file. A missing file is only an error if its path was set explicitly.
+func (c *Config) loadFile(path string, isRequired bool) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) && !isRequired {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer utils.Close(file)
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err = decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file '%s': %w", path, err)
+	}
+	return nil
+}
+
+var legacyEnvKeys = map[string]string{
+	"HOST":           "STORE_SERVER_PUBLIC_URL",
+	"SMTP_HOST":      "STORE_EMAIL_SMTP_HOST",
+	"SMTP_PORT":      "STORE_EMAIL_SMTP_PORT",
+	"EMAIL":          "STORE_EMAIL_FROM",
+	"EMAIL_USER":     "STORE_EMAIL_USER",
+	"EMAIL_PASSWORD": "STORE_EMAIL_PASSWORD",
+}
+
+func (c *Config) loadLegacyEnvFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open legacy env file: %w", err)
+	}
+	defer utils.Close(file)
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), "=")
+		if newKey, isKnown := legacyEnvKeys[key]; found && isKnown {
+			values[newKey] = value
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read legacy env file: %w", err)
+	}
+
+	return c.loadEnvOverrides(func(key string) (string, bool) {
+		value, found := values[key]
+		return value, found
+	}), nil
+}
+
+// loadEnvOverrides sets every field for which an environment variable is present. The variable name consists of
+// the prefix STORE_ and the YAML keys of the section and the field, e.g. STORE_SERVER_PORT. Lists are comma separated.
+// It returns the variables which could not be parsed.
+func (c *Config) loadEnvOverrides(lookupEnv func(string) (string, bool)) []string {
+	var problems []string
+	forEachField(c, func(key string, field reflect.Value) {
+		value, found := lookupEnv(EnvName(key))
+		if !found {
+			return
+		}
+		if err := setField(field, value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", EnvName(key), err))
+		}
+	})
+	return problems
+}
+
+// EnvName returns the name of the environment variable overriding the setting with the given dotted key, e.g. "server.port".
+func EnvName(key string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+func forEachField(config *Config, apply func(key string, field reflect.Value)) {
+	sections := reflect.ValueOf(config).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		sectionName := sections.Type().Field(i).Tag.Get("yaml")
+		section := sections.Field(i)
+		for j := 0; j < section.NumField(); j++ {
+			apply(sectionName+"."+section.Type().Field(j).Tag.Get("yaml"), section.Field(j))
+		}
+	}
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func setField(field reflect.Value, value string) error {
+	switch {
+	case field.Type() == durationType:
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a duration like '30s'", value)
+		}
+		field.SetInt(int64(duration))
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	case field.Kind() == reflect.Int:
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a number", value)
+		}
+		field.SetInt(int64(number))
+	case field.Kind() == reflect.Bool:
+		boolean, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("'%s' is not a boolean", value)
+		}
+		field.SetBool(boolean)
+	case field.Kind() == reflect.Slice:
+		var values []string
+		for _, element := range strings.Split(value, ",") {
+			if element = strings.TrimSpace(element); element != "" {
+				values = append(values, element)
+			}
+		}
+		field.Set(reflect.ValueOf(values))
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+// ValidationError lists every problem found in the config, so that all of them can be fixed at once.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+func (c *Config) Validate() error {
+	if problems := c.validate(); len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func (c *Config) validate() []string {
+	var problems []string
+	check := func(isValid bool, format string, args ...any) {
+		if !isValid {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	publicUrl, err := url.Parse(c.Server.PublicUrl)
+	check(err == nil && (publicUrl.Scheme == "http" || publicUrl.Scheme == "https") && publicUrl.Host != "",
+		"server.public_url must be an absolute http or https URL, but was '%s'", c.Server.PublicUrl)
+	check(isValidPort(c.Server.Port), "server.port must be between 1 and 65535, but was %d", c.Server.Port)
+	check(c.Server.Profile == ProfileProd || c.Server.Profile == ProfileTest, "server.profile must be %s or %s, but was '%s'", ProfileProd, ProfileTest, c.Server.Profile)
+	check(slices.Contains(logLevels, c.Server.LogLevel), "server.log_level must be one of %s, but was '%s'", strings.Join(logLevels, ", "), c.Server.LogLevel)
+	check(c.Server.ReadTimeout > 0, "server.read_timeout must be positive")
+	check(c.Server.WriteTimeout > 0, "server.write_timeout must be positive")
+	check(c.Server.IdleTimeout > 0, "server.idle_timeout must be positive")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+
+	check((c.Tls.CertFile == "") == (c.Tls.KeyFile == ""), "tls.cert_file and tls.key_file must either both be set or both be empty")
+	if c.Tls.IsEnabled() && c.Tls.KeyFile != "" {
+		_, err = tls.LoadX509KeyPair(c.Tls.CertFile, c.Tls.KeyFile)
+		check(err == nil, "tls.cert_file and tls.key_file must contain a certificate and its key: %v", err)
+	}
+	check(c.Tls.ReloadCheckInterval > 0, "tls.reload_check_interval must be positive")
+	check(c.Tls.RedirectPort == 0 || isValidPort(c.Tls.RedirectPort) && c.Tls.RedirectPort != c.Server.Port,
+		"tls.redirect_port must be 0 or a port between 1 and 65535 other than server.port, but was %d", c.Tls.RedirectPort)
+	check(c.Tls.RedirectPort == 0 || c.Tls.IsEnabled(), "tls.redirect_port requires tls.cert_file and tls.key_file")
+	check(c.Tls.HstsMaxAge >= 0, "tls.hsts_max_age must not be negative")
+
+	switch c.Database.Driver {
+	case DriverPostgres:
+		check(c.Database.Host != "", "database.host must not be empty")
+		check(isValidPort(c.Database.Port), "database.port must be between 1 and 65535, but was %d", c.Database.Port)
+		check(c.Database.Name != "", "database.name must not be empty")
+		check(c.Database.User != "", "database.user must not be empty")
+		if c.Database.PasswordFile != "" {
+			_, err = c.Database.ReadPassword()
+			check(err == nil, "database.password_file must be readable: %v", err)
+		}
+		check(slices.Contains(sslModes, c.Database.SslMode), "database.sslmode must be one of %s, but was '%s'", strings.Join(sslModes, ", "), c.Database.SslMode)
+	case DriverSqlite:
+		check(c.Database.Path != "", "database.path must not be empty when using the %s driver", DriverSqlite)
+	default:
+		check(false, "database.driver must be %s or %s, but was '%s'", DriverPostgres, DriverSqlite, c.Database.Driver)
+	}
+	check(c.Database.MaxOpenConnections > 0, "database.max_open_connections must be positive, but was %d", c.Database.MaxOpenConnections)
+	check(c.Database.MaxIdleConnections >= 0 && c.Database.MaxIdleConnections <= c.Database.MaxOpenConnections,
+		"database.max_idle_connections must be between 0 and database.max_open_connections, but was %d", c.Database.MaxIdleConnections)
+	check(c.Database.ConnectionMaxLifetime >= 0, "database.connection_max_lifetime must not be negative")
+	check(c.Database.ConnectTimeout > 0, "database.connect_timeout must be positive")
+
+	// the SMTP settings are only needed if emails are actually sent, see UsesMockEmailClient
+	if !c.UsesMockEmailClient() {
+		check(c.Email.SmtpHost != "", "email.smtp_host must not be empty unless email.use_mock_client is enabled")
+		check(isValidPort(c.Email.SmtpPort), "email.smtp_port must be between 1 and 65535, but was %d", c.Email.SmtpPort)
+		check(strings.Contains(c.Email.From, "@"), "email.from must be an email address, but was '%s'", c.Email.From)
+		check(c.Email.User != "", "email.user must not be empty unless email.use_mock_client is enabled")
+		check(c.Email.Password != "", "email.password must not be empty unless email.use_mock_client is enabled")
+	}
+
+	check(c.Quota.MaxPayloadSize > 0, "quota.max_payload_size must be positive, but was %d", c.Quota.MaxPayloadSize)
+	check(c.Quota.DefaultStorageLimit > 0, "quota.default_storage_limit must be positive, but was %d", c.Quota.DefaultStorageLimit)
+
+	check(c.Jobs.UsedSpaceReconciliationInterval > 0, "jobs.used_space_reconciliation_interval must be positive")
+	check(c.Jobs.VersionPruningInterval > 0, "jobs.version_pruning_interval must be positive")
+	check(c.Jobs.MetricsRefreshInterval > 0, "jobs.metrics_refresh_interval must be positive")
+
+	_, err = c.RateLimit.ParseTrustedProxies()
+	check(err == nil, "rate_limit.trusted_proxies is invalid: %v", err)
+	for _, limit := range []struct {
+		name             string
+		perMinute, burst int
+	}{
+		{"account", c.RateLimit.AccountPerMinute, c.RateLimit.AccountBurst},
+		{"search", c.RateLimit.SearchPerMinute, c.RateLimit.SearchBurst},
+		{"download", c.RateLimit.DownloadPerMinute, c.RateLimit.DownloadBurst},
+		{"write", c.RateLimit.WritePerMinute, c.RateLimit.WriteBurst},
+	} {
+		check(limit.perMinute > 0, "rate_limit.%s_per_minute must be positive, but was %d", limit.name, limit.perMinute)
+		check(limit.burst > 0, "rate_limit.%s_burst must be positive, but was %d", limit.name, limit.burst)
+	}
+
+	for _, origin := range c.Cors.AllowedOrigins {
+		check(origin == "*" || isValidOrigin(origin), "cors.allowed_origins must contain origins like 'https://example.com' or '*', but contained '%s'", origin)
+	}
+	check(!c.Cors.AllowCredentials || !slices.Contains(c.Cors.AllowedOrigins, "*"),
+		"cors.allowed_origins must not contain '*' while cors.allow_credentials is enabled")
+	check(len(c.Cors.AllowedMethods) > 0, "cors.allowed_methods must not be empty")
+	check(c.Cors.MaxAge >= 0, "cors.max_age must not be negative")
+
+	check(c.Webhooks.MaxPerUser > 0, "webhooks.max_per_user must be positive, but was %d", c.Webhooks.MaxPerUser)
+	check(c.Webhooks.Timeout > 0, "webhooks.timeout must be positive")
+	check(c.Webhooks.MaxAttempts > 0, "webhooks.max_attempts must be positive, but was %d", c.Webhooks.MaxAttempts)
+	check(c.Webhooks.InitialBackoff > 0, "webhooks.initial_backoff must be positive")
+	check(c.Webhooks.MaxBackoff >= c.Webhooks.InitialBackoff, "webhooks.max_backoff must not be less than webhooks.initial_backoff")
+	check(c.Webhooks.PollInterval > 0, "webhooks.poll_interval must be positive")
+	check(c.Webhooks.HistoryRetention > 0, "webhooks.history_retention must be positive")
+	return problems
+}
+
+// isValidOrigin reports whether origin consists of a scheme, a host and an optional port, as sent by browsers in the
+// Origin header.
+func isValidOrigin(origin string) bool {
+	parsed, err := url.Parse(origin)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != "" &&
+		parsed.User == nil && parsed.Path == "" && parsed.RawQuery == "" && parsed.Fragment == ""
+}
+
+func isValidPort(port int) bool {
+	return port > 0 && port <= 65535
+}
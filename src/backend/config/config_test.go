@@ -0,0 +1,214 @@
+package config
+
+import (
+	"errors"
+	"github.com/ocelot-cloud/shared/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const sampleConfig = `
+server:
+  public_url: https://store.example.com
+  port: 9000
+  read_timeout: 5s
+  shutdown_timeout: 1m
+email:
+  smtp_host: smtp.example.com
+  smtp_port: 587
+  from: store@example.com
+  user: store
+  password: secret
+quota:
+  admin_users: [alice, bob]
+`
+
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	assert.Nil(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func getProblems(t *testing.T, err error) []string {
+	var validationErr *ValidationError
+	assert.True(t, errors.As(err, &validationErr))
+	if validationErr == nil {
+		return nil
+	}
+	return validationErr.Problems
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	config, err := Load([]string{"--config", writeConfigFile(t, sampleConfig)})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://store.example.com", config.Server.PublicUrl)
+	assert.Equal(t, 9000, config.Server.Port)
+	assert.Equal(t, 5*time.Second, config.Server.ReadTimeout)
+	assert.Equal(t, 10*time.Second, config.Server.WriteTimeout)
+	assert.Equal(t, time.Minute, config.Server.ShutdownTimeout)
+	assert.Equal(t, 587, config.Email.SmtpPort)
+	assert.Equal(t, []string{"alice", "bob"}, config.Quota.AdminUsers)
+	assert.Equal(t, "localhost", config.Database.Host)
+}
+
+func TestEnvOverridesFileAndFlagsOverrideEnv(t *testing.T) {
+	t.Setenv("STORE_SERVER_PORT", "9001")
+	t.Setenv("STORE_SERVER_PROFILE", "test")
+	t.Setenv("STORE_QUOTA_ADMIN_USERS", "carol, dave")
+	t.Setenv("STORE_JOBS_VERSION_PRUNING_INTERVAL", "5m")
+	config, err := Load([]string{"--config", writeConfigFile(t, sampleConfig), "--port", "9002"})
+	assert.Nil(t, err)
+	assert.Equal(t, 9002, config.Server.Port)
+	assert.Equal(t, ProfileTest, config.Server.Profile)
+	assert.Equal(t, []string{"carol", "dave"}, config.Quota.AdminUsers)
+	assert.Equal(t, 5*time.Minute, config.Jobs.VersionPruningInterval)
+}
+
+func TestExplicitlySetConfigFileMustExist(t *testing.T) {
+	_, err := Load([]string{"--config", filepath.Join(t.TempDir(), "missing.yml")})
+	assert.NotNil(t, err)
+}
+
+func TestUnknownKeysAreRejected(t *testing.T) {
+	_, err := Load([]string{"--config", writeConfigFile(t, sampleConfig+"unknown: true\n")})
+	assert.NotNil(t, err)
+}
+
+func TestEmailSettingsAreRequiredWithoutMockClient(t *testing.T) {
+	config := Default()
+	assert.Equal(t, 4, len(getProblems(t, config.Validate())))
+	config.Email.UseMockClient = true
+	assert.Nil(t, config.Validate())
+}
+
+func TestEmailSettingsAreNotRequiredInTestProfile(t *testing.T) {
+	config := Default()
+	config.Server.Profile = ProfileTest
+	assert.True(t, config.UsesMockEmailClient())
+	assert.Nil(t, config.Validate())
+}
+
+func TestAllProblemsAreReportedAtOnce(t *testing.T) {
+	t.Setenv("STORE_SERVER_READ_TIMEOUT", "soon")
+	t.Setenv("STORE_EMAIL_USE_MOCK_CLIENT", "true")
+	invalidConfig := `
+server:
+  port: 70000
+  profile: staging
+database:
+  host: ""
+  sslmode: sometimes
+  password_file: /not/existing
+quota:
+  max_payload_size: 0
+`
+	_, err := Load([]string{"--config", writeConfigFile(t, invalidConfig)})
+	assert.Equal(t, []string{
+		"STORE_SERVER_READ_TIMEOUT: 'soon' is not a duration like '30s'",
+		"server.port must be between 1 and 65535, but was 70000",
+		"server.profile must be PROD or TEST, but was 'STAGING'",
+		"database.host must not be empty",
+		"database.password_file must be readable: failed to read database password file: open /not/existing: no such file or directory",
+		"database.sslmode must be one of disable, allow, prefer, require, verify-ca, verify-full, but was 'sometimes'",
+		"quota.max_payload_size must be positive, but was 0",
+	}, getProblems(t, err))
+}
+
+func TestLegacyEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	legacyEnv := "HOST=https://store.example.com\nSMTP_HOST=smtp.example.com\nSMTP_PORT=587\nEMAIL=store@example.com\nEMAIL_USER=store\nEMAIL_PASSWORD=secret\n"
+	assert.Nil(t, os.WriteFile(path, []byte(legacyEnv), 0600))
+
+	config := Default()
+	problems, err := config.loadLegacyEnvFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(problems))
+	assert.Equal(t, "https://store.example.com", config.Server.PublicUrl)
+	assert.Equal(t, "smtp.example.com", config.Email.SmtpHost)
+	assert.Equal(t, 587, config.Email.SmtpPort)
+	assert.Equal(t, "store@example.com", config.Email.From)
+	assert.Equal(t, "store", config.Email.User)
+	assert.Equal(t, "secret", config.Email.Password)
+	assert.Nil(t, config.Validate())
+}
+
+func TestDatabasePasswordFile(t *testing.T) {
+	config := Default().Database
+	password, err := config.ReadPassword()
+	assert.Nil(t, err)
+	assert.Equal(t, "", password)
+
+	config.PasswordFile = filepath.Join(t.TempDir(), "password")
+	assert.Nil(t, os.WriteFile(config.PasswordFile, []byte("secret\n"), 0600))
+	password, err = config.ReadPassword()
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", password)
+}
+
+func TestSqliteDriverDoesNotNeedPostgresSettings(t *testing.T) {
+	config := Default()
+	config.Email.UseMockClient = true
+	config.Database.Driver = DriverSqlite
+	config.Database.Host = ""
+	config.Database.SslMode = "sometimes"
+	assert.Nil(t, config.Validate())
+
+	config.Database.Path = ""
+	assert.Equal(t, []string{"database.path must not be empty when using the sqlite driver"}, getProblems(t, config.Validate()))
+
+	config.Database.Driver = "mysql"
+	assert.Equal(t, []string{"database.driver must be postgres or sqlite, but was 'mysql'"}, getProblems(t, config.Validate()))
+}
+
+func TestTrustedProxiesMustBeAddressesOrRanges(t *testing.T) {
+	config := Default()
+	config.Email.UseMockClient = true
+	config.RateLimit.TrustedProxies = []string{"127.0.0.1", "10.0.0.0/8", "::1"}
+	assert.Nil(t, config.Validate())
+	prefixes, err := config.RateLimit.ParseTrustedProxies()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(prefixes))
+	assert.True(t, prefixes[0].IsSingleIP())
+
+	config.RateLimit.TrustedProxies = []string{"proxy.example.com"}
+	assert.Equal(t, 1, len(getProblems(t, config.Validate())))
+}
+
+func TestTlsRequiresCertificateAndKey(t *testing.T) {
+	config := Default()
+	config.Email.UseMockClient = true
+	config.Tls.CertFile = filepath.Join(t.TempDir(), "cert.pem")
+	config.Tls.RedirectPort = config.Server.Port
+	assert.Equal(t, 2, len(getProblems(t, config.Validate())))
+
+	config.Tls.KeyFile = filepath.Join(t.TempDir(), "key.pem")
+	config.Tls.RedirectPort = 0
+	assert.Equal(t, 1, len(getProblems(t, config.Validate())))
+}
+
+func TestCorsAllowedOriginsMustBeOrigins(t *testing.T) {
+	config := Default()
+	config.Email.UseMockClient = true
+	config.Cors.AllowedOrigins = []string{"https://dashboard.example.com", "http://localhost:8081"}
+	assert.Nil(t, config.Validate())
+	assert.True(t, config.Cors.IsOriginAllowed("http://localhost:8081"))
+	assert.False(t, config.Cors.IsOriginAllowed("http://localhost:8082"))
+
+	config.Cors.AllowedOrigins = []string{"dashboard.example.com", "https://example.com/path"}
+	assert.Equal(t, 2, len(getProblems(t, config.Validate())))
+
+	config.Cors.AllowedOrigins = []string{"*"}
+	assert.Equal(t, []string{"cors.allowed_origins must not contain '*' while cors.allow_credentials is enabled"}, getProblems(t, config.Validate()))
+	config.Cors.AllowCredentials = false
+	assert.Nil(t, config.Validate())
+	assert.True(t, config.Cors.IsOriginAllowed("https://any.example.com"))
+}
+
+func TestWebhookBackoffMustNotShrink(t *testing.T) {
+	config := Default()
+	config.Email.UseMockClient = true
+	config.Webhooks.MaxBackoff = config.Webhooks.InitialBackoff / 2
+	assert.Equal(t, []string{"webhooks.max_backoff must not be less than webhooks.initial_backoff"}, getProblems(t, config.Validate()))
+}
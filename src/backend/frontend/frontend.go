@@ -0,0 +1,32 @@
+package frontend
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+)
+
+// dist contains the build of the frontend, which is copied to frontend/dist before building the store. Without it,
+// the store still builds but only serves the API.
+//
+//go:embed all:dist
+var dist embed.FS
+
+// Files returns the files of the frontend. They are taken from dir if it is not empty, so that a frontend can be
+// tested without rebuilding the store, and from the embedded build otherwise.
+func Files(dir string) fs.FS {
+	if dir != "" {
+		return os.DirFS(dir)
+	}
+	files, err := fs.Sub(dist, "dist")
+	if err != nil {
+		panic("embedded frontend is not accessible: " + err.Error())
+	}
+	return files
+}
+
+// IsBuilt reports whether the files contain a frontend build.
+func IsBuilt(files fs.FS) bool {
+	_, err := fs.Stat(files, "index.html")
+	return err == nil
+}
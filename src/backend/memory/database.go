@@ -0,0 +1,192 @@
+package memory
+
+import (
+	"ocelot/store/tools"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Database holds the data of the in-memory repositories. Like the tables of the SQL database, the data is shared
+// by the repositories created from it, e.g. deleting a user also deletes the apps and versions of the user.
+type Database struct {
+	mutex                       sync.Mutex
+	users                       map[int]*user
+	apps                        map[int]*app
+	versions                    map[int]*version
+	retentionPolicies           map[int]tools.RetentionPolicy
+	webhooks                    map[int]*webhook
+	webhookDeliveries           map[int]*webhookDelivery
+	waitingForEmailVerification map[string]*tools.RegistrationForm
+	lastUserId                  int
+	lastAppId                   int
+	lastVersionId               int
+	lastWebhookId               int
+	lastDeliveryId              int
+}
+
+type user struct {
+	id                int
+	name              string
+	email             string
+	hashedPassword    string
+	hashedCookieValue string
+	expirationDate    string
+	usedSpace         int
+	storageLimit      *int
+}
+
+type app struct {
+	id           int
+	userId       int
+	name         string
+	storageLimit *int
+	maxVersions  *int
+}
+
+type version struct {
+	id                int
+	appId             int
+	name              string
+	creationTimestamp time.Time
+	data              []byte
+	changelog         string
+}
+
+type webhook struct {
+	id                int
+	userId            int
+	url               string
+	secret            string
+	allApps           bool
+	creationTimestamp time.Time
+}
+
+type webhookDelivery struct {
+	id                int
+	webhookId         int
+	event             string
+	payload           []byte
+	status            string
+	attempts          int
+	nextAttempt       time.Time
+	lastAttempt       *time.Time
+	lastStatusCode    int
+	lastError         string
+	creationTimestamp time.Time
+}
+
+func NewDatabase() *Database {
+	return &Database{
+		users:                       map[int]*user{},
+		apps:                        map[int]*app{},
+		versions:                    map[int]*version{},
+		retentionPolicies:           map[int]tools.RetentionPolicy{},
+		webhooks:                    map[int]*webhook{},
+		webhookDeliveries:           map[int]*webhookDelivery{},
+		waitingForEmailVerification: map[string]*tools.RegistrationForm{},
+	}
+}
+
+// The following helpers expect the caller to hold the mutex.
+
+func (d *Database) findUser(name string) *user {
+	for _, u := range d.users {
+		if u.name == name {
+			return u
+		}
+	}
+	return nil
+}
+
+func (d *Database) findApp(userId int, name string) *app {
+	for _, a := range d.apps {
+		if a.userId == userId && a.name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// appsOf returns the apps of the user ordered by ID, which is the order of creation.
+func (d *Database) appsOf(userId int) []*app {
+	var result []*app
+	for _, a := range d.apps {
+		if a.userId == userId {
+			result = append(result, a)
+		}
+	}
+	slices.SortFunc(result, func(a, b *app) int { return a.id - b.id })
+	return result
+}
+
+// versionsOf returns the versions of the app ordered from newest to oldest.
+func (d *Database) versionsOf(appId int) []*version {
+	var result []*version
+	for _, v := range d.versions {
+		if v.appId == appId {
+			result = append(result, v)
+		}
+	}
+	slices.SortFunc(result, func(a, b *version) int {
+		if c := b.creationTimestamp.Compare(a.creationTimestamp); c != 0 {
+			return c
+		}
+		return b.id - a.id
+	})
+	return result
+}
+
+func (d *Database) latestVersionOf(appId int) *version {
+	versions := d.versionsOf(appId)
+	if len(versions) == 0 {
+		return nil
+	}
+	return versions[0]
+}
+
+func (d *Database) usedSpaceOfApp(appId int) (int, int) {
+	usedSpace, versionCount := 0, 0
+	for _, v := range d.versions {
+		if v.appId == appId {
+			usedSpace += len(v.data)
+			versionCount++
+		}
+	}
+	return usedSpace, versionCount
+}
+
+func (d *Database) deleteUser(userId int) {
+	for _, a := range d.appsOf(userId) {
+		d.deleteApp(a.id)
+	}
+	for _, w := range d.webhooks {
+		if w.userId == userId {
+			d.deleteWebhook(w.id)
+		}
+	}
+	delete(d.users, userId)
+}
+
+// deleteWebhook deletes the webhook with its deliveries.
+func (d *Database) deleteWebhook(webhookId int) {
+	for _, delivery := range d.webhookDeliveries {
+		if delivery.webhookId == webhookId {
+			delete(d.webhookDeliveries, delivery.id)
+		}
+	}
+	delete(d.webhooks, webhookId)
+}
+
+// deleteApp deletes the app with its versions and retention policy, the used space of the owner is not changed.
+func (d *Database) deleteApp(appId int) {
+	for _, v := range d.versionsOf(appId) {
+		delete(d.versions, v.id)
+	}
+	delete(d.retentionPolicies, appId)
+	delete(d.apps, appId)
+}
+
+func copyBytes(data []byte) []byte {
+	return append([]byte{}, data...)
+}
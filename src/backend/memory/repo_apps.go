@@ -0,0 +1,207 @@
+package memory
+
+import (
+	"fmt"
+	"github.com/ocelot-cloud/shared/utils"
+	"ocelot/store/apps"
+	"ocelot/store/tools"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type AppRepository struct {
+	db     *Database
+	logger utils.LoggerType
+}
+
+func NewAppRepository(db *Database, logger utils.LoggerType) *AppRepository {
+	return &AppRepository{db: db, logger: logger}
+}
+
+func (a *AppRepository) WithLogger(logger utils.LoggerType) apps.AppRepository {
+	return &AppRepository{db: a.db, logger: logger}
+}
+
+var _ apps.AppRepository = &AppRepository{}
+
+const maxSearchResults = 100
+
+func (a *AppRepository) IsAppOwner(user string, appId int) bool {
+	a.db.mutex.Lock()
+	defer a.db.mutex.Unlock()
+	owner := a.db.findUser(user)
+	if owner == nil {
+		a.logger.Info("Failed to get user ID: %v", tools.ErrUserNotFound)
+		return false
+	}
+	existing, found := a.db.apps[appId]
+	if !found {
+		a.logger.Error("Failed to get app owner ID: %v", tools.ErrAppNotFound)
+		return false
+	}
+	return existing.userId == owner.id
+}
+
+func (a *AppRepository) DoesAppExist(appId int) bool {
+	a.db.mutex.Lock()
+	defer a.db.mutex.Unlock()
+	_, found := a.db.apps[appId]
+	return found
+}
+
+func (a *AppRepository) CreateApp(user, appName string) error {
+	a.db.mutex.Lock()
+	defer a.db.mutex.Unlock()
+	owner := a.db.findUser(user)
+	if owner == nil {
+		a.logger.Info("User '%s' does not exist", user)
+		return fmt.Errorf("user does not exist")
+	}
+	if a.db.findApp(owner.id, appName) != nil {
+		a.logger.Error("Failed to create app: app '%s' of user '%s' already exists", appName, user)
+		return fmt.Errorf("failed to create app")
+	}
+	a.db.lastAppId++
+	a.db.apps[a.db.lastAppId] = &app{id: a.db.lastAppId, userId: owner.id, name: appName}
+	return nil
+}
+
+func (a *AppRepository) DeleteApp(appId int) error {
+	a.db.mutex.Lock()
+	defer a.db.mutex.Unlock()
+	existing, found := a.db.apps[appId]
+	if !found {
+		a.logger.Error("Failed to get user ID of app: %v", tools.ErrAppNotFound)
+		return fmt.Errorf("failed to get user ID of app")
+	}
+	usedSpace, _ := a.db.usedSpaceOfApp(appId)
+	a.db.deleteApp(appId)
+	if owner, found := a.db.users[existing.userId]; found {
+		owner.usedSpace -= usedSpace
+	}
+	return nil
+}
+
+func (a *AppRepository) SearchForApps(request tools.AppSearchRequest) ([]tools.AppWithLatestVersion, error) {
+	a.db.mutex.Lock()
+	defer a.db.mutex.Unlock()
+	var allApps []*app
+	for _, existing := range a.db.apps {
+		allApps = append(allApps, existing)
+	}
+	slices.SortFunc(allApps, func(x, y *app) int { return x.id - y.id })
+
+	var result []tools.AppWithLatestVersion
+	for _, existing := range allApps {
+		maintainer := a.db.users[existing.userId]
+		latestVersion := a.db.latestVersionOf(existing.id)
+		if maintainer == nil || latestVersion == nil {
+			continue
+		}
+		if !strings.Contains(maintainer.name, request.SearchTerm) && !strings.Contains(existing.name, request.SearchTerm) {
+			continue
+		}
+		if !request.ShowUnofficialApps && maintainer.name != "ocelotcloud" {
+			continue
+		}
+		result = append(result, tools.AppWithLatestVersion{
+			Maintainer:        maintainer.name,
+			AppId:             strconv.Itoa(existing.id),
+			AppName:           existing.name,
+			LatestVersionId:   strconv.Itoa(latestVersion.id),
+			LatestVersionName: latestVersion.name,
+		})
+		if len(result) == maxSearchResults {
+			break
+		}
+	}
+	return result, nil
+}
+
+func (a *AppRepository) GetAppId(user, appName string) (int, error) {
+	a.db.mutex.Lock()
+	defer a.db.mutex.Unlock()
+	owner := a.db.findUser(user)
+	if owner == nil {
+		return -1, tools.ErrUserNotFound
+	}
+	existing := a.db.findApp(owner.id, appName)
+	if existing == nil {
+		return -1, tools.ErrAppNotFound
+	}
+	return existing.id, nil
+}
+
+func (a *AppRepository) GetAppName(appId int) (string, error) {
+	a.db.mutex.Lock()
+	defer a.db.mutex.Unlock()
+	existing, found := a.db.apps[appId]
+	if !found {
+		return "", fmt.Errorf("failed to get app name: %w", tools.ErrAppNotFound)
+	}
+	return existing.name, nil
+}
+
+func (a *AppRepository) GetAppList(user string) ([]tools.App, error) {
+	a.db.mutex.Lock()
+	defer a.db.mutex.Unlock()
+	owner := a.db.findUser(user)
+	if owner == nil {
+		return nil, tools.ErrUserNotFound
+	}
+
+	var result []tools.App
+	for _, existing := range a.db.appsOf(owner.id) {
+		result = append(result, tools.App{Maintainer: user, Name: existing.name, Id: strconv.Itoa(existing.id)})
+	}
+	return result, nil
+}
+
+func (a *AppRepository) GetMaintainerName(appId int) (string, error) {
+	a.db.mutex.Lock()
+	defer a.db.mutex.Unlock()
+	existing, found := a.db.apps[appId]
+	if !found {
+		return "", fmt.Errorf("failed to get maintainer name: %w", tools.ErrAppNotFound)
+	}
+	return a.db.users[existing.userId].name, nil
+}
+
+func (a *AppRepository) GetAppWithLatestVersion(appId int) (*tools.AppWithLatestVersion, error) {
+	a.db.mutex.Lock()
+	defer a.db.mutex.Unlock()
+	existing, found := a.db.apps[appId]
+	if !found {
+		return nil, fmt.Errorf("failed to get app: %w", tools.ErrAppNotFound)
+	}
+
+	result := &tools.AppWithLatestVersion{
+		Maintainer: a.db.users[existing.userId].name,
+		AppId:      strconv.Itoa(appId),
+		AppName:    existing.name,
+	}
+	if latestVersion := a.db.latestVersionOf(appId); latestVersion != nil {
+		result.LatestVersionId = strconv.Itoa(latestVersion.id)
+		result.LatestVersionName = latestVersion.name
+	}
+	return result, nil
+}
+
+func (a *AppRepository) SetAppQuota(appId int, storageLimit *int, maxVersions *int) error {
+	a.db.mutex.Lock()
+	defer a.db.mutex.Unlock()
+	existing, found := a.db.apps[appId]
+	if !found {
+		return tools.ErrAppNotFound
+	}
+	existing.storageLimit = copyIntPointer(storageLimit)
+	existing.maxVersions = copyIntPointer(maxVersions)
+	return nil
+}
+
+func (a *AppRepository) CountApps() (int, error) {
+	a.db.mutex.Lock()
+	defer a.db.mutex.Unlock()
+	return len(a.db.apps), nil
+}
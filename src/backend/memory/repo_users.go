@@ -0,0 +1,336 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ocelot-cloud/shared/utils"
+	"golang.org/x/crypto/bcrypt"
+	"ocelot/store/config"
+	"ocelot/store/tools"
+	"ocelot/store/users"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type UserRepository struct {
+	db     *Database
+	config *config.Config
+	logger utils.LoggerType
+}
+
+func NewUserRepository(db *Database, cfg *config.Config, logger utils.LoggerType) *UserRepository {
+	return &UserRepository{db: db, config: cfg, logger: logger}
+}
+
+func (u *UserRepository) WithLogger(logger utils.LoggerType) users.UserRepository {
+	return &UserRepository{db: u.db, config: u.config, logger: logger}
+}
+
+var _ users.UserRepository = &UserRepository{}
+
+func (u *UserRepository) CreateUser(form *tools.RegistrationForm) (string, error) {
+	key, err := users.NewValidationCode(u.config.UsesMockEmailClient())
+	if err != nil {
+		return "", err
+	}
+	u.logger.Info("adding user to validation list: %s", form.User)
+	u.db.mutex.Lock()
+	defer u.db.mutex.Unlock()
+	u.db.waitingForEmailVerification[key] = form
+	return key, nil
+}
+
+func (u *UserRepository) ValidateUser(code string) error {
+	u.db.mutex.Lock()
+	form, ok := u.db.waitingForEmailVerification[code]
+	u.db.mutex.Unlock()
+	if !ok {
+		return fmt.Errorf("code not found")
+	}
+
+	hashedPassword, err := utils.SaltAndHash(form.Password)
+	if err != nil {
+		u.logger.Error("Failed to hash password: %v", err)
+		return fmt.Errorf("failed to hash password")
+	}
+
+	u.db.mutex.Lock()
+	defer u.db.mutex.Unlock()
+	for _, existing := range u.db.users {
+		if existing.name == form.User || existing.email == form.Email {
+			u.logger.Error("Failed to create user: user name or email already exists")
+			return fmt.Errorf("failed to create user")
+		}
+	}
+	u.db.lastUserId++
+	u.db.users[u.db.lastUserId] = &user{id: u.db.lastUserId, name: form.User, email: form.Email, hashedPassword: hashedPassword}
+	delete(u.db.waitingForEmailVerification, code)
+	return nil
+}
+
+func (u *UserRepository) DoesUserExist(user string) bool {
+	u.db.mutex.Lock()
+	defer u.db.mutex.Unlock()
+	return u.db.findUser(user) != nil
+}
+
+func (u *UserRepository) DoesEmailExist(email string) bool {
+	u.db.mutex.Lock()
+	defer u.db.mutex.Unlock()
+	for _, existing := range u.db.users {
+		if existing.email == email {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *UserRepository) DeleteUser(user string) error {
+	u.db.mutex.Lock()
+	defer u.db.mutex.Unlock()
+	existing := u.db.findUser(user)
+	if existing == nil {
+		u.logger.Info("User '%s' does not exist", user)
+		return fmt.Errorf("user does not exist")
+	}
+	u.db.deleteUser(existing.id)
+	return nil
+}
+
+func (u *UserRepository) IsPasswordCorrect(user string, password string) bool {
+	u.db.mutex.Lock()
+	existing := u.db.findUser(user)
+	u.db.mutex.Unlock()
+	if existing == nil {
+		u.logger.Error("Failed to fetch hashed password: user '%s' does not exist", user)
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(existing.hashedPassword), []byte(password)) == nil
+}
+
+func (u *UserRepository) HashAndSaveCookie(user string, cookie string, expirationDate time.Time) error {
+	hashedCookieValue, err := utils.Hash(cookie)
+	if err != nil {
+		return fmt.Errorf("hashing failed")
+	}
+
+	u.db.mutex.Lock()
+	defer u.db.mutex.Unlock()
+	if existing := u.db.findUser(user); existing != nil {
+		existing.hashedCookieValue = hashedCookieValue
+		existing.expirationDate = expirationDate.Format(time.RFC3339)
+	}
+	return nil
+}
+
+func (u *UserRepository) findUserByCookie(cookie string) (*user, error) {
+	hashedCookieValue, err := utils.Hash(cookie)
+	if err != nil {
+		return nil, fmt.Errorf("hashing failed")
+	}
+	for _, existing := range u.db.users {
+		if existing.hashedCookieValue != "" && existing.hashedCookieValue == hashedCookieValue {
+			return existing, nil
+		}
+	}
+	return nil, tools.ErrCookieNotFound
+}
+
+func (u *UserRepository) IsCookieExpired(cookie string) bool {
+	u.db.mutex.Lock()
+	defer u.db.mutex.Unlock()
+	existing, err := u.findUserByCookie(cookie)
+	if err != nil {
+		u.logger.Error("Failed to fetch expiration date: %v", err)
+		return true
+	} else if existing.expirationDate == "" {
+		return true
+	}
+
+	expirationDate, err := time.Parse(time.RFC3339, existing.expirationDate)
+	if err != nil {
+		u.logger.Error("Failed to parse expiration date: %v", err)
+		return true
+	}
+	return time.Now().UTC().After(expirationDate)
+}
+
+func (u *UserRepository) GetUserViaCookie(cookie string) (string, error) {
+	if cookie == "" {
+		u.logger.Error("Cookie not set in request")
+		return "", fmt.Errorf("cookie not set in request")
+	}
+
+	u.db.mutex.Lock()
+	defer u.db.mutex.Unlock()
+	existing, err := u.findUserByCookie(cookie)
+	if errors.Is(err, tools.ErrCookieNotFound) {
+		u.logger.Info("Cookie not found")
+		return "", err
+	} else if err != nil {
+		return "", err
+	}
+	return existing.name, nil
+}
+
+func (u *UserRepository) ChangePassword(user string, newPassword string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		u.logger.Error("Failed to hash password: %v", err)
+		return fmt.Errorf("failed to hash password")
+	}
+
+	u.db.mutex.Lock()
+	defer u.db.mutex.Unlock()
+	if existing := u.db.findUser(user); existing != nil {
+		existing.hashedPassword = string(hashedPassword)
+	}
+	return nil
+}
+
+func (u *UserRepository) Logout(user string) error {
+	u.db.mutex.Lock()
+	defer u.db.mutex.Unlock()
+	if existing := u.db.findUser(user); existing != nil {
+		existing.hashedCookieValue = ""
+		existing.expirationDate = ""
+	}
+	return nil
+}
+
+func (u *UserRepository) IsThereEnoughSpaceToAddVersion(user string, bytesToAdd int) error {
+	bytesUsed, err := u.GetUsedSpaceInBytes(user)
+	if err != nil {
+		u.logger.Error("checking space failed: %v", err)
+		return errors.New("checking space failed")
+	}
+	storageLimit, err := u.GetStorageLimitInBytes(user)
+	if err != nil {
+		u.logger.Error("checking space failed: %v", err)
+		return errors.New("checking space failed")
+	}
+	if bytesUsed+bytesToAdd > storageLimit {
+		u.logger.Info("user '%s' tried to upload version, but storage limit would be exceeded", user)
+		return &users.QuotaExceededError{Scope: users.QuotaScopeUser, UsedBytes: bytesUsed, RequestedBytes: bytesToAdd, LimitBytes: storageLimit}
+	}
+	return nil
+}
+
+func (u *UserRepository) GetUsedSpaceInBytes(user string) (int, error) {
+	u.db.mutex.Lock()
+	defer u.db.mutex.Unlock()
+	existing := u.db.findUser(user)
+	if existing == nil {
+		u.logger.Error("Failed to get used space: user '%s' does not exist", user)
+		return 0, fmt.Errorf("failed to get used space")
+	}
+	return existing.usedSpace, nil
+}
+
+func (u *UserRepository) GetStorageLimitInBytes(user string) (int, error) {
+	u.db.mutex.Lock()
+	defer u.db.mutex.Unlock()
+	existing := u.db.findUser(user)
+	if existing == nil {
+		return 0, tools.ErrUserNotFound
+	}
+	return getStorageLimit(existing, u.config.Quota.DefaultStorageLimit), nil
+}
+
+func getStorageLimit(u *user, defaultLimit int) int {
+	if u.storageLimit == nil {
+		return defaultLimit
+	}
+	return *u.storageLimit
+}
+
+func (u *UserRepository) SetStorageLimit(user string, storageLimit *int) error {
+	u.db.mutex.Lock()
+	defer u.db.mutex.Unlock()
+	existing := u.db.findUser(user)
+	if existing == nil {
+		return tools.ErrUserNotFound
+	}
+	existing.storageLimit = copyIntPointer(storageLimit)
+	return nil
+}
+
+func (u *UserRepository) GetQuota(user string) (*tools.QuotaInfo, error) {
+	u.db.mutex.Lock()
+	defer u.db.mutex.Unlock()
+	existing := u.db.findUser(user)
+	if existing == nil {
+		u.logger.Error("Failed to get used space: user '%s' does not exist", user)
+		return nil, fmt.Errorf("failed to get used space")
+	}
+
+	appQuotas := []tools.AppQuota{}
+	for _, a := range u.db.appsOf(existing.id) {
+		usedSpace, versionCount := u.db.usedSpaceOfApp(a.id)
+		appQuotas = append(appQuotas, tools.AppQuota{
+			AppId:             strconv.Itoa(a.id),
+			AppName:           a.name,
+			UsedBytes:         usedSpace,
+			VersionCount:      versionCount,
+			StorageLimitBytes: copyIntPointer(a.storageLimit),
+			MaxVersions:       copyIntPointer(a.maxVersions),
+		})
+	}
+	slices.SortFunc(appQuotas, func(a, b tools.AppQuota) int { return strings.Compare(a.AppName, b.AppName) })
+
+	return &tools.QuotaInfo{
+		UsedBytes:         existing.usedSpace,
+		StorageLimitBytes: getStorageLimit(existing, u.config.Quota.DefaultStorageLimit),
+		MaxPayloadBytes:   u.config.Quota.MaxPayloadSize,
+		Apps:              appQuotas,
+	}, nil
+}
+
+func copyIntPointer(value *int) *int {
+	if value == nil {
+		return nil
+	}
+	number := *value
+	return &number
+}
+
+// ReconcileUsedSpace corrects the used space of users which does not match their stored version content. Since
+// all changes happen under one lock, this only happens if the data was changed bypassing the repositories.
+func (u *UserRepository) ReconcileUsedSpace() (int, error) {
+	u.db.mutex.Lock()
+	defer u.db.mutex.Unlock()
+	corrected := 0
+	for _, existing := range u.db.users {
+		actualSpace := 0
+		for _, a := range u.db.appsOf(existing.id) {
+			appSpace, _ := u.db.usedSpaceOfApp(a.id)
+			actualSpace += appSpace
+		}
+		if existing.usedSpace == actualSpace {
+			continue
+		}
+		u.logger.Warn("used space of user '%s' drifted by %d bytes, corrected from %d to %d", existing.name, existing.usedSpace-actualSpace, existing.usedSpace, actualSpace)
+		existing.usedSpace = actualSpace
+		corrected++
+	}
+	return corrected, nil
+}
+
+func (u *UserRepository) WipeDatabase() {
+	u.db.mutex.Lock()
+	defer u.db.mutex.Unlock()
+	for _, existing := range u.db.users {
+		if existing.name != "sample" {
+			u.db.deleteUser(existing.id)
+		}
+	}
+	u.db.waitingForEmailVerification = map[string]*tools.RegistrationForm{}
+}
+
+func (u *UserRepository) CountUsers() (int, error) {
+	u.db.mutex.Lock()
+	defer u.db.mutex.Unlock()
+	return len(u.db.users), nil
+}
@@ -0,0 +1,281 @@
+package memory
+
+import (
+	"fmt"
+	"github.com/ocelot-cloud/shared/utils"
+	"ocelot/store/config"
+	"ocelot/store/tools"
+	"ocelot/store/users"
+	"ocelot/store/versions"
+	"slices"
+	"strconv"
+	"time"
+)
+
+type VersionRepository struct {
+	db     *Database
+	config *config.Config
+	logger utils.LoggerType
+}
+
+func NewVersionRepository(db *Database, cfg *config.Config, logger utils.LoggerType) *VersionRepository {
+	return &VersionRepository{db: db, config: cfg, logger: logger}
+}
+
+func (v *VersionRepository) WithLogger(logger utils.LoggerType) versions.VersionRepository {
+	return &VersionRepository{db: v.db, config: v.config, logger: logger}
+}
+
+var _ versions.VersionRepository = &VersionRepository{}
+
+func (v *VersionRepository) IsVersionOwner(user string, versionId int) bool {
+	v.db.mutex.Lock()
+	defer v.db.mutex.Unlock()
+	owner := v.db.findUser(user)
+	if owner == nil {
+		v.logger.Info("Failed to get user ID: %v", tools.ErrUserNotFound)
+		return false
+	}
+	existing, found := v.db.versions[versionId]
+	if !found {
+		v.logger.Error("Failed to get version owner ID: %v", tools.ErrVersionNotFound)
+		return false
+	}
+	return v.db.apps[existing.appId].userId == owner.id
+}
+
+// CreateVersion checks the quotas like the SQL repository does, see versions.VersionRepositoryImpl.CreateVersion.
+func (v *VersionRepository) CreateVersion(appId int, versionName string, data []byte, changelog string) error {
+	v.db.mutex.Lock()
+	defer v.db.mutex.Unlock()
+	existing, found := v.db.apps[appId]
+	if !found {
+		v.logger.Error("Failed to get user ID of app: %v", tools.ErrAppNotFound)
+		return fmt.Errorf("failed to get user ID of app")
+	}
+	owner := v.db.users[existing.userId]
+
+	dataSize := len(data)
+	storageLimit := getStorageLimit(owner, v.config.Quota.DefaultStorageLimit)
+	if owner.usedSpace+dataSize > storageLimit {
+		return &users.QuotaExceededError{Scope: users.QuotaScopeUser, UsedBytes: owner.usedSpace, RequestedBytes: dataSize, LimitBytes: storageLimit}
+	}
+	appUsedSpace, versionCount := v.db.usedSpaceOfApp(appId)
+	if existing.storageLimit != nil && appUsedSpace+dataSize > *existing.storageLimit {
+		return &users.QuotaExceededError{Scope: users.QuotaScopeApp, UsedBytes: appUsedSpace, RequestedBytes: dataSize, LimitBytes: *existing.storageLimit}
+	}
+	if existing.maxVersions != nil && versionCount >= *existing.maxVersions {
+		return &versions.VersionLimitExceededError{VersionCount: versionCount, MaxVersions: *existing.maxVersions}
+	}
+	for _, other := range v.db.versionsOf(appId) {
+		if other.name == versionName {
+			return tools.ErrVersionAlreadyExists
+		}
+	}
+
+	v.db.lastVersionId++
+	v.db.versions[v.db.lastVersionId] = &version{
+		id:                v.db.lastVersionId,
+		appId:             appId,
+		name:              versionName,
+		creationTimestamp: time.Now().UTC(),
+		data:              copyBytes(data),
+		changelog:         changelog,
+	}
+	owner.usedSpace += dataSize
+	return nil
+}
+
+func (v *VersionRepository) GetVersionId(appId int, versionName string) (int, error) {
+	v.db.mutex.Lock()
+	defer v.db.mutex.Unlock()
+	for _, existing := range v.db.versionsOf(appId) {
+		if existing.name == versionName {
+			return existing.id, nil
+		}
+	}
+	return -1, tools.ErrVersionNotFound
+}
+
+func (v *VersionRepository) DeleteVersion(versionId int) error {
+	v.db.mutex.Lock()
+	defer v.db.mutex.Unlock()
+	existing, found := v.db.versions[versionId]
+	if !found {
+		return fmt.Errorf("failed to get app ID: %w", tools.ErrVersionNotFound)
+	}
+	delete(v.db.versions, versionId)
+	v.db.users[v.db.apps[existing.appId].userId].usedSpace -= len(existing.data)
+	return nil
+}
+
+func (v *VersionRepository) GetVersionList(appId int) ([]tools.Version, error) {
+	v.db.mutex.Lock()
+	defer v.db.mutex.Unlock()
+	if _, found := v.db.apps[appId]; !found {
+		return nil, fmt.Errorf("app with id %d does not exist", appId)
+	}
+
+	var result []tools.Version
+	for _, existing := range v.db.versionsOf(appId) {
+		result = append(result, toVersion(existing))
+	}
+	return result, nil
+}
+
+func toVersion(existing *version) tools.Version {
+	return tools.Version{
+		Name:              existing.name,
+		Id:                strconv.Itoa(existing.id),
+		CreationTimestamp: existing.creationTimestamp,
+	}
+}
+
+func (v *VersionRepository) DoesVersionExist(versionId int) bool {
+	v.db.mutex.Lock()
+	defer v.db.mutex.Unlock()
+	_, found := v.db.versions[versionId]
+	return found
+}
+
+func (v *VersionRepository) GetVersionContent(versionId int) ([]byte, error) {
+	v.db.mutex.Lock()
+	defer v.db.mutex.Unlock()
+	existing, found := v.db.versions[versionId]
+	if !found {
+		return nil, tools.ErrVersionNotFound
+	}
+	return copyBytes(existing.data), nil
+}
+
+func (v *VersionRepository) GetAppIdByVersionId(versionId int) (int, error) {
+	v.db.mutex.Lock()
+	defer v.db.mutex.Unlock()
+	existing, found := v.db.versions[versionId]
+	if !found {
+		v.logger.Error("Failed to get app ID by version ID %d: %v", versionId, tools.ErrVersionNotFound)
+		return -1, fmt.Errorf("failed to get app ID by version ID")
+	}
+	return existing.appId, nil
+}
+
+func (v *VersionRepository) GetFullVersionInfo(versionId int) (*tools.FullVersionInfo, error) {
+	v.db.mutex.Lock()
+	defer v.db.mutex.Unlock()
+	existing, found := v.db.versions[versionId]
+	if !found {
+		return nil, fmt.Errorf("failed to get full version info: %w", tools.ErrVersionNotFound)
+	}
+	existingApp := v.db.apps[existing.appId]
+	return &tools.FullVersionInfo{
+		Maintainer:               v.db.users[existingApp.userId].name,
+		AppName:                  existingApp.name,
+		VersionName:              existing.name,
+		Content:                  copyBytes(existing.data),
+		Id:                       existing.id,
+		VersionCreationTimestamp: existing.creationTimestamp,
+	}, nil
+}
+
+func (v *VersionRepository) GetLatestVersionId(appId int) (int, error) {
+	v.db.mutex.Lock()
+	defer v.db.mutex.Unlock()
+	latestVersion := v.db.latestVersionOf(appId)
+	if latestVersion == nil {
+		return -1, tools.ErrVersionNotFound
+	}
+	return latestVersion.id, nil
+}
+
+func (v *VersionRepository) GetVersion(versionId int) (*tools.Version, error) {
+	v.db.mutex.Lock()
+	defer v.db.mutex.Unlock()
+	existing, found := v.db.versions[versionId]
+	if !found {
+		return nil, fmt.Errorf("failed to get version: %w", tools.ErrVersionNotFound)
+	}
+	result := toVersion(existing)
+	return &result, nil
+}
+
+func (v *VersionRepository) GetVersionSizes(appId int) (map[string]int, error) {
+	v.db.mutex.Lock()
+	defer v.db.mutex.Unlock()
+	sizes := map[string]int{}
+	for _, existing := range v.db.versionsOf(appId) {
+		sizes[strconv.Itoa(existing.id)] = len(existing.data)
+	}
+	return sizes, nil
+}
+
+func (v *VersionRepository) SetRetentionPolicy(appId int, policy tools.RetentionPolicy) error {
+	v.db.mutex.Lock()
+	defer v.db.mutex.Unlock()
+	if _, found := v.db.apps[appId]; !found {
+		v.logger.Error("Failed to set retention policy: %v", tools.ErrAppNotFound)
+		return fmt.Errorf("failed to set retention policy")
+	}
+	v.db.retentionPolicies[appId] = tools.RetentionPolicy{
+		AppId:              strconv.Itoa(appId),
+		KeepLast:           policy.KeepLast,
+		KeepDays:           policy.KeepDays,
+		KeepLatestPerMajor: policy.KeepLatestPerMajor,
+	}
+	return nil
+}
+
+func (v *VersionRepository) GetRetentionPolicy(appId int) (*tools.RetentionPolicy, error) {
+	v.db.mutex.Lock()
+	defer v.db.mutex.Unlock()
+	policy, found := v.db.retentionPolicies[appId]
+	if !found {
+		return &tools.RetentionPolicy{AppId: strconv.Itoa(appId)}, nil
+	}
+	return &policy, nil
+}
+
+func (v *VersionRepository) GetAppIdsWithRetentionPolicy() ([]int, error) {
+	v.db.mutex.Lock()
+	defer v.db.mutex.Unlock()
+	var appIds []int
+	for appId := range v.db.retentionPolicies {
+		appIds = append(appIds, appId)
+	}
+	slices.Sort(appIds)
+	return appIds, nil
+}
+
+func (v *VersionRepository) CountVersions() (int, error) {
+	v.db.mutex.Lock()
+	defer v.db.mutex.Unlock()
+	return len(v.db.versions), nil
+}
+
+func (v *VersionRepository) GetReleases(maintainer, app string, limit int) ([]tools.Release, error) {
+	v.db.mutex.Lock()
+	defer v.db.mutex.Unlock()
+	releases := []tools.Release{}
+	for _, existing := range v.db.versions {
+		existingApp := v.db.apps[existing.appId]
+		maintainerName := v.db.users[existingApp.userId].name
+		if maintainer != "" && maintainerName != maintainer || app != "" && existingApp.name != app {
+			continue
+		}
+		releases = append(releases, tools.Release{
+			Maintainer:        maintainerName,
+			AppId:             existingApp.id,
+			AppName:           existingApp.name,
+			VersionId:         existing.id,
+			VersionName:       existing.name,
+			Changelog:         existing.changelog,
+			CreationTimestamp: existing.creationTimestamp,
+		})
+	}
+	slices.SortFunc(releases, func(a, b tools.Release) int {
+		if c := b.CreationTimestamp.Compare(a.CreationTimestamp); c != 0 {
+			return c
+		}
+		return b.VersionId - a.VersionId
+	})
+	return releases[:min(limit, len(releases))], nil
+}
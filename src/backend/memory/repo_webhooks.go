@@ -0,0 +1,240 @@
+package memory
+
+import (
+	"fmt"
+	"github.com/ocelot-cloud/shared/utils"
+	"ocelot/store/tools"
+	"ocelot/store/webhooks"
+	"slices"
+	"strconv"
+	"time"
+)
+
+type WebhookRepository struct {
+	db     *Database
+	logger utils.LoggerType
+}
+
+func NewWebhookRepository(db *Database, logger utils.LoggerType) *WebhookRepository {
+	return &WebhookRepository{db: db, logger: logger}
+}
+
+func (w *WebhookRepository) WithLogger(logger utils.LoggerType) webhooks.WebhookRepository {
+	return &WebhookRepository{db: w.db, logger: logger}
+}
+
+var _ webhooks.WebhookRepository = &WebhookRepository{}
+
+func (w *WebhookRepository) CreateWebhook(user string, creation tools.WebhookCreation) (*tools.Webhook, error) {
+	w.db.mutex.Lock()
+	defer w.db.mutex.Unlock()
+	owner := w.db.findUser(user)
+	if owner == nil {
+		return nil, tools.ErrUserNotFound
+	}
+	w.db.lastWebhookId++
+	created := &webhook{
+		id:                w.db.lastWebhookId,
+		userId:            owner.id,
+		url:               creation.Url,
+		secret:            creation.Secret,
+		allApps:           creation.AllApps,
+		creationTimestamp: time.Now().UTC(),
+	}
+	w.db.webhooks[created.id] = created
+	return toWebhook(created), nil
+}
+
+func toWebhook(w *webhook) *tools.Webhook {
+	return &tools.Webhook{Id: strconv.Itoa(w.id), Url: w.url, AllApps: w.allApps, CreationTimestamp: w.creationTimestamp}
+}
+
+// webhooksOf returns the webhooks of the user ordered by ID.
+func (w *WebhookRepository) webhooksOf(userId int) []*webhook {
+	var result []*webhook
+	for _, existing := range w.db.webhooks {
+		if existing.userId == userId {
+			result = append(result, existing)
+		}
+	}
+	slices.SortFunc(result, func(a, b *webhook) int { return a.id - b.id })
+	return result
+}
+
+func (w *WebhookRepository) GetWebhooks(user string) ([]tools.Webhook, error) {
+	w.db.mutex.Lock()
+	defer w.db.mutex.Unlock()
+	result := []tools.Webhook{}
+	owner := w.db.findUser(user)
+	if owner == nil {
+		return result, nil
+	}
+	for _, existing := range w.webhooksOf(owner.id) {
+		result = append(result, *toWebhook(existing))
+	}
+	return result, nil
+}
+
+func (w *WebhookRepository) CountWebhooks(user string) (int, error) {
+	w.db.mutex.Lock()
+	defer w.db.mutex.Unlock()
+	owner := w.db.findUser(user)
+	if owner == nil {
+		return 0, nil
+	}
+	return len(w.webhooksOf(owner.id)), nil
+}
+
+func (w *WebhookRepository) DoesWebhookExist(webhookId int) bool {
+	w.db.mutex.Lock()
+	defer w.db.mutex.Unlock()
+	_, found := w.db.webhooks[webhookId]
+	return found
+}
+
+func (w *WebhookRepository) IsWebhookOwner(user string, webhookId int) bool {
+	w.db.mutex.Lock()
+	defer w.db.mutex.Unlock()
+	owner := w.db.findUser(user)
+	if owner == nil {
+		w.logger.Info("Failed to get user ID: %v", tools.ErrUserNotFound)
+		return false
+	}
+	existing, found := w.db.webhooks[webhookId]
+	if !found {
+		w.logger.Error("Failed to get webhook owner ID: webhook with ID '%d' not found", webhookId)
+		return false
+	}
+	return existing.userId == owner.id
+}
+
+func (w *WebhookRepository) DeleteWebhook(webhookId int) error {
+	w.db.mutex.Lock()
+	defer w.db.mutex.Unlock()
+	w.db.deleteWebhook(webhookId)
+	return nil
+}
+
+func (w *WebhookRepository) EnqueueDeliveries(maintainer, event string, payload []byte, now time.Time) (int, error) {
+	w.db.mutex.Lock()
+	defer w.db.mutex.Unlock()
+	owner := w.db.findUser(maintainer)
+	count := 0
+	for _, existing := range w.db.webhooks {
+		if !existing.allApps && (owner == nil || existing.userId != owner.id) {
+			continue
+		}
+		w.db.lastDeliveryId++
+		w.db.webhookDeliveries[w.db.lastDeliveryId] = &webhookDelivery{
+			id:                w.db.lastDeliveryId,
+			webhookId:         existing.id,
+			event:             event,
+			payload:           copyBytes(payload),
+			status:            tools.WebhookStatusPending,
+			nextAttempt:       now,
+			creationTimestamp: now,
+		}
+		count++
+	}
+	return count, nil
+}
+
+func (w *WebhookRepository) GetDueDeliveries(now time.Time, limit int) ([]webhooks.PendingDelivery, error) {
+	w.db.mutex.Lock()
+	defer w.db.mutex.Unlock()
+	var due []*webhookDelivery
+	for _, delivery := range w.db.webhookDeliveries {
+		if delivery.status == tools.WebhookStatusPending && !delivery.nextAttempt.After(now) {
+			due = append(due, delivery)
+		}
+	}
+	slices.SortFunc(due, func(a, b *webhookDelivery) int {
+		if c := a.nextAttempt.Compare(b.nextAttempt); c != 0 {
+			return c
+		}
+		return a.id - b.id
+	})
+
+	var result []webhooks.PendingDelivery
+	for _, delivery := range due[:min(limit, len(due))] {
+		receiver := w.db.webhooks[delivery.webhookId]
+		result = append(result, webhooks.PendingDelivery{
+			Id:        delivery.id,
+			WebhookId: receiver.id,
+			Url:       receiver.url,
+			Secret:    receiver.secret,
+			Event:     delivery.event,
+			Payload:   copyBytes(delivery.payload),
+			Attempts:  delivery.attempts,
+		})
+	}
+	return result, nil
+}
+
+func (w *WebhookRepository) RecordAttempt(deliveryId int, attempt webhooks.Attempt) error {
+	w.db.mutex.Lock()
+	defer w.db.mutex.Unlock()
+	delivery, found := w.db.webhookDeliveries[deliveryId]
+	if !found {
+		return fmt.Errorf("failed to record delivery attempt: delivery with ID '%d' not found", deliveryId)
+	}
+	attemptTime := attempt.Time
+	delivery.status = attempt.Status
+	delivery.attempts++
+	delivery.nextAttempt = attempt.NextAttempt
+	if attempt.Status != tools.WebhookStatusPending {
+		delivery.nextAttempt = attempt.Time
+	}
+	delivery.lastAttempt = &attemptTime
+	delivery.lastStatusCode = attempt.StatusCode
+	delivery.lastError = attempt.Error
+	return nil
+}
+
+func (w *WebhookRepository) GetDeliveries(webhookId int, limit int) ([]tools.WebhookDelivery, error) {
+	w.db.mutex.Lock()
+	defer w.db.mutex.Unlock()
+	var deliveries []*webhookDelivery
+	for _, delivery := range w.db.webhookDeliveries {
+		if delivery.webhookId == webhookId {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	slices.SortFunc(deliveries, func(a, b *webhookDelivery) int { return b.id - a.id })
+
+	result := []tools.WebhookDelivery{}
+	for _, delivery := range deliveries[:min(limit, len(deliveries))] {
+		entry := tools.WebhookDelivery{
+			Id:                strconv.Itoa(delivery.id),
+			Event:             delivery.event,
+			Status:            delivery.status,
+			Attempts:          delivery.attempts,
+			LastStatusCode:    delivery.lastStatusCode,
+			LastError:         delivery.lastError,
+			CreationTimestamp: delivery.creationTimestamp,
+		}
+		if delivery.status == tools.WebhookStatusPending {
+			nextAttempt := delivery.nextAttempt
+			entry.NextAttempt = &nextAttempt
+		}
+		if delivery.lastAttempt != nil {
+			lastAttempt := *delivery.lastAttempt
+			entry.LastAttempt = &lastAttempt
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+func (w *WebhookRepository) DeleteFinishedDeliveriesBefore(before time.Time) (int, error) {
+	w.db.mutex.Lock()
+	defer w.db.mutex.Unlock()
+	count := 0
+	for _, delivery := range w.db.webhookDeliveries {
+		if delivery.status != tools.WebhookStatusPending && delivery.creationTimestamp.Before(before) {
+			delete(w.db.webhookDeliveries, delivery.id)
+			count++
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,212 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"github.com/ocelot-cloud/shared/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const namespace = "store"
+
+// Metrics collects the metrics of a store and serves them in the Prometheus text format. Each instance has its own
+// registry, so several stores can coexist in one process.
+type Metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	uploadedBytes   prometheus.Counter
+	downloadedBytes prometheus.Counter
+	logins          *prometheus.CounterVec
+	quotaRejections *prometheus.CounterVec
+	rateLimited     *prometheus.CounterVec
+	webhookAttempts *prometheus.CounterVec
+	gauges          []*gaugeCollector
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of handled API requests by route, method and status code.",
+		}, []string{"route", "method", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of API requests by route, method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "code"}),
+		uploadedBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "uploaded_bytes_total",
+			Help:      "Size of all successfully uploaded version contents.",
+		}),
+		downloadedBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "downloaded_bytes_total",
+			Help:      "Size of all downloaded version contents.",
+		}),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "logins_total",
+			Help:      "Number of login attempts by result.",
+		}, []string{"result"}),
+		quotaRejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "quota_rejections_total",
+			Help:      "Number of version uploads rejected because a storage limit or the maximum number of versions was reached, by limit.",
+		}, []string{"limit"}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limited_requests_total",
+			Help:      "Number of requests rejected because the client exceeded the rate limit, by class of route.",
+		}, []string{"class"}),
+		webhookAttempts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "webhook_delivery_attempts_total",
+			Help:      "Number of attempts to deliver webhook events by result.",
+		}, []string{"result"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.uploadedBytes,
+		m.downloadedBytes,
+		m.logins,
+		m.quotaRejections,
+		m.rateLimited,
+		m.webhookAttempts,
+	)
+	return m
+}
+
+// Handler serves the collected metrics.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// InstrumentRoute counts the requests to the route and measures their duration. The route is used as label instead
+// of the request path so that the number of time series stays bounded.
+func (m *Metrics) InstrumentRoute(route string, next http.Handler) http.Handler {
+	labels := prometheus.Labels{"route": route}
+	return promhttp.InstrumentHandlerDuration(m.requestDuration.MustCurryWith(labels),
+		promhttp.InstrumentHandlerCounter(m.requests.MustCurryWith(labels), next))
+}
+
+// RegisterDatabase exposes the statistics of the connection pool of db.
+func (m *Metrics) RegisterDatabase(db *sql.DB) {
+	m.registry.MustRegister(collectors.NewDBStatsCollector(db, namespace))
+}
+
+// RegisterGauge exposes the result of count as gauge. Since count may be expensive, e.g. a database query, it is not
+// called on every scrape but by RefreshGauges. The gauge is missing from the metrics until it was refreshed.
+func (m *Metrics) RegisterGauge(name, help string, count func() (int, error)) {
+	gauge := &gaugeCollector{
+		desc:  prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, nil, nil),
+		count: count,
+	}
+	m.registry.MustRegister(gauge)
+	m.gauges = append(m.gauges, gauge)
+}
+
+// RefreshGauges updates the values of all gauges. A gauge whose count fails keeps its previous value, the first
+// error is returned.
+func (m *Metrics) RefreshGauges() error {
+	var firstErr error
+	for _, gauge := range m.gauges {
+		if err := gauge.refresh(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// RunGaugeRefresher refreshes the gauges right away and then in the given interval until ctx is done.
+func (m *Metrics) RunGaugeRefresher(ctx context.Context, interval time.Duration, logger utils.LoggerType) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := m.RefreshGauges(); err != nil {
+			logger.Error("refreshing metrics failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *Metrics) AddUploadedBytes(bytes int) {
+	m.uploadedBytes.Add(float64(bytes))
+}
+
+func (m *Metrics) AddDownloadedBytes(bytes int) {
+	m.downloadedBytes.Add(float64(bytes))
+}
+
+func (m *Metrics) CountLogin(success bool) {
+	result := "failure"
+	if success {
+		result = "success"
+	}
+	m.logins.WithLabelValues(result).Inc()
+}
+
+// CountQuotaRejection counts a rejected upload, limit names the limit that was reached.
+func (m *Metrics) CountQuotaRejection(limit string) {
+	m.quotaRejections.WithLabelValues(limit).Inc()
+}
+
+func (m *Metrics) CountRateLimitRejection(class string) {
+	m.rateLimited.WithLabelValues(class).Inc()
+}
+
+func (m *Metrics) CountWebhookAttempt(success bool) {
+	result := "failure"
+	if success {
+		result = "success"
+	}
+	m.webhookAttempts.WithLabelValues(result).Inc()
+}
+
+type gaugeCollector struct {
+	desc        *prometheus.Desc
+	count       func() (int, error)
+	mutex       sync.Mutex
+	value       int
+	isRefreshed bool
+}
+
+func (c *gaugeCollector) refresh() error {
+	value, err := c.count()
+	if err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.value = value
+	c.isRefreshed = true
+	return nil
+}
+
+func (c *gaugeCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- c.desc
+}
+
+func (c *gaugeCollector) Collect(metrics chan<- prometheus.Metric) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.isRefreshed {
+		metrics <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(c.value))
+	}
+}
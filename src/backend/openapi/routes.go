@@ -0,0 +1,155 @@
+package openapi
+
+import (
+	"github.com/ocelot-cloud/shared/utils"
+	"net/http"
+	"ocelot/store/tools"
+	"reflect"
+	"sort"
+)
+
+const (
+	cookieAuthScheme = "cookieAuth"
+	bearerAuthScheme = "bearerAuth"
+)
+
+// RouteDoc describes a single API route. Request and Response hold a sample value of the DTO sent in the
+// request body and returned in the response body respectively, or nil if there is no JSON body.
+type RouteDoc struct {
+	Path        string
+	Summary     string
+	Tag         string
+	Request     any
+	Response    any
+	Protected   bool
+	QueryParams []Parameter
+	// Method is the HTTP method of the route, POST if empty.
+	Method string
+}
+
+var RouteDocs = []RouteDoc{
+	{Path: tools.RegistrationPath, Summary: "Register a new account, a validation link is sent via email", Tag: "account", Request: tools.RegistrationForm{}},
+	{Path: tools.EmailValidationPath, Summary: "Validate the email address of a registered account", Tag: "account", QueryParams: []Parameter{
+		{Name: "code", In: "query", Required: true, Schema: &Schema{Type: "string", Pattern: "^[a-f0-9]{64}$"}},
+	}},
+	{Path: tools.LoginPath, Summary: "Log in and receive an authentication cookie and the csrf cookie, whose value is also returned in the X-CSRF-Token header", Tag: "account", Request: tools.LoginCredentials{}},
+	{Path: tools.LogoutPath, Summary: "Log out and invalidate the authentication cookie", Tag: "account", Protected: true},
+	{Path: tools.AuthCheckPath, Summary: "Return the name of the authenticated user", Tag: "account", Response: tools.UserNameString{}, Protected: true},
+	{Path: tools.DeleteUserPath, Summary: "Delete the account of the authenticated user", Tag: "account", Protected: true},
+	{Path: tools.ChangePasswordPath, Summary: "Change the password of the authenticated user", Tag: "account", Request: tools.ChangePasswordForm{}, Protected: true},
+	{Path: tools.QuotaPath, Summary: "Return the storage usage and limits of the authenticated user and its apps", Tag: "account", Response: tools.QuotaInfo{}, Protected: true},
+
+	{Path: tools.AppCreationPath, Summary: "Create an app owned by the authenticated user", Tag: "apps", Request: tools.AppNameString{}, Protected: true},
+	{Path: tools.AppGetListPath, Summary: "List the apps of the authenticated user", Tag: "apps", Response: []tools.App{}, Protected: true},
+	{Path: tools.AppDeletePath, Summary: "Delete an app and all its versions", Tag: "apps", Request: tools.NumberString{}, Protected: true},
+	{Path: tools.SearchAppsPath, Summary: "Search apps by maintainer or app name", Tag: "apps", Request: tools.AppSearchRequest{}, Response: []tools.AppWithLatestVersion{}},
+	{Path: tools.AppLookupPath, Summary: "Resolve an app by maintainer and app name", Tag: "apps", Request: tools.AppLookupRequest{}, Response: tools.AppWithLatestVersion{}},
+
+	{Path: tools.VersionUploadPath, Summary: "Upload a zipped version of an app", Tag: "versions", Request: tools.VersionUpload{}, Protected: true},
+	{Path: tools.VersionDeletePath, Summary: "Delete a version", Tag: "versions", Request: tools.NumberString{}, Protected: true},
+	{Path: tools.GetVersionsPath, Summary: "List the versions of an app, newest first", Tag: "versions", Request: tools.NumberString{}, Response: []tools.Version{}},
+	{Path: tools.DownloadPath, Summary: "Download a version including its content", Tag: "versions", Request: tools.NumberString{}, Response: tools.FullVersionInfo{}},
+	{Path: tools.RetentionPolicySetPath, Summary: "Set the retention policy of an app, versions not kept by any of its rules are pruned after uploads and periodically", Tag: "versions", Request: tools.RetentionPolicy{}, Protected: true},
+	{Path: tools.RetentionPolicyGetPath, Summary: "Return the retention policy of an app", Tag: "versions", Request: tools.NumberString{}, Response: tools.RetentionPolicy{}, Protected: true},
+	{Path: tools.RetentionDryRunPath, Summary: "List the versions which would be pruned by the retention policy of an app", Tag: "versions", Request: tools.NumberString{}, Response: tools.PruneResult{}, Protected: true},
+	{Path: tools.VersionLookupPath, Summary: "Resolve a version by maintainer, app and version name, 'latest' refers to the newest version", Tag: "versions", Request: tools.VersionLookupRequest{}, Response: tools.VersionLookupResult{}},
+	{Path: tools.ReleaseFeedPath, Summary: "Return an Atom feed of the newest releases including changelog excerpts, restricted to a maintainer or one of its apps if given. Supports conditional requests via ETag and Last-Modified", Tag: "versions", Method: http.MethodGet, QueryParams: []Parameter{
+		{Name: "maintainer", In: "query", Schema: &Schema{Type: "string", Pattern: "^[a-z0-9]{3,20}$"}},
+		{Name: "app", In: "query", Schema: &Schema{Type: "string", Pattern: "^[a-z0-9]{3,20}$"}},
+	}},
+
+	{Path: tools.WebhookCreationPath, Summary: "Register a URL which receives the events of the apps of the authenticated user, signed with the secret in the " + tools.WebhookSignatureHeader + " header. Only admins may receive the events of all apps", Tag: "webhooks", Request: tools.WebhookCreation{}, Response: tools.Webhook{}, Protected: true},
+	{Path: tools.WebhookListPath, Summary: "List the webhooks of the authenticated user", Tag: "webhooks", Response: []tools.Webhook{}, Protected: true},
+	{Path: tools.WebhookDeletePath, Summary: "Delete a webhook, pending deliveries are dropped", Tag: "webhooks", Request: tools.NumberString{}, Protected: true},
+	{Path: tools.WebhookDeliveriesPath, Summary: "List the latest deliveries of a webhook, newest first", Tag: "webhooks", Request: tools.NumberString{}, Response: []tools.WebhookDelivery{}, Protected: true},
+
+	{Path: tools.AdminUserQuotaPath, Summary: "Change the storage limit of a user, only available to admins", Tag: "admin", Request: tools.UserQuotaUpdate{}, Protected: true},
+	{Path: tools.AdminAppQuotaPath, Summary: "Change the storage limit and maximum number of versions of an app, only available to admins", Tag: "admin", Request: tools.AppQuotaUpdate{}, Protected: true},
+
+	{Path: tools.OpenApiPath, Summary: "Return this OpenAPI document", Tag: "meta", Method: http.MethodGet},
+	{Path: tools.InfoPath, Summary: "Return the version, commit and build date of the store and its profile", Tag: "meta", Response: tools.BuildInfo{}, Method: http.MethodGet},
+	{Path: tools.CspReportPath, Summary: "Report a violation of the Content Security Policy, sent by browsers in the format of the report-uri directive or the Reporting API", Tag: "meta"},
+	{Path: tools.HealthPath, Summary: "Succeed if the store process is alive", Tag: "meta", Method: http.MethodGet},
+	{Path: tools.MetricsPath, Summary: "Return metrics about requests, transferred bytes, logins, quota rejections, webhook delivery attempts, the database connection pool and the amount of stored data in the Prometheus text format. Requires the bearer token from server.metrics_token if set", Tag: "meta", Method: http.MethodGet},
+	{Path: tools.ReadinessPath, Summary: "Report whether the database is reachable and writable, the schema is up to date and, if enabled, the SMTP server is reachable, answers with status 503 if not", Tag: "meta", Response: tools.ReadinessReport{}, Method: http.MethodGet},
+	{Path: tools.WipeDataPath, Summary: "Delete all data, only available in the TEST profile", Tag: "testing"},
+}
+
+var document = Generate(RouteDocs)
+
+func Generate(routeDocs []RouteDoc) *Document {
+	registry := schemaRegistry{}
+	paths := map[string]PathItem{}
+	errorContent := map[string]MediaType{"application/json": {Schema: registry.schemaOf(reflect.TypeOf(tools.ErrorResponse{}))}}
+
+	for _, route := range routeDocs {
+		operation := &Operation{
+			Summary:    route.Summary,
+			Tags:       []string{route.Tag},
+			Parameters: route.QueryParams,
+			Responses: map[string]Response{
+				"500": {Description: "internal error", Content: errorContent},
+			},
+		}
+
+		if route.Request != nil || route.QueryParams != nil {
+			operation.Responses["400"] = Response{Description: "invalid input", Content: errorContent}
+		}
+
+		if route.Request != nil {
+			operation.RequestBody = &RequestBody{
+				Required: true,
+				Content:  map[string]MediaType{"application/json": {Schema: registry.schemaOf(reflect.TypeOf(route.Request))}},
+			}
+		}
+
+		okResponse := Response{Description: "success"}
+		if route.Response != nil {
+			okResponse.Content = map[string]MediaType{"application/json": {Schema: registry.schemaOf(reflect.TypeOf(route.Response))}}
+		}
+		operation.Responses["200"] = okResponse
+
+		if route.Protected {
+			operation.Security = []map[string][]string{{cookieAuthScheme: {}}, {bearerAuthScheme: {}}}
+			operation.Responses["401"] = Response{Description: "not authenticated or not authorized", Content: errorContent}
+			operation.Responses["403"] = Response{Description: "CSRF token missing or invalid", Content: errorContent}
+		}
+
+		if route.Method == http.MethodGet {
+			paths[route.Path] = PathItem{Get: operation}
+		} else {
+			paths[route.Path] = PathItem{Post: operation}
+		}
+	}
+
+	return &Document{
+		OpenApi: "3.1.0",
+		Info: Info{
+			Title:       "Ocelot App Store API",
+			Description: "API of the Ocelot App Store. Protected routes require the authentication cookie received at login, or its value as bearer token. When using the cookie, requests must also send the CSRF token in the X-CSRF-Token header, which is the value of the csrf cookie and also returned in the same header by the login. Errors are returned as JSON objects with a stable machine-readable code.",
+			Version:     "1.0.0",
+		},
+		Paths: paths,
+		Components: Components{
+			Schemas: registry,
+			SecuritySchemes: map[string]SecurityScheme{
+				cookieAuthScheme: {Type: "apiKey", In: "cookie", Name: tools.CookieName},
+				bearerAuthScheme: {Type: "http", Scheme: "bearer"},
+			},
+		},
+	}
+}
+
+// DocumentedPaths returns the sorted paths of all documented routes.
+func DocumentedPaths() []string {
+	var paths []string
+	for path := range document.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func SpecHandler(w http.ResponseWriter, r *http.Request) {
+	utils.SendJsonResponse(w, document)
+}
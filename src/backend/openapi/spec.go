@@ -0,0 +1,164 @@
+package openapi
+
+import (
+	"github.com/ocelot-cloud/shared/validation"
+	"reflect"
+	"strings"
+	"time"
+)
+
+type Document struct {
+	OpenApi    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type PathItem struct {
+	Post *Operation `json:"post,omitempty"`
+	Get  *Operation `json:"get,omitempty"`
+}
+
+type Operation struct {
+	Summary     string                `json:"summary"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref         string             `json:"$ref,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Pattern     string             `json:"pattern,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme,omitempty"`
+	In     string `json:"in,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaRegistry collects the component schemas of all DTOs referenced by the documented routes.
+type schemaRegistry map[string]*Schema
+
+// schemaOf returns the schema of the given Go type. Named structs are registered as components and referenced.
+func (s schemaRegistry) schemaOf(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return &Schema{Type: "string", Format: "byte", Description: "base64 encoded bytes"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: s.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object"}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.structSchema(t)
+		}
+		if _, exists := s[t.Name()]; !exists {
+			// placeholder prevents endless recursion on self-referencing types
+			s[t.Name()] = &Schema{}
+			*s[t.Name()] = *s.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + t.Name()}
+	default:
+		return &Schema{}
+	}
+}
+
+func (s schemaRegistry) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := jsonName(field)
+		if name == "-" {
+			continue
+		}
+
+		fieldSchema := s.schemaOf(field.Type)
+		validationType := field.Tag.Get("validate")
+		if regex, found := validation.ValidationTypeMap[validationType]; found {
+			fieldSchema.Pattern = regex.String()
+			// Fields whose validation regex rejects the empty string must always be provided.
+			if !regex.MatchString("") {
+				schema.Required = append(schema.Required, name)
+			}
+		}
+		schema.Properties[name] = fieldSchema
+	}
+	return schema
+}
+
+func jsonName(field reflect.StructField) string {
+	tag := field.Tag.Get("json")
+	if tag == "" {
+		return field.Name
+	}
+	name := strings.Split(tag, ",")[0]
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
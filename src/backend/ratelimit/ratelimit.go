@@ -0,0 +1,119 @@
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cleanupInterval is how often buckets which are full again are removed, so that the memory used stays bounded by
+// the number of recently active clients.
+const cleanupInterval = time.Minute
+
+// Limiter is a token bucket rate limiter with one bucket per client key.
+type Limiter struct {
+	mutex       sync.Mutex
+	ratePerSec  float64
+	burst       float64
+	buckets     map[string]*bucket
+	lastCleanup time.Time
+	now         func() time.Time
+}
+
+type bucket struct {
+	tokens     float64
+	lastRefill time.Time
+}
+
+// NewLimiter returns a limiter allowing each client burst requests at once, which are refilled with perMinute
+// requests per minute.
+func NewLimiter(perMinute, burst int) *Limiter {
+	return newLimiterWithClock(perMinute, burst, time.Now)
+}
+
+func newLimiterWithClock(perMinute, burst int, now func() time.Time) *Limiter {
+	return &Limiter{
+		ratePerSec:  float64(perMinute) / 60,
+		burst:       float64(burst),
+		buckets:     map[string]*bucket{},
+		lastCleanup: now(),
+		now:         now,
+	}
+}
+
+// Allow takes a token from the bucket of the client. If the bucket is empty, it returns false and how long the client
+// has to wait for the next token.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := l.now()
+	l.removeFullBuckets(now)
+
+	b, found := l.buckets[key]
+	if !found {
+		b = &bucket{tokens: l.burst, lastRefill: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.lastRefill).Seconds()*l.ratePerSec)
+	b.lastRefill = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.ratePerSec * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// removeFullBuckets forgets clients whose buckets were refilled completely, since a new bucket is full as well.
+func (l *Limiter) removeFullBuckets(now time.Time) {
+	if now.Sub(l.lastCleanup) < cleanupInterval {
+		return
+	}
+	l.lastCleanup = now
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.lastRefill).Seconds()*l.ratePerSec >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// ClientIp returns the IP address of the client which sent the request. If the request comes from a trusted proxy,
+// the X-Forwarded-For header is followed from the right to the first address not belonging to a trusted proxy, since
+// entries left of it may be forged by the client.
+func ClientIp(r *http.Request, trustedProxies []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	remote, err := netip.ParseAddr(host)
+	if err != nil || !isTrusted(remote.Unmap(), trustedProxies) {
+		return host
+	}
+
+	forwardedFor := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	client := host
+	for i := len(forwardedFor) - 1; i >= 0; i-- {
+		address, err := netip.ParseAddr(strings.TrimSpace(forwardedFor[i]))
+		if err != nil {
+			break
+		}
+		client = address.Unmap().String()
+		if !isTrusted(address.Unmap(), trustedProxies) {
+			break
+		}
+	}
+	return client
+}
+
+func isTrusted(address netip.Addr, trustedProxies []netip.Prefix) bool {
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(address) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"github.com/ocelot-cloud/shared/assert"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func TestLimiterAllowsBurstAndRefills(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	limiter := newLimiterWithClock(60, 2, clock.Now)
+
+	allowed, _ := limiter.Allow("a")
+	assert.True(t, allowed)
+	allowed, _ = limiter.Allow("a")
+	assert.True(t, allowed)
+	allowed, retryAfter := limiter.Allow("a")
+	assert.False(t, allowed)
+	assert.Equal(t, time.Second, retryAfter)
+
+	allowed, _ = limiter.Allow("b")
+	assert.True(t, allowed)
+
+	clock.now = clock.now.Add(time.Second)
+	allowed, _ = limiter.Allow("a")
+	assert.True(t, allowed)
+	allowed, _ = limiter.Allow("a")
+	assert.False(t, allowed)
+}
+
+func TestLimiterForgetsIdleClients(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	limiter := newLimiterWithClock(60, 2, clock.Now)
+	limiter.Allow("a")
+	clock.now = clock.now.Add(cleanupInterval)
+	limiter.Allow("b")
+	assert.Equal(t, 1, len(limiter.buckets))
+}
+
+func TestClientIp(t *testing.T) {
+	trustedProxies := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	getClientIp := func(remoteAddr string, forwardedFor string) string {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			request.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		return ClientIp(request, trustedProxies)
+	}
+
+	assert.Equal(t, "203.0.113.1", getClientIp("203.0.113.1:1234", ""))
+	assert.Equal(t, "203.0.113.1", getClientIp("203.0.113.1:1234", "198.51.100.7"))
+	assert.Equal(t, "198.51.100.7", getClientIp("10.0.0.1:1234", "198.51.100.7"))
+	assert.Equal(t, "198.51.100.7", getClientIp("10.0.0.1:1234", "192.0.2.99, 198.51.100.7, 10.0.0.2"))
+	assert.Equal(t, "10.0.0.1", getClientIp("10.0.0.1:1234", ""))
+}
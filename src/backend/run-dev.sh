@@ -2,6 +2,5 @@
 
 set -e
 
-docker compose -f ../ci-runner/docker-compose.yml up -d
 go build
-PROFILE="TEST" USE_MOCK_EMAIL_CLIENT=true ./store
+STORE_EMAIL_USE_MOCK_CLIENT=true STORE_DATABASE_DRIVER=sqlite STORE_CORS_ALLOWED_ORIGINS=http://localhost:8081 ./store --profile TEST
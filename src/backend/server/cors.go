@@ -0,0 +1,83 @@
+package server
+
+import (
+	"net/http"
+	"ocelot/store/tools"
+	"strconv"
+	"strings"
+)
+
+// exposedHeaders are the response headers which scripts of other origins may read besides the basic ones. The CSRF
+// token of the login response is among them, since frontends of other origins can't read the csrf cookie.
+var exposedHeaders = []string{tools.RequestIdHeader, "Retry-After", tools.CsrfHeader}
+
+// withCors applies the CORS policy of the config. Requests without an origin or from the host itself are passed on
+// unchanged. Requests from the allowed origins get the CORS headers, preflight requests are answered directly.
+// Requests from all other origins are rejected, so that other sites cannot trigger any actions, even with simple
+// requests which browsers send without preflight.
+func (s *Server) withCors(next http.Handler) http.Handler {
+	cors := s.config.Cors
+	allowedMethods := strings.Join(cors.AllowedMethods, ", ")
+	allowedHeaders := strings.Join(cors.AllowedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cors.MaxAge.Seconds()))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+
+		if !cors.IsOriginAllowed(origin) {
+			if removeSchemeAndPortIfPresent(origin) == removeSchemeAndPortIfPresent(r.Host) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			tools.GetLogger(r).Info("request failed since origin '%s' differed from host '%s' and is not allowed", origin, r.Host)
+			tools.WriteError(w, r, http.StatusBadRequest, tools.CodeOriginMismatch, "When 'Origin' header is set, it must match host header or be an allowed origin")
+			return
+		}
+
+		if cors.AllowCredentials {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		} else if cors.IsOriginAllowed("*") {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Methods", allowedMethods)
+			if allowedHeaders != "" {
+				w.Header().Set("Access-Control-Allow-Headers", allowedHeaders)
+			}
+			if cors.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", maxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Access-Control-Expose-Headers", strings.Join(exposedHeaders, ", "))
+		next.ServeHTTP(w, r)
+	})
+}
+
+func removeSchemeAndPortIfPresent(url string) string {
+	var newUrl string
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		newUrl = strings.Split(url, "://")[1]
+	} else {
+		newUrl = url
+	}
+
+	if strings.Contains(newUrl, ":") {
+		newUrl = strings.Split(newUrl, ":")[0]
+	}
+
+	return newUrl
+}
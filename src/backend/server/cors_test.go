@@ -0,0 +1,120 @@
+package server
+
+import (
+	"github.com/ocelot-cloud/shared/assert"
+	"net/http"
+	"net/http/httptest"
+	"ocelot/store/config"
+	"ocelot/store/tools"
+	"ocelot/store/users"
+	"strings"
+	"testing"
+)
+
+const partnerOrigin = "https://dashboard.example.com"
+
+func sendWithOrigin(handler http.Handler, method, origin string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, tools.SearchAppsPath, strings.NewReader(`{"search_term":""}`))
+	request.Host = "store.example.com"
+	request.Header.Set("Origin", origin)
+	if method == http.MethodOptions {
+		request.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		request.Header.Set("Access-Control-Request-Headers", "content-type, x-csrf-token")
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestAllowedOriginsGetCorsHeaders(t *testing.T) {
+	cfg := config.Default()
+	cfg.Cors.AllowedOrigins = []string{partnerOrigin}
+	handler := newTestServer(cfg).Handler()
+
+	recorder := sendWithOrigin(handler, http.MethodOptions, partnerOrigin)
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Equal(t, partnerOrigin, recorder.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", recorder.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "GET, POST, OPTIONS", recorder.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Accept, Content-Type, Authorization, X-CSRF-Token, X-Request-ID", recorder.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", recorder.Header().Get("Access-Control-Max-Age"))
+
+	recorder = sendWithOrigin(handler, http.MethodPost, partnerOrigin)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, partnerOrigin, recorder.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "X-Request-ID, Retry-After, X-CSRF-Token", recorder.Header().Get("Access-Control-Expose-Headers"))
+	assert.Equal(t, "", recorder.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Origin", recorder.Header().Get("Vary"))
+}
+
+func TestOtherOriginsAreRejected(t *testing.T) {
+	cfg := config.Default()
+	cfg.Cors.AllowedOrigins = []string{partnerOrigin}
+	handler := newTestServer(cfg).Handler()
+
+	for _, method := range []string{http.MethodOptions, http.MethodPost} {
+		recorder := sendWithOrigin(handler, method, "https://evil.example.com")
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		assert.Equal(t, "", recorder.Header().Get("Access-Control-Allow-Origin"))
+	}
+
+	recorder := sendWithOrigin(handler, http.MethodPost, "https://store.example.com")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "", recorder.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestWildcardOriginWithoutCredentials(t *testing.T) {
+	cfg := config.Default()
+	cfg.Cors.AllowedOrigins = []string{"*"}
+	cfg.Cors.AllowCredentials = false
+	recorder := sendWithOrigin(newTestServer(cfg).Handler(), http.MethodOptions, partnerOrigin)
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Equal(t, "*", recorder.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "", recorder.Header().Get("Access-Control-Allow-Credentials"))
+}
+
+// Browsers only send the SameSite=Strict session cookie to allowed origins of the same site, e.g. other subdomains.
+// Such frontends can't read the csrf cookie of the store, so they take the token from the login response.
+func TestAllowedOriginsGetTheCsrfTokenOnLogin(t *testing.T) {
+	cfg := config.Default()
+	cfg.Cors.AllowedOrigins = []string{partnerOrigin}
+	s := newTestServer(cfg)
+	handler := s.Handler()
+	assert.Nil(t, users.CreateAndValidateUser(s.repos.Users, tools.SampleForm))
+
+	credentials := `{"user":"` + tools.SampleUser + `","password":"` + tools.SamplePassword + `"}`
+	request := httptest.NewRequest(http.MethodPost, tools.LoginPath, strings.NewReader(credentials))
+	request.Host = "store.example.com"
+	request.Header.Set("Origin", partnerOrigin)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.True(t, strings.Contains(recorder.Header().Get("Access-Control-Expose-Headers"), tools.CsrfHeader))
+	csrfToken := recorder.Header().Get(tools.CsrfHeader)
+	assert.NotEqual(t, "", csrfToken)
+	var sessionCookie *http.Cookie
+	for _, cookie := range recorder.Result().Cookies() {
+		if cookie.Name == tools.CookieName {
+			sessionCookie = cookie
+		} else if cookie.Name == tools.CsrfCookieName {
+			assert.Equal(t, cookie.Value, csrfToken)
+		}
+	}
+	assert.NotNil(t, sessionCookie)
+
+	checkAuth := func(csrfToken string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, tools.AuthCheckPath, nil)
+		request.Host = "store.example.com"
+		request.Header.Set("Origin", partnerOrigin)
+		request.AddCookie(&http.Cookie{Name: tools.CookieName, Value: sessionCookie.Value})
+		request.Header.Set(tools.CsrfHeader, csrfToken)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+	recorder = checkAuth(csrfToken)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, partnerOrigin, recorder.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", recorder.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, http.StatusForbidden, checkAuth("").Code)
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/ocelot-cloud/shared/utils"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"ocelot/store/tools"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// hashedAssetPattern matches the files the frontend build names after a hash of their content. Since their content
+// never changes, browsers may cache them forever.
+var hashedAssetPattern = regexp.MustCompile(`^assets/.+-[A-Za-z0-9_-]{8,}\.[a-z0-9]+$`)
+
+// precompressedEncodings are the encodings of the precompressed variants of the frontend files, named after the file
+// plus the extension, in order of preference.
+var precompressedEncodings = []struct {
+	name      string
+	extension string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// computeFrontendEtags returns the ETags of the frontend files by their name. Embedded files have no modification time,
+// so without an ETag, browsers could not revalidate them and would download them again in full.
+func computeFrontendEtags(files fs.FS, logger utils.LoggerType) map[string]string {
+	etags := map[string]string{}
+	err := fs.WalkDir(files, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		content, err := fs.ReadFile(files, name)
+		if err != nil {
+			return err
+		}
+		hash := sha256.Sum256(content)
+		etags[name] = `"` + hex.EncodeToString(hash[:16]) + `"`
+		return nil
+	})
+	if err != nil {
+		logger.Warn("computing the ETags of the frontend files failed, files without ETag are not cached: %v", err)
+	}
+	return etags
+}
+
+func (s *Server) initializeFrontendResourceDelivery(mux *http.ServeMux) {
+	mux.Handle("/", withRoute("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		if name == "" || name == "index.html" {
+			s.serveIndexHtml(w, r)
+			return
+		}
+
+		info, err := fs.Stat(s.frontendFiles, name)
+		// If the requested file does not exist and the path does not seem to refer to a static file (i.e. no dot
+		// extension like ".css"), then serve index.html. This caters to SPA routing needs, allowing frontend routes to
+		// be handled by index.html. This means that users can directly access pages with paths such as
+		// "example.com/some/path".
+		if err != nil && !strings.Contains(name, ".") {
+			tools.GetLogger(r).Debug("Serving index.html for SPA route: %s", r.URL.Path)
+			s.serveIndexHtml(w, r)
+			return
+		} else if err != nil || info.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+
+		tools.GetLogger(r).Debug("Serving static content at '%s'", r.URL.Path)
+		s.serveFrontendFile(w, r, name)
+	})))
+}
+
+// serveFrontendFile serves the file, or its precompressed variant if the client accepts it. Range requests always get
+// the uncompressed file, so that a partial response never has a Content-Encoding.
+func (s *Server) serveFrontendFile(w http.ResponseWriter, r *http.Request, name string) {
+	if hashedAssetPattern.MatchString(name) {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	w.Header().Set("Vary", "Accept-Encoding")
+	if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+
+	fileName := name
+	for _, encoding := range precompressedEncodings {
+		if _, err := fs.Stat(s.frontendFiles, name+encoding.extension); err == nil && r.Header.Get("Range") == "" && acceptsEncoding(r, encoding.name) {
+			fileName = name + encoding.extension
+			w.Header().Set("Content-Encoding", encoding.name)
+			break
+		}
+	}
+	// Each variant has its own ETag, since they differ in their bytes.
+	if etag, found := s.frontendEtags[fileName]; found {
+		w.Header().Set("ETag", etag)
+	}
+
+	file, err := s.frontendFiles.Open(fileName)
+	if err != nil {
+		tools.GetLogger(r).Error("opening frontend file '%s' failed: %v", fileName, err)
+		tools.WriteInternalError(w, r, "frontend not available")
+		return
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	info, err := file.Stat()
+	content, isSeekable := file.(io.ReadSeeker)
+	if err != nil || !isSeekable {
+		tools.GetLogger(r).Error("reading frontend file '%s' failed: %v", fileName, err)
+		tools.WriteInternalError(w, r, "frontend not available")
+		return
+	}
+	http.ServeContent(w, r, name, info.ModTime(), content)
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header of the request contains the encoding without a quality
+// of zero.
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, value := range r.Header.Values("Accept-Encoding") {
+		for _, entry := range strings.Split(value, ",") {
+			name, parameters, _ := strings.Cut(strings.TrimSpace(entry), ";")
+			if strings.TrimSpace(name) != encoding {
+				continue
+			}
+			quality, hasQuality := strings.CutPrefix(strings.TrimSpace(parameters), "q=")
+			if !hasQuality {
+				return true
+			}
+			value, err := strconv.ParseFloat(quality, 64)
+			return err == nil && value > 0
+		}
+	}
+	return false
+}
+
+// serveIndexHtml serves index.html with a new nonce for the Content Security Policy. It must not be cached, since it
+// refers to the current hashed assets and the nonce must not be reused.
+func (s *Server) serveIndexHtml(w http.ResponseWriter, r *http.Request) {
+	indexHtml, err := fs.ReadFile(s.frontendFiles, "index.html")
+	if err != nil {
+		tools.GetLogger(r).Error("reading index.html failed: %v", err)
+		tools.WriteInternalError(w, r, "frontend not available")
+		return
+	}
+	nonce := newCspNonce()
+	s.setContentSecurityPolicy(w, nonce)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache, no-store")
+	w.WriteHeader(http.StatusOK)
+	if _, err = w.Write([]byte(addCspNonce(string(indexHtml), nonce))); err != nil {
+		tools.GetLogger(r).Error("writing index.html failed: %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"github.com/ocelot-cloud/shared/assert"
+	"net/http"
+	"net/http/httptest"
+	"ocelot/store/config"
+	"testing"
+	"testing/fstest"
+)
+
+const hashedAsset = "/assets/index-B7xq2Lz9.js"
+
+func getFrontendFile(t *testing.T, path string, acceptEncoding string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, path, nil)
+	if acceptEncoding != "" {
+		request.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	return serveTestFrontend(request)
+}
+
+func serveTestFrontend(request *http.Request) *httptest.ResponseRecorder {
+	s := newTestServer(config.Default())
+	s.frontendFiles = fstest.MapFS{
+		"index.html":                  {Data: []byte(sampleIndexHtml)},
+		"favicon.png":                 {Data: []byte("png")},
+		"assets/index-B7xq2Lz9.js":    {Data: []byte("plain")},
+		"assets/index-B7xq2Lz9.js.br": {Data: []byte("brotli")},
+		"assets/index-B7xq2Lz9.js.gz": {Data: []byte("gzip")},
+	}
+	s.frontendEtags = computeFrontendEtags(s.frontendFiles, s.logger)
+	recorder := httptest.NewRecorder()
+	s.Handler().ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestPrecompressedVariantsAreServedIfAccepted(t *testing.T) {
+	expectedContents := map[string]string{
+		"gzip, deflate, br": "brotli",
+		"gzip":              "gzip",
+		"br;q=0, gzip":      "gzip",
+		"":                  "plain",
+	}
+	for acceptEncoding, expectedContent := range expectedContents {
+		recorder := getFrontendFile(t, hashedAsset, acceptEncoding)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, expectedContent, recorder.Body.String())
+		assert.Equal(t, "text/javascript; charset=utf-8", recorder.Header().Get("Content-Type"))
+		assert.Equal(t, "Accept-Encoding", recorder.Header().Get("Vary"))
+	}
+	assert.Equal(t, "br", getFrontendFile(t, hashedAsset, "br").Header().Get("Content-Encoding"))
+	assert.Equal(t, "", getFrontendFile(t, hashedAsset, "").Header().Get("Content-Encoding"))
+}
+
+func TestOnlyHashedAssetsAreCachedForever(t *testing.T) {
+	assert.Equal(t, "public, max-age=31536000, immutable", getFrontendFile(t, hashedAsset, "").Header().Get("Cache-Control"))
+	assert.Equal(t, "no-cache", getFrontendFile(t, "/favicon.png", "").Header().Get("Cache-Control"))
+	for _, path := range []string{"/", "/index.html", "/apps/sample"} {
+		recorder := getFrontendFile(t, path, "")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "no-cache, no-store", recorder.Header().Get("Cache-Control"))
+	}
+	assert.Equal(t, http.StatusNotFound, getFrontendFile(t, "/assets/missing.js", "").Code)
+}
+
+func TestFrontendFilesAreRevalidatedByTheirEtag(t *testing.T) {
+	etag := getFrontendFile(t, "/favicon.png", "").Header().Get("ETag")
+	assert.NotEqual(t, "", etag)
+	assert.NotEqual(t, etag, getFrontendFile(t, hashedAsset, "").Header().Get("ETag"))
+	assert.NotEqual(t, getFrontendFile(t, hashedAsset, "").Header().Get("ETag"), getFrontendFile(t, hashedAsset, "br").Header().Get("ETag"))
+
+	request := httptest.NewRequest(http.MethodGet, "/favicon.png", nil)
+	request.Header.Set("If-None-Match", etag)
+	recorder := serveTestFrontend(request)
+	assert.Equal(t, http.StatusNotModified, recorder.Code)
+	assert.Equal(t, "", recorder.Body.String())
+}
+
+func TestRangeRequestsGetTheUncompressedFile(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, hashedAsset, nil)
+	request.Header.Set("Accept-Encoding", "br, gzip")
+	request.Header.Set("Range", "bytes=1-2")
+	recorder := serveTestFrontend(request)
+	assert.Equal(t, http.StatusPartialContent, recorder.Code)
+	assert.Equal(t, "la", recorder.Body.String())
+	assert.Equal(t, "", recorder.Header().Get("Content-Encoding"))
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"github.com/ocelot-cloud/shared/utils"
+	"net/http"
+	"ocelot/store/buildinfo"
+	"ocelot/store/tools"
+	"strings"
+	"time"
+)
+
+const readinessCheckTimeout = 5 * time.Second
+
+// getProbeRoutes returns the routes meant for load balancers, process supervisors, monitoring and the violation
+// reports of browsers. They are unprotected and served without origin check, since such clients send arbitrary
+// origins. Only the metrics and the violation reports are rate limited, and the metrics can be protected with a token.
+func (s *Server) getProbeRoutes() []Route {
+	return []Route{
+		{tools.HealthPath, s.healthHandler},
+		{tools.ReadinessPath, s.readinessHandler},
+		{tools.InfoPath, s.infoHandler},
+		{tools.MetricsPath, s.metricsHandler},
+		{tools.CspReportPath, s.cspReportHandler},
+	}
+}
+
+// healthHandler reports that the process is alive and able to handle requests.
+func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+// readinessHandler reports whether the store can serve requests. The database checks are skipped if the repositories
+// don't use a database and the SMTP server is only checked if enabled in the config.
+func (s *Server) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessCheckTimeout)
+	defer cancel()
+
+	report := tools.ReadinessReport{Ready: true, Checks: []tools.ReadinessCheck{}}
+	addCheck := func(name string, err error) {
+		check := tools.ReadinessCheck{Name: name, Ok: err == nil}
+		if err != nil {
+			tools.GetLogger(r).Warn("readiness check '%s' failed: %v", name, err)
+			report.Ready = false
+		}
+		report.Checks = append(report.Checks, check)
+	}
+
+	if s.db != nil {
+		addCheck("database", s.db.PingContext(ctx))
+		addCheck("migrations", s.db.CheckSchemaVersion(ctx))
+		addCheck("storage", s.db.CheckWritable(ctx))
+	}
+	if s.config.Email.ReadinessCheck && !s.config.UsesMockEmailClient() {
+		addCheck("smtp", s.mailer.Ping())
+	}
+
+	statusCode := http.StatusOK
+	if !report.Ready {
+		statusCode = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		tools.GetLogger(r).Error("writing readiness report failed: %v", err)
+	}
+}
+
+func (s *Server) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if token := s.config.Server.MetricsToken; token != "" {
+		received, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(received), []byte(token)) != 1 {
+			tools.GetLogger(r).Info("metrics requested without valid token")
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			tools.WriteError(w, r, http.StatusUnauthorized, tools.CodeMetricsTokenInvalid, "metrics token missing or invalid")
+			return
+		}
+	}
+	s.metrics.Handler().ServeHTTP(w, r)
+}
+
+func (s *Server) infoHandler(w http.ResponseWriter, r *http.Request) {
+	info := buildinfo.Get()
+	utils.SendJsonResponse(w, tools.BuildInfo{
+		Version:   info.Version,
+		Commit:    info.Commit,
+		BuildDate: info.Date,
+		Profile:   s.config.Server.Profile,
+	})
+}
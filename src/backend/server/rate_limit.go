@@ -0,0 +1,97 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"ocelot/store/ratelimit"
+	"ocelot/store/tools"
+	"strconv"
+)
+
+const (
+	rateLimitClassAccount  = "account"
+	rateLimitClassSearch   = "search"
+	rateLimitClassDownload = "download"
+	rateLimitClassWrite    = "write"
+)
+
+// rateLimitClasses assigns the routes which are rate limited to their class. Routes of the same class share the limit.
+// All API routes except the one of the TEST profile must be listed, reads which are not a search share its class.
+var rateLimitClasses = map[string]string{
+	tools.RegistrationPath:    rateLimitClassAccount,
+	tools.EmailValidationPath: rateLimitClassAccount,
+	tools.LoginPath:           rateLimitClassAccount,
+	tools.ChangePasswordPath:  rateLimitClassAccount,
+	tools.LogoutPath:          rateLimitClassAccount,
+	tools.DeleteUserPath:      rateLimitClassAccount,
+
+	tools.SearchAppsPath:         rateLimitClassSearch,
+	tools.AppLookupPath:          rateLimitClassSearch,
+	tools.VersionLookupPath:      rateLimitClassSearch,
+	tools.GetVersionsPath:        rateLimitClassSearch,
+	tools.ReleaseFeedPath:        rateLimitClassSearch,
+	tools.CspReportPath:          rateLimitClassSearch,
+	tools.MetricsPath:            rateLimitClassSearch,
+	tools.OpenApiPath:            rateLimitClassSearch,
+	tools.AuthCheckPath:          rateLimitClassSearch,
+	tools.AppGetListPath:         rateLimitClassSearch,
+	tools.QuotaPath:              rateLimitClassSearch,
+	tools.RetentionPolicyGetPath: rateLimitClassSearch,
+	tools.RetentionDryRunPath:    rateLimitClassSearch,
+	tools.WebhookListPath:        rateLimitClassSearch,
+	tools.WebhookDeliveriesPath:  rateLimitClassSearch,
+
+	tools.DownloadPath: rateLimitClassDownload,
+
+	tools.AppCreationPath:        rateLimitClassWrite,
+	tools.AppDeletePath:          rateLimitClassWrite,
+	tools.VersionUploadPath:      rateLimitClassWrite,
+	tools.VersionDeletePath:      rateLimitClassWrite,
+	tools.RetentionPolicySetPath: rateLimitClassWrite,
+	tools.WebhookCreationPath:    rateLimitClassWrite,
+	tools.WebhookDeletePath:      rateLimitClassWrite,
+	tools.AdminUserQuotaPath:     rateLimitClassWrite,
+	tools.AdminAppQuotaPath:      rateLimitClassWrite,
+}
+
+// newRateLimiters returns a limiter per class, or nil if rate limiting is disabled.
+func (s *Server) newRateLimiters() map[string]*ratelimit.Limiter {
+	if !s.config.UsesRateLimits() {
+		return nil
+	}
+	limits := s.config.RateLimit
+	return map[string]*ratelimit.Limiter{
+		rateLimitClassAccount:  ratelimit.NewLimiter(limits.AccountPerMinute, limits.AccountBurst),
+		rateLimitClassSearch:   ratelimit.NewLimiter(limits.SearchPerMinute, limits.SearchBurst),
+		rateLimitClassDownload: ratelimit.NewLimiter(limits.DownloadPerMinute, limits.DownloadBurst),
+		rateLimitClassWrite:    ratelimit.NewLimiter(limits.WritePerMinute, limits.WriteBurst),
+	}
+}
+
+// rateLimitMiddleware rejects requests of clients which exceeded the limit of the class of the route. Clients are
+// identified by their user name if authenticated and by their IP address otherwise, so on protected routes it must
+// be wrapped by the authMiddleware.
+func (s *Server) rateLimitMiddleware(path string, next http.Handler) http.Handler {
+	class, isLimited := rateLimitClasses[path]
+	limiter := s.rateLimiters[class]
+	if !isLimited || limiter == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := "ip:" + ratelimit.ClientIp(r, s.trustedProxies)
+		if info := tools.GetRequestInfo(r); info != nil && info.User != "" {
+			key = "user:" + info.User
+		}
+		allowed, retryAfter := limiter.Allow(key)
+		if !allowed {
+			retryAfterSeconds := int(math.Ceil(retryAfter.Seconds()))
+			tools.GetLogger(r).Info("rate limit of class '%s' exceeded by %s", class, key)
+			s.metrics.CountRateLimitRejection(class)
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds))
+			tools.WriteErrorWithDetails(w, r, http.StatusTooManyRequests, tools.CodeRateLimited, "too many requests, try again later",
+				map[string]any{"retry_after_seconds": retryAfterSeconds})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,282 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"ocelot/store/apps"
+	"ocelot/store/openapi"
+	"ocelot/store/tools"
+	"ocelot/store/users"
+	"ocelot/store/versions"
+	"ocelot/store/webhooks"
+	"regexp"
+	"time"
+)
+
+type Route struct {
+	path    string
+	handler http.HandlerFunc
+}
+
+type handlers struct {
+	users    *users.Handlers
+	apps     *apps.Handlers
+	versions *versions.Handlers
+	webhooks *webhooks.Handlers
+}
+
+func newHandlers(s *Server) *handlers {
+	return &handlers{
+		users: &users.Handlers{Users: s.repos.Users, Apps: s.repos.Apps, Mailer: s.mailer, Config: s.config, Metrics: s.metrics, Webhooks: s.webhooks},
+		apps:  &apps.Handlers{Apps: s.repos.Apps, Users: s.repos.Users, Webhooks: s.webhooks},
+		versions: &versions.Handlers{
+			Versions: s.repos.Versions,
+			Apps:     s.repos.Apps,
+			Users:    s.repos.Users,
+			Config:   s.config,
+			Metrics:  s.metrics,
+			Webhooks: s.webhooks,
+		},
+		webhooks: &webhooks.Handlers{Webhooks: s.repos.Webhooks, Config: s.config},
+	}
+}
+
+func getUnprotectedRoutes(h *handlers) []Route {
+	return []Route{
+		{tools.LoginPath, h.users.LoginHandler},
+		{tools.DownloadPath, h.versions.VersionDownloadHandler},
+		{tools.GetVersionsPath, h.versions.GetVersionsHandler},
+		{tools.SearchAppsPath, h.apps.SearchForAppsHandler},
+		{tools.RegistrationPath, h.users.RegistrationHandler},
+		{tools.EmailValidationPath, h.users.ValidationCodeHandler},
+		{tools.AppLookupPath, h.apps.AppLookupHandler},
+		{tools.VersionLookupPath, h.versions.VersionLookupHandler},
+		{tools.ReleaseFeedPath, h.versions.ReleaseFeedHandler},
+		{tools.OpenApiPath, openapi.SpecHandler},
+	}
+}
+
+func getProtectedRoutes(h *handlers) []Route {
+	return []Route{
+		{tools.AuthCheckPath, h.users.AuthCheckHandler},
+		{tools.VersionUploadPath, h.versions.VersionUploadHandler},
+		{tools.VersionDeletePath, h.versions.VersionDeleteHandler},
+		{tools.ChangePasswordPath, h.users.ChangePasswordHandler},
+		{tools.AppCreationPath, h.apps.AppCreationHandler},
+		{tools.AppGetListPath, h.apps.AppGetListHandler},
+		{tools.AppDeletePath, h.apps.AppDeleteHandler},
+		{tools.DeleteUserPath, h.users.UserDeleteHandler},
+		{tools.LogoutPath, h.users.LogoutHandler},
+		{tools.QuotaPath, h.users.QuotaHandler},
+		{tools.RetentionPolicySetPath, h.versions.RetentionPolicySetHandler},
+		{tools.RetentionPolicyGetPath, h.versions.RetentionPolicyGetHandler},
+		{tools.RetentionDryRunPath, h.versions.RetentionDryRunHandler},
+		{tools.WebhookCreationPath, h.webhooks.WebhookCreationHandler},
+		{tools.WebhookListPath, h.webhooks.WebhookListHandler},
+		{tools.WebhookDeletePath, h.webhooks.WebhookDeleteHandler},
+		{tools.WebhookDeliveriesPath, h.webhooks.WebhookDeliveriesHandler},
+	}
+}
+
+// getAdminRoutes returns the protected routes which are only available to admins.
+func getAdminRoutes(h *handlers) []Route {
+	return []Route{
+		{tools.AdminUserQuotaPath, h.users.UserQuotaUpdateHandler},
+		{tools.AdminAppQuotaPath, h.apps.AppQuotaUpdateHandler},
+	}
+}
+
+func getTestProfileRoutes(h *handlers) []Route {
+	return []Route{
+		{tools.WipeDataPath, h.users.WipeDataHandler},
+	}
+}
+
+// newHandler returns the handler of all routes. Requests from origins other than the host are subject to the CORS
+// policy, except for those to the probe routes.
+func (s *Server) newHandler() http.Handler {
+	mux := http.NewServeMux()
+	s.registerRoutes(mux)
+	s.initializeFrontendResourceDelivery(mux)
+
+	rootMux := http.NewServeMux()
+	for _, route := range s.getProbeRoutes() {
+		rootMux.Handle(route.path, withRoute(route.path, s.rateLimitMiddleware(route.path, route.handler)))
+	}
+	rootMux.Handle("/", s.withCors(mux))
+
+	var handler http.Handler = s.withRequestContext(s.withSecurityHeaders(rootMux))
+	if s.config.Tls.IsEnabled() && s.config.Tls.HstsMaxAge > 0 {
+		handler = s.withHsts(handler)
+	}
+	return handler
+}
+
+func (s *Server) registerRoutes(mux *http.ServeMux) {
+	h := newHandlers(s)
+	unprotectedRoutes := getUnprotectedRoutes(h)
+
+	if s.config.IsTestProfile() {
+		s.repos.Users.WipeDatabase()
+		s.logger.Warn("opening unprotected full data wipe endpoint meant for testing only")
+		unprotectedRoutes = append(unprotectedRoutes, getTestProfileRoutes(h)...)
+		// This user is created to manually test the GUI so that account registration can be skipped to save time.
+		sampleUser := "sample"
+		// The user may already exist from previous runs. In this case, ignore the error.
+		err := users.CreateAndValidateUser(s.repos.Users, &tools.RegistrationForm{
+			User:     sampleUser,
+			Password: "password",
+			Email:    "sample@sample.com",
+		})
+		if err != nil {
+			s.logger.Debug("Failed to create user '%s' - maybe because he already exists, error: %v.", sampleUser, err)
+		}
+		s.logger.Warn("created '%s' user with weak password for manual testing", sampleUser)
+		s.loadSampleAppData("sampleuser", "nginx", "sample2@sample.com", "sampleuser-app", true)
+		s.loadSampleAppData("maliciousmaintainer", "maliciousapp", "sample3@sample.com", "malicious-app", false)
+	}
+
+	for _, route := range unprotectedRoutes {
+		mux.Handle(route.path, s.instrumentRoute(route.path, s.rateLimitMiddleware(route.path, route.handler)))
+	}
+	for _, route := range getProtectedRoutes(h) {
+		mux.Handle(route.path, s.instrumentRoute(route.path, authMiddleware(s.rateLimitMiddleware(route.path, route.handler), h.users)))
+	}
+	for _, route := range getAdminRoutes(h) {
+		mux.Handle(route.path, s.instrumentRoute(route.path, authMiddleware(s.rateLimitMiddleware(route.path, s.adminMiddleware(route.handler)), h.users)))
+	}
+}
+
+func (s *Server) loadSampleAppData(username, appname, email, sampleDir string, shouldBeValid bool) {
+	err := users.CreateAndValidateUser(s.repos.Users, &tools.RegistrationForm{
+		User:     username,
+		Password: "password",
+		Email:    email,
+	})
+	if err != nil {
+		s.logger.Fatal("Failed to create '%s' user: %v.", username, err)
+	}
+	if err = s.repos.Apps.CreateApp(username, appname); err != nil {
+		s.logger.Fatal("Failed to create '%s' app: %v.", appname, err)
+	}
+	appId, err := s.repos.Apps.GetAppId(username, appname)
+	if err != nil {
+		s.logger.Fatal("Failed to get app ID: %v", err)
+	}
+	if err = s.repos.Versions.CreateVersion(appId, "0.0.1",
+		tools.GetVersionBytesOfSampleUserApp(sampleDir, username, appname, shouldBeValid), "Initial release."); err != nil {
+		s.logger.Fatal("Failed to create sample version: %v", err)
+	}
+}
+
+// instrumentRoute records the route of the requests for the access log and the metrics.
+func (s *Server) instrumentRoute(route string, next http.Handler) http.Handler {
+	return withRoute(route, s.metrics.InstrumentRoute(route, next))
+}
+
+// withRoute sets the route of the request info, so that the access log records the route instead of only the path.
+func withRoute(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if info := tools.GetRequestInfo(r); info != nil {
+			info.Route = route
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withRequestContext assigns an ID to every request, or takes the one given by the client, and adds it together with
+// a logger adding the ID to all lines to the context. Once the request is handled, it is written to the access log.
+func (s *Server) withRequestContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		requestId := r.Header.Get(tools.RequestIdHeader)
+		if !requestIdPattern.MatchString(requestId) {
+			requestId = newRequestId()
+		}
+		w.Header().Set(tools.RequestIdHeader, requestId)
+
+		info := &tools.RequestInfo{Id: requestId}
+		ctx := tools.WithRequestInfo(r.Context(), info)
+		ctx = tools.WithLogger(ctx, tools.WithRequestId(s.logger, requestId))
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		s.accessLog.Write(tools.AccessLogEntry{
+			RequestId: requestId,
+			Method:    r.Method,
+			Route:     info.Route,
+			Path:      r.URL.Path,
+			Status:    recorder.status,
+			Bytes:     recorder.bytes,
+			Duration:  time.Since(start),
+			User:      info.User,
+		})
+	})
+}
+
+// requestIdPattern restricts the request IDs accepted from clients, so that they can't inject arbitrary content into
+// the logs.
+var requestIdPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+func newRequestId() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// responseRecorder remembers the status code and the number of bytes of the response for the access log.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if !rr.wroteHeader {
+		rr.status = status
+		rr.wroteHeader = true
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(data []byte) (int, error) {
+	rr.wroteHeader = true
+	n, err := rr.ResponseWriter.Write(data)
+	rr.bytes += n
+	return n, err
+}
+
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
+
+func authMiddleware(next http.Handler, userHandlers *users.Handlers) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := userHandlers.CheckAuthentication(w, r)
+		if err != nil {
+			return
+		}
+		if info := tools.GetRequestInfo(r); info != nil {
+			info.User = user
+		}
+		ctx := context.WithValue(r.Context(), tools.UserCtxKey, user)
+		r = r.WithContext(ctx)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// adminMiddleware rejects users who are not admins. It must be wrapped by the authMiddleware.
+func (s *Server) adminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := tools.GetUserFromContext(r)
+		if !s.config.Quota.IsAdmin(user) {
+			s.logger.Warn("user '%s' tried to access admin route '%s'", user, r.URL.Path)
+			tools.WriteError(w, r, http.StatusForbidden, tools.CodeNotAdmin, "admin privileges required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
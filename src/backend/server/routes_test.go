@@ -0,0 +1,61 @@
+package server
+
+import (
+	"github.com/ocelot-cloud/shared/assert"
+	"ocelot/store/openapi"
+	"sort"
+	"testing"
+)
+
+func TestEveryRegisteredRouteIsDocumented(t *testing.T) {
+	docs := map[string]openapi.RouteDoc{}
+	for _, doc := range openapi.RouteDocs {
+		docs[doc.Path] = doc
+	}
+
+	h := newHandlers(&Server{})
+	var registeredPaths []string
+	unprotectedRoutes := append(getUnprotectedRoutes(h), getTestProfileRoutes(h)...)
+	unprotectedRoutes = append(unprotectedRoutes, (&Server{}).getProbeRoutes()...)
+	for _, route := range unprotectedRoutes {
+		doc, found := docs[route.path]
+		assert.True(t, found, "route '"+route.path+"' is registered but not described in the OpenAPI document")
+		assert.False(t, doc.Protected, "route '"+route.path+"' is unprotected but documented as protected")
+		registeredPaths = append(registeredPaths, route.path)
+	}
+	for _, route := range append(getProtectedRoutes(h), getAdminRoutes(h)...) {
+		doc, found := docs[route.path]
+		assert.True(t, found, "route '"+route.path+"' is registered but not described in the OpenAPI document")
+		assert.True(t, doc.Protected, "route '"+route.path+"' is protected but documented as unprotected")
+		registeredPaths = append(registeredPaths, route.path)
+	}
+
+	sort.Strings(registeredPaths)
+	assert.Equal(t, registeredPaths, openapi.DocumentedPaths())
+}
+
+func TestEveryApiRouteIsRateLimited(t *testing.T) {
+	h := newHandlers(&Server{})
+	routes := append(getUnprotectedRoutes(h), getProtectedRoutes(h)...)
+	routes = append(routes, getAdminRoutes(h)...)
+	for _, route := range routes {
+		_, isLimited := rateLimitClasses[route.path]
+		assert.True(t, isLimited, "route '"+route.path+"' has no rate limit class")
+	}
+}
+
+func TestOpenApiSchemasAreDerivedFromDtos(t *testing.T) {
+	document := openapi.Generate(openapi.RouteDocs)
+	form, found := document.Components.Schemas["RegistrationForm"]
+	assert.True(t, found)
+	assert.Equal(t, "object", form.Type)
+	assert.Equal(t, []string{"user", "password", "email"}, form.Required)
+	assert.Equal(t, "^[a-z0-9]{3,20}$", form.Properties["user"].Pattern)
+
+	searchRequest := document.Components.Schemas["AppSearchRequest"]
+	assert.Equal(t, "boolean", searchRequest.Properties["show_unofficial_apps"].Type)
+	assert.Equal(t, 0, len(searchRequest.Required))
+
+	upload := document.Components.Schemas["VersionUpload"]
+	assert.Equal(t, "byte", upload.Properties["content"].Format)
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/ocelot-cloud/shared/utils"
+	"io"
+	"net/http"
+	"ocelot/store/tools"
+	"strings"
+	"unicode"
+)
+
+const (
+	cspReportingEndpoint = "csp-endpoint"
+	maxCspReportSize     = 64 * 1024
+	// maxLoggedCspViolations is the number of violations logged per report, so that a single report can't flood the log.
+	maxLoggedCspViolations = 5
+	// maxLoggedCspFieldLength is the number of characters logged of each field of a violation.
+	maxLoggedCspFieldLength = 200
+)
+
+// withSecurityHeaders adds the security headers to every response. The Content Security Policy set here has no nonce,
+// index.html replaces it with one allowing the nonce of the document.
+func (s *Server) withSecurityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("Referrer-Policy", "strict-origin-when-cross-origin")
+		header.Set("Permissions-Policy", "camera=(), microphone=(), geolocation=(), payment=(), usb=()")
+		header.Set("X-Frame-Options", "DENY")
+		header.Set("Reporting-Endpoints", cspReportingEndpoint+`="`+tools.CspReportPath+`"`)
+		s.setContentSecurityPolicy(w, "")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// setContentSecurityPolicy only allows resources of the store itself. If nonce is not empty, scripts and styles
+// carrying it are allowed as well.
+func (s *Server) setContentSecurityPolicy(w http.ResponseWriter, nonce string) {
+	sources := "'self'"
+	if nonce != "" {
+		sources += " 'nonce-" + nonce + "'"
+	}
+	policy := strings.Join([]string{
+		"default-src 'self'",
+		"script-src " + sources,
+		"style-src " + sources,
+		"img-src 'self' data:",
+		"font-src 'self'",
+		"connect-src 'self'",
+		"object-src 'none'",
+		"base-uri 'self'",
+		"form-action 'self'",
+		"frame-ancestors 'none'",
+		"report-uri " + tools.CspReportPath,
+		"report-to " + cspReportingEndpoint,
+	}, "; ")
+
+	if s.config.Server.CspReportOnly {
+		w.Header().Set("Content-Security-Policy-Report-Only", policy)
+	} else {
+		w.Header().Set("Content-Security-Policy", policy)
+	}
+}
+
+func newCspNonce() string {
+	nonce := make([]byte, 16)
+	_, _ = rand.Read(nonce)
+	return base64.StdEncoding.EncodeToString(nonce)
+}
+
+// addCspNonce adds the nonce to all scripts of index.html and as meta tag, from which the frontend takes it for the
+// styles it injects.
+func addCspNonce(indexHtml string, nonce string) string {
+	indexHtml = strings.ReplaceAll(indexHtml, "<script", `<script nonce="`+nonce+`"`)
+	return strings.Replace(indexHtml, "</head>", `<meta name="csp-nonce" content="`+nonce+`"></head>`, 1)
+}
+
+// cspReportHandler logs the violations of the Content Security Policy reported by browsers. Both the format of the
+// report-uri directive and the one of the Reporting API are accepted. Since anybody can send reports, they are rate
+// limited and only a few shortened fields of them are logged.
+func (s *Server) cspReportHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCspReportSize))
+	if err != nil {
+		tools.GetLogger(r).Info("reading CSP report failed: %v", err)
+		tools.WriteError(w, r, http.StatusBadRequest, tools.CodeInvalidRequestBody, "could not read request body")
+		return
+	}
+
+	var violations []map[string]any
+	var legacyReport struct {
+		Report map[string]any `json:"csp-report"`
+	}
+	var reports []struct {
+		Type string         `json:"type"`
+		Body map[string]any `json:"body"`
+	}
+	if json.Unmarshal(body, &legacyReport) == nil && legacyReport.Report != nil {
+		violations = append(violations, legacyReport.Report)
+	} else if json.Unmarshal(body, &reports) == nil {
+		for _, report := range reports {
+			if report.Type == "csp-violation" && report.Body != nil {
+				violations = append(violations, report.Body)
+			}
+		}
+	} else {
+		tools.GetLogger(r).Info("CSP report could not be decoded")
+		tools.WriteError(w, r, http.StatusBadRequest, tools.CodeInvalidRequestBody, "could not decode request body")
+		return
+	}
+
+	logCspViolations(tools.GetLogger(r), violations)
+	w.WriteHeader(http.StatusOK)
+}
+
+// logCspViolations logs up to maxLoggedCspViolations violations as warnings and the number of the omitted ones.
+func logCspViolations(logger utils.LoggerType, violations []map[string]any) {
+	for i, violation := range violations {
+		if i == maxLoggedCspViolations {
+			logger.Warn("omitted %d further violations of the content security policy of the same report", len(violations)-i)
+			return
+		}
+		logger.Warn("content security policy violated on '%s': directive '%s' blocked '%s'",
+			getFirst(violation, "document-uri", "documentURL"),
+			getFirst(violation, "violated-directive", "effectiveDirective"),
+			getFirst(violation, "blocked-uri", "blockedURL"))
+	}
+}
+
+// getFirst returns the value of the first key present in the report, since the formats name the fields differently.
+// The value is prepared for logging with sanitizeLogField.
+func getFirst(report map[string]any, keys ...string) string {
+	for _, key := range keys {
+		if value, found := report[key]; found {
+			return sanitizeLogField(fmt.Sprint(value))
+		}
+	}
+	return ""
+}
+
+// sanitizeLogField removes control characters like line breaks, which could forge log lines, and shortens the value
+// to maxLoggedCspFieldLength characters.
+func sanitizeLogField(value string) string {
+	value = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, value)
+	if runes := []rune(value); len(runes) > maxLoggedCspFieldLength {
+		return string(runes[:maxLoggedCspFieldLength]) + "…"
+	}
+	return value
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"fmt"
+	"github.com/ocelot-cloud/shared/assert"
+	"github.com/ocelot-cloud/shared/utils"
+	"net/http"
+	"net/http/httptest"
+	"ocelot/store/config"
+	"ocelot/store/tools"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const sampleIndexHtml = `<html><head><script type="module" src="/assets/index.js"></script></head><body></body></html>`
+
+func serveFrontendRequest(t *testing.T, cfg *config.Config, path string) *httptest.ResponseRecorder {
+	cfg.Server.FrontendDir = t.TempDir()
+	assert.Nil(t, os.WriteFile(cfg.Server.FrontendDir+"/index.html", []byte(sampleIndexHtml), 0600))
+	recorder := httptest.NewRecorder()
+	newTestServer(cfg).Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	return recorder
+}
+
+func TestIndexHtmlGetsNonceOfContentSecurityPolicy(t *testing.T) {
+	for _, path := range []string{"/", "/some/spa/route"} {
+		recorder := serveFrontendRequest(t, config.Default(), path)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		policy := recorder.Header().Get("Content-Security-Policy")
+		nonce := regexp.MustCompile(`script-src 'self' 'nonce-([^']+)'`).FindStringSubmatch(policy)
+		assert.Equal(t, 2, len(nonce))
+		assert.True(t, strings.Contains(policy, "frame-ancestors 'none'"))
+
+		body := recorder.Body.String()
+		assert.True(t, strings.Contains(body, `<script nonce="`+nonce[1]+`" type="module"`))
+		assert.True(t, strings.Contains(body, `<meta name="csp-nonce" content="`+nonce[1]+`">`))
+		assert.Equal(t, "nosniff", recorder.Header().Get("X-Content-Type-Options"))
+		assert.Equal(t, "DENY", recorder.Header().Get("X-Frame-Options"))
+		assert.NotEqual(t, "", recorder.Header().Get("Referrer-Policy"))
+		assert.NotEqual(t, "", recorder.Header().Get("Permissions-Policy"))
+	}
+}
+
+func TestContentSecurityPolicyCanBeReportOnly(t *testing.T) {
+	cfg := config.Default()
+	cfg.Server.CspReportOnly = true
+	recorder := serveFrontendRequest(t, cfg, "/")
+	assert.Equal(t, "", recorder.Header().Get("Content-Security-Policy"))
+	assert.True(t, strings.Contains(recorder.Header().Get("Content-Security-Policy-Report-Only"), "'nonce-"))
+}
+
+func TestCspReportsAreAccepted(t *testing.T) {
+	handler := newTestServer(config.Default()).Handler()
+	reports := map[string]int{
+		`{"csp-report":{"document-uri":"https://store.example.com/","violated-directive":"script-src","blocked-uri":"inline"}}`: http.StatusOK,
+		`[{"type":"csp-violation","body":{"documentURL":"https://store.example.com/","effectiveDirective":"style-src-elem"}}]`:  http.StatusOK,
+		`not json`: http.StatusBadRequest,
+	}
+	for report, expectedStatus := range reports {
+		request := httptest.NewRequest(http.MethodPost, tools.CspReportPath, strings.NewReader(report))
+		request.Header.Set("Origin", "null")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		assert.Equal(t, expectedStatus, recorder.Code)
+	}
+}
+
+// recordingLogger remembers the lines logged at warn level.
+type recordingLogger struct {
+	utils.LoggerType
+	warnLines []string
+}
+
+func (l *recordingLogger) Warn(format string, v ...any) {
+	l.warnLines = append(l.warnLines, fmt.Sprintf(format, v...))
+}
+
+func TestNumberOfLoggedCspViolationsPerReportIsLimited(t *testing.T) {
+	var violations []map[string]any
+	for i := 0; i < 100; i++ {
+		violations = append(violations, map[string]any{"blocked-uri": "https://evil.example.com/" + strconv.Itoa(i)})
+	}
+	logger := &recordingLogger{LoggerType: utils.Logger}
+	logCspViolations(logger, violations)
+	assert.Equal(t, maxLoggedCspViolations+1, len(logger.warnLines))
+	assert.True(t, strings.Contains(logger.warnLines[maxLoggedCspViolations], "omitted 95 further violations"))
+
+	logger = &recordingLogger{LoggerType: utils.Logger}
+	logCspViolations(logger, violations[:2])
+	assert.Equal(t, 2, len(logger.warnLines))
+}
+
+func TestLoggedCspFieldsAreSanitized(t *testing.T) {
+	logger := &recordingLogger{LoggerType: utils.Logger}
+	logCspViolations(logger, []map[string]any{{
+		"document-uri":       "https://store.example.com/\n2026-01-01 ERR forged line",
+		"violated-directive": "script-src\r\n\x1b[31m",
+		"blocked-uri":        strings.Repeat("a", 10000),
+	}})
+	assert.Equal(t, 1, len(logger.warnLines))
+	line := logger.warnLines[0]
+	assert.False(t, strings.ContainsAny(line, "\n\r\x1b"))
+	assert.True(t, strings.Contains(line, "'https://store.example.com/2026-01-01 ERR forged line'"))
+	assert.True(t, strings.Contains(line, "directive 'script-src[31m'"))
+	assert.True(t, strings.Contains(line, "'"+strings.Repeat("a", maxLoggedCspFieldLength)+"…'"))
+}
+
+func TestCspReportsAreRateLimited(t *testing.T) {
+	cfg := config.Default()
+	cfg.RateLimit.SearchBurst = 2
+	handler := newTestServer(cfg).Handler()
+	sendReport := func() int {
+		request := httptest.NewRequest(http.MethodPost, tools.CspReportPath, strings.NewReader(`{"csp-report":{"blocked-uri":"inline"}}`))
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+	assert.Equal(t, http.StatusOK, sendReport())
+	assert.Equal(t, http.StatusOK, sendReport())
+	assert.Equal(t, http.StatusTooManyRequests, sendReport())
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/ocelot-cloud/shared/utils"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/netip"
+	"ocelot/store/apps"
+	"ocelot/store/config"
+	"ocelot/store/frontend"
+	"ocelot/store/metrics"
+	"ocelot/store/ratelimit"
+	"ocelot/store/tools"
+	"ocelot/store/users"
+	"ocelot/store/versions"
+	"ocelot/store/webhooks"
+	"strconv"
+	"sync"
+)
+
+// Repositories are the storage backends the handlers work on.
+type Repositories struct {
+	Users    users.UserRepository
+	Apps     apps.AppRepository
+	Versions versions.VersionRepository
+	Webhooks webhooks.WebhookRepository
+}
+
+// Server serves the API and the frontend. It only works on the dependencies it was constructed with, so several
+// servers can coexist in one process.
+type Server struct {
+	config    *config.Config
+	db        *tools.Database
+	logger    utils.LoggerType
+	mailer    users.Mailer
+	repos     Repositories
+	metrics   *metrics.Metrics
+	accessLog *tools.AccessLog
+	webhooks  *webhooks.Dispatcher
+	// rateLimiters holds a limiter per class of routes, it is nil if rate limiting is disabled.
+	rateLimiters   map[string]*ratelimit.Limiter
+	trustedProxies []netip.Prefix
+	frontendFiles  fs.FS
+	// frontendEtags holds the ETags of the embedded frontend files, see computeFrontendEtags.
+	frontendEtags map[string]string
+	handler       http.Handler
+}
+
+// New creates the server and registers its routes. db is closed when the server stops and may be nil if the
+// repositories don't use a database. In the TEST profile, the data is reset to sample data and an unprotected route
+// for wiping the data is added.
+func New(cfg *config.Config, db *tools.Database, logger utils.LoggerType, mailer users.Mailer, repos Repositories) *Server {
+	s := &Server{
+		config:    cfg,
+		db:        db,
+		logger:    logger,
+		mailer:    mailer,
+		repos:     repos,
+		metrics:   metrics.New(),
+		accessLog: tools.NewAccessLog(),
+	}
+	s.webhooks = webhooks.NewDispatcher(repos.Webhooks, cfg.Webhooks, s.metrics, logger)
+	s.frontendFiles = frontend.Files(cfg.Server.FrontendDir)
+	if !frontend.IsBuilt(s.frontendFiles) {
+		logger.Warn("no frontend found, only the API is served")
+	}
+	// The files of a frontend directory may change while the store runs, they are revalidated by their modification
+	// time instead.
+	if cfg.Server.FrontendDir == "" {
+		s.frontendEtags = computeFrontendEtags(s.frontendFiles, logger)
+	}
+	s.rateLimiters = s.newRateLimiters()
+	// the config was validated on loading, so the trusted proxies are valid
+	s.trustedProxies, _ = cfg.RateLimit.ParseTrustedProxies()
+	s.registerMetrics()
+	s.handler = s.newHandler()
+	return s
+}
+
+// Handler returns the handler of all routes.
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// Run serves on the configured ports until ctx is done, see Serve.
+func (s *Server) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(s.config.Server.Port))
+	if err != nil {
+		s.close()
+		return fmt.Errorf("failed to listen on port %d: %w", s.config.Server.Port, err)
+	}
+	var redirectListener net.Listener
+	if s.config.Tls.RedirectPort != 0 {
+		redirectListener, err = net.Listen("tcp", ":"+strconv.Itoa(s.config.Tls.RedirectPort))
+		if err != nil {
+			utils.Close(listener)
+			s.close()
+			return fmt.Errorf("failed to listen on port %d: %w", s.config.Tls.RedirectPort, err)
+		}
+		s.logger.Info("redirecting HTTP requests on port %d to HTTPS", s.config.Tls.RedirectPort)
+	}
+	s.logger.Info("server starting on port %d", s.config.Server.Port)
+	return s.Serve(ctx, listener, redirectListener)
+}
+
+// Serve handles the connections of listener and runs the background jobs until ctx is done. Then it stops accepting
+// connections, waits up to the shutdown timeout for running requests, stops the background jobs and closes the
+// database. An error is returned if serving failed or not all requests finished in time. If TLS is enabled, listener
+// is served with HTTPS and requests to redirectListener, which may be nil, are redirected to HTTPS.
+func (s *Server) Serve(ctx context.Context, listener net.Listener, redirectListener net.Listener) error {
+	servers := []*http.Server{s.newHttpServer(s.handler)}
+	listeners := []net.Listener{listener}
+	if redirectListener != nil {
+		servers = append(servers, s.newHttpServer(s.getRedirectHandler()))
+		listeners = append(listeners, redirectListener)
+	}
+	if s.config.Tls.IsEnabled() {
+		reloader, err := newCertificateReloader(s.config.Tls, s.logger)
+		if err != nil {
+			for _, l := range listeners {
+				utils.Close(l)
+			}
+			s.close()
+			return err
+		}
+		servers[0].TLSConfig = newTlsConfig(reloader)
+	}
+
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	var jobs sync.WaitGroup
+	s.startBackgroundJobs(jobsCtx, &jobs)
+
+	serveErr := make(chan error, len(servers))
+	for i, httpServer := range servers {
+		go func() {
+			if httpServer.TLSConfig != nil {
+				serveErr <- httpServer.ServeTLS(listeners[i], "", "")
+			} else {
+				serveErr <- httpServer.Serve(listeners[i])
+			}
+		}()
+	}
+
+	var err error
+	select {
+	case err = <-serveErr:
+		err = fmt.Errorf("server stopped unexpectedly: %w", err)
+		for _, httpServer := range servers {
+			utils.Close(httpServer)
+		}
+	case <-ctx.Done():
+		s.logger.Info("shutting down, waiting up to %s for running requests", s.config.Server.ShutdownTimeout)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), s.config.Server.ShutdownTimeout)
+		defer cancel()
+		for _, httpServer := range servers {
+			if shutdownErr := httpServer.Shutdown(shutdownCtx); shutdownErr != nil {
+				err = fmt.Errorf("not all requests finished within the shutdown timeout: %w", shutdownErr)
+				utils.Close(httpServer)
+			}
+		}
+	}
+
+	stopJobs()
+	jobs.Wait()
+	s.close()
+	return err
+}
+
+func (s *Server) newHttpServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:      handler,
+		ReadTimeout:  s.config.Server.ReadTimeout,
+		WriteTimeout: s.config.Server.WriteTimeout,
+		IdleTimeout:  s.config.Server.IdleTimeout,
+	}
+}
+
+// registerMetrics exposes the statistics of the database connection pool and the amount of stored data, which is
+// counted by a background job so that scrapes don't query the database.
+func (s *Server) registerMetrics() {
+	if s.db != nil {
+		s.metrics.RegisterDatabase(s.db.DB)
+	}
+	s.metrics.RegisterGauge("users", "Number of registered users.", s.repos.Users.CountUsers)
+	s.metrics.RegisterGauge("apps", "Number of apps.", s.repos.Apps.CountApps)
+	s.metrics.RegisterGauge("versions", "Number of versions.", s.repos.Versions.CountVersions)
+}
+
+// startBackgroundJobs runs the periodic maintenance of the stored data, the delivery of webhook events and the
+// refreshing of the metrics until ctx is done.
+func (s *Server) startBackgroundJobs(ctx context.Context, jobs *sync.WaitGroup) {
+	jobs.Add(4)
+	go func() {
+		defer jobs.Done()
+		users.RunUsedSpaceReconciler(ctx, s.repos.Users, s.config.Jobs.UsedSpaceReconciliationInterval, s.logger)
+	}()
+	go func() {
+		defer jobs.Done()
+		versions.RunVersionPruner(ctx, s.repos.Versions, s.webhooks, s.config.Jobs.VersionPruningInterval, s.logger)
+	}()
+	go func() {
+		defer jobs.Done()
+		s.webhooks.Run(ctx)
+	}()
+	go func() {
+		defer jobs.Done()
+		s.metrics.RunGaugeRefresher(ctx, s.config.Jobs.MetricsRefreshInterval, s.logger)
+	}()
+}
+
+func (s *Server) close() {
+	if s.db != nil {
+		utils.Close(s.db)
+	}
+}
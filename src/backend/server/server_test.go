@@ -0,0 +1,339 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/ocelot-cloud/shared/assert"
+	"github.com/ocelot-cloud/shared/utils"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"ocelot/store/config"
+	"ocelot/store/memory"
+	"ocelot/store/tools"
+	"ocelot/store/users"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestServer(cfg *config.Config) *Server {
+	logger := utils.ProvideLogger(cfg.Server.LogLevel)
+	db := memory.NewDatabase()
+	repos := Repositories{
+		Users:    memory.NewUserRepository(db, cfg, logger),
+		Apps:     memory.NewAppRepository(db, logger),
+		Versions: memory.NewVersionRepository(db, cfg, logger),
+		Webhooks: memory.NewWebhookRepository(db, logger),
+	}
+	return New(cfg, nil, logger, users.NewMailer(cfg, logger), repos)
+}
+
+// serveInBackground starts serving the handler and returns the URL of the server and the result of Serve.
+func serveInBackground(t *testing.T, s *Server, handler http.Handler, ctx context.Context) (string, chan error) {
+	s.handler = handler
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	result := make(chan error, 1)
+	go func() {
+		result <- s.Serve(ctx, listener, nil)
+	}()
+	return "http://" + listener.Addr().String(), result
+}
+
+// getBlockingHandler returns a handler that signals the start of a request and answers once release is closed.
+func getBlockingHandler(started chan struct{}, release chan struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func TestRunningRequestsAreFinishedOnShutdown(t *testing.T) {
+	s := newTestServer(config.Default())
+	started, release := make(chan struct{}), make(chan struct{})
+	ctx, stop := context.WithCancel(context.Background())
+	url, result := serveInBackground(t, s, getBlockingHandler(started, release), ctx)
+
+	statusCode := make(chan int, 1)
+	go func() {
+		response, err := http.Get(url)
+		if err != nil {
+			statusCode <- 0
+			return
+		}
+		utils.Close(response.Body)
+		statusCode <- response.StatusCode
+	}()
+	<-started
+	stop()
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+
+	assert.Equal(t, http.StatusOK, <-statusCode)
+	assert.Nil(t, <-result)
+	_, err := http.Get(url)
+	assert.NotNil(t, err)
+}
+
+func TestShutdownFailsIfRequestsExceedTheTimeout(t *testing.T) {
+	cfg := config.Default()
+	cfg.Server.ShutdownTimeout = 100 * time.Millisecond
+	s := newTestServer(cfg)
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	ctx, stop := context.WithCancel(context.Background())
+	url, result := serveInBackground(t, s, getBlockingHandler(started, release), ctx)
+
+	go func() {
+		response, err := http.Get(url)
+		if err == nil {
+			utils.Close(response.Body)
+		}
+	}()
+	<-started
+	stop()
+	assert.NotNil(t, <-result)
+}
+
+func TestProbeRoutesSkipOriginCheck(t *testing.T) {
+	handler := newTestServer(config.Default()).Handler()
+	for _, path := range []string{tools.HealthPath, tools.ReadinessPath, tools.InfoPath} {
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		request.Header.Set("Origin", "https://monitoring.example.com")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	}
+
+	request := httptest.NewRequest(http.MethodPost, tools.SearchAppsPath, nil)
+	request.Header.Set("Origin", "https://monitoring.example.com")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestInfoContainsProfile(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	newTestServer(config.Default()).Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tools.InfoPath, nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var info tools.BuildInfo
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &info))
+	assert.Equal(t, config.ProfileProd, info.Profile)
+	assert.Equal(t, "dev", info.Version)
+}
+
+func TestReadinessFailsIfSmtpServerIsUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	utils.Close(listener)
+
+	cfg := config.Default()
+	cfg.Email = config.EmailConfig{SmtpHost: "127.0.0.1", SmtpPort: port, From: "store@example.com", User: "store", Password: "secret"}
+	s := newTestServer(cfg)
+	readyRecorder := httptest.NewRecorder()
+	s.Handler().ServeHTTP(readyRecorder, httptest.NewRequest(http.MethodGet, tools.ReadinessPath, nil))
+	assert.Equal(t, http.StatusOK, readyRecorder.Code)
+
+	cfg.Email.ReadinessCheck = true
+	recorder := httptest.NewRecorder()
+	s.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tools.ReadinessPath, nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	var report tools.ReadinessReport
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	assert.False(t, report.Ready)
+	assert.Equal(t, 1, len(report.Checks))
+	assert.Equal(t, "smtp", report.Checks[0].Name)
+	assert.False(t, report.Checks[0].Ok)
+	// the error would reveal the address of the SMTP server
+	assert.False(t, strings.Contains(recorder.Body.String(), "127.0.0.1"))
+}
+
+func getMetrics(t *testing.T, handler http.Handler, token string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, tools.MetricsPath, nil)
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestMetricsCountRequestsAndLogins(t *testing.T) {
+	s := newTestServer(config.Default())
+	handler := s.Handler()
+	body := strings.NewReader(`{"user":"unknownuser","password":"password"}`)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, tools.LoginPath, body))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = getMetrics(t, handler, "")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	metrics := recorder.Body.String()
+	assert.True(t, strings.Contains(metrics, `store_http_requests_total{code="404",method="post",route="/api/account/login"} 1`))
+	assert.True(t, strings.Contains(metrics, `store_logins_total{result="failure"} 1`))
+	// the amount of stored data is only counted by the background job
+	assert.False(t, strings.Contains(metrics, "store_users"))
+
+	assert.Nil(t, s.metrics.RefreshGauges())
+	metrics = getMetrics(t, handler, "").Body.String()
+	assert.True(t, strings.Contains(metrics, "store_users 0"))
+	assert.True(t, strings.Contains(metrics, "store_versions 0"))
+
+	assert.Nil(t, users.CreateAndValidateUser(s.repos.Users, &tools.RegistrationForm{User: "sampleuser", Password: "password", Email: "sampleuser@example.com"}))
+	assert.True(t, strings.Contains(getMetrics(t, handler, "").Body.String(), "store_users 0"))
+	assert.Nil(t, s.metrics.RefreshGauges())
+	assert.True(t, strings.Contains(getMetrics(t, handler, "").Body.String(), "store_users 1"))
+}
+
+func TestMetricsRequireTheTokenIfConfigured(t *testing.T) {
+	cfg := config.Default()
+	cfg.Server.MetricsToken = "metricstoken"
+	handler := newTestServer(cfg).Handler()
+
+	for _, token := range []string{"", "wrongtoken"} {
+		recorder := getMetrics(t, handler, token)
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		assert.Equal(t, "Bearer", recorder.Header().Get("WWW-Authenticate"))
+		assert.False(t, strings.Contains(recorder.Body.String(), "store_"))
+	}
+	recorder := getMetrics(t, handler, "metricstoken")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.True(t, strings.Contains(recorder.Body.String(), "store_uploaded_bytes_total"))
+}
+
+func TestRequestIdIsTakenFromClientOrGenerated(t *testing.T) {
+	handler := newTestServer(config.Default()).Handler()
+	getRequestId := func(clientRequestId string) (string, tools.ErrorResponse) {
+		request := httptest.NewRequest(http.MethodPost, tools.LoginPath, strings.NewReader(`{"user":"unknownuser","password":"password"}`))
+		if clientRequestId != "" {
+			request.Header.Set(tools.RequestIdHeader, clientRequestId)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		var errorResponse tools.ErrorResponse
+		assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &errorResponse))
+		return recorder.Header().Get(tools.RequestIdHeader), errorResponse
+	}
+
+	requestId, errorResponse := getRequestId("")
+	assert.Equal(t, 32, len(requestId))
+	assert.Equal(t, requestId, errorResponse.RequestId)
+
+	requestId, errorResponse = getRequestId("client-request-1")
+	assert.Equal(t, "client-request-1", requestId)
+	assert.Equal(t, "client-request-1", errorResponse.RequestId)
+
+	requestId, _ = getRequestId("invalid id\" injected=true")
+	assert.Equal(t, 32, len(requestId))
+}
+
+func TestRequestsAreWrittenToAccessLog(t *testing.T) {
+	s := newTestServer(config.Default())
+	var accessLog bytes.Buffer
+	s.accessLog = tools.NewAccessLogTo(&accessLog)
+	request := httptest.NewRequest(http.MethodPost, tools.LoginPath, strings.NewReader(`{"user":"unknownuser","password":"password"}`))
+	request.Header.Set(tools.RequestIdHeader, "client-request-1")
+	recorder := httptest.NewRecorder()
+	s.Handler().ServeHTTP(recorder, request)
+
+	var entry map[string]any
+	assert.Nil(t, json.Unmarshal(accessLog.Bytes(), &entry))
+	assert.Equal(t, "client-request-1", entry["request_id"])
+	assert.Equal(t, http.MethodPost, entry["method"])
+	assert.Equal(t, tools.LoginPath, entry["route"])
+	assert.Equal(t, tools.LoginPath, entry["path"])
+	assert.Equal(t, float64(http.StatusNotFound), entry["status"])
+	assert.Equal(t, float64(recorder.Body.Len()), entry["bytes"])
+	assert.Equal(t, "", entry["user"])
+}
+
+func TestAccessLogRecordsTheRouteOfFrontendPaths(t *testing.T) {
+	s := newTestServer(config.Default())
+	var accessLog bytes.Buffer
+	s.accessLog = tools.NewAccessLogTo(&accessLog)
+	s.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/some/spa/route", nil))
+
+	var entry map[string]any
+	assert.Nil(t, json.Unmarshal(accessLog.Bytes(), &entry))
+	assert.Equal(t, "/", entry["route"])
+	assert.Equal(t, "/some/spa/route", entry["path"])
+}
+
+func TestHandlersCanBeCalledWithoutRequestContext(t *testing.T) {
+	h := newHandlers(newTestServer(config.Default()))
+	request := httptest.NewRequest(http.MethodPost, tools.LoginPath, strings.NewReader(`{"user":"unknownuser","password":"password"}`))
+	recorder := httptest.NewRecorder()
+	h.users.LoginHandler(recorder, request)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestRateLimitRejectsRequestsExceedingTheBurst(t *testing.T) {
+	cfg := config.Default()
+	cfg.RateLimit.AccountBurst = 2
+	handler := newTestServer(cfg).Handler()
+	login := func(remoteAddr string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, tools.LoginPath, strings.NewReader(`{"user":"unknownuser","password":"password"}`))
+		request.RemoteAddr = remoteAddr
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	assert.Equal(t, http.StatusNotFound, login("192.0.2.1:1000").Code)
+	assert.Equal(t, http.StatusNotFound, login("192.0.2.1:1001").Code)
+	recorder := login("192.0.2.1:1002")
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, "3", recorder.Header().Get("Retry-After"))
+	var errorResponse tools.ErrorResponse
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &errorResponse))
+	assert.Equal(t, tools.CodeRateLimited, errorResponse.Code)
+
+	assert.Equal(t, http.StatusNotFound, login("192.0.2.2:1000").Code)
+}
+
+func TestRateLimitIsDisabledInTestProfile(t *testing.T) {
+	cfg := config.Default()
+	cfg.Server.Profile = config.ProfileTest
+	s := &Server{config: cfg}
+	assert.Nil(t, s.newRateLimiters())
+}
+
+func TestDeletingAnAccountAnnouncesTheDeletionOfItsApps(t *testing.T) {
+	s := newTestServer(config.Default())
+	handler := s.Handler()
+	assert.Nil(t, users.CreateAndValidateUser(s.repos.Users, tools.SampleForm))
+	assert.Nil(t, s.repos.Apps.CreateApp(tools.SampleUser, tools.SampleApp))
+	adminForm := &tools.RegistrationForm{User: "adminuser", Password: tools.SamplePassword, Email: "admin@example.com"}
+	assert.Nil(t, users.CreateAndValidateUser(s.repos.Users, adminForm))
+	webhook, err := s.repos.Webhooks.CreateWebhook(adminForm.User, tools.WebhookCreation{Url: "https://example.com/hook", Secret: "0123456789abcdef", AllApps: true})
+	assert.Nil(t, err)
+
+	recorder := httptest.NewRecorder()
+	credentials := `{"user":"` + tools.SampleUser + `","password":"` + tools.SamplePassword + `"}`
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, tools.LoginPath, strings.NewReader(credentials)))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var sessionToken string
+	for _, cookie := range recorder.Result().Cookies() {
+		if cookie.Name == tools.CookieName {
+			sessionToken = cookie.Value
+		}
+	}
+
+	request := httptest.NewRequest(http.MethodPost, tools.DeleteUserPath, nil)
+	request.Header.Set("Authorization", "Bearer "+sessionToken)
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	webhookId, err := strconv.Atoi(webhook.Id)
+	assert.Nil(t, err)
+	deliveries, err := s.repos.Webhooks.GetDeliveries(webhookId, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(deliveries))
+	assert.Equal(t, tools.WebhookEventAppDeleted, deliveries[0].Event)
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/ocelot-cloud/shared/utils"
+	"net"
+	"net/http"
+	"ocelot/store/config"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// certificateReloader provides the configured certificate to the TLS handshakes. At most once per check interval, it
+// checks whether the files changed and loads them again. If loading fails, e.g. because only one of the files was
+// replaced yet, the previous certificate is kept.
+type certificateReloader struct {
+	config       config.TlsConfig
+	logger       utils.LoggerType
+	mutex        sync.Mutex
+	certificate  *tls.Certificate
+	lastCheck    time.Time
+	lastModTimes [2]time.Time
+	now          func() time.Time
+}
+
+func newCertificateReloader(cfg config.TlsConfig, logger utils.LoggerType) (*certificateReloader, error) {
+	reloader := &certificateReloader{config: cfg, logger: logger, now: time.Now}
+	modTimes, err := reloader.getModTimes()
+	if err != nil {
+		return nil, err
+	}
+	if err = reloader.load(modTimes); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+func (c *certificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.now().Sub(c.lastCheck) >= c.config.ReloadCheckInterval {
+		c.reloadIfChanged()
+	}
+	return c.certificate, nil
+}
+
+func (c *certificateReloader) reloadIfChanged() {
+	c.lastCheck = c.now()
+	modTimes, err := c.getModTimes()
+	if err != nil {
+		c.logger.Error("checking TLS certificate files for changes failed, keeping the current certificate: %v", err)
+		return
+	}
+	if modTimes == c.lastModTimes {
+		return
+	}
+	if err = c.load(modTimes); err != nil {
+		c.logger.Error("reloading TLS certificate failed, keeping the current certificate: %v", err)
+		return
+	}
+	c.logger.Info("reloaded TLS certificate from '%s'", c.config.CertFile)
+}
+
+func (c *certificateReloader) load(modTimes [2]time.Time) error {
+	certificate, err := tls.LoadX509KeyPair(c.config.CertFile, c.config.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	c.certificate = &certificate
+	c.lastModTimes = modTimes
+	c.lastCheck = c.now()
+	return nil
+}
+
+func (c *certificateReloader) getModTimes() ([2]time.Time, error) {
+	var modTimes [2]time.Time
+	for i, path := range []string{c.config.CertFile, c.config.KeyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return modTimes, err
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+// newTlsConfig returns a TLS config only allowing TLS 1.2 with forward secret AEAD ciphers and TLS 1.3.
+func newTlsConfig(reloader *certificateReloader) *tls.Config {
+	return &tls.Config{
+		MinVersion:       tls.VersionTLS12,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+		GetCertificate: reloader.GetCertificate,
+	}
+}
+
+// getRedirectHandler redirects every request to the same URL using HTTPS on the server port.
+func (s *Server) getRedirectHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if s.config.Server.Port != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(s.config.Server.Port))
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// withHsts tells browsers to only use HTTPS for the store in future.
+func (s *Server) withHsts(next http.Handler) http.Handler {
+	value := "max-age=" + strconv.Itoa(int(s.config.Tls.HstsMaxAge.Seconds()))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Strict-Transport-Security", value)
+		next.ServeHTTP(w, r)
+	})
+}
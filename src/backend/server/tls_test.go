@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/ocelot-cloud/shared/assert"
+	"github.com/ocelot-cloud/shared/utils"
+	"math/big"
+	"net"
+	"net/http"
+	"ocelot/store/config"
+	"ocelot/store/tools"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSelfSignedCertificate writes a certificate for localhost with the given common name and its key to dir.
+func writeSelfSignedCertificate(t *testing.T, dir, commonName string) (certFile string, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	assert.Nil(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate}), 0600))
+	assert.Nil(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0600))
+	return certFile, keyFile
+}
+
+func newTlsTestConfig(t *testing.T) *config.Config {
+	cfg := config.Default()
+	cfg.Tls.CertFile, cfg.Tls.KeyFile = writeSelfSignedCertificate(t, t.TempDir(), "first")
+	return cfg
+}
+
+// serveTlsInBackground starts serving the server with TLS and returns the address of the TLS and the redirect listener.
+func serveTlsInBackground(t *testing.T, s *Server, ctx context.Context) (string, string, chan error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	redirectListener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	result := make(chan error, 1)
+	go func() {
+		result <- s.Serve(ctx, listener, redirectListener)
+	}()
+	return listener.Addr().String(), redirectListener.Addr().String(), result
+}
+
+func getServerCertificateName(t *testing.T, address string, clientConfig *tls.Config) (string, error) {
+	connection, err := tls.Dial("tcp", address, clientConfig)
+	if err != nil {
+		return "", err
+	}
+	defer utils.Close(connection)
+	return connection.ConnectionState().PeerCertificates[0].Subject.CommonName, nil
+}
+
+func TestServingWithTls(t *testing.T) {
+	s := newTestServer(newTlsTestConfig(t))
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	address, _, _ := serveTlsInBackground(t, s, ctx)
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	response, err := client.Get("https://" + address + tools.HealthPath)
+	assert.Nil(t, err)
+	utils.Close(response.Body)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "max-age=31536000", response.Header.Get("Strict-Transport-Security"))
+
+	_, err = getServerCertificateName(t, address, &tls.Config{InsecureSkipVerify: true, MaxVersion: tls.VersionTLS11})
+	assert.NotNil(t, err)
+}
+
+func TestTlsCertificateIsReloadedWhenFilesChange(t *testing.T) {
+	cfg := newTlsTestConfig(t)
+	cfg.Tls.ReloadCheckInterval = time.Millisecond
+	s := newTestServer(cfg)
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	address, _, _ := serveTlsInBackground(t, s, ctx)
+	clientConfig := &tls.Config{InsecureSkipVerify: true}
+
+	name, err := getServerCertificateName(t, address, clientConfig)
+	assert.Nil(t, err)
+	assert.Equal(t, "first", name)
+
+	writeSelfSignedCertificate(t, filepath.Dir(cfg.Tls.CertFile), "second")
+	later := time.Now().Add(time.Minute)
+	assert.Nil(t, os.Chtimes(cfg.Tls.CertFile, later, later))
+	time.Sleep(10 * time.Millisecond)
+	name, err = getServerCertificateName(t, address, clientConfig)
+	assert.Nil(t, err)
+	assert.Equal(t, "second", name)
+
+	assert.Nil(t, os.WriteFile(cfg.Tls.KeyFile, []byte("broken"), 0600))
+	later = later.Add(time.Minute)
+	assert.Nil(t, os.Chtimes(cfg.Tls.KeyFile, later, later))
+	time.Sleep(10 * time.Millisecond)
+	name, err = getServerCertificateName(t, address, clientConfig)
+	assert.Nil(t, err)
+	assert.Equal(t, "second", name)
+}
+
+func TestHttpRequestsAreRedirectedToHttps(t *testing.T) {
+	s := newTestServer(newTlsTestConfig(t))
+	ctx, stop := context.WithCancel(context.Background())
+	address, redirectAddress, result := serveTlsInBackground(t, s, ctx)
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	response, err := client.Get("http://" + redirectAddress + tools.InfoPath + "?a=b")
+	assert.Nil(t, err)
+	utils.Close(response.Body)
+	assert.Equal(t, http.StatusPermanentRedirect, response.StatusCode)
+	assert.Equal(t, "https://127.0.0.1:8082"+tools.InfoPath+"?a=b", response.Header.Get("Location"))
+
+	stop()
+	assert.Nil(t, <-result)
+	_, err = net.Dial("tcp", address)
+	assert.NotNil(t, err)
+	_, err = net.Dial("tcp", redirectAddress)
+	assert.NotNil(t, err)
+}
@@ -2,42 +2,76 @@ package tools
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
-	_ "github.com/jackc/pgx/v5/stdlib"
-	"github.com/ocelot-cloud/shared/utils"
-	"sync"
+	"ocelot/store/config"
 )
 
-var Db *sql.DB
-
-func InitializeDatabase() {
-	var err error
-	customPostgresPort := "5433"
-	Db, err = utils.WaitForPostgresDb("localhost", customPostgresPort)
+// RunInTransaction commits the transaction if operation succeeds and rolls it back otherwise.
+func (db *Database) RunInTransaction(operation func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
 	if err != nil {
-		Logger.Fatal("Failed to create database client: %v", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if err = operation(tx); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return fmt.Errorf("%w, rolling back the transaction failed as well: %v", err, rollbackErr)
+		}
+		return err
 	}
 
-	migrationsDir := utils.FindDir("assets") + "/migrations"
-	utils.RunMigrations(migrationsDir, "localhost", customPostgresPort)
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
 }
 
-var WaitingForEmailVerificationList sync.Map
+// LockUsedSpace locks the row of the user until the end of the transaction and returns the used space, so
+// that concurrent changes of the stored version content of the same user are serialized.
+func (db *Database) LockUsedSpace(tx *sql.Tx, userId int) (int, error) {
+	query := "SELECT used_space FROM users WHERE user_id = $1"
+	if db.Driver == config.DriverPostgres {
+		// SQLite has no row locks, but its transactions hold the write lock of the whole database from the start
+		query += " FOR UPDATE"
+	}
+	var usedSpace int
+	err := tx.QueryRow(query, userId).Scan(&usedSpace)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrUserNotFound
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to lock used space: %w", err)
+	}
+	return usedSpace, nil
+}
 
-func GetAppId(userID int, app string) (int, error) {
+func (db *Database) GetAppId(userID int, app string) (int, error) {
 	var appID int
-	err := Db.QueryRow("SELECT app_id FROM apps WHERE user_id = $1 AND app_name = $2", userID, app).Scan(&appID)
-	if err != nil {
-		return 0, fmt.Errorf("app not found: %v", err)
+	err := db.QueryRow("SELECT app_id FROM apps WHERE user_id = $1 AND app_name = $2", userID, app).Scan(&appID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrAppNotFound
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to get app ID: %w", err)
 	}
 	return appID, nil
 }
 
-func GetUserId(user string) (int, error) {
+func (db *Database) GetUserId(user string) (int, error) {
 	var userID int
-	err := Db.QueryRow("SELECT user_id FROM users WHERE user_name = $1", user).Scan(&userID)
-	if err != nil {
-		return 0, fmt.Errorf("user not found: %w", err)
+	err := db.QueryRow("SELECT user_id FROM users WHERE user_name = $1", user).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrUserNotFound
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to get user ID: %w", err)
 	}
 	return userID, nil
 }
+
+func (db *Database) GetUserIdOfApp(appId int) (int, error) {
+	var userId int
+	err := db.QueryRow(`SELECT user_id FROM apps WHERE app_id = $1`, appId).Scan(&userId)
+	if err != nil {
+		return -1, fmt.Errorf("failed to get user ID of app: %w", err)
+	}
+	return userId, nil
+}
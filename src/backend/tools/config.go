@@ -1,19 +1,30 @@
 package tools
 
 import (
-	"github.com/ocelot-cloud/shared/utils"
-	"os"
+	"ocelot/store/config"
+	"strconv"
 )
 
 var (
-	Logger     = utils.ProvideLogger("DEBUG")
-	Port       = "8082"
-	RootUrl    = "http://localhost:" + Port
+	// RootUrl is the address of the store the component tests and clients run against by default.
+	RootUrl    = "http://localhost:" + strconv.Itoa(config.Default().Server.Port)
 	CookieName = "auth"
-	Profile    = getProfile()
+	// CsrfCookieName is the cookie holding the token which browsers must send in the CsrfHeader of state-changing
+	// requests authenticated by the session cookie.
+	CsrfCookieName = "csrf"
+	CsrfHeader     = "X-CSRF-Token"
 
-	apiPrefix    = "/api"
-	WipeDataPath = apiPrefix + "/wipe-data"
+	apiPrefix     = "/api"
+	WipeDataPath  = apiPrefix + "/wipe-data"
+	OpenApiPath   = apiPrefix + "/openapi.json"
+	InfoPath      = apiPrefix + "/info"
+	CspReportPath = apiPrefix + "/csp-report"
+
+	// HealthPath, ReadinessPath and MetricsPath are meant for load balancers, process supervisors and monitoring
+	// and therefore are not part of the API prefix.
+	HealthPath    = "/healthz"
+	ReadinessPath = "/readyz"
+	MetricsPath   = "/metrics"
 
 	userPath            = apiPrefix + "/account"
 	RegistrationPath    = userPath + "/registration"
@@ -29,32 +40,34 @@ var (
 	VersionDeletePath = versionPath + "/delete"
 	GetVersionsPath   = versionPath + "/list"
 	DownloadPath      = versionPath + "/download"
+	VersionLookupPath = versionPath + "/lookup"
+
+	retentionPath          = versionPath + "/retention"
+	RetentionPolicySetPath = retentionPath + "/set"
+	RetentionPolicyGetPath = retentionPath + "/get"
+	RetentionDryRunPath    = retentionPath + "/dry-run"
 
 	appPath         = apiPrefix + "/apps"
 	AppCreationPath = appPath + "/create"
 	AppGetListPath  = appPath + "/get-list"
 	AppDeletePath   = appPath + "/delete"
 	SearchAppsPath  = appPath + "/search"
+	AppLookupPath   = appPath + "/lookup"
 
-	UseMailMockClient = false
-)
+	QuotaPath = userPath + "/quota"
+
+	adminPath          = apiPrefix + "/admin"
+	AdminUserQuotaPath = adminPath + "/user-quota"
+	AdminAppQuotaPath  = adminPath + "/app-quota"
 
-type PROFILE int
+	webhookPath           = apiPrefix + "/webhooks"
+	WebhookCreationPath   = webhookPath + "/create"
+	WebhookListPath       = webhookPath + "/list"
+	WebhookDeletePath     = webhookPath + "/delete"
+	WebhookDeliveriesPath = webhookPath + "/deliveries"
 
-const (
-	PROD PROFILE = iota
-	TEST
+	ReleaseFeedPath = apiPrefix + "/feeds/releases"
 )
 
-func getProfile() PROFILE {
-	envProfile := os.Getenv("PROFILE")
-	if envProfile == "TEST" {
-		UseMailMockClient = true
-		return TEST
-	} else {
-		return PROD
-	}
-}
-
-const MaxPayloadSize = 1024 * 1024 // = 1 MiB
-const MaxStorageSize = 10 * MaxPayloadSize
+// LatestVersionAlias can be used instead of a version name when looking up a version and always refers to the most recently uploaded one.
+const LatestVersionAlias = "latest"
@@ -0,0 +1,247 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/database/sqlite"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/ocelot-cloud/shared/utils"
+	moderncsqlite "modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+	"ocelot/store/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ExpectedSchemaVersion is the version of the latest migration in assets/migrations/<driver>. The store refuses to
+// start if the database schema has a different version, e.g. because the database was migrated by a newer release.
+// The migrations of all drivers must be kept equivalent.
+const ExpectedSchemaVersion = 6
+
+// Database is the connection pool of the SQL repositories. The driver is kept since some statements differ between
+// the drivers.
+type Database struct {
+	*sql.DB
+	Driver string
+}
+
+// OpenDatabase connects to the configured database, applies the pending migrations if enabled and checks the schema version.
+func OpenDatabase(cfg config.DatabaseConfig, logger utils.LoggerType) (*Database, error) {
+	db, err := connectToDatabase(cfg, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create database client: %w", err)
+	}
+
+	migrationsDir := utils.FindDir("assets") + "/migrations/" + cfg.Driver
+	if err = migrateDatabase(db, cfg, migrationsDir, logger); err != nil {
+		utils.Close(db)
+		return nil, fmt.Errorf("database schema is not usable: %w", err)
+	}
+	return &Database{DB: db, Driver: cfg.Driver}, nil
+}
+
+func connectToDatabase(cfg config.DatabaseConfig, logger utils.LoggerType) (*sql.DB, error) {
+	db, location, err := openDatabase(cfg)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConnections)
+	db.SetMaxIdleConns(cfg.MaxIdleConnections)
+	db.SetConnMaxLifetime(cfg.ConnectionMaxLifetime)
+
+	deadline := time.Now().Add(cfg.ConnectTimeout)
+	for {
+		err = db.Ping()
+		if err == nil {
+			logger.Info("connected to %s database %s", cfg.Driver, location)
+			return db, nil
+		}
+		if time.Now().After(deadline) {
+			utils.Close(db)
+			return nil, fmt.Errorf("database not reachable within %s: %w", cfg.ConnectTimeout, err)
+		}
+		logger.Info("waiting for %s database %s: %v", cfg.Driver, location, err)
+		time.Sleep(time.Second)
+	}
+}
+
+// openDatabase returns the database handle for the configured driver and a description of its location for logging.
+func openDatabase(cfg config.DatabaseConfig) (*sql.DB, string, error) {
+	if cfg.Driver == config.DriverSqlite {
+		if err := os.MkdirAll(filepath.Dir(cfg.Path), 0700); err != nil {
+			return nil, "", fmt.Errorf("failed to create directory of database file: %w", err)
+		}
+		db, err := sql.Open("sqlite", getSqliteDataSourceName(cfg.Path))
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to open database: %w", err)
+		}
+		return db, "at " + cfg.Path, nil
+	}
+
+	password, err := cfg.ReadPassword()
+	if err != nil {
+		return nil, "", err
+	}
+	db, err := sql.Open("pgx", getDataSourceName(cfg, password))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open database: %w", err)
+	}
+	return db, fmt.Sprintf("'%s' at %s:%d", cfg.Name, cfg.Host, cfg.Port), nil
+}
+
+// getDataSourceName returns the connection string in the key/value format understood by PostgreSQL drivers.
+func getDataSourceName(cfg config.DatabaseConfig, password string) string {
+	settings := []string{
+		"host=" + quoteDataSourceValue(cfg.Host),
+		fmt.Sprintf("port=%d", cfg.Port),
+		"dbname=" + quoteDataSourceValue(cfg.Name),
+		"user=" + quoteDataSourceValue(cfg.User),
+		"sslmode=" + quoteDataSourceValue(cfg.SslMode),
+	}
+	if password != "" {
+		settings = append(settings, "password="+quoteDataSourceValue(password))
+	}
+	return strings.Join(settings, " ")
+}
+
+func quoteDataSourceValue(value string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+	return "'" + escaped + "'"
+}
+
+// getSqliteDataSourceName returns the connection string of the SQLite database file at path. SQLite has no row locks,
+// so transactions immediately take the write lock of the database instead, which serializes them like the
+// "SELECT ... FOR UPDATE" used with PostgreSQL. The remaining pragmas make SQLite behave like PostgreSQL regarding
+// foreign keys and LIKE, and let concurrent connections wait for each other instead of failing.
+func getSqliteDataSourceName(path string) string {
+	pragmas := []string{"foreign_keys(1)", "busy_timeout(10000)", "journal_mode(WAL)", "case_sensitive_like(1)"}
+	query := "_txlock=immediate"
+	for _, pragma := range pragmas {
+		query += "&_pragma=" + pragma
+	}
+	return "file:" + path + "?" + query
+}
+
+// migrateDatabase applies the pending migrations if enabled and checks the resulting schema version.
+func migrateDatabase(db *sql.DB, cfg config.DatabaseConfig, migrationsDir string, logger utils.LoggerType) error {
+	driver, err := getMigrationDriver(db, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create migration driver: %w", err)
+	}
+	m, err := migrate.NewWithDatabaseInstance("file://"+migrationsDir, cfg.Driver, driver)
+	if err != nil {
+		if closeErr := driver.Close(); closeErr != nil {
+			logger.Warn("failed to close migration driver: %v", closeErr)
+		}
+		return fmt.Errorf("failed to initialize migrations: %w", err)
+	}
+	defer func() {
+		if sourceErr, databaseErr := m.Close(); sourceErr != nil || databaseErr != nil {
+			logger.Warn("failed to close migration: %v, %v", sourceErr, databaseErr)
+		}
+	}()
+
+	if cfg.RunMigrations {
+		err = m.Up()
+		if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			return fmt.Errorf("migration failed: %w", err)
+		}
+	}
+
+	version, dirty, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		version = 0
+	} else if err != nil {
+		return fmt.Errorf("failed to get schema version: %w", err)
+	}
+	return checkSchemaVersion(version, dirty)
+}
+
+// getMigrationDriver returns a driver which does not close db when the migration is closed.
+func getMigrationDriver(db *sql.DB, cfg config.DatabaseConfig) (database.Driver, error) {
+	if cfg.Driver == config.DriverSqlite {
+		// the SQLite driver closes the handle it is given, so it gets its own one
+		migrationDb, err := sql.Open("sqlite", getSqliteDataSourceName(cfg.Path))
+		if err != nil {
+			return nil, err
+		}
+		driver, err := sqlite.WithInstance(migrationDb, &sqlite.Config{})
+		if err != nil {
+			utils.Close(migrationDb)
+			return nil, err
+		}
+		return driver, nil
+	}
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	driver, err := postgres.WithConnection(ctx, conn, &postgres.Config{})
+	if err != nil {
+		utils.Close(conn)
+		return nil, err
+	}
+	return driver, nil
+}
+
+func checkSchemaVersion(version uint, dirty bool) error {
+	if dirty {
+		return fmt.Errorf("schema version %d is dirty since a migration failed, it must be fixed manually", version)
+	}
+	if version != ExpectedSchemaVersion {
+		return fmt.Errorf("schema version is %d, but this binary expects version %d", version, ExpectedSchemaVersion)
+	}
+	return nil
+}
+
+// CheckSchemaVersion checks that the schema still has the version this binary expects, e.g. that no newer release
+// migrated the database in the meantime.
+func (db *Database) CheckSchemaVersion(ctx context.Context) error {
+	var version uint
+	var dirty bool
+	err := db.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations").Scan(&version, &dirty)
+	if err != nil {
+		return fmt.Errorf("failed to get schema version: %w", err)
+	}
+	return checkSchemaVersion(version, dirty)
+}
+
+// CheckWritable checks that version contents can be written by running an update in a transaction which is rolled
+// back. It fails for example if the database was switched to read-only mode.
+func (db *Database) CheckWritable(ctx context.Context) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	if _, err = tx.ExecContext(ctx, "UPDATE versions SET data = data WHERE version_id = -1"); err != nil {
+		return fmt.Errorf("failed to write version contents: %w", err)
+	}
+	return nil
+}
+
+// IsUniqueViolation reports whether err was caused by a unique constraint of the schema, whatever the driver.
+func IsUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23505"
+	}
+	var sqliteErr *moderncsqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+	}
+	return false
+}
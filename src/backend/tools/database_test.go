@@ -0,0 +1,145 @@
+package tools
+
+import (
+	"context"
+	"github.com/ocelot-cloud/shared/assert"
+	"github.com/ocelot-cloud/shared/utils"
+	"ocelot/store/config"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+var testLogger = utils.ProvideLogger("INFO")
+
+func TestExpectedSchemaVersionMatchesLatestMigration(t *testing.T) {
+	migrationPattern := regexp.MustCompile(`^(\d+)_.+\.up\.sql$`)
+	var migrationsOfDrivers [][]string
+	for _, driver := range []string{config.DriverPostgres, config.DriverSqlite} {
+		entries, err := os.ReadDir("../assets/migrations/" + driver)
+		assert.Nil(t, err)
+
+		var migrations []string
+		latestVersion := 0
+		for _, entry := range entries {
+			match := migrationPattern.FindStringSubmatch(entry.Name())
+			assert.NotNil(t, match, "unexpected file in migrations directory: "+entry.Name())
+			version, err := strconv.Atoi(match[1])
+			assert.Nil(t, err)
+			latestVersion = max(latestVersion, version)
+			migrations = append(migrations, entry.Name())
+		}
+		assert.Equal(t, ExpectedSchemaVersion, latestVersion)
+		migrationsOfDrivers = append(migrationsOfDrivers, migrations)
+	}
+	assert.Equal(t, migrationsOfDrivers[0], migrationsOfDrivers[1])
+}
+
+func TestSqliteMigrations(t *testing.T) {
+	cfg := config.Default().Database
+	cfg.Driver = config.DriverSqlite
+	cfg.Path = filepath.Join(t.TempDir(), "store.db")
+	db, err := connectToDatabase(cfg, testLogger)
+	assert.Nil(t, err)
+	defer utils.Close(db)
+
+	assert.Nil(t, migrateDatabase(db, cfg, "../assets/migrations/sqlite", testLogger))
+	// applying the migrations again must not change anything
+	assert.Nil(t, migrateDatabase(db, cfg, "../assets/migrations/sqlite", testLogger))
+	var foreignKeys bool
+	assert.Nil(t, db.QueryRow("PRAGMA foreign_keys").Scan(&foreignKeys))
+	assert.True(t, foreignKeys)
+
+	cfg.RunMigrations = false
+	cfg.Path = filepath.Join(t.TempDir(), "empty.db")
+	emptyDb, err := connectToDatabase(cfg, testLogger)
+	assert.Nil(t, err)
+	defer utils.Close(emptyDb)
+	assert.NotNil(t, migrateDatabase(emptyDb, cfg, "../assets/migrations/sqlite", testLogger))
+}
+
+func TestReadinessChecksOfSqliteDatabase(t *testing.T) {
+	cfg := config.Default().Database
+	cfg.Driver = config.DriverSqlite
+	cfg.Path = filepath.Join(t.TempDir(), "store.db")
+	db, err := OpenDatabase(cfg, testLogger)
+	assert.Nil(t, err)
+	defer utils.Close(db)
+	ctx := context.Background()
+
+	assert.Nil(t, db.CheckSchemaVersion(ctx))
+	assert.Nil(t, db.CheckWritable(ctx))
+
+	_, err = db.Exec("UPDATE schema_migrations SET version = version + 1")
+	assert.Nil(t, err)
+	assert.NotNil(t, db.CheckSchemaVersion(ctx))
+}
+
+func TestCheckSchemaVersion(t *testing.T) {
+	assert.Nil(t, checkSchemaVersion(ExpectedSchemaVersion, false))
+	assert.NotNil(t, checkSchemaVersion(ExpectedSchemaVersion, true))
+	assert.NotNil(t, checkSchemaVersion(ExpectedSchemaVersion-1, false))
+	assert.NotNil(t, checkSchemaVersion(ExpectedSchemaVersion+1, false))
+}
+
+func TestDataSourceName(t *testing.T) {
+	cfg := config.Default().Database
+	assert.Equal(t, "host='localhost' port=5433 dbname='postgres' user='postgres' sslmode='disable'", getDataSourceName(cfg, ""))
+
+	cfg.Host = "db.example.com"
+	cfg.SslMode = "verify-full"
+	assert.Equal(t, `host='db.example.com' port=5433 dbname='postgres' user='postgres' sslmode='verify-full' password='it\'s a \\ secret'`,
+		getDataSourceName(cfg, `it's a \ secret`))
+}
+
+func TestUniqueVersionNamesMigrationRenamesOlderDuplicates(t *testing.T) {
+	cfg := config.Default().Database
+	cfg.Driver = config.DriverSqlite
+	cfg.Path = filepath.Join(t.TempDir(), "store.db")
+	db, err := connectToDatabase(cfg, testLogger)
+	assert.Nil(t, err)
+	defer utils.Close(db)
+
+	// the schema before version names were unique
+	previousMigrations := t.TempDir()
+	for _, name := range []string{"0001_init", "0002_quotas", "0003_retention_policies", "0004_webhooks", "0005_changelogs"} {
+		content, err := os.ReadFile("../assets/migrations/sqlite/" + name + ".up.sql")
+		assert.Nil(t, err)
+		assert.Nil(t, os.WriteFile(filepath.Join(previousMigrations, name+".up.sql"), content, 0600))
+	}
+	assert.NotNil(t, migrateDatabase(db, cfg, previousMigrations, testLogger))
+	var version int
+	assert.Nil(t, db.QueryRow("SELECT version FROM schema_migrations").Scan(&version))
+	assert.Equal(t, ExpectedSchemaVersion-1, version)
+
+	_, err = db.Exec(`INSERT INTO users (user_name, email, hashed_password, used_space) VALUES ('sampleuser', 'sampleuser@example.com', 'hash', 0)`)
+	assert.Nil(t, err)
+	_, err = db.Exec(`INSERT INTO apps (user_id, app_name) VALUES (1, 'sampleapp'), (1, 'otherapp')`)
+	assert.Nil(t, err)
+	_, err = db.Exec(`INSERT INTO versions (version_id, version_name, app_id, creation_timestamp, data) VALUES
+		(1, '0.0.1', 1, '2026-01-01 00:00:00', x'00'),
+		(2, '0.0.1', 1, '2026-02-01 00:00:00', x'00'),
+		(3, '0.0.1', 1, '2026-02-01 00:00:00', x'00'),
+		(4, '0.0.2', 1, '2026-01-01 00:00:00', x'00'),
+		(5, '0.0.1', 2, '2026-01-01 00:00:00', x'00')`)
+	assert.Nil(t, err)
+
+	assert.Nil(t, migrateDatabase(db, cfg, "../assets/migrations/sqlite", testLogger))
+	rows, err := db.Query("SELECT version_id, version_name FROM versions ORDER BY version_id")
+	assert.Nil(t, err)
+	defer utils.Close(rows)
+	names := map[int]string{}
+	for rows.Next() {
+		var versionId int
+		var versionName string
+		assert.Nil(t, rows.Scan(&versionId, &versionName))
+		names[versionId] = versionName
+	}
+	assert.Nil(t, rows.Err())
+	assert.Equal(t, map[int]string{1: "0.0.1-duplicate-1", 2: "0.0.1-duplicate-2", 3: "0.0.1", 4: "0.0.2", 5: "0.0.1"}, names)
+
+	_, err = db.Exec(`INSERT INTO versions (version_name, app_id, creation_timestamp, data) VALUES ('0.0.1', 1, '2026-03-01 00:00:00', x'00')`)
+	assert.NotNil(t, err)
+}
@@ -1,11 +1,28 @@
 package tools
 
-import "time"
+import (
+	"github.com/ocelot-cloud/shared/validation"
+	"regexp"
+	"time"
+)
+
+func init() {
+	// The URL is checked more thoroughly when a webhook is created, the pattern only limits the characters and length.
+	validation.ValidationTypeMap["webhook_url"] = regexp.MustCompile(`^https?://[a-zA-Z0-9._~:/?#@!$&'()*+,;=%\[\]-]{1,500}$`)
+	validation.ValidationTypeMap["webhook_secret"] = regexp.MustCompile(`^[\x21-\x7e]{16,128}$`)
+	// The length of changelogs exceeds the maximum repetition count of regular expressions, it is checked separately.
+	validation.ValidationTypeMap["changelog"] = regexp.MustCompile(`^[^\x00-\x08\x0b\x0c\x0e-\x1f\x7f]*$`)
+}
+
+// MaxChangelogLength is the maximum size of the changelog of a version in bytes.
+const MaxChangelogLength = 10000
 
 type VersionUpload struct {
 	AppId   string `json:"appId" validate:"number"`
 	Version string `json:"version" validate:"version_name"`
 	Content []byte `json:"content"`
+	// Changelog describes the changes of the version, it is shown in the release feeds.
+	Changelog string `json:"changelog,omitempty" validate:"changelog"`
 }
 
 type Version struct {
@@ -37,7 +54,7 @@ type NumberString struct {
 }
 
 type UserNameString struct {
-	Value string `json:"value" validate:"number"`
+	Value string `json:"value" validate:"user_name"`
 }
 
 type RegistrationForm struct {
@@ -65,7 +82,167 @@ type FullVersionInfo struct {
 	VersionCreationTimestamp time.Time `json:"version_creation_timestamp"`
 }
 
+// Release is a published version as shown in the release feeds.
+type Release struct {
+	Maintainer        string
+	AppId             int
+	AppName           string
+	VersionId         int
+	VersionName       string
+	Changelog         string
+	CreationTimestamp time.Time
+}
+
 type AppSearchRequest struct {
 	SearchTerm         string `json:"search_term" validate:"search_term"`
 	ShowUnofficialApps bool   `json:"show_unofficial_apps"`
 }
+
+type AppLookupRequest struct {
+	Maintainer string `json:"maintainer" validate:"user_name"`
+	AppName    string `json:"app_name" validate:"app_name"`
+}
+
+type VersionLookupRequest struct {
+	Maintainer  string `json:"maintainer" validate:"user_name"`
+	AppName     string `json:"app_name" validate:"app_name"`
+	VersionName string `json:"version_name" validate:"version_name"`
+}
+
+type VersionLookupResult struct {
+	Maintainer        string    `json:"maintainer"`
+	AppId             string    `json:"app_id"`
+	AppName           string    `json:"app_name"`
+	VersionId         string    `json:"version_id"`
+	VersionName       string    `json:"version_name"`
+	CreationTimestamp time.Time `json:"creation_timestamp"`
+}
+
+// QuotaInfo contains the storage usage of a user and the limits applying to it.
+type QuotaInfo struct {
+	UsedBytes         int        `json:"used_bytes"`
+	StorageLimitBytes int        `json:"storage_limit_bytes"`
+	MaxPayloadBytes   int        `json:"max_payload_bytes"`
+	Apps              []AppQuota `json:"apps"`
+}
+
+// AppQuota contains the storage usage of an app. The limits are only set if an admin restricted the app.
+type AppQuota struct {
+	AppId             string `json:"app_id"`
+	AppName           string `json:"app_name"`
+	UsedBytes         int    `json:"used_bytes"`
+	VersionCount      int    `json:"version_count"`
+	StorageLimitBytes *int   `json:"storage_limit_bytes,omitempty"`
+	MaxVersions       *int   `json:"max_versions,omitempty"`
+}
+
+// UserQuotaUpdate sets the storage limit of a user, a missing or zero limit resets it to the default.
+type UserQuotaUpdate struct {
+	User              string `json:"user" validate:"user_name"`
+	StorageLimitBytes int    `json:"storage_limit_bytes"`
+}
+
+// AppQuotaUpdate sets the limits of an app, missing or zero limits remove the restriction.
+type AppQuotaUpdate struct {
+	AppId             string `json:"app_id" validate:"number"`
+	StorageLimitBytes int    `json:"storage_limit_bytes"`
+	MaxVersions       int    `json:"max_versions"`
+}
+
+// RetentionPolicy defines which versions of an app are kept when pruning. A version is kept if at least one of the
+// configured rules applies to it, the latest version is always kept. Rules set to zero are disabled and without any
+// rule, nothing is pruned.
+type RetentionPolicy struct {
+	AppId              string `json:"app_id" validate:"number"`
+	KeepLast           int    `json:"keep_last,omitempty"`
+	KeepDays           int    `json:"keep_days,omitempty"`
+	KeepLatestPerMajor bool   `json:"keep_latest_per_major"`
+}
+
+// PruneResult lists the versions of an app that were or, in case of a dry run, would be pruned.
+type PruneResult struct {
+	AppId      string    `json:"app_id"`
+	Versions   []Version `json:"versions"`
+	FreedBytes int       `json:"freed_bytes"`
+}
+
+// BuildInfo describes the running store.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	Profile   string `json:"profile"`
+}
+
+// ReadinessReport lists the results of the readiness checks. The store is ready if all checks passed.
+type ReadinessReport struct {
+	Ready  bool             `json:"ready"`
+	Checks []ReadinessCheck `json:"checks"`
+}
+
+// ReadinessCheck is the result of a single check. The reason of a failure is only logged, since the report is public
+// and the errors may reveal internals like host names.
+type ReadinessCheck struct {
+	Name string `json:"name"`
+	Ok   bool   `json:"ok"`
+}
+
+// Webhook events and the headers sent along with each delivery. The signature is the hex encoded HMAC-SHA256 of the
+// request body keyed with the secret of the webhook, prefixed with "sha256=".
+const (
+	WebhookEventVersionPublished = "version.published"
+	WebhookEventVersionDeleted   = "version.deleted"
+	WebhookEventAppDeleted       = "app.deleted"
+
+	WebhookEventHeader     = "X-Store-Event"
+	WebhookDeliveryHeader  = "X-Store-Delivery"
+	WebhookSignatureHeader = "X-Store-Signature-256"
+)
+
+// Delivery states, pending deliveries are waiting for their first attempt or a retry.
+const (
+	WebhookStatusPending   = "pending"
+	WebhookStatusDelivered = "delivered"
+	WebhookStatusFailed    = "failed"
+)
+
+// WebhookCreation registers a URL to be notified about events of the apps of the user. With AllApps, which only admins
+// may set, the webhook receives the events of all apps.
+type WebhookCreation struct {
+	Url     string `json:"url" validate:"webhook_url"`
+	Secret  string `json:"secret" validate:"webhook_secret"`
+	AllApps bool   `json:"all_apps"`
+}
+
+// Webhook is a registered webhook, the secret is never returned.
+type Webhook struct {
+	Id                string    `json:"id"`
+	Url               string    `json:"url"`
+	AllApps           bool      `json:"all_apps"`
+	CreationTimestamp time.Time `json:"creation_timestamp"`
+}
+
+// WebhookDelivery is an entry of the delivery history of a webhook.
+type WebhookDelivery struct {
+	Id             string `json:"id"`
+	Event          string `json:"event"`
+	Status         string `json:"status"`
+	Attempts       int    `json:"attempts"`
+	LastStatusCode int    `json:"last_status_code,omitempty"`
+	LastError      string `json:"last_error,omitempty"`
+	// NextAttempt is only set while the delivery is pending.
+	NextAttempt       *time.Time `json:"next_attempt,omitempty"`
+	LastAttempt       *time.Time `json:"last_attempt,omitempty"`
+	CreationTimestamp time.Time  `json:"creation_timestamp"`
+}
+
+// WebhookEvent is the body of a delivery. Version fields are empty for app events.
+type WebhookEvent struct {
+	Event       string    `json:"event"`
+	Timestamp   time.Time `json:"timestamp"`
+	Maintainer  string    `json:"maintainer"`
+	AppId       string    `json:"app_id"`
+	AppName     string    `json:"app_name"`
+	VersionId   string    `json:"version_id,omitempty"`
+	VersionName string    `json:"version_name,omitempty"`
+}
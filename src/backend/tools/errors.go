@@ -0,0 +1,115 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/ocelot-cloud/shared/validation"
+	"io"
+	"net/http"
+)
+
+// ErrorCode is a stable machine-readable identifier of an error. Unlike messages, codes never change,
+// so clients can rely on them.
+type ErrorCode string
+
+const (
+	CodeInvalidRequestBody   ErrorCode = "INVALID_REQUEST_BODY"
+	CodeInvalidInput         ErrorCode = "INVALID_INPUT"
+	CodeCookieMissing        ErrorCode = "COOKIE_MISSING"
+	CodeCookieInvalid        ErrorCode = "COOKIE_INVALID"
+	CodeCookieNotFound       ErrorCode = "COOKIE_NOT_FOUND"
+	CodeCookieExpired        ErrorCode = "COOKIE_EXPIRED"
+	CodeCsrfTokenInvalid     ErrorCode = "CSRF_TOKEN_INVALID"
+	CodeInvalidCredentials   ErrorCode = "INVALID_CREDENTIALS"
+	CodeNotOwner             ErrorCode = "NOT_OWNER"
+	CodeUserNotFound         ErrorCode = "USER_NOT_FOUND"
+	CodeUserAlreadyExists    ErrorCode = "USER_ALREADY_EXISTS"
+	CodeEmailAlreadyExists   ErrorCode = "EMAIL_ALREADY_EXISTS"
+	CodeValidationFailed     ErrorCode = "VALIDATION_FAILED"
+	CodeAppNotFound          ErrorCode = "APP_NOT_FOUND"
+	CodeAppAlreadyExists     ErrorCode = "APP_ALREADY_EXISTS"
+	CodeReservedName         ErrorCode = "RESERVED_NAME"
+	CodeVersionNotFound      ErrorCode = "VERSION_NOT_FOUND"
+	CodeVersionAlreadyExists ErrorCode = "VERSION_ALREADY_EXISTS"
+	CodeInvalidVersion       ErrorCode = "INVALID_VERSION"
+	CodePayloadTooLarge      ErrorCode = "PAYLOAD_TOO_LARGE"
+	CodeQuotaExceeded        ErrorCode = "QUOTA_EXCEEDED"
+	CodeVersionLimitExceeded ErrorCode = "VERSION_LIMIT_EXCEEDED"
+	CodeNotAdmin             ErrorCode = "NOT_ADMIN"
+	CodeWebhookNotFound      ErrorCode = "WEBHOOK_NOT_FOUND"
+	CodeWebhookLimitExceeded ErrorCode = "WEBHOOK_LIMIT_EXCEEDED"
+	CodeOriginMismatch       ErrorCode = "ORIGIN_MISMATCH"
+	CodeRateLimited          ErrorCode = "RATE_LIMITED"
+	CodeMetricsTokenInvalid  ErrorCode = "METRICS_TOKEN_INVALID"
+	CodeInternalError        ErrorCode = "INTERNAL_ERROR"
+)
+
+// RequestIdHeader carries the ID of a request. Clients may set it to correlate their requests with the logs of the
+// store, otherwise the store generates one. It is returned in the response headers and error responses.
+const RequestIdHeader = "X-Request-ID"
+
+// ErrorResponse is the body of every error response sent by the store.
+type ErrorResponse struct {
+	Code      ErrorCode      `json:"code"`
+	Message   string         `json:"message"`
+	Details   map[string]any `json:"details,omitempty"`
+	RequestId string         `json:"request_id,omitempty"`
+}
+
+var (
+	ErrUserNotFound    = errors.New("user not found")
+	ErrAppNotFound     = errors.New("app not found")
+	ErrVersionNotFound = errors.New("version not found")
+	ErrCookieNotFound  = errors.New("cookie not found")
+	// ErrVersionAlreadyExists is returned when the app already has a version with the same name.
+	ErrVersionAlreadyExists = errors.New("version already exists")
+)
+
+func WriteError(w http.ResponseWriter, r *http.Request, statusCode int, code ErrorCode, message string) {
+	WriteErrorWithDetails(w, r, statusCode, code, message, nil)
+}
+
+func WriteErrorWithDetails(w http.ResponseWriter, r *http.Request, statusCode int, code ErrorCode, message string, details map[string]any) {
+	response := ErrorResponse{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestId: GetRequestId(r),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		GetLogger(r).Error("writing error response failed: %v", err)
+	}
+}
+
+func WriteInternalError(w http.ResponseWriter, r *http.Request, message string) {
+	WriteError(w, r, http.StatusInternalServerError, CodeInternalError, message)
+}
+
+// ReadBody decodes and validates the JSON request body. In case of an error, the error response is already
+// written and the handler only needs to return.
+func ReadBody[T any](w http.ResponseWriter, r *http.Request) (*T, error) {
+	var result T
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		GetLogger(r).Warn("Failed to read request body: %v", err)
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequestBody, "unable to read request body")
+		return nil, err
+	}
+
+	if err = json.Unmarshal(body, &result); err != nil {
+		GetLogger(r).Warn("Failed to parse request body: %v", err)
+		WriteError(w, r, http.StatusBadRequest, CodeInvalidRequestBody, "invalid request body")
+		return nil, err
+	}
+
+	if err = validation.ValidateStruct(result); err != nil {
+		HandleInvalidInput(w, r, err)
+		return nil, err
+	}
+
+	return &result, nil
+}
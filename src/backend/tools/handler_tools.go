@@ -1,19 +1,74 @@
 package tools
 
 import (
+	"context"
+	"github.com/ocelot-cloud/shared/utils"
 	"net/http"
 )
 
 type ContextKey string
 
-const UserCtxKey ContextKey = "user"
+const (
+	UserCtxKey    ContextKey = "user"
+	loggerCtxKey  ContextKey = "logger"
+	requestCtxKey ContextKey = "request"
+)
+
+// RequestInfo describes the request being handled. The server adds it to the context of every request and sets the
+// user once the request is authenticated.
+type RequestInfo struct {
+	Id   string
+	User string
+	// Route is the pattern of the route handling the request.
+	Route string
+}
+
+func WithRequestInfo(ctx context.Context, info *RequestInfo) context.Context {
+	return context.WithValue(ctx, requestCtxKey, info)
+}
+
+// GetRequestInfo returns the info of the request or nil if the request was not received by the server.
+func GetRequestInfo(r *http.Request) *RequestInfo {
+	info, _ := r.Context().Value(requestCtxKey).(*RequestInfo)
+	return info
+}
 
-func HandleInvalidInput(w http.ResponseWriter, err error) {
-	Logger.Info("invalid input: %v", err)
-	http.Error(w, "invalid input", http.StatusBadRequest)
+// GetRequestId returns the ID of the request or an empty string if it has none.
+func GetRequestId(r *http.Request) string {
+	if info := GetRequestInfo(r); info != nil {
+		return info.Id
+	}
+	return ""
+}
+
+// WithLogger returns a copy of ctx carrying the logger the helpers of this package use while handling a request.
+func WithLogger(ctx context.Context, logger utils.LoggerType) context.Context {
+	return context.WithValue(ctx, loggerCtxKey, logger)
+}
+
+// GetLogger returns the logger of the request. The server adds it to the context of every request, for requests not
+// received by the server, e.g. handlers called directly by tests, the logger of the shared module is returned.
+func GetLogger(r *http.Request) utils.LoggerType {
+	if logger, ok := r.Context().Value(loggerCtxKey).(utils.LoggerType); ok {
+		return logger
+	}
+	return utils.Logger
+}
+
+func HandleInvalidInput(w http.ResponseWriter, r *http.Request, err error) {
+	GetLogger(r).Info("invalid input: %v", err)
+	WriteErrorWithDetails(w, r, http.StatusBadRequest, CodeInvalidInput, "invalid input", map[string]any{"reason": err.Error()})
 }
 
 // GetUserFromContext Since only authenticated users are added to the context, it only works in protected handlers.
 func GetUserFromContext(r *http.Request) string {
 	return r.Context().Value(UserCtxKey).(string)
 }
+
+// NilIfZero converts optional numbers of request bodies, where zero means "not set", into nullable values.
+func NilIfZero(value int) *int {
+	if value == 0 {
+		return nil
+	}
+	return &value
+}
@@ -0,0 +1,122 @@
+package tools
+
+import (
+	"fmt"
+	"github.com/ocelot-cloud/shared/utils"
+	"github.com/rs/zerolog"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const logDir = "data/logs"
+
+// Logger writes the same log lines as the logger of the shared module, to stdout and data/logs/app.log, but its
+// lines can carry additional fields like the ID of the request being handled.
+type Logger struct {
+	logger zerolog.Logger
+}
+
+var _ utils.LoggerType = &Logger{}
+
+// NewLogger returns a logger which omits lines below the given level, e.g. "INFO".
+func NewLogger(level string) *Logger {
+	zerologLevel, err := zerolog.ParseLevel(strings.ToLower(level))
+	if err != nil || zerologLevel == zerolog.NoLevel {
+		zerologLevel = zerolog.InfoLevel
+	}
+	output := zerolog.MultiLevelWriter(
+		zerolog.ConsoleWriter{Out: newLogFile("app.log"), TimeFormat: time.RFC3339, NoColor: true, TimeLocation: time.UTC},
+		zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339, TimeLocation: time.UTC},
+	)
+	// The caller is skipped by 3 frames so that the code calling the Logger methods is reported instead of the methods.
+	logger := zerolog.New(output).Level(zerologLevel).With().Timestamp().CallerWithSkipFrameCount(3).Logger()
+	return &Logger{logger: logger}
+}
+
+// WithRequestId returns a logger adding the request ID to all lines. Loggers other than Logger are returned as is.
+func WithRequestId(logger utils.LoggerType, requestId string) utils.LoggerType {
+	if l, ok := logger.(*Logger); ok {
+		return &Logger{logger: l.logger.With().Str("request_id", requestId).Logger()}
+	}
+	return logger
+}
+
+func (l *Logger) Trace(format string, v ...any) {
+	l.logger.Trace().Msgf(format, v...)
+}
+
+func (l *Logger) Debug(format string, v ...any) {
+	l.logger.Debug().Msgf(format, v...)
+}
+
+func (l *Logger) Info(format string, v ...any) {
+	l.logger.Info().Msgf(format, v...)
+}
+
+func (l *Logger) Warn(format string, v ...any) {
+	l.logger.Warn().Msgf(format, v...)
+}
+
+func (l *Logger) Error(format string, v ...any) {
+	l.logger.Error().Msgf(format, v...)
+}
+
+func (l *Logger) Fatal(format string, v ...any) {
+	l.logger.Fatal().Msgf(format, v...)
+}
+
+// AccessLogEntry describes a handled request.
+type AccessLogEntry struct {
+	RequestId string
+	Method    string
+	// Route is the pattern of the route which handled the request, unlike Path its number of values is bounded.
+	Route    string
+	Path     string
+	Status   int
+	Bytes    int
+	Duration time.Duration
+	// User is the authenticated user or empty if the route is unprotected or authentication failed.
+	User string
+}
+
+// AccessLog writes one JSON line per handled request.
+type AccessLog struct {
+	logger zerolog.Logger
+}
+
+// NewAccessLog returns an access log writing to data/logs/access.log.
+func NewAccessLog() *AccessLog {
+	return NewAccessLogTo(newLogFile("access.log"))
+}
+
+func NewAccessLogTo(output io.Writer) *AccessLog {
+	return &AccessLog{logger: zerolog.New(output).With().Timestamp().Logger()}
+}
+
+func (a *AccessLog) Write(entry AccessLogEntry) {
+	a.logger.Log().
+		Str("request_id", entry.RequestId).
+		Str("method", entry.Method).
+		Str("route", entry.Route).
+		Str("path", entry.Path).
+		Int("status", entry.Status).
+		Int("bytes", entry.Bytes).
+		Float64("duration_ms", float64(entry.Duration.Microseconds())/1000).
+		Str("user", entry.User).
+		Send()
+}
+
+func newLogFile(name string) io.Writer {
+	if err := os.MkdirAll(logDir, 0700); err != nil {
+		panic(fmt.Sprintf("Failed to create logs directory: %v", err))
+	}
+	return &lumberjack.Logger{
+		Filename: logDir + "/" + name,
+		MaxSize:  100, // megabytes
+		MaxAge:   30,  // days
+		Compress: true,
+	}
+}
@@ -22,14 +22,14 @@ func GetVersionBytesOfSampleUserApp(folderName, sampleUser, sampleApp string, sh
 	sampleAppDir := utils.FindDir("assets") + "/" + folderName
 	versionBytes, err := validation.ZipDirectory(sampleAppDir)
 	if err != nil {
-		Logger.Fatal("Failed to read sample version file: %v", err)
+		panic("failed to read sample version file: " + err.Error())
 	}
 	err = validation.ValidateVersion(versionBytes, sampleUser, sampleApp)
 	if shouldBeValid && err != nil {
-		Logger.Fatal("expected sample version to be valid, but it is not: %v", err)
+		panic("expected sample version to be valid, but it is not: " + err.Error())
 	}
 	if !shouldBeValid && err == nil {
-		Logger.Fatal("expected sample version to be invalid, but it is valid")
+		panic("expected sample version to be invalid, but it is valid")
 	}
 	return versionBytes
 }
@@ -38,7 +38,7 @@ func GetValidVersionBytesOfSampleMaintainerApp() []byte {
 	sampleAppDir := utils.FindDir("assets") + "/samplemaintainer-app"
 	versionBytes, err := validation.ZipDirectory(sampleAppDir)
 	if err != nil {
-		Logger.Fatal("Failed to read sample version file: %v", err)
+		panic("failed to read sample version file: " + err.Error())
 	}
 	return versionBytes
 }
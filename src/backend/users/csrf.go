@@ -0,0 +1,47 @@
+package users
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"ocelot/store/tools"
+	"strings"
+)
+
+// Browsers are protected against cross-site request forgery by the double-submit pattern. Besides the session cookie,
+// they receive a cookie with a token which the frontend reads and sends back in a header. Other sites can neither
+// read the cookie nor set the header. The token is derived from the session, so a cookie planted by another site,
+// e.g. a compromised subdomain, is rejected as well. Frontends of allowed CORS origins can't read the cookie of the
+// store either, so the login response also carries the token in the CsrfHeader, which CORS exposes to them only.
+
+func csrfToken(sessionToken string) string {
+	mac := hmac.New(sha256.New, []byte(sessionToken))
+	mac.Write([]byte("csrf"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newCsrfCookie(sessionCookie *http.Cookie) *http.Cookie {
+	return &http.Cookie{
+		Name:     tools.CsrfCookieName,
+		Value:    csrfToken(sessionCookie.Value),
+		Expires:  sessionCookie.Expires,
+		Path:     "/",
+		SameSite: http.SameSiteStrictMode,
+	}
+}
+
+// hasValidCsrfToken reports whether a request authenticated by the session cookie carries the token belonging to
+// the session. The token is required regardless of the method, since protected routes don't restrict the method and
+// some of them, like the account deletion, read no body and would change state on a plain GET.
+func hasValidCsrfToken(r *http.Request, sessionToken string) bool {
+	expected := csrfToken(sessionToken)
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get(tools.CsrfHeader)), []byte(expected)) == 1
+}
+
+// getBearerToken returns the session token sent by API clients in the Authorization header. Browsers never send
+// this header on their own, so such requests need no CSRF protection.
+func getBearerToken(r *http.Request) (string, bool) {
+	return strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
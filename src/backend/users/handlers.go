@@ -1,11 +1,15 @@
 package users
 
 import (
+	"errors"
 	"fmt"
 	"github.com/ocelot-cloud/shared/utils"
 	"github.com/ocelot-cloud/shared/validation"
 	"net/http"
+	"ocelot/store/config"
+	"ocelot/store/metrics"
 	"ocelot/store/tools"
+	"ocelot/store/webhooks"
 	"time"
 )
 
@@ -14,40 +18,68 @@ const (
 	TestUserWithOldButNotExpiredCookie = "oldcookietestuser"
 )
 
-var Logger = tools.Logger
+// Handlers serve the account routes using the given repository. Deleting an account is announced to the webhooks as
+// deletion of each of its apps.
+type Handlers struct {
+	Users    UserRepository
+	Apps     AppLister
+	Mailer   Mailer
+	Config   *config.Config
+	Metrics  *metrics.Metrics
+	Webhooks *webhooks.Dispatcher
+}
+
+// forRequest returns a copy of the handlers whose repositories log with the logger of the request, so that their lines
+// carry the request ID.
+func (h *Handlers) forRequest(r *http.Request) *Handlers {
+	logger := tools.GetLogger(r)
+	bound := *h
+	bound.Users = h.Users.WithLogger(logger)
+	return &bound
+}
 
-func WipeDataHandler(w http.ResponseWriter, r *http.Request) {
-	UserRepo.WipeDatabase()
-	Logger.Warn("database wipe completed")
+// AppLister lists the apps of a user. It is implemented by the app repository, which can't be referenced here since
+// the apps package depends on this one.
+type AppLister interface {
+	GetAppList(user string) ([]tools.App, error)
+}
+
+func (h *Handlers) WipeDataHandler(w http.ResponseWriter, r *http.Request) {
+	h = h.forRequest(r)
+	h.Users.WipeDatabase()
+	tools.GetLogger(r).Warn("database wipe completed")
 	w.WriteHeader(http.StatusOK)
 }
 
-func LoginHandler(w http.ResponseWriter, r *http.Request) {
-	creds, err := validation.ReadBody[tools.LoginCredentials](w, r)
+func (h *Handlers) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	h = h.forRequest(r)
+	creds, err := tools.ReadBody[tools.LoginCredentials](w, r)
 	if err != nil {
 		return
 	}
 
-	if !UserRepo.DoesUserExist(creds.User) {
-		Logger.Info("user '%s' does not exist", creds.User)
-		http.Error(w, "user does not exist", http.StatusNotFound)
+	if !h.Users.DoesUserExist(creds.User) {
+		tools.GetLogger(r).Info("user '%s' does not exist", creds.User)
+		h.Metrics.CountLogin(false)
+		tools.WriteError(w, r, http.StatusNotFound, tools.CodeUserNotFound, "user does not exist")
 		return
 	}
 
-	if !UserRepo.IsPasswordCorrect(creds.User, creds.Password) {
-		Logger.Info("Password of user '%s' was not correct", creds.User)
-		http.Error(w, "incorrect username or password", http.StatusUnauthorized)
+	if !h.Users.IsPasswordCorrect(creds.User, creds.Password) {
+		tools.GetLogger(r).Info("Password of user '%s' was not correct", creds.User)
+		h.Metrics.CountLogin(false)
+		tools.WriteError(w, r, http.StatusUnauthorized, tools.CodeInvalidCredentials, "incorrect username or password")
 		return
 	}
 
 	cookie, err := utils.GenerateCookie()
 	if err != nil {
-		Logger.Error("cookie generation failed: %v", err)
-		http.Error(w, "cookie generation failed", http.StatusInternalServerError)
+		tools.GetLogger(r).Error("cookie generation failed: %v", err)
+		tools.WriteInternalError(w, r, "cookie generation failed")
 		return
 	}
 
-	if tools.Profile == tools.TEST {
+	if h.Config.IsTestProfile() {
 		if creds.User == TestUserWithExpiredCookie {
 			cookie.Expires = time.Now().UTC().Add(-1 * time.Second)
 		} else if creds.User == TestUserWithOldButNotExpiredCookie {
@@ -55,179 +87,265 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	err = UserRepo.HashAndSaveCookie(creds.User, cookie.Value, cookie.Expires)
+	err = h.Users.HashAndSaveCookie(creds.User, cookie.Value, cookie.Expires)
 	if err != nil {
-		Logger.Error("setting cookie failed: %v", err)
-		http.Error(w, "setting cookie failed", http.StatusInternalServerError)
+		tools.GetLogger(r).Error("setting cookie failed: %v", err)
+		tools.WriteInternalError(w, r, "setting cookie failed")
 		return
 	}
 
 	http.SetCookie(w, cookie)
-	Logger.Info("user '%s' logged in successfully", creds.User)
+	http.SetCookie(w, newCsrfCookie(cookie))
+	w.Header().Set(tools.CsrfHeader, csrfToken(cookie.Value))
+	tools.GetLogger(r).Info("user '%s' logged in successfully", creds.User)
+	h.Metrics.CountLogin(true)
 	w.WriteHeader(http.StatusOK)
 }
 
-func AuthCheckHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) AuthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	user := tools.GetUserFromContext(r)
 	utils.SendJsonResponse(w, tools.UserNameString{Value: user})
 }
 
-func UserDeleteHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) QuotaHandler(w http.ResponseWriter, r *http.Request) {
+	h = h.forRequest(r)
 	user := tools.GetUserFromContext(r)
 
-	if !UserRepo.DoesUserExist(user) {
-		Logger.Error("user '%s' wanted to delete his account but seems not to exist although authenticated", user)
-		http.Error(w, "user does not exist", http.StatusInternalServerError)
+	quota, err := h.Users.GetQuota(user)
+	if err != nil {
+		tools.GetLogger(r).Error("getting quota of user '%s' failed: %v", user, err)
+		tools.WriteInternalError(w, r, "getting quota failed")
 		return
 	}
 
-	err := UserRepo.DeleteUser(user)
+	utils.SendJsonResponse(w, quota)
+}
+
+func (h *Handlers) UserQuotaUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	h = h.forRequest(r)
+	admin := tools.GetUserFromContext(r)
+
+	update, err := tools.ReadBody[tools.UserQuotaUpdate](w, r)
 	if err != nil {
-		Logger.Error("user '%s' deletion failed", err)
-		http.Error(w, "user deletion failed", http.StatusInternalServerError)
 		return
 	}
 
-	Logger.Info("deleted user: %s", user)
+	if update.StorageLimitBytes < 0 {
+		tools.HandleInvalidInput(w, r, errors.New("storage limit must not be negative"))
+		return
+	}
+
+	err = h.Users.SetStorageLimit(update.User, tools.NilIfZero(update.StorageLimitBytes))
+	if errors.Is(err, tools.ErrUserNotFound) {
+		tools.GetLogger(r).Info("admin '%s' tried to change the storage limit of user '%s' but the user does not exist", admin, update.User)
+		tools.WriteError(w, r, http.StatusNotFound, tools.CodeUserNotFound, "user does not exist")
+		return
+	} else if err != nil {
+		tools.GetLogger(r).Error("admin '%s' failed to change the storage limit of user '%s': %v", admin, update.User, err)
+		tools.WriteInternalError(w, r, "changing storage limit failed")
+		return
+	}
+
+	tools.GetLogger(r).Info("admin '%s' changed the storage limit of user '%s'", admin, update.User)
 	w.WriteHeader(http.StatusOK)
 }
 
-func ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) UserDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	h = h.forRequest(r)
 	user := tools.GetUserFromContext(r)
 
-	form, err := validation.ReadBody[tools.ChangePasswordForm](w, r)
+	if !h.Users.DoesUserExist(user) {
+		tools.GetLogger(r).Error("user '%s' wanted to delete his account but seems not to exist although authenticated", user)
+		tools.WriteInternalError(w, r, "user does not exist")
+		return
+	}
+
+	// the apps are deleted together with the user, so they must be listed beforehand
+	apps, err := h.Apps.GetAppList(user)
 	if err != nil {
+		tools.GetLogger(r).Error("getting apps of user '%s' failed: %v", user, err)
+		tools.WriteInternalError(w, r, "user deletion failed")
 		return
 	}
 
-	if !UserRepo.DoesUserExist(user) {
-		Logger.Warn("somebody tried to change password but user '%s' does not exist", user)
-		http.Error(w, "user does not exist", http.StatusNotFound)
+	err = h.Users.DeleteUser(user)
+	if err != nil {
+		tools.GetLogger(r).Error("user '%s' deletion failed", err)
+		tools.WriteInternalError(w, r, "user deletion failed")
 		return
 	}
 
-	if !UserRepo.IsPasswordCorrect(user, form.OldPassword) {
-		Logger.Info("incorrect credentials for user '%s' when trying to change password", user)
-		http.Error(w, "incorrect username or password", http.StatusUnauthorized)
+	tools.GetLogger(r).Info("deleted user: %s", user)
+	for _, app := range apps {
+		h.Webhooks.Notify(tools.GetLogger(r), tools.WebhookEvent{
+			Event:      tools.WebhookEventAppDeleted,
+			Maintainer: user,
+			AppId:      app.Id,
+			AppName:    app.Name,
+		})
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handlers) ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	h = h.forRequest(r)
+	user := tools.GetUserFromContext(r)
+
+	form, err := tools.ReadBody[tools.ChangePasswordForm](w, r)
+	if err != nil {
+		return
+	}
+
+	if !h.Users.DoesUserExist(user) {
+		tools.GetLogger(r).Warn("somebody tried to change password but user '%s' does not exist", user)
+		tools.WriteError(w, r, http.StatusNotFound, tools.CodeUserNotFound, "user does not exist")
+		return
+	}
+
+	if !h.Users.IsPasswordCorrect(user, form.OldPassword) {
+		tools.GetLogger(r).Info("incorrect credentials for user '%s' when trying to change password", user)
+		tools.WriteError(w, r, http.StatusUnauthorized, tools.CodeInvalidCredentials, "incorrect username or password")
 		return
 	}
 
-	err = UserRepo.ChangePassword(user, form.NewPassword)
+	err = h.Users.ChangePassword(user, form.NewPassword)
 	if err != nil {
-		Logger.Error("changing password for user '%s' failed: %v", user, err)
-		http.Error(w, "error when trying to change password", http.StatusInternalServerError)
+		tools.GetLogger(r).Error("changing password for user '%s' failed: %v", user, err)
+		tools.WriteInternalError(w, r, "error when trying to change password")
 		return
 	}
 
-	Logger.Info("user '%s' changed his password", user)
+	tools.GetLogger(r).Info("user '%s' changed his password", user)
 	w.WriteHeader(http.StatusOK)
 }
 
-func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	h = h.forRequest(r)
 	user := tools.GetUserFromContext(r)
 
-	err := UserRepo.Logout(user)
+	err := h.Users.Logout(user)
 	if err != nil {
-		Logger.Error("logout of user '%s' failed: %v", user, err)
-		http.Error(w, "logout failed", http.StatusInternalServerError)
+		tools.GetLogger(r).Error("logout of user '%s' failed: %v", user, err)
+		tools.WriteInternalError(w, r, "logout failed")
 		return
 	}
 
-	Logger.Info("user '%s' logged out", user)
+	tools.GetLogger(r).Info("user '%s' logged out", user)
 	w.WriteHeader(http.StatusOK)
 }
 
-func RegistrationHandler(w http.ResponseWriter, r *http.Request) {
-	form, err := validation.ReadBody[tools.RegistrationForm](w, r)
+func (h *Handlers) RegistrationHandler(w http.ResponseWriter, r *http.Request) {
+	h = h.forRequest(r)
+	form, err := tools.ReadBody[tools.RegistrationForm](w, r)
 	if err != nil {
 		return
 	}
 
-	if UserRepo.DoesUserExist(form.User) {
-		Logger.Info("user '%s' tried to register but he already exists", form.User)
-		http.Error(w, "user already exists", http.StatusConflict)
+	if h.Users.DoesUserExist(form.User) {
+		tools.GetLogger(r).Info("user '%s' tried to register but he already exists", form.User)
+		tools.WriteError(w, r, http.StatusConflict, tools.CodeUserAlreadyExists, "user already exists")
 		return
 	}
 
-	if UserRepo.DoesEmailExist(form.Email) {
-		Logger.Info("user '%s' tried to register but email '%s' already exists", form.User, form.Email)
-		http.Error(w, "email already exists", http.StatusConflict)
+	if h.Users.DoesEmailExist(form.Email) {
+		tools.GetLogger(r).Info("user '%s' tried to register but email '%s' already exists", form.User, form.Email)
+		tools.WriteError(w, r, http.StatusConflict, tools.CodeEmailAlreadyExists, "email already exists")
 		return
 	}
 
-	code, err := UserRepo.CreateUser(form)
+	code, err := h.Users.CreateUser(form)
 	if err != nil {
-		Logger.Error("user '%s' registration failed: %v", form.User, err)
-		http.Error(w, "user registration failed", http.StatusInternalServerError)
+		tools.GetLogger(r).Error("user '%s' registration failed: %v", form.User, err)
+		tools.WriteInternalError(w, r, "user registration failed")
 		return
 	}
 
-	err = sendVerificationEmail(form.Email, code)
+	err = h.Mailer.SendVerificationEmail(form.Email, code)
 	if err != nil {
-		Logger.Error("sending verification email failed: %v", err)
-		http.Error(w, "sending verification email failed", http.StatusInternalServerError)
+		tools.GetLogger(r).Error("sending verification email failed: %v", err)
+		tools.WriteInternalError(w, r, "sending verification email failed")
 		return
 	}
 
-	Logger.Info("user wants to register, validation still necessary: " + form.User)
+	tools.GetLogger(r).Info("user wants to register, validation still necessary: " + form.User)
 	w.WriteHeader(http.StatusOK)
 }
 
-func ValidationCodeHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) ValidationCodeHandler(w http.ResponseWriter, r *http.Request) {
+	h = h.forRequest(r)
 	queryParams := r.URL.Query()
 	code := queryParams.Get("code")
 
 	err := validation.ValidateSecret(code)
 	if err != nil {
-		tools.HandleInvalidInput(w, err)
+		tools.HandleInvalidInput(w, r, err)
 		return
 	}
 
-	err = UserRepo.ValidateUser(code)
+	err = h.Users.ValidateUser(code)
 	if err != nil {
-		Logger.Error("validation process of user failed: %v", err)
-		http.Error(w, "validation process failed", http.StatusBadRequest)
+		tools.GetLogger(r).Error("validation process of user failed: %v", err)
+		tools.WriteError(w, r, http.StatusBadRequest, tools.CodeValidationFailed, "validation process failed")
 		return
 	}
 
-	Logger.Info("user validation code accepted")
+	tools.GetLogger(r).Info("user validation code accepted")
 	w.WriteHeader(http.StatusOK)
 }
 
-func CheckAuthentication(w http.ResponseWriter, r *http.Request) (string, error) {
-	Logger.Debug("path: %s", r.URL.Path)
-	cookie, err := r.Cookie(tools.CookieName)
-	if err != nil {
-		Logger.Info("cookie not set in request: %s", err.Error())
-		http.Error(w, "cookie not set in request", http.StatusUnauthorized)
+func (h *Handlers) CheckAuthentication(w http.ResponseWriter, r *http.Request) (string, error) {
+	h = h.forRequest(r)
+	tools.GetLogger(r).Debug("path: %s", r.URL.Path)
+	var cookie *http.Cookie
+	var err error
+	token, isBearer := getBearerToken(r)
+	if isBearer {
+		cookie = &http.Cookie{Name: tools.CookieName, Value: token}
+	} else if cookie, err = r.Cookie(tools.CookieName); err != nil {
+		tools.GetLogger(r).Info("cookie not set in request: %s", err.Error())
+		tools.WriteError(w, r, http.StatusUnauthorized, tools.CodeCookieMissing, "cookie not set in request")
 		return "", fmt.Errorf("")
 	}
 
 	if err = validation.ValidateSecret(cookie.Value); err != nil {
-		http.Error(w, "invalid cookie", http.StatusBadRequest)
+		tools.WriteError(w, r, http.StatusBadRequest, tools.CodeCookieInvalid, "invalid cookie")
 		return "", fmt.Errorf("")
 	}
 
-	user, err := UserRepo.GetUserViaCookie(cookie.Value)
-	if err != nil {
-		Logger.Info("error when getting cookie of user: %s", err.Error())
-		http.Error(w, "cookie not found", http.StatusUnauthorized)
+	user, err := h.Users.GetUserViaCookie(cookie.Value)
+	if errors.Is(err, tools.ErrCookieNotFound) {
+		tools.GetLogger(r).Info("error when getting cookie of user: %s", err.Error())
+		tools.WriteError(w, r, http.StatusUnauthorized, tools.CodeCookieNotFound, "cookie not found")
+		return "", fmt.Errorf("")
+	} else if err != nil {
+		tools.GetLogger(r).Error("error when getting cookie of user: %s", err.Error())
+		tools.WriteInternalError(w, r, "getting user of cookie failed")
 		return "", fmt.Errorf("")
 	}
 
-	if UserRepo.IsCookieExpired(cookie.Value) {
-		Logger.Warn("user '%s' used an expired cookie'", user)
-		http.Error(w, "cookie expired", http.StatusBadRequest)
+	if h.Users.IsCookieExpired(cookie.Value) {
+		tools.GetLogger(r).Warn("user '%s' used an expired cookie'", user)
+		tools.WriteError(w, r, http.StatusBadRequest, tools.CodeCookieExpired, "cookie expired")
+		return "", fmt.Errorf("")
+	}
+
+	if !isBearer && !hasValidCsrfToken(r, cookie.Value) {
+		tools.GetLogger(r).Warn("request of user '%s' lacked a valid CSRF token", user)
+		tools.WriteError(w, r, http.StatusForbidden, tools.CodeCsrfTokenInvalid, "CSRF token missing or invalid")
 		return "", fmt.Errorf("")
 	}
 
 	newExpirationTime := utils.GetTimeIn30Days()
-	err = UserRepo.HashAndSaveCookie(user, cookie.Value, newExpirationTime)
+	err = h.Users.HashAndSaveCookie(user, cookie.Value, newExpirationTime)
 	if err != nil {
-		Logger.Error("setting new cookie failed: %v", err)
-		http.Error(w, "setting new cookie failed", http.StatusInternalServerError)
+		tools.GetLogger(r).Error("setting new cookie failed: %v", err)
+		tools.WriteInternalError(w, r, "setting new cookie failed")
 		return "", fmt.Errorf("")
 	}
+	if isBearer {
+		return user, nil
+	}
+
 	cookie.Expires = newExpirationTime
 	// Note: If no path is given, browsers set the default path one level higher than the
 	// request path. For example, calling "/a" sets the cookie path to two "/", and calling
@@ -237,6 +355,7 @@ func CheckAuthentication(w http.ResponseWriter, r *http.Request) (string, error)
 	cookie.Path = "/"
 	cookie.SameSite = http.SameSiteStrictMode
 	http.SetCookie(w, cookie)
+	http.SetCookie(w, newCsrfCookie(cookie))
 
 	return user, nil
 }
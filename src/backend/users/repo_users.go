@@ -1,39 +1,72 @@
 package users
 
 import (
+	"context"
 	"crypto/rand"
+	"database/sql"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/ocelot-cloud/shared/utils"
 	"golang.org/x/crypto/bcrypt"
+	"ocelot/store/config"
 	"ocelot/store/tools"
+	"strconv"
 	"sync"
 	"time"
 )
 
-var NotEnoughSpacePrefix = "not enough space"
+type QuotaScope string
+
+const (
+	QuotaScopeUser QuotaScope = "user"
+	QuotaScopeApp  QuotaScope = "app"
+)
+
+// QuotaExceededError is returned when storing additional bytes would exceed the storage limit of a user or an app.
+type QuotaExceededError struct {
+	Scope          QuotaScope
+	UsedBytes      int
+	RequestedBytes int
+	LimitBytes     int
+}
+
+func (e *QuotaExceededError) Error() string {
+	owner := "you"
+	if e.Scope == QuotaScopeApp {
+		owner = "this app"
+	}
+	percent := 100
+	if e.LimitBytes > 0 {
+		percent = e.UsedBytes * 100 / e.LimitBytes
+	}
+	return fmt.Sprintf("not enough space, %s can't store more than %d bytes of version content, currently used storage in bytes: %d/%d (%d percent)",
+		owner, e.LimitBytes, e.UsedBytes, e.LimitBytes, percent)
+}
 
 func (u *UserRepositoryImpl) IsThereEnoughSpaceToAddVersion(user string, bytesToAdd int) error {
-	bytesUsed, err := UserRepo.GetUsedSpaceInBytes(user)
+	bytesUsed, err := u.GetUsedSpaceInBytes(user)
 	if err != nil {
-		tools.Logger.Error("checking space failed: %v", err)
+		u.logger.Error("checking space failed: %v", err)
 		return errors.New("checking space failed")
 	}
-	if bytesUsed+bytesToAdd > tools.MaxStorageSize {
-		tools.Logger.Info("user '%s' tried to upload version, but storage limit would be exceeded", user)
-		usedStorageInPercent := bytesUsed * 100 / tools.MaxStorageSize
-		msg := fmt.Sprintf(NotEnoughSpacePrefix+", you can't store more then 10MiB of version content, currently used storage in bytes: %d/%d (%d percent)", bytesUsed, tools.MaxStorageSize, usedStorageInPercent)
-		return errors.New(msg)
+	storageLimit, err := u.GetStorageLimitInBytes(user)
+	if err != nil {
+		u.logger.Error("checking space failed: %v", err)
+		return errors.New("checking space failed")
+	}
+	if bytesUsed+bytesToAdd > storageLimit {
+		u.logger.Info("user '%s' tried to upload version, but storage limit would be exceeded", user)
+		return &QuotaExceededError{Scope: QuotaScopeUser, UsedBytes: bytesUsed, RequestedBytes: bytesToAdd, LimitBytes: storageLimit}
 	}
 	return nil
 }
 
 func (u *UserRepositoryImpl) IsPasswordCorrect(user string, password string) bool {
 	var hashedPassword string
-	err := tools.Db.QueryRow("SELECT hashed_password FROM users WHERE user_name = $1", user).Scan(&hashedPassword)
+	err := u.db.QueryRow("SELECT hashed_password FROM users WHERE user_name = $1", user).Scan(&hashedPassword)
 	if err != nil {
-		tools.Logger.Error("Failed to fetch hashed password: %v", err)
+		u.logger.Error("Failed to fetch hashed password: %v", err)
 		return false
 	}
 
@@ -43,33 +76,40 @@ func (u *UserRepositoryImpl) IsPasswordCorrect(user string, password string) boo
 
 func (u *UserRepositoryImpl) DoesUserExist(user string) bool {
 	var exists bool
-	err := tools.Db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE user_name = $1)", user).Scan(&exists)
+	err := u.db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE user_name = $1)", user).Scan(&exists)
 	if err != nil {
-		tools.Logger.Error("Failed to check user existence: %v", err)
+		u.logger.Error("Failed to check user existence: %v", err)
 		return false
 	}
 	return exists
 }
 
+// NewValidationCode returns the code which is sent to a registering user to validate the email address. With the
+// mock email client, the code is always the same so that tests can validate users without receiving emails.
+func NewValidationCode(useMockEmailClient bool) (string, error) {
+	if useMockEmailClient {
+		return "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", nil
+	}
+	randomBytes := make([]byte, 32)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", fmt.Errorf("failed to generate validation code: %w", err)
+	}
+	return hex.EncodeToString(randomBytes), nil
+}
+
 func (u *UserRepositoryImpl) CreateUser(form *tools.RegistrationForm) (string, error) {
-	var key string
-	if tools.UseMailMockClient {
-		key = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
-	} else {
-		randomBytes := make([]byte, 32)
-		if _, err := rand.Read(randomBytes); err != nil {
-			tools.Logger.Error("Failed to generate cookie: %v", err)
-			return "", err
-		}
-		key = hex.EncodeToString(randomBytes)
+	key, err := NewValidationCode(u.config.UsesMockEmailClient())
+	if err != nil {
+		u.logger.Error("Failed to create user: %v", err)
+		return "", err
 	}
-	tools.Logger.Info("adding user to validation list: %s", form.User)
-	tools.WaitingForEmailVerificationList.Store(key, form)
+	u.logger.Info("adding user to validation list: %s", form.User)
+	u.waitingForEmailVerification.Store(key, form)
 	return key, nil
 }
 
 func (u *UserRepositoryImpl) ValidateUser(code string) error {
-	value, ok := tools.WaitingForEmailVerificationList.Load(code)
+	value, ok := u.waitingForEmailVerification.Load(code)
 	if !ok {
 		return fmt.Errorf("code not found")
 	}
@@ -78,27 +118,27 @@ func (u *UserRepositoryImpl) ValidateUser(code string) error {
 
 	hashedPassword, err := utils.SaltAndHash(form.Password)
 	if err != nil {
-		tools.Logger.Error("Failed to hash password: %v", err)
+		u.logger.Error("Failed to hash password: %v", err)
 		return fmt.Errorf("failed to hash password")
 	}
-	_, err = tools.Db.Exec("INSERT INTO users (user_name, email, hashed_password, used_space) VALUES ($1, $2, $3, $4)", form.User, form.Email, hashedPassword, 0)
+	_, err = u.db.Exec("INSERT INTO users (user_name, email, hashed_password, used_space) VALUES ($1, $2, $3, $4)", form.User, form.Email, hashedPassword, 0)
 	if err != nil {
-		tools.Logger.Error("Failed to create user: %v", err)
+		u.logger.Error("Failed to create user: %v", err)
 		return fmt.Errorf("failed to create user")
 	}
-	tools.WaitingForEmailVerificationList.Delete(code)
+	u.waitingForEmailVerification.Delete(code)
 	return nil
 }
 
 func (u *UserRepositoryImpl) DeleteUser(user string) error {
 	if !u.DoesUserExist(user) {
-		tools.Logger.Info("User '%s' does not exist", user)
+		u.logger.Info("User '%s' does not exist", user)
 		return fmt.Errorf("user does not exist")
 	}
 
-	_, err := tools.Db.Exec("DELETE FROM users WHERE user_name = $1", user)
+	_, err := u.db.Exec("DELETE FROM users WHERE user_name = $1", user)
 	if err != nil {
-		tools.Logger.Error("Failed to delete user: %v", err)
+		u.logger.Error("Failed to delete user: %v", err)
 		return fmt.Errorf("failed to delete user")
 	}
 
@@ -111,9 +151,9 @@ func (u *UserRepositoryImpl) HashAndSaveCookie(user string, cookie string, expir
 		return fmt.Errorf("hashing failed")
 	}
 
-	_, err = tools.Db.Exec("UPDATE users SET hashed_cookie_value = $1, expiration_date = $2 WHERE user_name = $3", hashedCookieValue, expirationDate.Format(time.RFC3339), user)
+	_, err = u.db.Exec("UPDATE users SET hashed_cookie_value = $1, expiration_date = $2 WHERE user_name = $3", hashedCookieValue, expirationDate.Format(time.RFC3339), user)
 	if err != nil {
-		tools.Logger.Error("Failed to hash and save cookie: %v", err)
+		u.logger.Error("Failed to hash and save cookie: %v", err)
 		return fmt.Errorf("failed to hash and save cookie")
 	}
 	return nil
@@ -122,14 +162,14 @@ func (u *UserRepositoryImpl) HashAndSaveCookie(user string, cookie string, expir
 func (u *UserRepositoryImpl) IsCookieExpired(cookie string) bool {
 	hashedCookieValue, err := utils.Hash(cookie)
 	if err != nil {
-		tools.Logger.Error("Error hashing cookie: %v", err)
+		u.logger.Error("Error hashing cookie: %v", err)
 		return false
 	}
 
 	var expirationDateStr string
-	err = tools.Db.QueryRow("SELECT expiration_date FROM users WHERE hashed_cookie_value = $1", hashedCookieValue).Scan(&expirationDateStr)
+	err = u.db.QueryRow("SELECT expiration_date FROM users WHERE hashed_cookie_value = $1", hashedCookieValue).Scan(&expirationDateStr)
 	if err != nil {
-		tools.Logger.Error("Failed to fetch expiration date: %v", err)
+		u.logger.Error("Failed to fetch expiration date: %v", err)
 		return true
 	} else if expirationDateStr == "" {
 		return true
@@ -137,7 +177,7 @@ func (u *UserRepositoryImpl) IsCookieExpired(cookie string) bool {
 
 	expirationDate, err := time.Parse(time.RFC3339, expirationDateStr)
 	if err != nil {
-		tools.Logger.Error("Failed to parse expiration date: %v", err)
+		u.logger.Error("Failed to parse expiration date: %v", err)
 		return true
 	}
 
@@ -146,7 +186,7 @@ func (u *UserRepositoryImpl) IsCookieExpired(cookie string) bool {
 
 func (u *UserRepositoryImpl) GetUserViaCookie(cookie string) (string, error) {
 	if cookie == "" {
-		tools.Logger.Error("Cookie not set in request")
+		u.logger.Error("Cookie not set in request")
 		return "", fmt.Errorf("cookie not set in request")
 	}
 
@@ -156,15 +196,13 @@ func (u *UserRepositoryImpl) GetUserViaCookie(cookie string) (string, error) {
 	}
 
 	var user string
-	err = tools.Db.QueryRow("SELECT user_name FROM users WHERE hashed_cookie_value = $1", hashedCookieValue).Scan(&user)
-	if err != nil {
-		if err.Error() == "sql: no rows in result set" {
-			tools.Logger.Info("Cookie not found")
-			return "", fmt.Errorf("cookie not found")
-		} else {
-			tools.Logger.Error("Failed to fetch user: %v", err)
-			return "", fmt.Errorf("failed to fetch user")
-		}
+	err = u.db.QueryRow("SELECT user_name FROM users WHERE hashed_cookie_value = $1", hashedCookieValue).Scan(&user)
+	if errors.Is(err, sql.ErrNoRows) {
+		u.logger.Info("Cookie not found")
+		return "", tools.ErrCookieNotFound
+	} else if err != nil {
+		u.logger.Error("Failed to fetch user: %v", err)
+		return "", fmt.Errorf("failed to fetch user")
 	}
 
 	return user, nil
@@ -173,13 +211,13 @@ func (u *UserRepositoryImpl) GetUserViaCookie(cookie string) (string, error) {
 func (u *UserRepositoryImpl) ChangePassword(user string, newPassword string) error {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
 	if err != nil {
-		tools.Logger.Error("Failed to hash password: %v", err)
+		u.logger.Error("Failed to hash password: %v", err)
 		return fmt.Errorf("failed to hash password")
 	}
 
-	_, err = tools.Db.Exec("UPDATE users SET hashed_password = $1 WHERE user_name = $2", hashedPassword, user)
+	_, err = u.db.Exec("UPDATE users SET hashed_password = $1 WHERE user_name = $2", hashedPassword, user)
 	if err != nil {
-		tools.Logger.Error("Failed to change password: %v", err)
+		u.logger.Error("Failed to change password: %v", err)
 		return fmt.Errorf("failed to change password")
 	}
 
@@ -187,54 +225,251 @@ func (u *UserRepositoryImpl) ChangePassword(user string, newPassword string) err
 }
 
 func (u *UserRepositoryImpl) WipeDatabase() {
-	_, err := tools.Db.Exec("DELETE FROM users WHERE user_name != 'sample'")
+	_, err := u.db.Exec("DELETE FROM users WHERE user_name != 'sample'")
 	if err != nil {
-		tools.Logger.Error("Failed to wipe database: %v", err)
+		u.logger.Error("Failed to wipe database: %v", err)
 	}
-	tools.WaitingForEmailVerificationList = sync.Map{}
+	u.waitingForEmailVerification.Clear()
 }
 
 func (u *UserRepositoryImpl) GetUsedSpaceInBytes(user string) (int, error) {
 	var usedSpace int
-	err := tools.Db.QueryRow(`SELECT used_space FROM users WHERE user_name = $1`, user).Scan(&usedSpace)
+	err := u.db.QueryRow(`SELECT used_space FROM users WHERE user_name = $1`, user).Scan(&usedSpace)
 	if err != nil {
-		tools.Logger.Error("Failed to get used space: %v", err)
+		u.logger.Error("Failed to get used space: %v", err)
 		return 0, fmt.Errorf("failed to get used space")
 	}
 	return usedSpace, nil
 }
 
+// GetStorageLimitInBytes returns the storage limit of the user, which is the default limit unless an admin changed it.
+func (u *UserRepositoryImpl) GetStorageLimitInBytes(user string) (int, error) {
+	var storageLimit int
+	err := u.db.QueryRow(`SELECT COALESCE(storage_limit, $2) FROM users WHERE user_name = $1`, user, u.config.Quota.DefaultStorageLimit).Scan(&storageLimit)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, tools.ErrUserNotFound
+	} else if err != nil {
+		u.logger.Error("Failed to get storage limit: %v", err)
+		return 0, fmt.Errorf("failed to get storage limit")
+	}
+	return storageLimit, nil
+}
+
+// SetStorageLimit sets the storage limit of the user, nil resets it to the default limit.
+func (u *UserRepositoryImpl) SetStorageLimit(user string, storageLimit *int) error {
+	result, err := u.db.Exec("UPDATE users SET storage_limit = $1 WHERE user_name = $2", storageLimit, user)
+	if err != nil {
+		u.logger.Error("Failed to set storage limit: %v", err)
+		return fmt.Errorf("failed to set storage limit")
+	}
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 {
+		return tools.ErrUserNotFound
+	}
+	return nil
+}
+
+func (u *UserRepositoryImpl) GetQuota(user string) (*tools.QuotaInfo, error) {
+	usedSpace, err := u.GetUsedSpaceInBytes(user)
+	if err != nil {
+		return nil, err
+	}
+	storageLimit, err := u.GetStorageLimitInBytes(user)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := u.db.Query(`
+		SELECT a.app_id, a.app_name, COALESCE(SUM(LENGTH(v.data)), 0), COUNT(v.version_id), a.storage_limit, a.max_versions
+		FROM apps a
+		JOIN users u ON u.user_id = a.user_id
+		LEFT JOIN versions v ON v.app_id = a.app_id
+		WHERE u.user_name = $1
+		GROUP BY a.app_id, a.app_name, a.storage_limit, a.max_versions
+		ORDER BY a.app_name`, user)
+	if err != nil {
+		u.logger.Error("Failed to get app quotas: %v", err)
+		return nil, fmt.Errorf("failed to get app quotas")
+	}
+	defer utils.Close(rows)
+
+	appQuotas := []tools.AppQuota{}
+	for rows.Next() {
+		var appQuota tools.AppQuota
+		var appId int
+		var appStorageLimit, maxVersions sql.NullInt64
+		if err = rows.Scan(&appId, &appQuota.AppName, &appQuota.UsedBytes, &appQuota.VersionCount, &appStorageLimit, &maxVersions); err != nil {
+			return nil, fmt.Errorf("failed to scan app quota: %w", err)
+		}
+		appQuota.AppId = strconv.Itoa(appId)
+		appQuota.StorageLimitBytes = toIntPointer(appStorageLimit)
+		appQuota.MaxVersions = toIntPointer(maxVersions)
+		appQuotas = append(appQuotas, appQuota)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate app quotas: %w", err)
+	}
+
+	return &tools.QuotaInfo{
+		UsedBytes:         usedSpace,
+		StorageLimitBytes: storageLimit,
+		MaxPayloadBytes:   u.config.Quota.MaxPayloadSize,
+		Apps:              appQuotas,
+	}, nil
+}
+
+func toIntPointer(value sql.NullInt64) *int {
+	if !value.Valid {
+		return nil
+	}
+	number := int(value.Int64)
+	return &number
+}
+
 func (u *UserRepositoryImpl) Logout(user string) error {
-	_, err := tools.Db.Exec("UPDATE users SET hashed_cookie_value = $1, expiration_date = $2 WHERE user_name = $3", nil, nil, user)
+	_, err := u.db.Exec("UPDATE users SET hashed_cookie_value = $1, expiration_date = $2 WHERE user_name = $3", nil, nil, user)
 	if err != nil {
-		tools.Logger.Error("failed to logout: %v", err)
+		u.logger.Error("failed to logout: %v", err)
 		return errors.New("failed to logout")
 	}
 	return nil
 }
 
-func CreateAndValidateUser(form *tools.RegistrationForm) error {
-	code, err := UserRepo.CreateUser(form)
+func CreateAndValidateUser(repo UserRepository, form *tools.RegistrationForm) error {
+	code, err := repo.CreateUser(form)
 	if err != nil {
 		return err
 	}
-	err = UserRepo.ValidateUser(code)
+	err = repo.ValidateUser(code)
 	return err
 }
 
 func (u *UserRepositoryImpl) DoesEmailExist(email string) bool {
 	var exists bool
-	err := tools.Db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE email = $1)", email).Scan(&exists)
+	err := u.db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE email = $1)", email).Scan(&exists)
 	if err != nil {
-		tools.Logger.Error("Failed to check email existence: %v", err)
+		u.logger.Error("Failed to check email existence: %v", err)
 		return false
 	}
 	return exists
 }
 
-type UserRepositoryImpl struct{}
+// ReconcileUsedSpace recomputes the used space of every user from the stored version content and corrects
+// the users whose bookkeeping drifted. It returns the number of corrected users.
+func (u *UserRepositoryImpl) ReconcileUsedSpace() (int, error) {
+	rows, err := u.db.Query(`
+		SELECT u.user_id, u.user_name
+		FROM users u
+		WHERE u.used_space != (
+			SELECT COALESCE(SUM(LENGTH(v.data)), 0)
+			FROM apps a
+			JOIN versions v ON v.app_id = a.app_id
+			WHERE a.user_id = u.user_id
+		)`)
+	if err != nil {
+		u.logger.Error("Failed to find users with drifted used space: %v", err)
+		return 0, errors.New("failed to find users with drifted used space")
+	}
+
+	type driftedUser struct {
+		id   int
+		name string
+	}
+	var driftedUsers []driftedUser
+	for rows.Next() {
+		var user driftedUser
+		if err = rows.Scan(&user.id, &user.name); err != nil {
+			utils.Close(rows)
+			return 0, fmt.Errorf("failed to scan drifted user: %w", err)
+		}
+		driftedUsers = append(driftedUsers, user)
+	}
+	utils.Close(rows)
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to iterate drifted users: %w", err)
+	}
 
-var UserRepo UserRepository = &UserRepositoryImpl{}
+	corrected := 0
+	for _, user := range driftedUsers {
+		err = u.db.RunInTransaction(func(tx *sql.Tx) error {
+			recordedSpace, err := u.db.LockUsedSpace(tx, user.id)
+			if err != nil {
+				return err
+			}
+
+			var actualSpace int
+			err = tx.QueryRow(`
+				SELECT COALESCE(SUM(LENGTH(v.data)), 0)
+				FROM apps a
+				JOIN versions v ON v.app_id = a.app_id
+				WHERE a.user_id = $1`, user.id).Scan(&actualSpace)
+			if err != nil {
+				return fmt.Errorf("failed to calculate used space: %w", err)
+			}
+			if recordedSpace == actualSpace {
+				return nil
+			}
+
+			_, err = tx.Exec("UPDATE users SET used_space = $1 WHERE user_id = $2", actualSpace, user.id)
+			if err != nil {
+				return fmt.Errorf("failed to update user space: %w", err)
+			}
+			u.logger.Warn("used space of user '%s' drifted by %d bytes, corrected from %d to %d", user.name, recordedSpace-actualSpace, recordedSpace, actualSpace)
+			corrected++
+			return nil
+		})
+		if errors.Is(err, tools.ErrUserNotFound) {
+			continue
+		} else if err != nil {
+			u.logger.Error("Failed to reconcile used space of user '%s': %v", user.name, err)
+			return corrected, err
+		}
+	}
+	return corrected, nil
+}
+
+// RunUsedSpaceReconciler reconciles the used space of all users right away and then in the given interval until ctx is done.
+func RunUsedSpaceReconciler(ctx context.Context, repo UserRepository, interval time.Duration, logger utils.LoggerType) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := repo.ReconcileUsedSpace(); err != nil {
+			logger.Error("used space reconciliation failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type UserRepositoryImpl struct {
+	db     *tools.Database
+	config *config.Config
+	logger utils.LoggerType
+	// waitingForEmailVerification maps the validation codes to the registration forms of users who did not
+	// validate their email address yet.
+	waitingForEmailVerification *sync.Map
+}
+
+func NewUserRepository(db *tools.Database, cfg *config.Config, logger utils.LoggerType) *UserRepositoryImpl {
+	return &UserRepositoryImpl{db: db, config: cfg, logger: logger, waitingForEmailVerification: &sync.Map{}}
+}
+
+func (u *UserRepositoryImpl) WithLogger(logger utils.LoggerType) UserRepository {
+	copied := *u
+	copied.logger = logger
+	return &copied
+}
+
+// CountUsers returns the number of registered users whose email address was validated.
+func (u *UserRepositoryImpl) CountUsers() (int, error) {
+	var count int
+	if err := u.db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count users: %w", err)
+	}
+	return count, nil
+}
 
 type UserRepository interface {
 	CreateUser(form *tools.RegistrationForm) (string, error)
@@ -250,5 +485,12 @@ type UserRepository interface {
 	Logout(user string) error
 	IsThereEnoughSpaceToAddVersion(user string, bytesToAdd int) error
 	GetUsedSpaceInBytes(user string) (int, error)
+	GetStorageLimitInBytes(user string) (int, error)
+	SetStorageLimit(user string, storageLimit *int) error
+	GetQuota(user string) (*tools.QuotaInfo, error)
+	ReconcileUsedSpace() (int, error)
+	CountUsers() (int, error)
 	WipeDatabase()
+	// WithLogger returns a copy of the repository logging with the given logger, e.g. the one of the request being handled.
+	WithLogger(logger utils.LoggerType) UserRepository
 }
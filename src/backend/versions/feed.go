@@ -0,0 +1,173 @@
+package versions
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"github.com/ocelot-cloud/shared/validation"
+	"net/http"
+	"net/url"
+	"ocelot/store/tools"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// maxFeedEntries is the number of releases contained in a release feed.
+	maxFeedEntries = 50
+	// maxExcerptLength is the number of characters of a changelog shown in a feed entry.
+	maxExcerptLength = 500
+	atomNamespace    = "http://www.w3.org/2005/Atom"
+	atomContentType  = "application/atom+xml; charset=utf-8"
+)
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	Id      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Id      string       `xml:"id"`
+	Title   string       `xml:"title"`
+	Updated string       `xml:"updated"`
+	Author  atomAuthor   `xml:"author"`
+	Link    atomLink     `xml:"link"`
+	Summary *atomSummary `xml:"summary,omitempty"`
+}
+
+type atomSummary struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+// ReleaseFeedHandler serves an Atom feed of the newest releases of all apps, of the apps of the maintainer given in
+// the query or of a single app if the app name is given as well. Clients can poll it with conditional requests, the
+// ETag changes whenever the content of the feed does, while Last-Modified is the time of the newest release.
+func (h *Handlers) ReleaseFeedHandler(w http.ResponseWriter, r *http.Request) {
+	h = h.forRequest(r)
+	maintainer := r.URL.Query().Get("maintainer")
+	app := r.URL.Query().Get("app")
+	if maintainer != "" && !validation.ValidationTypeMap["user_name"].MatchString(maintainer) {
+		tools.HandleInvalidInput(w, r, fmt.Errorf("invalid maintainer name"))
+		return
+	}
+	if app != "" && (maintainer == "" || !validation.ValidationTypeMap["app_name"].MatchString(app)) {
+		tools.HandleInvalidInput(w, r, fmt.Errorf("app name must be valid and requires a maintainer"))
+		return
+	}
+
+	title := "New releases"
+	if app != "" {
+		if _, err := h.Apps.GetAppId(maintainer, app); err != nil {
+			tools.GetLogger(r).Info("release feed of app '%s' of maintainer '%s' requested, but app does not exist", app, maintainer)
+			tools.WriteError(w, r, http.StatusNotFound, tools.CodeAppNotFound, "app does not exist")
+			return
+		}
+		title = fmt.Sprintf("Releases of %s/%s", maintainer, app)
+	} else if maintainer != "" {
+		if !h.Users.DoesUserExist(maintainer) {
+			tools.GetLogger(r).Info("release feed of maintainer '%s' requested, but user does not exist", maintainer)
+			tools.WriteError(w, r, http.StatusNotFound, tools.CodeUserNotFound, "user does not exist")
+			return
+		}
+		title = "Releases of " + maintainer
+	}
+
+	releases, err := h.Versions.GetReleases(maintainer, app, maxFeedEntries)
+	if err != nil {
+		tools.GetLogger(r).Error("getting releases failed: %v", err)
+		tools.WriteInternalError(w, r, "error getting releases")
+		return
+	}
+
+	selfUrl := strings.TrimSuffix(h.Config.Server.PublicUrl, "/") + r.URL.RequestURI()
+	body, updated, err := renderFeed(h.Config.Server.PublicUrl, selfUrl, title, releases)
+	if err != nil {
+		tools.GetLogger(r).Error("rendering release feed failed: %v", err)
+		tools.WriteInternalError(w, r, "error rendering release feed")
+		return
+	}
+
+	hash := sha256.Sum256(body)
+	w.Header().Set("Content-Type", atomContentType)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(hash[:16])+`"`)
+	w.Header().Set("Cache-Control", "no-cache")
+	// ServeContent sets Last-Modified and answers If-None-Match and If-Modified-Since with 304 Not Modified.
+	http.ServeContent(w, r, "", updated, bytes.NewReader(body))
+}
+
+// renderFeed returns the Atom document of the releases, which must be ordered newest first, and the time it was last
+// updated. A feed without releases was last updated at the Unix epoch.
+func renderFeed(publicUrl, selfUrl, title string, releases []tools.Release) ([]byte, time.Time, error) {
+	updated := time.Unix(0, 0).UTC()
+	if len(releases) > 0 {
+		updated = releases[0].CreationTimestamp.UTC()
+	}
+
+	host := publicUrl
+	if parsed, err := url.Parse(publicUrl); err == nil && parsed.Hostname() != "" {
+		host = parsed.Hostname()
+	}
+
+	feed := atomFeed{
+		Xmlns:   atomNamespace,
+		Id:      selfUrl,
+		Title:   title,
+		Updated: updated.Format(time.RFC3339),
+		Links:   []atomLink{{Rel: "self", Type: "application/atom+xml", Href: selfUrl}, {Rel: "alternate", Href: publicUrl}},
+	}
+	for _, release := range releases {
+		created := release.CreationTimestamp.UTC()
+		entry := atomEntry{
+			// Tag URIs stay stable if the public URL changes its scheme or port.
+			Id:      fmt.Sprintf("tag:%s,%s:version/%d", host, created.Format(time.DateOnly), release.VersionId),
+			Title:   fmt.Sprintf("%s/%s %s", release.Maintainer, release.AppName, release.VersionName),
+			Updated: created.Format(time.RFC3339),
+			Author:  atomAuthor{Name: release.Maintainer},
+			Link:    atomLink{Rel: "alternate", Href: publicUrl},
+		}
+		if release.Changelog != "" {
+			entry.Summary = &atomSummary{Type: "text", Text: excerpt(release.Changelog, maxExcerptLength)}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	body, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to marshal feed: %w", err)
+	}
+	return append([]byte(xml.Header), body...), updated, nil
+}
+
+// excerpt shortens the text to at most maxLength characters, cutting at the last word boundary and appending an
+// ellipsis if it is too long.
+func excerpt(text string, maxLength int) string {
+	text = strings.TrimSpace(text)
+	runes := []rune(text)
+	if len(runes) <= maxLength {
+		return text
+	}
+	cut := string(runes[:maxLength])
+	if index := strings.LastIndexFunc(cut, unicode.IsSpace); index > 0 {
+		cut = strings.TrimRightFunc(cut[:index], unicode.IsSpace)
+	}
+	return cut + "…"
+}
@@ -0,0 +1,47 @@
+package versions
+
+import (
+	"encoding/xml"
+	"github.com/ocelot-cloud/shared/assert"
+	"ocelot/store/tools"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExcerptCutsAtWordBoundary(t *testing.T) {
+	assert.Equal(t, "short text", excerpt("  short text\n", 20))
+	assert.Equal(t, "fixes the…", excerpt("fixes the login", 12))
+	assert.Equal(t, "fixesthelo…", excerpt("fixestheloginbug", 10))
+	assert.Equal(t, "äöü…", excerpt("äöü äöü", 5))
+}
+
+func TestRenderFeed(t *testing.T) {
+	created := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+	releases := []tools.Release{
+		{Maintainer: "maintainer", AppId: 1, AppName: "app", VersionId: 7, VersionName: "1.0.1", Changelog: "fixes <bugs> & more", CreationTimestamp: created},
+		{Maintainer: "maintainer", AppId: 1, AppName: "app", VersionId: 6, VersionName: "1.0.0", CreationTimestamp: created.Add(-time.Hour)},
+	}
+	body, updated, err := renderFeed("https://store.example.com", "https://store.example.com/api/feeds/releases", "New releases", releases)
+	assert.Nil(t, err)
+	assert.Equal(t, created, updated)
+	assert.True(t, strings.HasPrefix(string(body), xml.Header))
+
+	var feed atomFeed
+	assert.Nil(t, xml.Unmarshal(body, &feed))
+	assert.Equal(t, atomNamespace, feed.XMLName.Space)
+	assert.Equal(t, "https://store.example.com/api/feeds/releases", feed.Id)
+	assert.Equal(t, "2026-03-04T05:06:07Z", feed.Updated)
+	assert.Equal(t, 2, len(feed.Entries))
+	assert.Equal(t, "tag:store.example.com,2026-03-04:version/7", feed.Entries[0].Id)
+	assert.Equal(t, "maintainer/app 1.0.1", feed.Entries[0].Title)
+	assert.Equal(t, "fixes <bugs> & more", feed.Entries[0].Summary.Text)
+	assert.True(t, feed.Entries[1].Summary == nil)
+}
+
+func TestRenderEmptyFeed(t *testing.T) {
+	body, updated, err := renderFeed("http://localhost:8082", "http://localhost:8082/api/feeds/releases", "New releases", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Unix(0, 0).UTC(), updated)
+	assert.False(t, strings.Contains(string(body), "<entry>"))
+}
@@ -2,181 +2,437 @@ package versions
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/ocelot-cloud/shared/utils"
 	"github.com/ocelot-cloud/shared/validation"
 	"net/http"
 	"ocelot/store/apps"
+	"ocelot/store/config"
+	"ocelot/store/metrics"
 	"ocelot/store/tools"
 	"ocelot/store/users"
+	"ocelot/store/webhooks"
 	"strconv"
-	"strings"
 )
 
-func VersionUploadHandler(w http.ResponseWriter, r *http.Request) {
+// Handlers serve the version routes using the given repositories. Publishing and deleting versions is announced to
+// the webhooks.
+type Handlers struct {
+	Versions VersionRepository
+	Apps     apps.AppRepository
+	Users    users.UserRepository
+	Config   *config.Config
+	Metrics  *metrics.Metrics
+	Webhooks *webhooks.Dispatcher
+}
+
+// forRequest returns a copy of the handlers whose repositories log with the logger of the request, so that their lines
+// carry the request ID.
+func (h *Handlers) forRequest(r *http.Request) *Handlers {
+	logger := tools.GetLogger(r)
+	bound := *h
+	bound.Versions = h.Versions.WithLogger(logger)
+	bound.Apps = h.Apps.WithLogger(logger)
+	bound.Users = h.Users.WithLogger(logger)
+	return &bound
+}
+
+func (h *Handlers) VersionUploadHandler(w http.ResponseWriter, r *http.Request) {
+	h = h.forRequest(r)
 	user := tools.GetUserFromContext(r)
-	r.Body = http.MaxBytesReader(w, r.Body, tools.MaxPayloadSize)
+	r.Body = http.MaxBytesReader(w, r.Body, int64(h.Config.Quota.MaxPayloadSize))
 	defer utils.Close(r.Body)
 
 	var versionUpload tools.VersionUpload
 	err := json.NewDecoder(r.Body).Decode(&versionUpload)
 	if err != nil {
-		if err.Error() == "http: request body too large" {
-			tools.Logger.Info("version upload version content of user '%s' was too large", user)
-			http.Error(w, "version content too large, the limit is 1MB", http.StatusRequestEntityTooLarge)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			tools.GetLogger(r).Info("version upload version content of user '%s' was too large", user)
+			h.Metrics.CountQuotaRejection("payload_size")
+			tools.WriteErrorWithDetails(w, r, http.StatusRequestEntityTooLarge, tools.CodePayloadTooLarge, fmt.Sprintf("version content too large, the limit is %d bytes", h.Config.Quota.MaxPayloadSize),
+				map[string]any{"limit_bytes": maxBytesErr.Limit})
 			return
 		} else {
-			tools.Logger.Info("version upload request body of user '%s' was invalid: %v", user, err)
-			http.Error(w, "could not decode request body", http.StatusBadRequest)
+			tools.GetLogger(r).Info("version upload request body of user '%s' was invalid: %v", user, err)
+			tools.WriteError(w, r, http.StatusBadRequest, tools.CodeInvalidRequestBody, "could not decode request body")
 			return
 		}
 	}
 
 	err = validation.ValidateStruct(versionUpload)
 	if err != nil {
-		tools.Logger.Info("version upload of user '%s' failed: %v", user, err)
-		http.Error(w, "invalid input", http.StatusBadRequest)
+		tools.GetLogger(r).Info("version upload of user '%s' failed: %v", user, err)
+		tools.HandleInvalidInput(w, r, err)
+		return
+	}
+
+	if len(versionUpload.Changelog) > tools.MaxChangelogLength {
+		tools.GetLogger(r).Info("version upload of user '%s' failed: changelog has %d bytes", user, len(versionUpload.Changelog))
+		tools.HandleInvalidInput(w, r, fmt.Errorf("changelog must not be longer than %d bytes", tools.MaxChangelogLength))
 		return
 	}
 
-	err = users.UserRepo.IsThereEnoughSpaceToAddVersion(user, len(versionUpload.Content))
+	err = h.Users.IsThereEnoughSpaceToAddVersion(user, len(versionUpload.Content))
 	if err != nil {
-		if strings.HasPrefix(err.Error(), users.NotEnoughSpacePrefix) {
-			tools.Logger.Info("version upload of user '%s' failed: not enough space", user)
-			http.Error(w, err.Error(), http.StatusInsufficientStorage)
-			return
-		} else {
-			http.Error(w, "internal error", http.StatusInternalServerError)
-			return
+		if !h.handleQuotaExceeded(w, r, user, err) {
+			tools.GetLogger(r).Error("checking available space of user '%s' failed: %v", user, err)
+			tools.WriteInternalError(w, r, "internal error")
 		}
+		return
 	}
 
 	appId, err := strconv.Atoi(versionUpload.AppId)
 	if err != nil {
-		tools.Logger.Info("user '%s' tried to upload version '%s' to app with ID '%s', but app ID is not a number", user, versionUpload.Version, versionUpload.AppId)
-		http.Error(w, "could not convert to number", http.StatusBadRequest)
+		tools.GetLogger(r).Info("user '%s' tried to upload version '%s' to app with ID '%s', but app ID is not a number", user, versionUpload.Version, versionUpload.AppId)
+		tools.WriteError(w, r, http.StatusBadRequest, tools.CodeInvalidInput, "could not convert to number")
 		return
 	}
 
-	if !apps.AppRepo.DoesAppExist(appId) {
-		tools.Logger.Info("user '%s' tried to upload version '%s' to app with ID '%s', but app does not exist", user, versionUpload.Version, versionUpload.AppId)
-		http.Error(w, "app does not exist", http.StatusNotFound)
+	if !h.Apps.DoesAppExist(appId) {
+		tools.GetLogger(r).Info("user '%s' tried to upload version '%s' to app with ID '%s', but app does not exist", user, versionUpload.Version, versionUpload.AppId)
+		tools.WriteError(w, r, http.StatusNotFound, tools.CodeAppNotFound, "app does not exist")
 		return
 	}
 
-	if !apps.AppRepo.IsAppOwner(user, appId) {
-		tools.Logger.Warn("user '%s' tried to delete app with ID '%d' but does not own it", user, versionUpload.AppId)
-		http.Error(w, "you do not own this app", http.StatusUnauthorized)
+	if !h.Apps.IsAppOwner(user, appId) {
+		tools.GetLogger(r).Warn("user '%s' tried to delete app with ID '%d' but does not own it", user, versionUpload.AppId)
+		tools.WriteError(w, r, http.StatusUnauthorized, tools.CodeNotOwner, "you do not own this app")
 		return
 	}
 
-	appName, err := apps.AppRepo.GetAppName(appId)
+	appName, err := h.Apps.GetAppName(appId)
 	if err != nil {
-		tools.Logger.Error("getting app name failed: %v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		tools.GetLogger(r).Error("getting app name failed: %v", err)
+		tools.WriteInternalError(w, r, "internal error")
 		return
 	}
 
-	maintainerName, err := apps.AppRepo.GetMaintainerName(appId)
+	maintainerName, err := h.Apps.GetMaintainerName(appId)
 	if err != nil {
-		tools.Logger.Error("getting maintainer name failed: %v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		tools.GetLogger(r).Error("getting maintainer name failed: %v", err)
+		tools.WriteInternalError(w, r, "internal error")
 		return
 	}
 
 	err = validation.ValidateVersion(versionUpload.Content, maintainerName, appName)
 	if err != nil {
-		tools.Logger.Info("version upload of user '%s' invalid: %v", user, err)
-		http.Error(w, "invalid version: "+err.Error(), http.StatusBadRequest)
+		tools.GetLogger(r).Info("version upload of user '%s' invalid: %v", user, err)
+		tools.WriteError(w, r, http.StatusBadRequest, tools.CodeInvalidVersion, "invalid version: "+err.Error())
 		return
 	}
 
-	_, err = VersionRepo.GetVersionId(appId, versionUpload.Version)
+	if versionUpload.Version == tools.LatestVersionAlias {
+		tools.GetLogger(r).Info("user '%s' tried to upload version '%s' but the name is reserved", user, versionUpload.Version)
+		tools.WriteError(w, r, http.StatusBadRequest, tools.CodeReservedName, "version name is reserved")
+		return
+	}
+
+	_, err = h.Versions.GetVersionId(appId, versionUpload.Version)
 	if err == nil {
-		tools.Logger.Info("user '%s' tried to upload version '%s' to app with ID '%s', but version already exists", user, versionUpload.Version, versionUpload.AppId)
-		http.Error(w, "version already exists", http.StatusConflict)
+		tools.GetLogger(r).Info("user '%s' tried to upload version '%s' to app with ID '%s', but version already exists", user, versionUpload.Version, versionUpload.AppId)
+		tools.WriteError(w, r, http.StatusConflict, tools.CodeVersionAlreadyExists, "version already exists")
 		return
 	}
 
-	err = VersionRepo.CreateVersion(appId, versionUpload.Version, versionUpload.Content)
-	if err != nil {
-		tools.Logger.Error("creating version failed: %v", err)
-		http.Error(w, "invalid input", http.StatusInternalServerError)
+	err = h.Versions.CreateVersion(appId, versionUpload.Version, versionUpload.Content, versionUpload.Changelog)
+	if errors.Is(err, tools.ErrVersionAlreadyExists) {
+		// a concurrent upload of the same version won the race
+		tools.GetLogger(r).Info("user '%s' tried to upload version '%s' to app with ID '%s', but version already exists", user, versionUpload.Version, versionUpload.AppId)
+		tools.WriteError(w, r, http.StatusConflict, tools.CodeVersionAlreadyExists, "version already exists")
+		return
+	} else if err != nil {
+		if !h.handleQuotaExceeded(w, r, user, err) {
+			tools.GetLogger(r).Error("creating version failed: %v", err)
+			tools.WriteInternalError(w, r, "internal error")
+		}
 		return
 	}
 
-	tools.Logger.Info("version '%s' was uploaded to app with ID '%s' by user '%s'", versionUpload.Version, versionUpload.AppId, user)
+	tools.GetLogger(r).Info("version '%s' was uploaded to app with ID '%s' by user '%s'", versionUpload.Version, versionUpload.AppId, user)
+	h.Metrics.AddUploadedBytes(len(versionUpload.Content))
+	if versionId, err := h.Versions.GetVersionId(appId, versionUpload.Version); err != nil {
+		tools.GetLogger(r).Error("getting ID of uploaded version failed, webhooks are not notified: %v", err)
+	} else {
+		h.Webhooks.Notify(tools.GetLogger(r), tools.WebhookEvent{
+			Event:       tools.WebhookEventVersionPublished,
+			Maintainer:  maintainerName,
+			AppId:       versionUpload.AppId,
+			AppName:     appName,
+			VersionId:   strconv.Itoa(versionId),
+			VersionName: versionUpload.Version,
+		})
+	}
+	if _, err = PruneVersions(h.Versions, h.Webhooks, appId, false, tools.GetLogger(r)); err != nil {
+		tools.GetLogger(r).Error("pruning versions of app with ID '%d' after upload failed: %v", appId, err)
+	}
 	w.WriteHeader(http.StatusOK)
 }
 
-func VersionDeleteHandler(w http.ResponseWriter, r *http.Request) {
+// handleQuotaExceeded writes the response for a rejected upload and reports whether err was a quota violation.
+func (h *Handlers) handleQuotaExceeded(w http.ResponseWriter, r *http.Request, user string, err error) bool {
+	var quotaErr *users.QuotaExceededError
+	var versionLimitErr *VersionLimitExceededError
+	if errors.As(err, &quotaErr) {
+		tools.GetLogger(r).Info("version upload of user '%s' failed: not enough space", user)
+		h.Metrics.CountQuotaRejection(string(quotaErr.Scope) + "_storage")
+		tools.WriteErrorWithDetails(w, r, http.StatusInsufficientStorage, tools.CodeQuotaExceeded, quotaErr.Error(), map[string]any{
+			"scope":           quotaErr.Scope,
+			"used_bytes":      quotaErr.UsedBytes,
+			"requested_bytes": quotaErr.RequestedBytes,
+			"limit_bytes":     quotaErr.LimitBytes,
+		})
+		return true
+	} else if errors.As(err, &versionLimitErr) {
+		tools.GetLogger(r).Info("version upload of user '%s' failed: maximum number of versions reached", user)
+		h.Metrics.CountQuotaRejection("max_versions")
+		tools.WriteErrorWithDetails(w, r, http.StatusInsufficientStorage, tools.CodeVersionLimitExceeded, versionLimitErr.Error(), map[string]any{
+			"version_count": versionLimitErr.VersionCount,
+			"max_versions":  versionLimitErr.MaxVersions,
+		})
+		return true
+	}
+	return false
+}
+
+func (h *Handlers) VersionDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	h = h.forRequest(r)
 	user := tools.GetUserFromContext(r)
 	versionId, err := apps.ReadBodyAsStringNumber(w, r)
 	if err != nil {
 		return
 	}
 
-	if !VersionRepo.DoesVersionExist(versionId) {
-		tools.Logger.Info("someone tried to delete version with ID '%d' but it does not exist", versionId)
-		http.Error(w, "version does not exist", http.StatusNotFound)
+	if !h.Versions.DoesVersionExist(versionId) {
+		tools.GetLogger(r).Info("someone tried to delete version with ID '%d' but it does not exist", versionId)
+		tools.WriteError(w, r, http.StatusNotFound, tools.CodeVersionNotFound, "version does not exist")
+		return
+	}
+
+	if !h.Versions.IsVersionOwner(user, versionId) {
+		tools.GetLogger(r).Warn("user '%s' tried to delete version with ID '%d' but does not own it", user, versionId)
+		tools.WriteError(w, r, http.StatusUnauthorized, tools.CodeNotOwner, "you do not own this version")
 		return
 	}
 
-	if !VersionRepo.IsVersionOwner(user, versionId) {
-		tools.Logger.Warn("user '%s' tried to delete version with ID '%d' but does not own it", user, versionId)
-		http.Error(w, "you do not own this version", http.StatusUnauthorized)
+	event, err := getVersionEvent(h.Versions, tools.WebhookEventVersionDeleted, versionId)
+	if err != nil {
+		tools.GetLogger(r).Error("getting info of version with ID '%d' failed: %v", versionId, err)
+		tools.WriteInternalError(w, r, "internal error")
 		return
 	}
 
-	err = VersionRepo.DeleteVersion(versionId)
+	err = h.Versions.DeleteVersion(versionId)
 	if err != nil {
-		tools.Logger.Info("deleting version with ID '%d' failed: %v", versionId, err)
-		http.Error(w, "invalid input", http.StatusInternalServerError)
+		tools.GetLogger(r).Info("deleting version with ID '%d' failed: %v", versionId, err)
+		tools.WriteInternalError(w, r, "internal error")
 		return
 	}
-	tools.Logger.Info("version with ID '%d' was deleted", versionId)
-	http.Error(w, "version deleted", http.StatusOK)
+	tools.GetLogger(r).Info("version with ID '%d' was deleted", versionId)
+	h.Webhooks.Notify(tools.GetLogger(r), *event)
+	w.WriteHeader(http.StatusOK)
 }
 
-func GetVersionsHandler(w http.ResponseWriter, r *http.Request) {
+// getVersionEvent collects the info about the version which is sent to the webhooks.
+func getVersionEvent(repo VersionRepository, event string, versionId int) (*tools.WebhookEvent, error) {
+	appId, err := repo.GetAppIdByVersionId(versionId)
+	if err != nil {
+		return nil, err
+	}
+	info, err := repo.GetFullVersionInfo(versionId)
+	if err != nil {
+		return nil, err
+	}
+	return &tools.WebhookEvent{
+		Event:       event,
+		Maintainer:  info.Maintainer,
+		AppId:       strconv.Itoa(appId),
+		AppName:     info.AppName,
+		VersionId:   strconv.Itoa(versionId),
+		VersionName: info.VersionName,
+	}, nil
+}
+
+func (h *Handlers) GetVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	h = h.forRequest(r)
 	appId, err := apps.ReadBodyAsStringNumber(w, r)
 	if err != nil {
 		return
 	}
 
-	if !apps.AppRepo.DoesAppExist(appId) {
-		tools.Logger.Info("someone tried to list versions but app with ID '%d' does not exist", appId)
-		http.Error(w, "app does not exist", http.StatusNotFound)
+	if !h.Apps.DoesAppExist(appId) {
+		tools.GetLogger(r).Info("someone tried to list versions but app with ID '%d' does not exist", appId)
+		tools.WriteError(w, r, http.StatusNotFound, tools.CodeAppNotFound, "app does not exist")
 		return
 	}
 
-	versionsList, err := VersionRepo.GetVersionList(appId)
+	versionsList, err := h.Versions.GetVersionList(appId)
 	if err != nil {
-		tools.Logger.Error("getting version list failed for app with ID '%d'", appId)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		tools.GetLogger(r).Error("getting version list failed for app with ID '%d'", appId)
+		tools.WriteInternalError(w, r, "getting version list failed")
 		return
 	}
 
 	utils.SendJsonResponse(w, versionsList)
 }
 
-func VersionDownloadHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) VersionDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	h = h.forRequest(r)
 	versionId, err := apps.ReadBodyAsStringNumber(w, r)
 	if err != nil {
 		return
 	}
 
-	if !VersionRepo.DoesVersionExist(versionId) {
-		tools.Logger.Info("version with ID '%d' does not exist", versionId)
-		http.Error(w, "version does not exist", http.StatusNotFound)
+	if !h.Versions.DoesVersionExist(versionId) {
+		tools.GetLogger(r).Info("version with ID '%d' does not exist", versionId)
+		tools.WriteError(w, r, http.StatusNotFound, tools.CodeVersionNotFound, "version does not exist")
 		return
 	}
 
-	versionInfo, err := VersionRepo.GetFullVersionInfo(versionId)
+	versionInfo, err := h.Versions.GetFullVersionInfo(versionId)
 	if err != nil {
-		tools.Logger.Error("error when accessing version info: %v", err)
-		http.Error(w, "error when accessing version info", http.StatusInternalServerError)
+		tools.GetLogger(r).Error("error when accessing version info: %v", err)
+		tools.WriteInternalError(w, r, "error when accessing version info")
 		return
 	}
 
+	h.Metrics.AddDownloadedBytes(len(versionInfo.Content))
 	utils.SendJsonResponse(w, versionInfo)
 }
+
+func (h *Handlers) VersionLookupHandler(w http.ResponseWriter, r *http.Request) {
+	h = h.forRequest(r)
+	lookupRequest, err := tools.ReadBody[tools.VersionLookupRequest](w, r)
+	if err != nil {
+		return
+	}
+
+	appId, err := h.Apps.GetAppId(lookupRequest.Maintainer, lookupRequest.AppName)
+	if apps.IsNotFound(err) {
+		tools.GetLogger(r).Info("someone looked up a version of app '%s/%s' but the app does not exist", lookupRequest.Maintainer, lookupRequest.AppName)
+		tools.WriteError(w, r, http.StatusNotFound, tools.CodeAppNotFound, "app does not exist")
+		return
+	} else if err != nil {
+		tools.GetLogger(r).Error("looking up app '%s/%s' failed: %v", lookupRequest.Maintainer, lookupRequest.AppName, err)
+		tools.WriteInternalError(w, r, "error getting app")
+		return
+	}
+
+	var versionId int
+	if lookupRequest.VersionName == tools.LatestVersionAlias {
+		versionId, err = h.Versions.GetLatestVersionId(appId)
+	} else {
+		versionId, err = h.Versions.GetVersionId(appId, lookupRequest.VersionName)
+	}
+	if errors.Is(err, tools.ErrVersionNotFound) {
+		tools.GetLogger(r).Info("someone looked up version '%s' of app '%s/%s' but it does not exist", lookupRequest.VersionName, lookupRequest.Maintainer, lookupRequest.AppName)
+		tools.WriteError(w, r, http.StatusNotFound, tools.CodeVersionNotFound, "version does not exist")
+		return
+	} else if err != nil {
+		tools.GetLogger(r).Error("looking up version '%s' of app with ID '%d' failed: %v", lookupRequest.VersionName, appId, err)
+		tools.WriteInternalError(w, r, "error getting version")
+		return
+	}
+
+	version, err := h.Versions.GetVersion(versionId)
+	if err != nil {
+		tools.GetLogger(r).Error("getting version with ID '%d' failed: %v", versionId, err)
+		tools.WriteInternalError(w, r, "error getting version")
+		return
+	}
+
+	utils.SendJsonResponse(w, tools.VersionLookupResult{
+		Maintainer:        lookupRequest.Maintainer,
+		AppId:             strconv.Itoa(appId),
+		AppName:           lookupRequest.AppName,
+		VersionId:         version.Id,
+		VersionName:       version.Name,
+		CreationTimestamp: version.CreationTimestamp,
+	})
+}
+
+func (h *Handlers) RetentionPolicySetHandler(w http.ResponseWriter, r *http.Request) {
+	h = h.forRequest(r)
+	user := tools.GetUserFromContext(r)
+	policy, err := tools.ReadBody[tools.RetentionPolicy](w, r)
+	if err != nil {
+		return
+	}
+
+	appId, err := strconv.Atoi(policy.AppId)
+	if err != nil {
+		tools.WriteError(w, r, http.StatusBadRequest, tools.CodeInvalidInput, "could not convert to number")
+		return
+	}
+
+	if policy.KeepLast < 0 || policy.KeepDays < 0 {
+		tools.HandleInvalidInput(w, r, errors.New("retention rules must not be negative"))
+		return
+	}
+
+	if !h.Apps.IsAppOwner(user, appId) {
+		tools.GetLogger(r).Warn("user '%s' tried to set the retention policy of app with ID '%d' but does not own it", user, appId)
+		tools.WriteError(w, r, http.StatusUnauthorized, tools.CodeNotOwner, "you do not own this app")
+		return
+	}
+
+	err = h.Versions.SetRetentionPolicy(appId, *policy)
+	if err != nil {
+		tools.GetLogger(r).Error("setting retention policy of app with ID '%d' failed: %v", appId, err)
+		tools.WriteInternalError(w, r, "setting retention policy failed")
+		return
+	}
+
+	tools.GetLogger(r).Info("user '%s' set the retention policy of app with ID '%d'", user, appId)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handlers) RetentionPolicyGetHandler(w http.ResponseWriter, r *http.Request) {
+	h = h.forRequest(r)
+	appId, ok := h.readOwnedAppId(w, r)
+	if !ok {
+		return
+	}
+
+	policy, err := h.Versions.GetRetentionPolicy(appId)
+	if err != nil {
+		tools.GetLogger(r).Error("getting retention policy of app with ID '%d' failed: %v", appId, err)
+		tools.WriteInternalError(w, r, "getting retention policy failed")
+		return
+	}
+
+	utils.SendJsonResponse(w, policy)
+}
+
+func (h *Handlers) RetentionDryRunHandler(w http.ResponseWriter, r *http.Request) {
+	h = h.forRequest(r)
+	appId, ok := h.readOwnedAppId(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := PruneVersions(h.Versions, h.Webhooks, appId, true, tools.GetLogger(r))
+	if err != nil {
+		tools.GetLogger(r).Error("dry run of pruning versions of app with ID '%d' failed: %v", appId, err)
+		tools.WriteInternalError(w, r, "dry run failed")
+		return
+	}
+
+	utils.SendJsonResponse(w, result)
+}
+
+func (h *Handlers) readOwnedAppId(w http.ResponseWriter, r *http.Request) (int, bool) {
+	user := tools.GetUserFromContext(r)
+	appId, err := apps.ReadBodyAsStringNumber(w, r)
+	if err != nil {
+		return -1, false
+	}
+
+	if !h.Apps.IsAppOwner(user, appId) {
+		tools.GetLogger(r).Warn("user '%s' tried to access the retention policy of app with ID '%d' but does not own it", user, appId)
+		tools.WriteError(w, r, http.StatusUnauthorized, tools.CodeNotOwner, "you do not own this app")
+		return -1, false
+	}
+	return appId, true
+}
@@ -1,19 +1,20 @@
 package versions
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/ocelot-cloud/shared/utils"
-	"ocelot/store/apps"
+	"ocelot/store/config"
 	"ocelot/store/tools"
+	"ocelot/store/users"
 	"strconv"
 	"time"
 )
 
-var VersionRepo VersionRepository = &VersionRepositoryImpl{}
-
 func (u *VersionRepositoryImpl) GetFullVersionInfo(versionId int) (*tools.FullVersionInfo, error) {
 	var fullVersionInfo tools.FullVersionInfo
-	err := tools.Db.QueryRow(`
+	err := u.db.QueryRow(`
 		SELECT users.user_name, apps.app_name, versions.version_name, versions.data, versions.version_id, versions.creation_timestamp
 		FROM versions
 		JOIN apps ON versions.app_id = apps.app_id
@@ -28,29 +29,29 @@ func (u *VersionRepositoryImpl) GetFullVersionInfo(versionId int) (*tools.FullVe
 
 func (u *VersionRepositoryImpl) GetAppIdByVersionId(versionId int) (int, error) {
 	var appId int
-	err := tools.Db.QueryRow("SELECT app_id FROM versions WHERE version_id = $1", versionId).Scan(&appId)
+	err := u.db.QueryRow("SELECT app_id FROM versions WHERE version_id = $1", versionId).Scan(&appId)
 	if err != nil {
-		tools.Logger.Error("Failed to get app ID by version ID %d: %v", versionId, err)
+		u.logger.Error("Failed to get app ID by version ID %d: %v", versionId, err)
 		return -1, fmt.Errorf("failed to get app ID by version ID")
 	}
 	return appId, nil
 }
 
 func (u *VersionRepositoryImpl) IsVersionOwner(user string, versionId int) bool {
-	userId, err := tools.GetUserId(user)
+	userId, err := u.db.GetUserId(user)
 	if err != nil {
-		tools.Logger.Info("Failed to get user ID: %v", err)
+		u.logger.Info("Failed to get user ID: %v", err)
 		return false
 	}
 
 	var ownerId int
-	err = tools.Db.QueryRow(`
+	err = u.db.QueryRow(`
 		SELECT apps.user_id 
 		FROM versions
 		JOIN apps ON versions.app_id = apps.app_id
 		WHERE versions.version_id = $1`, versionId).Scan(&ownerId)
 	if err != nil {
-		tools.Logger.Error("Failed to get version owner ID: %v", err)
+		u.logger.Error("Failed to get version owner ID: %v", err)
 		return false
 	}
 
@@ -59,82 +60,141 @@ func (u *VersionRepositoryImpl) IsVersionOwner(user string, versionId int) bool
 
 func (u *VersionRepositoryImpl) GetVersionContent(versionId int) ([]byte, error) {
 	var data []byte
-	err := tools.Db.QueryRow("SELECT data FROM versions WHERE version_id = $1", versionId).Scan(&data)
+	err := u.db.QueryRow("SELECT data FROM versions WHERE version_id = $1", versionId).Scan(&data)
 	if err != nil {
 		return nil, err
 	}
 	return data, nil
 }
 
-func (u *VersionRepositoryImpl) CreateVersion(appId int, version string, data []byte) error {
-	userId, err := apps.GetUserIdOfApp(appId)
+// VersionLimitExceededError is returned when an app already reached the maximum number of versions.
+type VersionLimitExceededError struct {
+	VersionCount int
+	MaxVersions  int
+}
+
+func (e *VersionLimitExceededError) Error() string {
+	return fmt.Sprintf("this app can't have more than %d versions, please delete a version first", e.MaxVersions)
+}
+
+// CreateVersion checks the quotas of the maintainer and the app and stores the version within one transaction, so
+// that concurrent uploads can't exceed the limits and used_space always matches the stored content.
+func (u *VersionRepositoryImpl) CreateVersion(appId int, version string, data []byte, changelog string) error {
+	userId, err := u.db.GetUserIdOfApp(appId)
 	if err != nil {
 		return err
 	}
 
-	now := time.Now().UTC()
-	_, err = tools.Db.Exec("INSERT INTO versions (app_id, version_name, creation_timestamp, data) VALUES ($1, $2, $3, $4)", appId, version, now, data)
-	if err != nil {
-		return fmt.Errorf("failed to create version: %w", err)
+	if data == nil {
+		// drivers store a nil slice as NULL, which the schema does not allow
+		data = []byte{}
 	}
 
-	dataSize := len(data)
-	_, err = tools.Db.Exec("UPDATE users SET used_space = used_space + $1 WHERE user_id = $2", dataSize, userId)
+	return u.db.RunInTransaction(func(tx *sql.Tx) error {
+		dataSize := len(data)
+		if err := u.checkQuotas(tx, userId, appId, dataSize); err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		_, err = tx.Exec("INSERT INTO versions (app_id, version_name, creation_timestamp, data, changelog) VALUES ($1, $2, $3, $4, $5)", appId, version, now, data, changelog)
+		if tools.IsUniqueViolation(err) {
+			return tools.ErrVersionAlreadyExists
+		} else if err != nil {
+			return fmt.Errorf("failed to create version: %w", err)
+		}
+
+		_, err = tx.Exec("UPDATE users SET used_space = used_space + $1 WHERE user_id = $2", dataSize, userId)
+		if err != nil {
+			return fmt.Errorf("failed to update user space: %w", err)
+		}
+		return nil
+	})
+}
+
+func (u *VersionRepositoryImpl) checkQuotas(tx *sql.Tx, userId, appId, dataSize int) error {
+	usedSpace, err := u.db.LockUsedSpace(tx, userId)
 	if err != nil {
-		return fmt.Errorf("failed to update user space: %w", err)
+		return err
+	}
+
+	var storageLimit int
+	var appStorageLimit, maxVersions sql.NullInt64
+	err = tx.QueryRow(`
+		SELECT COALESCE(u.storage_limit, $2), a.storage_limit, a.max_versions
+		FROM apps a
+		JOIN users u ON u.user_id = a.user_id
+		WHERE a.app_id = $1`, appId, u.config.Quota.DefaultStorageLimit).Scan(&storageLimit, &appStorageLimit, &maxVersions)
+	if errors.Is(err, sql.ErrNoRows) {
+		return tools.ErrAppNotFound
+	} else if err != nil {
+		return fmt.Errorf("failed to get quotas: %w", err)
 	}
 
+	if usedSpace+dataSize > storageLimit {
+		return &users.QuotaExceededError{Scope: users.QuotaScopeUser, UsedBytes: usedSpace, RequestedBytes: dataSize, LimitBytes: storageLimit}
+	}
+	if !appStorageLimit.Valid && !maxVersions.Valid {
+		return nil
+	}
+
+	var appUsedSpace, versionCount int
+	err = tx.QueryRow("SELECT COALESCE(SUM(LENGTH(data)), 0), COUNT(*) FROM versions WHERE app_id = $1", appId).Scan(&appUsedSpace, &versionCount)
+	if err != nil {
+		return fmt.Errorf("failed to get used space of app: %w", err)
+	}
+	if appStorageLimit.Valid && appUsedSpace+dataSize > int(appStorageLimit.Int64) {
+		return &users.QuotaExceededError{Scope: users.QuotaScopeApp, UsedBytes: appUsedSpace, RequestedBytes: dataSize, LimitBytes: int(appStorageLimit.Int64)}
+	}
+	if maxVersions.Valid && versionCount >= int(maxVersions.Int64) {
+		return &VersionLimitExceededError{VersionCount: versionCount, MaxVersions: int(maxVersions.Int64)}
+	}
 	return nil
 }
 
 func (u *VersionRepositoryImpl) DeleteVersion(versionId int) error {
-	dataSize, err := getBlobSize(versionId)
-	if err != nil {
-		return err
-	}
-	appId, err := getAppIdOfVersion(versionId)
+	appId, err := u.getAppIdOfVersion(versionId)
 	if err != nil {
 		return err
 	}
-	userId, err := apps.GetUserIdOfApp(appId)
+	userId, err := u.db.GetUserIdOfApp(appId)
 	if err != nil {
 		return err
 	}
 
-	_, err = tools.Db.Exec("DELETE FROM versions WHERE version_id = $1", versionId)
-	if err != nil {
-		return fmt.Errorf("failed to delete version: %w", err)
-	}
+	return u.db.RunInTransaction(func(tx *sql.Tx) error {
+		if _, err := u.db.LockUsedSpace(tx, userId); err != nil {
+			return err
+		}
 
-	_, err = tools.Db.Exec("UPDATE users SET used_space = used_space - $1 WHERE user_id = $2", dataSize, userId)
-	if err != nil {
-		return fmt.Errorf("failed to update user space: %w", err)
-	}
+		var dataSize int64
+		err := tx.QueryRow("DELETE FROM versions WHERE version_id = $1 RETURNING LENGTH(data)", versionId).Scan(&dataSize)
+		if errors.Is(err, sql.ErrNoRows) {
+			return tools.ErrVersionNotFound
+		} else if err != nil {
+			return fmt.Errorf("failed to delete version: %w", err)
+		}
 
-	return nil
+		_, err = tx.Exec("UPDATE users SET used_space = used_space - $1 WHERE user_id = $2", dataSize, userId)
+		if err != nil {
+			return fmt.Errorf("failed to update user space: %w", err)
+		}
+		return nil
+	})
 }
 
-func getAppIdOfVersion(versionId int) (int, error) {
+func (u *VersionRepositoryImpl) getAppIdOfVersion(versionId int) (int, error) {
 	var appId int
-	err := tools.Db.QueryRow("SELECT app_id FROM versions WHERE version_id = $1", versionId).Scan(&appId)
+	err := u.db.QueryRow("SELECT app_id FROM versions WHERE version_id = $1", versionId).Scan(&appId)
 	if err != nil {
 		return -1, fmt.Errorf("failed to get app ID: %w", err)
 	}
 	return appId, nil
 }
 
-func getBlobSize(versionId int) (int64, error) {
-	var dataSize int64
-	err := tools.Db.QueryRow("SELECT LENGTH(data) FROM versions WHERE version_id = $1", versionId).Scan(&dataSize)
-	if err != nil {
-		return 0, fmt.Errorf("failed to get BLOB size: %w", err)
-	}
-	return dataSize, nil
-}
-
 func (u *VersionRepositoryImpl) GetVersionList(appId int) ([]tools.Version, error) {
 	var exists bool
-	err := tools.Db.QueryRow("SELECT EXISTS(SELECT 1 FROM apps WHERE app_id = $1)", appId).Scan(&exists)
+	err := u.db.QueryRow("SELECT EXISTS(SELECT 1 FROM apps WHERE app_id = $1)", appId).Scan(&exists)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check app existence: %w", err)
 	}
@@ -142,7 +202,7 @@ func (u *VersionRepositoryImpl) GetVersionList(appId int) ([]tools.Version, erro
 		return nil, fmt.Errorf("app with id %d does not exist", appId)
 	}
 
-	rows, err := tools.Db.Query("SELECT version_name, version_id, creation_timestamp FROM versions WHERE app_id = $1 ORDER BY creation_timestamp DESC", appId)
+	rows, err := u.db.Query("SELECT version_name, version_id, creation_timestamp FROM versions WHERE app_id = $1 ORDER BY creation_timestamp DESC, version_id DESC", appId)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get versions: %w", err)
 	}
@@ -173,9 +233,9 @@ func (u *VersionRepositoryImpl) GetVersionList(appId int) ([]tools.Version, erro
 
 func (u *VersionRepositoryImpl) DoesVersionExist(versionId int) bool {
 	var exists bool
-	err := tools.Db.QueryRow(`SELECT EXISTS(SELECT 1 FROM versions WHERE version_id = $1)`, versionId).Scan(&exists)
+	err := u.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM versions WHERE version_id = $1)`, versionId).Scan(&exists)
 	if err != nil {
-		tools.Logger.Debug("error checking if version exists")
+		u.logger.Debug("error checking if version exists")
 		return false
 	}
 	return exists
@@ -183,18 +243,177 @@ func (u *VersionRepositoryImpl) DoesVersionExist(versionId int) bool {
 
 func (u *VersionRepositoryImpl) GetVersionId(appId int, version string) (int, error) {
 	var versionId int
-	err := tools.Db.QueryRow("SELECT version_id FROM versions WHERE app_id = $1 AND version_name = $2", appId, version).Scan(&versionId)
-	if err != nil {
-		return -1, fmt.Errorf("version not found: %w", err)
+	err := u.db.QueryRow("SELECT version_id FROM versions WHERE app_id = $1 AND version_name = $2", appId, version).Scan(&versionId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return -1, tools.ErrVersionNotFound
+	} else if err != nil {
+		return -1, fmt.Errorf("failed to get version ID: %w", err)
 	}
 	return versionId, nil
 }
 
-type VersionRepositoryImpl struct{}
+func (u *VersionRepositoryImpl) GetLatestVersionId(appId int) (int, error) {
+	var versionId int
+	err := u.db.QueryRow("SELECT version_id FROM versions WHERE app_id = $1 ORDER BY creation_timestamp DESC, version_id DESC LIMIT 1", appId).Scan(&versionId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return -1, tools.ErrVersionNotFound
+	} else if err != nil {
+		return -1, fmt.Errorf("failed to get latest version ID: %w", err)
+	}
+	return versionId, nil
+}
+
+func (u *VersionRepositoryImpl) GetVersion(versionId int) (*tools.Version, error) {
+	var name string
+	var creationTimestamp time.Time
+	err := u.db.QueryRow("SELECT version_name, creation_timestamp FROM versions WHERE version_id = $1", versionId).Scan(&name, &creationTimestamp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get version: %w", err)
+	}
+	return &tools.Version{
+		Name:              name,
+		Id:                strconv.Itoa(versionId),
+		CreationTimestamp: creationTimestamp.UTC(),
+	}, nil
+}
+
+// GetVersionSizes returns the size of the content of each version of the app by version ID.
+func (u *VersionRepositoryImpl) GetVersionSizes(appId int) (map[string]int, error) {
+	rows, err := u.db.Query("SELECT version_id, LENGTH(data) FROM versions WHERE app_id = $1", appId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get version sizes: %w", err)
+	}
+	defer utils.Close(rows)
+
+	sizes := map[string]int{}
+	for rows.Next() {
+		var versionId, size int
+		if err := rows.Scan(&versionId, &size); err != nil {
+			return nil, fmt.Errorf("failed to scan version size: %w", err)
+		}
+		sizes[strconv.Itoa(versionId)] = size
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return sizes, nil
+}
+
+func (u *VersionRepositoryImpl) SetRetentionPolicy(appId int, policy tools.RetentionPolicy) error {
+	_, err := u.db.Exec(`
+		INSERT INTO retention_policies (app_id, keep_last, keep_days, keep_latest_per_major) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (app_id) DO UPDATE SET keep_last = excluded.keep_last, keep_days = excluded.keep_days, keep_latest_per_major = excluded.keep_latest_per_major`,
+		appId, tools.NilIfZero(policy.KeepLast), tools.NilIfZero(policy.KeepDays), policy.KeepLatestPerMajor)
+	if err != nil {
+		u.logger.Error("Failed to set retention policy: %v", err)
+		return fmt.Errorf("failed to set retention policy")
+	}
+	return nil
+}
+
+// GetRetentionPolicy returns the retention policy of the app, which has no rules if none was set.
+func (u *VersionRepositoryImpl) GetRetentionPolicy(appId int) (*tools.RetentionPolicy, error) {
+	policy := &tools.RetentionPolicy{AppId: strconv.Itoa(appId)}
+	var keepLast, keepDays sql.NullInt64
+	err := u.db.QueryRow("SELECT keep_last, keep_days, keep_latest_per_major FROM retention_policies WHERE app_id = $1", appId).Scan(&keepLast, &keepDays, &policy.KeepLatestPerMajor)
+	if errors.Is(err, sql.ErrNoRows) {
+		return policy, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get retention policy: %w", err)
+	}
+	policy.KeepLast = int(keepLast.Int64)
+	policy.KeepDays = int(keepDays.Int64)
+	return policy, nil
+}
+
+func (u *VersionRepositoryImpl) GetAppIdsWithRetentionPolicy() ([]int, error) {
+	rows, err := u.db.Query("SELECT app_id FROM retention_policies")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get apps with retention policy: %w", err)
+	}
+	defer utils.Close(rows)
+
+	var appIds []int
+	for rows.Next() {
+		var appId int
+		if err := rows.Scan(&appId); err != nil {
+			return nil, fmt.Errorf("failed to scan app ID: %w", err)
+		}
+		appIds = append(appIds, appId)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return appIds, nil
+}
+
+// GetReleases returns the newest versions, newest first. Empty maintainer or app names don't restrict the result.
+func (u *VersionRepositoryImpl) GetReleases(maintainer, app string, limit int) ([]tools.Release, error) {
+	query := `
+		SELECT u.user_name, a.app_id, a.app_name, v.version_id, v.version_name, v.changelog, v.creation_timestamp
+		FROM versions v
+		JOIN apps a ON v.app_id = a.app_id
+		JOIN users u ON a.user_id = u.user_id
+		WHERE 1 = 1`
+	var args []any
+	if maintainer != "" {
+		args = append(args, maintainer)
+		query += fmt.Sprintf(" AND u.user_name = $%d", len(args))
+	}
+	if app != "" {
+		args = append(args, app)
+		query += fmt.Sprintf(" AND a.app_name = $%d", len(args))
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY v.creation_timestamp DESC, v.version_id DESC LIMIT $%d", len(args))
+
+	rows, err := u.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get releases: %w", err)
+	}
+	defer utils.Close(rows)
+
+	releases := []tools.Release{}
+	for rows.Next() {
+		var release tools.Release
+		if err := rows.Scan(&release.Maintainer, &release.AppId, &release.AppName, &release.VersionId, &release.VersionName, &release.Changelog, &release.CreationTimestamp); err != nil {
+			return nil, fmt.Errorf("failed to scan release: %w", err)
+		}
+		release.CreationTimestamp = release.CreationTimestamp.UTC()
+		releases = append(releases, release)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return releases, nil
+}
+
+type VersionRepositoryImpl struct {
+	db     *tools.Database
+	config *config.Config
+	logger utils.LoggerType
+}
+
+func (u *VersionRepositoryImpl) CountVersions() (int, error) {
+	var count int
+	if err := u.db.QueryRow("SELECT COUNT(*) FROM versions").Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count versions: %w", err)
+	}
+	return count, nil
+}
+
+func NewVersionRepository(db *tools.Database, cfg *config.Config, logger utils.LoggerType) *VersionRepositoryImpl {
+	return &VersionRepositoryImpl{db: db, config: cfg, logger: logger}
+}
+
+func (u *VersionRepositoryImpl) WithLogger(logger utils.LoggerType) VersionRepository {
+	return &VersionRepositoryImpl{db: u.db, config: u.config, logger: logger}
+}
 
 type VersionRepository interface {
 	IsVersionOwner(user string, versionId int) bool
-	CreateVersion(appId int, version string, data []byte) error
+	// CreateVersion stores the version, the changelog may be empty.
+	CreateVersion(appId int, version string, data []byte, changelog string) error
 	GetVersionId(appId int, version string) (int, error)
 	DeleteVersion(versionId int) error
 	GetVersionList(appId int) ([]tools.Version, error)
@@ -202,4 +421,14 @@ type VersionRepository interface {
 	GetVersionContent(versionId int) ([]byte, error)
 	GetAppIdByVersionId(versionId int) (int, error)
 	GetFullVersionInfo(versionId int) (*tools.FullVersionInfo, error)
+	GetLatestVersionId(appId int) (int, error)
+	GetVersion(versionId int) (*tools.Version, error)
+	GetVersionSizes(appId int) (map[string]int, error)
+	SetRetentionPolicy(appId int, policy tools.RetentionPolicy) error
+	GetRetentionPolicy(appId int) (*tools.RetentionPolicy, error)
+	GetAppIdsWithRetentionPolicy() ([]int, error)
+	CountVersions() (int, error)
+	GetReleases(maintainer, app string, limit int) ([]tools.Release, error)
+	// WithLogger returns a copy of the repository logging with the given logger, e.g. the one of the request being handled.
+	WithLogger(logger utils.LoggerType) VersionRepository
 }
@@ -0,0 +1,125 @@
+package versions
+
+import (
+	"context"
+	"github.com/ocelot-cloud/shared/utils"
+	"ocelot/store/tools"
+	"ocelot/store/webhooks"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var majorVersionPattern = regexp.MustCompile(`^(\d+)(\.|$)`)
+
+// SelectVersionsToPrune returns the versions which are not kept by any rule of the policy. The versions must be
+// ordered from newest to oldest. The newest version is never pruned.
+func SelectVersionsToPrune(policy tools.RetentionPolicy, versions []tools.Version, now time.Time) []tools.Version {
+	toPrune := []tools.Version{}
+	if !hasRules(policy) {
+		return toPrune
+	}
+
+	seenMajorVersions := map[string]bool{}
+	for i, version := range versions {
+		keep := i == 0
+		if i < policy.KeepLast {
+			keep = true
+		}
+		if policy.KeepDays > 0 && version.CreationTimestamp.After(now.AddDate(0, 0, -policy.KeepDays)) {
+			keep = true
+		}
+		if major, found := getMajorVersion(version.Name); policy.KeepLatestPerMajor && found && !seenMajorVersions[major] {
+			seenMajorVersions[major] = true
+			keep = true
+		}
+		if !keep {
+			toPrune = append(toPrune, version)
+		}
+	}
+	return toPrune
+}
+
+func hasRules(policy tools.RetentionPolicy) bool {
+	return policy.KeepLast > 0 || policy.KeepDays > 0 || policy.KeepLatestPerMajor
+}
+
+// getMajorVersion returns the leading number of a version name like "2" for "2.1.0". Names without a leading
+// number have no major version and are therefore not kept by the "latest per major version" rule.
+func getMajorVersion(versionName string) (string, bool) {
+	match := majorVersionPattern.FindStringSubmatch(versionName)
+	if match == nil {
+		return "", false
+	}
+	major, err := strconv.Atoi(match[1])
+	if err != nil {
+		return "", false
+	}
+	return strconv.Itoa(major), true
+}
+
+// PruneVersions applies the retention policy of the app. In a dry run, the versions are only selected but not deleted.
+// Otherwise, the deletion of each version is announced to the webhooks.
+func PruneVersions(repo VersionRepository, dispatcher *webhooks.Dispatcher, appId int, dryRun bool, logger utils.LoggerType) (*tools.PruneResult, error) {
+	policy, err := repo.GetRetentionPolicy(appId)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := repo.GetVersionList(appId)
+	if err != nil {
+		return nil, err
+	}
+	sizes, err := repo.GetVersionSizes(appId)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &tools.PruneResult{AppId: strconv.Itoa(appId), Versions: SelectVersionsToPrune(*policy, versions, time.Now().UTC())}
+	for _, version := range result.Versions {
+		result.FreedBytes += sizes[version.Id]
+		if dryRun {
+			continue
+		}
+		versionId, err := strconv.Atoi(version.Id)
+		if err != nil {
+			return nil, err
+		}
+		event, err := getVersionEvent(repo, tools.WebhookEventVersionDeleted, versionId)
+		if err != nil {
+			return nil, err
+		}
+		if err = repo.DeleteVersion(versionId); err != nil {
+			return nil, err
+		}
+		logger.Info("pruned version '%s' of app with ID '%d' due to its retention policy", version.Name, appId)
+		dispatcher.Notify(logger, *event)
+	}
+	return result, nil
+}
+
+// RunVersionPruner applies the retention policies of all apps right away and then in the given interval until ctx is done.
+func RunVersionPruner(ctx context.Context, repo VersionRepository, dispatcher *webhooks.Dispatcher, interval time.Duration, logger utils.LoggerType) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		pruneAllApps(repo, dispatcher, logger)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func pruneAllApps(repo VersionRepository, dispatcher *webhooks.Dispatcher, logger utils.LoggerType) {
+	appIds, err := repo.GetAppIdsWithRetentionPolicy()
+	if err != nil {
+		logger.Error("version pruning failed: %v", err)
+		return
+	}
+	for _, appId := range appIds {
+		if _, err = PruneVersions(repo, dispatcher, appId, false, logger); err != nil {
+			logger.Error("version pruning of app with ID '%d' failed: %v", appId, err)
+		}
+	}
+}
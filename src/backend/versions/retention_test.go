@@ -0,0 +1,73 @@
+package versions
+
+import (
+	"github.com/ocelot-cloud/shared/assert"
+	"ocelot/store/tools"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+func getSampleVersions() []tools.Version {
+	return []tools.Version{
+		{Id: "6", Name: "3.0.0", CreationTimestamp: now.AddDate(0, 0, -1)},
+		{Id: "5", Name: "2.1.0", CreationTimestamp: now.AddDate(0, 0, -5)},
+		{Id: "4", Name: "2.0.0", CreationTimestamp: now.AddDate(0, 0, -10)},
+		{Id: "3", Name: "1.1.0", CreationTimestamp: now.AddDate(0, 0, -20)},
+		{Id: "2", Name: "1.0.0", CreationTimestamp: now.AddDate(0, 0, -30)},
+		{Id: "1", Name: "nightly", CreationTimestamp: now.AddDate(0, 0, -40)},
+	}
+}
+
+func getIds(versions []tools.Version) []string {
+	ids := []string{}
+	for _, version := range versions {
+		ids = append(ids, version.Id)
+	}
+	return ids
+}
+
+func TestNothingIsPrunedWithoutRules(t *testing.T) {
+	policy := tools.RetentionPolicy{}
+	assert.Equal(t, []string{}, getIds(SelectVersionsToPrune(policy, getSampleVersions(), now)))
+}
+
+func TestKeepLast(t *testing.T) {
+	policy := tools.RetentionPolicy{KeepLast: 2}
+	assert.Equal(t, []string{"4", "3", "2", "1"}, getIds(SelectVersionsToPrune(policy, getSampleVersions(), now)))
+}
+
+func TestKeepDays(t *testing.T) {
+	policy := tools.RetentionPolicy{KeepDays: 15}
+	assert.Equal(t, []string{"3", "2", "1"}, getIds(SelectVersionsToPrune(policy, getSampleVersions(), now)))
+}
+
+func TestKeepLatestPerMajor(t *testing.T) {
+	policy := tools.RetentionPolicy{KeepLatestPerMajor: true}
+	assert.Equal(t, []string{"4", "2", "1"}, getIds(SelectVersionsToPrune(policy, getSampleVersions(), now)))
+}
+
+func TestRulesAreCombined(t *testing.T) {
+	policy := tools.RetentionPolicy{KeepLast: 1, KeepDays: 7, KeepLatestPerMajor: true}
+	assert.Equal(t, []string{"4", "2", "1"}, getIds(SelectVersionsToPrune(policy, getSampleVersions(), now)))
+}
+
+func TestLatestVersionIsNeverPruned(t *testing.T) {
+	policy := tools.RetentionPolicy{KeepDays: 1}
+	versions := getSampleVersions()[1:]
+	assert.Equal(t, []string{"4", "3", "2", "1"}, getIds(SelectVersionsToPrune(policy, versions, now)))
+}
+
+func TestGetMajorVersion(t *testing.T) {
+	major, found := getMajorVersion("12.3.4")
+	assert.True(t, found)
+	assert.Equal(t, "12", major)
+	major, found = getMajorVersion("007")
+	assert.True(t, found)
+	assert.Equal(t, "7", major)
+	_, found = getMajorVersion("1a.0")
+	assert.False(t, found)
+	_, found = getMajorVersion("nightly")
+	assert.False(t, found)
+}
@@ -0,0 +1,260 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/ocelot-cloud/shared/utils"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"ocelot/store/config"
+	"ocelot/store/metrics"
+	"ocelot/store/tools"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// deliveryBatchSize is the number of due deliveries fetched from the queue at once.
+	deliveryBatchSize = 50
+	// maxConcurrentDeliveries is the number of deliveries sent at the same time.
+	maxConcurrentDeliveries = 10
+	// maxResponseSize is how much of a response body is read so that the connection can be reused.
+	maxResponseSize = 64 * 1024
+	userAgent       = "ocelot-store-webhooks"
+)
+
+// Dispatcher queues webhook events and delivers them in the background. Since the queue is stored in the database,
+// pending deliveries survive restarts. Deliveries that fail are retried with exponential backoff until they succeed
+// or the maximum number of attempts is reached.
+type Dispatcher struct {
+	repo    WebhookRepository
+	config  config.WebhooksConfig
+	metrics *metrics.Metrics
+	logger  utils.LoggerType
+	client  *http.Client
+	wake    chan struct{}
+}
+
+func NewDispatcher(repo WebhookRepository, cfg config.WebhooksConfig, metrics *metrics.Metrics, logger utils.LoggerType) *Dispatcher {
+	return &Dispatcher{
+		repo:    repo,
+		config:  cfg,
+		metrics: metrics,
+		logger:  logger,
+		client:  newClient(cfg),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// newClient returns a client which does not follow redirects, so that a receiver cannot redirect deliveries to
+// addresses which would be rejected otherwise.
+func newClient(cfg config.WebhooksConfig) *http.Client {
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivateAddresses {
+		dialer.Control = rejectNonPublicAddress
+	}
+	return &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: cfg.Timeout},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// reservedPrefixes are the special-purpose ranges which are global unicast addresses to netip but are not reachable on
+// the internet, are used for internal services like cloud metadata, or embed IPv4 addresses which might be internal.
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // this network
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, including the broadcast address
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local NAT64
+	netip.MustParsePrefix("100::/64"),        // discard
+	netip.MustParsePrefix("2001::/23"),       // IETF protocol assignments, including Teredo
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+	netip.MustParsePrefix("2002::/16"),       // 6to4
+	netip.MustParsePrefix("fec0::/10"),       // site-local
+}
+
+// rejectNonPublicAddress is called with the resolved address right before connecting, so it also covers host names
+// resolving to internal addresses.
+func rejectNonPublicAddress(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return fmt.Errorf("address %s is not public", ip)
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(ip) {
+			return fmt.Errorf("address %s is not public", ip)
+		}
+	}
+	return nil
+}
+
+// Sign returns the value of the signature header of a delivery with the given body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Notify queues the event for all webhooks interested in it. Failures are only logged, since the action causing the
+// event already succeeded. The logger is the one of the request or job causing the event.
+func (d *Dispatcher) Notify(logger utils.LoggerType, event tools.WebhookEvent) {
+	event.Timestamp = time.Now().UTC()
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logger.Error("encoding webhook event '%s' failed: %v", event.Event, err)
+		return
+	}
+	count, err := d.repo.WithLogger(logger).EnqueueDeliveries(event.Maintainer, event.Event, payload, event.Timestamp)
+	if err != nil {
+		logger.Error("queueing webhook event '%s' failed: %v", event.Event, err)
+		return
+	}
+	if count > 0 {
+		logger.Debug("queued webhook event '%s' for %d webhooks", event.Event, count)
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run delivers queued events as soon as they are added and checks for due retries in the poll interval until ctx is
+// done. Old deliveries are removed from the history in the same interval.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		d.deliverDueEvents(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wake:
+		case <-ticker.C:
+			d.deleteOldDeliveries()
+		}
+	}
+}
+
+// deliverDueEvents sends the due deliveries batch by batch. The deliveries of a batch are sent concurrently, so a
+// receiver which only answers after the timeout holds up a single slot instead of the whole queue. The next batch is
+// fetched once the current one is finished, so that no delivery is sent twice at the same time.
+func (d *Dispatcher) deliverDueEvents(ctx context.Context) {
+	slots := make(chan struct{}, maxConcurrentDeliveries)
+	for ctx.Err() == nil {
+		deliveries, err := d.repo.GetDueDeliveries(time.Now().UTC(), deliveryBatchSize)
+		if err != nil {
+			d.logger.Error("getting due webhook deliveries failed: %v", err)
+			return
+		}
+		var wg sync.WaitGroup
+		for _, delivery := range deliveries {
+			slots <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-slots }()
+				d.deliver(ctx, delivery)
+			}()
+		}
+		wg.Wait()
+		if len(deliveries) < deliveryBatchSize {
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, delivery PendingDelivery) {
+	statusCode, err := d.send(ctx, delivery)
+	if ctx.Err() != nil {
+		// The store is shutting down, the delivery is attempted again after the restart.
+		return
+	}
+	d.metrics.CountWebhookAttempt(err == nil)
+
+	attempt := Attempt{Status: tools.WebhookStatusDelivered, StatusCode: statusCode, Time: time.Now().UTC()}
+	if err != nil {
+		attempt.Error = err.Error()
+		attemptNumber := delivery.Attempts + 1
+		if attemptNumber >= d.config.MaxAttempts {
+			attempt.Status = tools.WebhookStatusFailed
+			d.logger.Warn("delivering webhook event '%s' to webhook with ID '%d' failed for the last time after %d attempts: %v", delivery.Event, delivery.WebhookId, attemptNumber, err)
+		} else {
+			attempt.Status = tools.WebhookStatusPending
+			attempt.NextAttempt = attempt.Time.Add(backoff(attemptNumber, d.config.InitialBackoff, d.config.MaxBackoff))
+			d.logger.Info("delivering webhook event '%s' to webhook with ID '%d' failed, retrying at %s: %v", delivery.Event, delivery.WebhookId, attempt.NextAttempt.Format(time.RFC3339), err)
+		}
+	}
+
+	if err = d.repo.RecordAttempt(delivery.Id, attempt); err != nil {
+		d.logger.Error("recording attempt of webhook delivery with ID '%d' failed: %v", delivery.Id, err)
+	}
+}
+
+// send posts the delivery to the webhook and returns the status code of the response, which is 0 if there was none.
+func (d *Dispatcher) send(ctx context.Context, delivery PendingDelivery) (int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("invalid request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", userAgent)
+	request.Header.Set(tools.WebhookEventHeader, delivery.Event)
+	request.Header.Set(tools.WebhookDeliveryHeader, strconv.Itoa(delivery.Id))
+	request.Header.Set(tools.WebhookSignatureHeader, Sign(delivery.Secret, delivery.Payload))
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer utils.Close(response.Body)
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, maxResponseSize))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("receiver responded with status code %d", response.StatusCode)
+	}
+	return response.StatusCode, nil
+}
+
+// backoff returns the delay before the next attempt, which doubles with every failed attempt up to the maximum.
+func backoff(failedAttempts int, initial, maximum time.Duration) time.Duration {
+	delay := initial
+	for i := 1; i < failedAttempts && delay < maximum; i++ {
+		delay *= 2
+	}
+	return min(delay, maximum)
+}
+
+func (d *Dispatcher) deleteOldDeliveries() {
+	count, err := d.repo.DeleteFinishedDeliveriesBefore(time.Now().UTC().Add(-d.config.HistoryRetention))
+	if err != nil {
+		d.logger.Error("deleting old webhook deliveries failed: %v", err)
+	} else if count > 0 {
+		d.logger.Info("deleted %d old webhook deliveries", count)
+	}
+}
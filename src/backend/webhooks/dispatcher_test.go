@@ -0,0 +1,131 @@
+package webhooks
+
+import (
+	"context"
+	"github.com/ocelot-cloud/shared/assert"
+	"github.com/ocelot-cloud/shared/utils"
+	"net/http"
+	"net/http/httptest"
+	"ocelot/store/config"
+	"ocelot/store/metrics"
+	"ocelot/store/tools"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackoffDoublesUpToMaximum(t *testing.T) {
+	var delays []time.Duration
+	for attempt := 1; attempt <= 6; attempt++ {
+		delays = append(delays, backoff(attempt, time.Minute, 10*time.Minute))
+	}
+	assert.Equal(t, []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 10 * time.Minute, 10 * time.Minute}, delays)
+	assert.Equal(t, 10*time.Minute, backoff(1000, time.Minute, 10*time.Minute))
+}
+
+func TestSignature(t *testing.T) {
+	// expected value computed with: printf '{"event":"app.deleted"}' | openssl dgst -sha256 -hmac 0123456789abcdef
+	assert.Equal(t, "sha256=6e0b425bfececb714c2389a050738faa4f4ad10eeba64c2b5ee65cd311b13f4a", Sign("0123456789abcdef", []byte(`{"event":"app.deleted"}`)))
+}
+
+func TestNonPublicAddressesAreRejected(t *testing.T) {
+	for _, address := range []string{"127.0.0.1:80", "[::1]:443", "10.1.2.3:80", "192.168.0.1:80", "169.254.169.254:80", "0.0.0.0:80", "[::ffff:127.0.0.1]:80", "[fd00::1]:80",
+		"0.1.2.3:80", "100.64.0.1:80", "100.127.255.254:80", "[::ffff:100.100.100.200]:80", "198.18.0.1:80", "198.19.255.255:80", "192.0.0.1:80",
+		"203.0.113.1:80", "240.0.0.1:80", "255.255.255.255:80", "224.0.0.1:80", "[64:ff9b::a00:1]:80", "[2002:a00:1::1]:80", "[2001:db8::1]:80", "[fec0::1]:80", "[ff02::1]:80"} {
+		assert.NotNil(t, rejectNonPublicAddress("tcp", address, nil))
+	}
+	for _, address := range []string{"93.184.215.14:443", "[2606:2800:21f:cb07:6820:80da:af6b:8b2c]:443", "100.63.255.255:443", "100.128.0.1:443", "198.17.255.255:443", "198.20.0.1:443"} {
+		assert.Nil(t, rejectNonPublicAddress("tcp", address, nil))
+	}
+}
+
+func TestClientDoesNotReachPrivateAddressesUnlessAllowed(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	cfg := config.Default().Webhooks
+	_, err := newClient(cfg).Post(receiver.URL, "application/json", strings.NewReader("{}"))
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "is not public"))
+
+	cfg.AllowPrivateAddresses = true
+	response, err := newClient(cfg).Post(receiver.URL, "application/json", strings.NewReader("{}"))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNoContent, response.StatusCode)
+}
+
+func TestClientDoesNotFollowRedirects(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/", http.StatusFound)
+	}))
+	defer receiver.Close()
+
+	cfg := config.Default().Webhooks
+	cfg.AllowPrivateAddresses = true
+	response, err := newClient(cfg).Post(receiver.URL, "application/json", strings.NewReader("{}"))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusFound, response.StatusCode)
+}
+
+// queueRepository returns the queued deliveries once and records the attempts, the other methods are not used by the
+// dispatcher.
+type queueRepository struct {
+	WebhookRepository
+	mutex    sync.Mutex
+	queue    []PendingDelivery
+	attempts map[int]Attempt
+}
+
+func (q *queueRepository) GetDueDeliveries(_ time.Time, limit int) ([]PendingDelivery, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	due := q.queue[:min(limit, len(q.queue))]
+	q.queue = q.queue[len(due):]
+	return due, nil
+}
+
+func (q *queueRepository) RecordAttempt(deliveryId int, attempt Attempt) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.attempts[deliveryId] = attempt
+	return nil
+}
+
+func TestHangingReceiverDoesNotHoldUpOtherDeliveries(t *testing.T) {
+	release := make(chan struct{})
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer hanging.Close()
+	var delivered atomic.Int32
+	responsive := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if delivered.Add(1) == 3 {
+			close(release)
+		}
+	}))
+	defer responsive.Close()
+
+	repo := &queueRepository{attempts: map[int]Attempt{}}
+	repo.queue = append(repo.queue, PendingDelivery{Id: 1, Url: hanging.URL})
+	for id := 2; id <= 4; id++ {
+		repo.queue = append(repo.queue, PendingDelivery{Id: id, Url: responsive.URL})
+	}
+	cfg := config.Default().Webhooks
+	cfg.AllowPrivateAddresses = true
+	cfg.Timeout = 5 * time.Second
+	dispatcher := NewDispatcher(repo, cfg, metrics.New(), utils.ProvideLogger("DEBUG"))
+
+	// The hanging receiver only answers once the other deliveries arrived, so sending one after the other would run
+	// into the timeout.
+	start := time.Now()
+	dispatcher.deliverDueEvents(context.Background())
+	assert.True(t, time.Since(start) < cfg.Timeout)
+	assert.Equal(t, 4, len(repo.attempts))
+	for id := 1; id <= 4; id++ {
+		assert.Equal(t, tools.WebhookStatusDelivered, repo.attempts[id].Status)
+	}
+}
@@ -0,0 +1,156 @@
+package webhooks
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ocelot-cloud/shared/utils"
+	"net/http"
+	"net/url"
+	"ocelot/store/config"
+	"ocelot/store/tools"
+	"strconv"
+)
+
+// maxHistorySize is the number of deliveries returned by the delivery history of a webhook.
+const maxHistorySize = 100
+
+// Handlers serve the webhook routes using the given repository.
+type Handlers struct {
+	Webhooks WebhookRepository
+	Config   *config.Config
+}
+
+// forRequest returns a copy of the handlers whose repositories log with the logger of the request, so that their lines
+// carry the request ID.
+func (h *Handlers) forRequest(r *http.Request) *Handlers {
+	logger := tools.GetLogger(r)
+	bound := *h
+	bound.Webhooks = h.Webhooks.WithLogger(logger)
+	return &bound
+}
+
+func (h *Handlers) WebhookCreationHandler(w http.ResponseWriter, r *http.Request) {
+	h = h.forRequest(r)
+	user := tools.GetUserFromContext(r)
+
+	creation, err := tools.ReadBody[tools.WebhookCreation](w, r)
+	if err != nil {
+		return
+	}
+
+	if !isValidWebhookUrl(creation.Url) {
+		tools.HandleInvalidInput(w, r, errors.New("url must be an absolute http or https URL without credentials"))
+		return
+	}
+
+	if creation.AllApps && !h.Config.Quota.IsAdmin(user) {
+		tools.GetLogger(r).Warn("user '%s' tried to create a webhook for all apps but is not an admin", user)
+		tools.WriteError(w, r, http.StatusForbidden, tools.CodeNotAdmin, "only admins may create webhooks for all apps")
+		return
+	}
+
+	count, err := h.Webhooks.CountWebhooks(user)
+	if err != nil {
+		tools.GetLogger(r).Error("counting webhooks of user '%s' failed: %v", user, err)
+		tools.WriteInternalError(w, r, "webhook creation failed")
+		return
+	}
+	if count >= h.Config.Webhooks.MaxPerUser {
+		tools.GetLogger(r).Info("user '%s' tried to create a webhook but already has %d", user, count)
+		tools.WriteErrorWithDetails(w, r, http.StatusConflict, tools.CodeWebhookLimitExceeded, fmt.Sprintf("you can't have more than %d webhooks, please delete a webhook first", h.Config.Webhooks.MaxPerUser),
+			map[string]any{"max_webhooks": h.Config.Webhooks.MaxPerUser})
+		return
+	}
+
+	webhook, err := h.Webhooks.CreateWebhook(user, *creation)
+	if err != nil {
+		tools.GetLogger(r).Error("user '%s' failed to create a webhook: %v", user, err)
+		tools.WriteInternalError(w, r, "webhook creation failed")
+		return
+	}
+
+	tools.GetLogger(r).Info("user '%s' created webhook with ID '%s'", user, webhook.Id)
+	utils.SendJsonResponse(w, webhook)
+}
+
+func isValidWebhookUrl(webhookUrl string) bool {
+	parsed, err := url.Parse(webhookUrl)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Hostname() != "" && parsed.User == nil
+}
+
+func (h *Handlers) WebhookListHandler(w http.ResponseWriter, r *http.Request) {
+	h = h.forRequest(r)
+	user := tools.GetUserFromContext(r)
+
+	webhooks, err := h.Webhooks.GetWebhooks(user)
+	if err != nil {
+		tools.GetLogger(r).Error("getting webhooks of user '%s' failed: %v", user, err)
+		tools.WriteInternalError(w, r, "error getting webhooks")
+		return
+	}
+
+	utils.SendJsonResponse(w, webhooks)
+}
+
+func (h *Handlers) WebhookDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	h = h.forRequest(r)
+	user := tools.GetUserFromContext(r)
+	webhookId, ok := h.readOwnedWebhookId(w, r, user)
+	if !ok {
+		return
+	}
+
+	if err := h.Webhooks.DeleteWebhook(webhookId); err != nil {
+		tools.GetLogger(r).Error("user '%s' failed to delete webhook with ID '%d': %v", user, webhookId, err)
+		tools.WriteInternalError(w, r, "webhook deletion failed")
+		return
+	}
+
+	tools.GetLogger(r).Info("user '%s' deleted webhook with ID '%d'", user, webhookId)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handlers) WebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	h = h.forRequest(r)
+	user := tools.GetUserFromContext(r)
+	webhookId, ok := h.readOwnedWebhookId(w, r, user)
+	if !ok {
+		return
+	}
+
+	deliveries, err := h.Webhooks.GetDeliveries(webhookId, maxHistorySize)
+	if err != nil {
+		tools.GetLogger(r).Error("getting deliveries of webhook with ID '%d' failed: %v", webhookId, err)
+		tools.WriteInternalError(w, r, "error getting webhook deliveries")
+		return
+	}
+
+	utils.SendJsonResponse(w, deliveries)
+}
+
+// readOwnedWebhookId reads the webhook ID from the request body and checks that the webhook belongs to the user. If
+// not, an error response is written.
+func (h *Handlers) readOwnedWebhookId(w http.ResponseWriter, r *http.Request, user string) (int, bool) {
+	webhookIdString, err := tools.ReadBody[tools.NumberString](w, r)
+	if err != nil {
+		return -1, false
+	}
+	webhookId, err := strconv.Atoi(webhookIdString.Value)
+	if err != nil {
+		tools.WriteError(w, r, http.StatusBadRequest, tools.CodeInvalidInput, "could not convert to number")
+		return -1, false
+	}
+
+	if !h.Webhooks.DoesWebhookExist(webhookId) {
+		tools.GetLogger(r).Info("user '%s' tried to access webhook with ID '%d' but it does not exist", user, webhookId)
+		tools.WriteError(w, r, http.StatusNotFound, tools.CodeWebhookNotFound, "webhook does not exist")
+		return -1, false
+	}
+
+	if !h.Webhooks.IsWebhookOwner(user, webhookId) {
+		tools.GetLogger(r).Warn("user '%s' tried to access webhook with ID '%d' but does not own it", user, webhookId)
+		tools.WriteError(w, r, http.StatusUnauthorized, tools.CodeNotOwner, "you do not own this webhook")
+		return -1, false
+	}
+	return webhookId, true
+}
@@ -0,0 +1,294 @@
+package webhooks
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/ocelot-cloud/shared/utils"
+	"ocelot/store/tools"
+	"strconv"
+	"time"
+)
+
+// PendingDelivery is a queued delivery together with the webhook it is sent to.
+type PendingDelivery struct {
+	Id        int
+	WebhookId int
+	Url       string
+	Secret    string
+	Event     string
+	Payload   []byte
+	Attempts  int
+}
+
+// Attempt is the outcome of sending a delivery. NextAttempt is only relevant if the delivery is still pending.
+type Attempt struct {
+	Status      string
+	StatusCode  int
+	Error       string
+	Time        time.Time
+	NextAttempt time.Time
+}
+
+type WebhookRepository interface {
+	CreateWebhook(user string, webhook tools.WebhookCreation) (*tools.Webhook, error)
+	GetWebhooks(user string) ([]tools.Webhook, error)
+	CountWebhooks(user string) (int, error)
+	DoesWebhookExist(webhookId int) bool
+	IsWebhookOwner(user string, webhookId int) bool
+	DeleteWebhook(webhookId int) error
+	// EnqueueDeliveries queues the event for all webhooks of the maintainer and all webhooks receiving the events of
+	// all apps. It returns the number of queued deliveries.
+	EnqueueDeliveries(maintainer, event string, payload []byte, now time.Time) (int, error)
+	GetDueDeliveries(now time.Time, limit int) ([]PendingDelivery, error)
+	RecordAttempt(deliveryId int, attempt Attempt) error
+	// GetDeliveries returns the latest deliveries of the webhook, newest first.
+	GetDeliveries(webhookId int, limit int) ([]tools.WebhookDelivery, error)
+	// DeleteFinishedDeliveriesBefore removes delivered and failed deliveries created before the given time from the
+	// history. Pending deliveries are kept.
+	DeleteFinishedDeliveriesBefore(before time.Time) (int, error)
+	// WithLogger returns a copy of the repository logging with the given logger, e.g. the one of the request being handled.
+	WithLogger(logger utils.LoggerType) WebhookRepository
+}
+
+type WebhookRepositoryImpl struct {
+	db     *tools.Database
+	logger utils.LoggerType
+}
+
+func NewWebhookRepository(db *tools.Database, logger utils.LoggerType) *WebhookRepositoryImpl {
+	return &WebhookRepositoryImpl{db: db, logger: logger}
+}
+
+func (u *WebhookRepositoryImpl) WithLogger(logger utils.LoggerType) WebhookRepository {
+	return &WebhookRepositoryImpl{db: u.db, logger: logger}
+}
+
+func (u *WebhookRepositoryImpl) CreateWebhook(user string, webhook tools.WebhookCreation) (*tools.Webhook, error) {
+	userId, err := u.db.GetUserId(user)
+	if err != nil {
+		return nil, err
+	}
+
+	created := &tools.Webhook{Url: webhook.Url, AllApps: webhook.AllApps, CreationTimestamp: time.Now().UTC()}
+	var webhookId int
+	err = u.db.QueryRow("INSERT INTO webhooks (user_id, url, secret, all_apps, creation_timestamp) VALUES ($1, $2, $3, $4, $5) RETURNING webhook_id",
+		userId, webhook.Url, webhook.Secret, webhook.AllApps, created.CreationTimestamp).Scan(&webhookId)
+	if err != nil {
+		u.logger.Error("Failed to create webhook: %v", err)
+		return nil, fmt.Errorf("failed to create webhook")
+	}
+	created.Id = strconv.Itoa(webhookId)
+	return created, nil
+}
+
+func (u *WebhookRepositoryImpl) GetWebhooks(user string) ([]tools.Webhook, error) {
+	rows, err := u.db.Query(`
+		SELECT webhooks.webhook_id, webhooks.url, webhooks.all_apps, webhooks.creation_timestamp
+		FROM webhooks
+		JOIN users ON webhooks.user_id = users.user_id
+		WHERE users.user_name = $1
+		ORDER BY webhooks.webhook_id`, user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhooks: %w", err)
+	}
+	defer utils.Close(rows)
+
+	webhooks := []tools.Webhook{}
+	for rows.Next() {
+		var webhook tools.Webhook
+		var webhookId int
+		if err = rows.Scan(&webhookId, &webhook.Url, &webhook.AllApps, &webhook.CreationTimestamp); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		webhook.Id = strconv.Itoa(webhookId)
+		webhooks = append(webhooks, webhook)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return webhooks, nil
+}
+
+func (u *WebhookRepositoryImpl) CountWebhooks(user string) (int, error) {
+	var count int
+	err := u.db.QueryRow("SELECT COUNT(*) FROM webhooks JOIN users ON webhooks.user_id = users.user_id WHERE users.user_name = $1", user).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count webhooks: %w", err)
+	}
+	return count, nil
+}
+
+func (u *WebhookRepositoryImpl) DoesWebhookExist(webhookId int) bool {
+	var exists bool
+	err := u.db.QueryRow("SELECT EXISTS(SELECT 1 FROM webhooks WHERE webhook_id = $1)", webhookId).Scan(&exists)
+	if err != nil {
+		u.logger.Error("Failed to check if webhook exists: %v", err)
+		return false
+	}
+	return exists
+}
+
+func (u *WebhookRepositoryImpl) IsWebhookOwner(user string, webhookId int) bool {
+	userId, err := u.db.GetUserId(user)
+	if err != nil {
+		u.logger.Info("Failed to get user ID: %v", err)
+		return false
+	}
+
+	var ownerId int
+	err = u.db.QueryRow("SELECT user_id FROM webhooks WHERE webhook_id = $1", webhookId).Scan(&ownerId)
+	if err != nil {
+		u.logger.Error("Failed to get webhook owner ID: %v", err)
+		return false
+	}
+	return userId == ownerId
+}
+
+func (u *WebhookRepositoryImpl) DeleteWebhook(webhookId int) error {
+	_, err := u.db.Exec("DELETE FROM webhooks WHERE webhook_id = $1", webhookId)
+	if err != nil {
+		u.logger.Error("Failed to delete webhook: %v", err)
+		return fmt.Errorf("failed to delete webhook")
+	}
+	return nil
+}
+
+func (u *WebhookRepositoryImpl) EnqueueDeliveries(maintainer, event string, payload []byte, now time.Time) (int, error) {
+	var count int
+	err := u.db.RunInTransaction(func(tx *sql.Tx) error {
+		webhookIds, err := getReceivingWebhookIds(tx, maintainer)
+		if err != nil {
+			return err
+		}
+		for _, webhookId := range webhookIds {
+			_, err = tx.Exec(`
+				INSERT INTO webhook_deliveries (webhook_id, event, payload, status, next_attempt, creation_timestamp)
+				VALUES ($1, $2, $3, $4, $5, $6)`, webhookId, event, string(payload), tools.WebhookStatusPending, now, now)
+			if err != nil {
+				return fmt.Errorf("failed to queue delivery: %w", err)
+			}
+		}
+		count = len(webhookIds)
+		return nil
+	})
+	return count, err
+}
+
+func getReceivingWebhookIds(tx *sql.Tx, maintainer string) ([]int, error) {
+	rows, err := tx.Query(`
+		SELECT webhooks.webhook_id
+		FROM webhooks
+		JOIN users ON webhooks.user_id = users.user_id
+		WHERE webhooks.all_apps OR users.user_name = $1`, maintainer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhooks: %w", err)
+	}
+	defer utils.Close(rows)
+
+	var webhookIds []int
+	for rows.Next() {
+		var webhookId int
+		if err = rows.Scan(&webhookId); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook ID: %w", err)
+		}
+		webhookIds = append(webhookIds, webhookId)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return webhookIds, nil
+}
+
+func (u *WebhookRepositoryImpl) GetDueDeliveries(now time.Time, limit int) ([]PendingDelivery, error) {
+	rows, err := u.db.Query(`
+		SELECT webhook_deliveries.delivery_id, webhooks.webhook_id, webhooks.url, webhooks.secret, webhook_deliveries.event, webhook_deliveries.payload, webhook_deliveries.attempts
+		FROM webhook_deliveries
+		JOIN webhooks ON webhook_deliveries.webhook_id = webhooks.webhook_id
+		WHERE webhook_deliveries.status = $1 AND webhook_deliveries.next_attempt <= $2
+		ORDER BY webhook_deliveries.next_attempt, webhook_deliveries.delivery_id
+		LIMIT $3`, tools.WebhookStatusPending, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get due deliveries: %w", err)
+	}
+	defer utils.Close(rows)
+
+	var deliveries []PendingDelivery
+	for rows.Next() {
+		var delivery PendingDelivery
+		var payload string
+		if err = rows.Scan(&delivery.Id, &delivery.WebhookId, &delivery.Url, &delivery.Secret, &delivery.Event, &payload, &delivery.Attempts); err != nil {
+			return nil, fmt.Errorf("failed to scan delivery: %w", err)
+		}
+		delivery.Payload = []byte(payload)
+		deliveries = append(deliveries, delivery)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return deliveries, nil
+}
+
+func (u *WebhookRepositoryImpl) RecordAttempt(deliveryId int, attempt Attempt) error {
+	nextAttempt := attempt.NextAttempt
+	if attempt.Status != tools.WebhookStatusPending {
+		nextAttempt = attempt.Time
+	}
+	_, err := u.db.Exec(`
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = attempts + 1, next_attempt = $2, last_attempt = $3, last_status_code = $4, last_error = $5
+		WHERE delivery_id = $6`, attempt.Status, nextAttempt, attempt.Time, attempt.StatusCode, attempt.Error, deliveryId)
+	if err != nil {
+		return fmt.Errorf("failed to record delivery attempt: %w", err)
+	}
+	return nil
+}
+
+func (u *WebhookRepositoryImpl) GetDeliveries(webhookId int, limit int) ([]tools.WebhookDelivery, error) {
+	rows, err := u.db.Query(`
+		SELECT delivery_id, event, status, attempts, last_status_code, last_error, next_attempt, last_attempt, creation_timestamp
+		FROM webhook_deliveries
+		WHERE webhook_id = $1
+		ORDER BY delivery_id DESC
+		LIMIT $2`, webhookId, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deliveries: %w", err)
+	}
+	defer utils.Close(rows)
+
+	deliveries := []tools.WebhookDelivery{}
+	for rows.Next() {
+		var delivery tools.WebhookDelivery
+		var deliveryId int
+		var nextAttempt time.Time
+		var lastAttempt sql.NullTime
+		err = rows.Scan(&deliveryId, &delivery.Event, &delivery.Status, &delivery.Attempts, &delivery.LastStatusCode, &delivery.LastError,
+			&nextAttempt, &lastAttempt, &delivery.CreationTimestamp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan delivery: %w", err)
+		}
+		delivery.Id = strconv.Itoa(deliveryId)
+		if delivery.Status == tools.WebhookStatusPending {
+			delivery.NextAttempt = &nextAttempt
+		}
+		if lastAttempt.Valid {
+			delivery.LastAttempt = &lastAttempt.Time
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return deliveries, nil
+}
+
+func (u *WebhookRepositoryImpl) DeleteFinishedDeliveriesBefore(before time.Time) (int, error) {
+	result, err := u.db.Exec("DELETE FROM webhook_deliveries WHERE status != $1 AND creation_timestamp < $2", tools.WebhookStatusPending, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete old deliveries: %w", err)
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count deleted deliveries: %w", err)
+	}
+	return int(count), nil
+}
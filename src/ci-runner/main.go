@@ -45,7 +45,8 @@ func main() {
 	}
 	defer tr.Cleanup()
 
-	tr.DefaultEnvs = []string{"USE_MOCK_EMAIL_CLIENT=true", "LOG_LEVEL=DEBUG"}
+	// the TEST profile always uses the mock email client, but "run" and the acceptance tests start the store in the PROD profile
+	tr.DefaultEnvs = []string{"STORE_EMAIL_USE_MOCK_CLIENT=true", "STORE_SERVER_LOG_LEVEL=DEBUG"}
 
 	rootCmd := &cobra.Command{
 		Use:   "ci-runner",
@@ -66,7 +67,6 @@ var runCmd = &cobra.Command{
 	Short: "Run the application locally",
 	Run: func(cmd *cobra.Command, args []string) {
 		build()
-		tr.ExecuteInDir(backendDir, "bash -c './store || true'")
 		tr.ExecuteInDir(backendDir, "./store")
 	},
 }
@@ -105,14 +105,14 @@ var deployCmd = &cobra.Command{
 		var remoteHomeDir = "/home/user"
 		executeOnServer("systemctl stop store")
 		executeOnServer("mkdir -p %s/store", remoteHomeDir)
-		rsyncCmd := fmt.Sprintf("rsync -avz --delete assets store dist ocelot:%s/store/", remoteHomeDir)
+		rsyncCmd := fmt.Sprintf("rsync -avz --delete assets store ocelot:%s/store/", remoteHomeDir)
 		tr.ExecuteInDir(backendDir, rsyncCmd)
 		executeOnServer("chown -R user:user %s/store", remoteHomeDir)
 
 		executeOnServer("chmod -R 700 %s/store", remoteHomeDir)
 
 		executeOnServer("systemctl start store")
-		executeOnServer("nmap -p 8082 localhost")
+		executeOnServer("curl --fail --silent --retry 30 --retry-delay 1 --retry-all-errors localhost:8082/readyz")
 	},
 }
 
@@ -15,8 +15,10 @@ func TestUnits() {
 	defer tr.Cleanup()
 	startCockroachDb()
 
+	tr.ExecuteInDir(backendDir, "go test -count=1 ./...")
 	tr.ExecuteInDir(backendToolsDir, "go test -count=1 .")
 	tr.ExecuteInDir(backendCheckDir, "go test -count=1 -tags=unit .")
+	tr.ExecuteInDir(backendCheckDir, "go test -count=1 -tags=unit .", "STORE_DATABASE_DRIVER=sqlite")
 }
 
 var isPostgresDbStarted = false
@@ -35,11 +37,11 @@ func TestBackend() {
 	defer tr.Cleanup()
 	tr.ExecuteInDir(backendDir, "go build .")
 	startCockroachDb()
-	tr.ExecuteInDir(backendDir, "rm -f data/.env")
-	tr.ExecuteInDir(backendDir, "bash -c './store || true'") // creates default data/.env file and exit
-	tr.StartDaemon(backendDir, "./store", "PROFILE=TEST")
+	// the webhook receivers of the component tests listen on localhost
+	tr.StartDaemon(backendDir, "./store", "STORE_SERVER_PROFILE=TEST", "STORE_CORS_ALLOWED_ORIGINS=http://localhost:8081",
+		"STORE_WEBHOOKS_ALLOW_PRIVATE_ADDRESSES=true", "STORE_WEBHOOKS_INITIAL_BACKOFF=100ms", "STORE_WEBHOOKS_POLL_INTERVAL=100ms")
 	tr.WaitUntilPortIsReady("8082")
-	tr.ExecuteInDir(backendCheckDir, "go test -count=1 -tags=component ./...")
+	tr.ExecuteInDir(backendCheckDir, "go test -count=1 -tags=component ./...", "STORE_TEST_URL=http://localhost:8082")
 }
 
 func TestAcceptance() {
@@ -47,16 +49,27 @@ func TestAcceptance() {
 	defer tr.Cleanup()
 	build()
 	startCockroachDb()
-	tr.ExecuteInDir(backendDir, "bash -c './store || true'") // creates data/.env file and exit
-	tr.StartDaemon(backendDir, "./store")
+	// the tests log in and search far more often than a single user would
+	tr.StartDaemon(backendDir, "./store", "STORE_RATE_LIMIT_ENABLED=false")
 	tr.WaitUntilPortIsReady("8082")
 	tr.ExecuteInDir(backendCheckDir, "go test -count=1 -tags=acceptance ./...")
 	tr.ExecuteInDir(acceptanceTestsDir, "npx cypress run --spec cypress/e2e/hub.cy.ts --headless")
 }
 
+// precompressFrontend stores gzip and brotli variants next to the static assets so the
+// backend can serve them without compressing on every request. index.html is left out
+// because it is rendered per request.
+func precompressFrontend() {
+	findCmd := "find frontend/dist -type f \\( -name '*.js' -o -name '*.css' -o -name '*.svg' -o -name '*.json' \\)"
+	tr.ExecuteInDir(backendDir, findCmd+" -exec gzip -9 -k -f {} +")
+	tr.ExecuteInDir(backendDir, "if command -v brotli >/dev/null; then "+findCmd+" -exec brotli -k -f {} +; fi")
+}
+
 func build() {
 	tr.ExecuteInDir(backendDir, "rm -rf data dist")
+	tr.ExecuteInDir(backendDir, "find frontend/dist -mindepth 1 ! -name .gitkeep -delete")
 	tr.ExecuteInDir(frontendDir, "npm run build")
-	tr.ExecuteInDir(frontendDir, "cp -r ./dist "+backendDir)
-	tr.ExecuteInDir(backendDir, "go build")
+	tr.ExecuteInDir(frontendDir, "cp -r ./dist/. "+backendDir+"/frontend/dist")
+	precompressFrontend()
+	tr.ExecuteInDir(backendDir, "go build -ldflags \"-X ocelot/store/buildinfo.Version=$(git describe --tags --always --dirty)\"")
 }
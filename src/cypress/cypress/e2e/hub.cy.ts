@@ -1,4 +1,5 @@
 let authCookie = ""
+let csrfCookie = ""
 
 function getBaseUrl() {
     if (Cypress.env('CYPRESS_PROFILE') == "TEST") {
@@ -383,8 +384,12 @@ function login() {
         cy.getCookie("auth").should('exist').then((cookie) => {
             authCookie = cookie.value
         })
+        cy.getCookie("csrf").should('exist').then((cookie) => {
+            csrfCookie = cookie.value
+        })
     } else {
         cy.setCookie("auth", authCookie)
+        cy.setCookie("csrf", csrfCookie)
         cy.visit(appsPath)
     }
 }
@@ -2,7 +2,7 @@ import axios, {AxiosResponse} from "axios";
 
 export function alertError(error: any) {
     if (axios.isAxiosError(error) && error.response) {
-        const errorMessage = error.response.data || 'An unknown error occurred';
+        const errorMessage = error.response.data?.message || error.response.data || 'An unknown error occurred';
         alert(`An error occurred: ${errorMessage}`);
     } else {
         alert('An unknown error occurred');
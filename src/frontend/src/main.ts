@@ -9,9 +9,13 @@ import * as components from 'vuetify/components';
 import * as directives from 'vuetify/directives';
 import { mdi } from 'vuetify/iconsets/mdi';
 
+// The store adds a nonce to index.html, which the Content Security Policy requires for the styles injected by Vuetify.
+const cspNonce = document.querySelector<HTMLMetaElement>('meta[name="csp-nonce"]')?.content;
+
 const vuetify = createVuetify({
     theme: {
         defaultTheme: 'dark',
+        cspNonce,
     },
     icons: {
         defaultSet: 'mdi',